@@ -0,0 +1,232 @@
+package commands
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/f1-surya/git-go/commit"
+	"github.com/f1-surya/git-go/refs"
+	"github.com/f1-surya/git-go/revparse"
+)
+
+type Branch struct {
+	// The short name, like main.
+	Name string
+	Hash string
+	// Whether HEAD points to this branch.
+	Current bool
+}
+
+// Returns every branch sorted by name. The current branch has no entry before
+// its first commit.
+func (r *Repository) Branches() ([]Branch, error) {
+	current, err := refs.HeadBranch(r.GitDir)
+	if err != nil {
+		return nil, err
+	}
+	heads, err := refs.List(r.GitDir, refs.HeadsPrefix)
+	if err != nil {
+		return nil, err
+	}
+	var branches []Branch
+	for _, ref := range heads {
+		if ref.IsSymbolic() {
+			continue
+		}
+		branches = append(branches, Branch{
+			Name:    strings.TrimPrefix(ref.Name, refs.HeadsPrefix),
+			Hash:    ref.Hash,
+			Current: ref.Name == current,
+		})
+	}
+	return branches, nil
+}
+
+// Returns the name of the current branch, "" if HEAD is detached.
+func (r *Repository) CurrentBranch() (string, error) {
+	current, err := refs.HeadBranch(r.GitDir)
+	return strings.TrimPrefix(current, refs.HeadsPrefix), err
+}
+
+func checkBranchName(name string) error {
+	if name == "" || name == refs.Head || strings.HasPrefix(name, "-") || !refs.ValidName(refs.HeadsPrefix+name) {
+		return fmt.Errorf("'%s' is not a valid branch name", name)
+	}
+	return nil
+}
+
+// Returns a resolver for revisions like main~2 or v1.0^{tree}.
+func (r *Repository) Revisions() *revparse.Resolver {
+	return revparse.New(r.GitDir, r.Store)
+}
+
+// Returns the commit a revision points to, HEAD for "". Tags are followed to
+// the commit they point to.
+func (r *Repository) resolveCommit(rev string) (string, error) {
+	if rev == "" {
+		rev = refs.Head
+	}
+	hash, err := r.Revisions().ResolveCommit(rev)
+	if rev == refs.Head && errors.Is(err, revparse.ErrUnknown) {
+		return "", errors.New("there are no commits yet")
+	}
+	return hash, err
+}
+
+// Creates a branch pointing to start, a branch name or commit hash, or to
+// the current commit if start is "". An existing branch is only moved with force.
+func (r *Repository) CreateBranch(name, start string, force bool) error {
+	if err := checkBranchName(name); err != nil {
+		return err
+	}
+	hash, err := r.resolveCommit(start)
+	if err != nil {
+		return err
+	}
+	if start == "" {
+		start = refs.Head
+	}
+	oldHash := refs.ZeroHash
+	message := "branch: Created from " + start
+	if force {
+		current, err := r.CurrentBranch()
+		if err != nil {
+			return err
+		}
+		if current == name {
+			return fmt.Errorf("cannot force update the current branch")
+		}
+		oldHash = ""
+		if _, err := refs.Resolve(r.GitDir, refs.HeadsPrefix+name); err == nil {
+			message = "branch: Reset to " + start
+		}
+	}
+	reason, err := r.reason("%s", message)
+	if err != nil {
+		return err
+	}
+	err = refs.Update(r.GitDir, refs.HeadsPrefix+name, hash, oldHash, reason, r.LockOptions)
+	if errors.Is(err, refs.ErrRefChanged) {
+		return fmt.Errorf("a branch named '%s' already exists", name)
+	}
+	return err
+}
+
+// Deletes the branch and returns the commit it pointed to. Unless force is
+// set, the branch must be merged into HEAD so no commits are lost.
+func (r *Repository) DeleteBranch(name string, force bool) (string, error) {
+	current, err := r.CurrentBranch()
+	if err != nil {
+		return "", err
+	}
+	if name == current {
+		return "", fmt.Errorf("cannot delete branch '%s' checked out at '%s'", name, r.WorkTree)
+	}
+	hash, err := refs.Resolve(r.GitDir, refs.HeadsPrefix+name)
+	if errors.Is(err, refs.ErrNotFound) {
+		return "", fmt.Errorf("branch '%s' not found", name)
+	}
+	if err != nil {
+		return "", err
+	}
+	if !force {
+		merged, err := r.isMerged(hash)
+		if err != nil {
+			return "", err
+		}
+		if !merged {
+			return "", fmt.Errorf("the branch '%s' is not fully merged, use -D to delete it anyway", name)
+		}
+	}
+	return hash, refs.Delete(r.GitDir, refs.HeadsPrefix+name, hash, r.LockOptions)
+}
+
+// Reports whether the commit is reachable from HEAD.
+func (r *Repository) isMerged(hash string) (bool, error) {
+	head, err := refs.Resolve(r.GitDir, refs.Head)
+	if errors.Is(err, refs.ErrNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	merged := false
+	err = commit.Walk(r.Store, []string{head}, commit.WalkOptions{}, func(c *commit.Commit) error {
+		if c.Hash == hash {
+			merged = true
+			return commit.ErrStopWalk
+		}
+		return nil
+	})
+	return merged, err
+}
+
+// Renames the branch, the current branch if oldName is "". HEAD follows the
+// branch if it's checked out. An existing branch is only replaced with force.
+func (r *Repository) RenameBranch(oldName, newName string, force bool) error {
+	current, err := r.CurrentBranch()
+	if err != nil {
+		return err
+	}
+	if oldName == "" {
+		if current == "" {
+			return errors.New("HEAD is detached, there is no branch to rename")
+		}
+		oldName = current
+	}
+	if err := checkBranchName(newName); err != nil {
+		return err
+	}
+	if oldName == newName {
+		return nil
+	}
+
+	hash, err := refs.Resolve(r.GitDir, refs.HeadsPrefix+oldName)
+	// The current branch can be renamed before its first commit.
+	unborn := errors.Is(err, refs.ErrNotFound) && oldName == current
+	if err != nil && !unborn {
+		if errors.Is(err, refs.ErrNotFound) {
+			return fmt.Errorf("branch '%s' not found", oldName)
+		}
+		return err
+	}
+
+	oldRef, newRef := refs.HeadsPrefix+oldName, refs.HeadsPrefix+newName
+	reason, err := r.reason("Branch: renamed %s to %s", oldRef, newRef)
+	if err != nil {
+		return err
+	}
+	if !unborn {
+		oldHash := refs.ZeroHash
+		if force {
+			oldHash = ""
+		} else if _, err := refs.Resolve(r.GitDir, newRef); err == nil {
+			return fmt.Errorf("a branch named '%s' already exists", newName)
+		}
+		// The branch keeps its reflog, with the rename as the last entry.
+		if err := refs.RenameLog(r.GitDir, oldRef, newRef); err != nil {
+			return err
+		}
+		err = refs.Update(r.GitDir, newRef, hash, oldHash, reason, r.LockOptions)
+		if err != nil {
+			refs.RenameLog(r.GitDir, newRef, oldRef)
+			if errors.Is(err, refs.ErrRefChanged) {
+				return fmt.Errorf("a branch named '%s' already exists", newName)
+			}
+			return err
+		}
+		if err := refs.Delete(r.GitDir, oldRef, hash, r.LockOptions); err != nil {
+			return err
+		}
+	}
+	if oldName == current {
+		return refs.SetSymbolic(r.GitDir, refs.Head, newRef, reason, r.LockOptions)
+	}
+	return nil
+}
+
+// Returns the commit HEAD points to.
+func (r *Repository) Head() (string, error) {
+	return r.resolveCommit(refs.Head)
+}
@@ -0,0 +1,392 @@
+package commands
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/f1-surya/git-go/commit"
+	"github.com/f1-surya/git-go/index"
+	"github.com/f1-surya/git-go/lockfile"
+	"github.com/f1-surya/git-go/object"
+	"github.com/f1-surya/git-go/refs"
+	"github.com/f1-surya/git-go/tree"
+)
+
+type CheckoutOptions struct {
+	// Overwrite local changes and reset the index to the target.
+	Force bool
+	// Detach HEAD at the commit even if the target is a branch.
+	Detach bool
+	// Create a branch with this name at the target and switch to it.
+	NewBranch string
+}
+
+// Switches to the branch, or to a detached HEAD at a commit with
+// opts.Detach, updating the work tree and the index.
+func (r *Repository) Switch(target string, opts CheckoutOptions) error {
+	if opts.NewBranch == "" && !opts.Detach {
+		if _, err := refs.Resolve(r.GitDir, refs.HeadsPrefix+target); errors.Is(err, refs.ErrNotFound) {
+			return fmt.Errorf("invalid reference: %s, use --detach to switch to a commit", target)
+		}
+	}
+	return r.Checkout(target, opts)
+}
+
+// Checks out the target, a branch name or any other revision. HEAD points to
+// the branch afterwards, or is detached at the commit.
+func (r *Repository) Checkout(target string, opts CheckoutOptions) error {
+	branch := ""
+	if opts.NewBranch != "" {
+		if err := checkBranchName(opts.NewBranch); err != nil {
+			return err
+		}
+		if _, err := refs.Resolve(r.GitDir, refs.HeadsPrefix+opts.NewBranch); err == nil {
+			return fmt.Errorf("a branch named '%s' already exists", opts.NewBranch)
+		}
+		branch = opts.NewBranch
+	} else if !opts.Detach && target != refs.Head {
+		if _, err := refs.Resolve(r.GitDir, refs.HeadsPrefix+target); err == nil {
+			branch = target
+		}
+	}
+
+	rev := target
+	if branch != "" && opts.NewBranch == "" {
+		rev = refs.HeadsPrefix + branch
+	}
+	hash, err := r.resolveCommit(rev)
+	if err != nil {
+		return err
+	}
+	targetCommit, err := commit.ParseCommit(r.Store, hash)
+	if err != nil {
+		return err
+	}
+
+	current, err := r.CurrentBranch()
+	if err != nil {
+		return err
+	}
+	if branch != "" && branch == current && opts.NewBranch == "" && !opts.Force {
+		fmt.Fprintf(r.Out, "Already on '%s'\n", branch)
+		return nil
+	}
+
+	// Checking out HEAD only resets local changes. Otherwise the refs are
+	// locked before the work tree is touched, so it's only changed if HEAD
+	// can be moved too.
+	if target == refs.Head && opts.NewBranch == "" && !opts.Detach {
+		return r.checkoutTree(targetCommit.Tree, opts.Force)
+	}
+	var newBranch *refs.Locked
+	if opts.NewBranch != "" {
+		if newBranch, err = refs.Lock(r.GitDir, refs.HeadsPrefix+branch, refs.ZeroHash, r.LockOptions); err != nil {
+			return err
+		}
+		defer newBranch.Rollback()
+	}
+	head, err := refs.Lock(r.GitDir, refs.Head, "", r.LockOptions)
+	if err != nil {
+		return err
+	}
+	defer head.Rollback()
+	if err := r.checkoutTree(targetCommit.Tree, opts.Force); err != nil {
+		return err
+	}
+
+	from := current
+	if from == "" {
+		if from, err = refs.Resolve(r.GitDir, refs.Head); err != nil {
+			return err
+		}
+	}
+	to := target
+	if branch != "" {
+		to = branch
+	}
+	reason, err := r.reason("checkout: moving from %s to %s", from, to)
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case opts.NewBranch != "":
+		start := target
+		if start == "" {
+			start = refs.Head
+		}
+		created, err := r.reason("branch: Created from %s", start)
+		if err != nil {
+			return err
+		}
+		if err := newBranch.Set(hash, created); err != nil {
+			return err
+		}
+		if err := head.SetSymbolic(refs.HeadsPrefix+branch, reason); err != nil {
+			return err
+		}
+		fmt.Fprintf(r.Out, "Switched to a new branch '%s'\n", branch)
+	case branch != "":
+		if err := head.SetSymbolic(refs.HeadsPrefix+branch, reason); err != nil {
+			return err
+		}
+		fmt.Fprintf(r.Out, "Switched to branch '%s'\n", branch)
+	default:
+		if err := head.Set(hash, reason); err != nil {
+			return err
+		}
+		subject, _, _ := strings.Cut(targetCommit.Message, "\n")
+		fmt.Fprintf(r.Out, "HEAD is now at %s %s\n", hash[:7], subject)
+	}
+	return nil
+}
+
+// Returns the files of the tree of the given hash, keyed by path. "" is the
+// empty tree of a branch without commits.
+func (r *Repository) treeEntries(hash string) (map[string]tree.TreeEntry, error) {
+	if hash == "" {
+		return map[string]tree.TreeEntry{}, nil
+	}
+	trees, err := tree.GetTreesRecursive(r.Store, hash)
+	if err != nil {
+		return nil, err
+	}
+	return tree.GetAllEntries(trees), nil
+}
+
+// Updates the work tree and the index from the tree of HEAD to the target
+// tree. Only files that differ between the two trees are touched, so local
+// changes to other files are kept. Fails without changing anything if a local
+// change would be overwritten, unless force is set.
+func (r *Repository) checkoutTree(targetTree string, force bool) error {
+	lock, err := lockfile.Acquire(r.IndexPath(), r.LockOptions)
+	if err != nil {
+		return err
+	}
+	defer lock.Rollback()
+
+	indexEntries, err := index.ReadIndex(r.IndexPath())
+	if err != nil {
+		return err
+	}
+	entries := make(map[string]index.IndexEntry)
+	for _, entry := range indexEntries {
+		entries[entry.Path] = entry
+	}
+
+	headTree := ""
+	if latest, err := commit.GetLatest(r.Store, r.GitDir); err != nil {
+		return err
+	} else if latest != nil {
+		headTree = latest.Tree
+	}
+	changes, err := tree.Diff(r.Store, headTree, targetTree, tree.DiffOptions{})
+	if err != nil {
+		return err
+	}
+
+	// Paths whose content changes, with their entries in HEAD and the
+	// target. With force, everything that differs from the target in HEAD
+	// or the index is reset as well.
+	changed := make(map[string]bool)
+	headFiles := make(map[string]tree.TreeEntry)
+	targetFiles := make(map[string]tree.TreeEntry)
+	for _, change := range changes {
+		changed[change.Path()] = true
+		if change.Type != tree.Added {
+			headFiles[change.OldPath] = change.Old
+		}
+		if change.Type != tree.Deleted {
+			targetFiles[change.NewPath] = change.New
+		}
+	}
+	if force {
+		if targetFiles, err = r.treeEntries(targetTree); err != nil {
+			return err
+		}
+		for path, entry := range entries {
+			if target, ok := targetFiles[path]; !ok || !sameIndexEntry(entry, target) {
+				changed[path] = true
+			}
+		}
+	}
+	paths := make([]string, 0, len(changed))
+	for path := range changed {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	if !force {
+		indexInfo, err := os.Stat(r.IndexPath())
+		if err != nil {
+			return err
+		}
+		var overwritten, untracked []string
+		for _, path := range paths {
+			local, err := r.localChange(path, entries, headFiles, targetFiles, indexInfo)
+			if err != nil {
+				return err
+			}
+			switch local {
+			case localModified:
+				overwritten = append(overwritten, path)
+			case localUntracked:
+				untracked = append(untracked, path)
+			}
+		}
+		var problems []string
+		if len(overwritten) > 0 {
+			problems = append(problems, "your local changes to the following files would be overwritten by checkout:\n\t"+
+				strings.Join(overwritten, "\n\t")+"\nplease commit your changes before you switch branches, or use --force to discard them")
+		}
+		if len(untracked) > 0 {
+			problems = append(problems, "the following untracked working tree files would be overwritten by checkout:\n\t"+
+				strings.Join(untracked, "\n\t")+"\nplease move or remove them before you switch branches, or use --force to overwrite them")
+		}
+		if len(problems) > 0 {
+			return errors.New(strings.Join(problems, "\n"))
+		}
+	}
+
+	// Removals go first, so a file can replace a directory that became empty.
+	for _, path := range paths {
+		if _, ok := targetFiles[path]; ok {
+			continue
+		}
+		if err := os.Remove(filepath.Join(r.WorkTree, path)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		r.removeEmptyDirs(filepath.Dir(path))
+		delete(entries, path)
+	}
+	for _, path := range paths {
+		target, ok := targetFiles[path]
+		if !ok {
+			continue
+		}
+		entry, err := r.checkoutFile(path, target)
+		if err != nil {
+			return err
+		}
+		entries[path] = entry
+	}
+
+	newEntries := make([]index.IndexEntry, 0, len(entries))
+	for _, entry := range entries {
+		newEntries = append(newEntries, entry)
+	}
+	sort.Sort(index.ByPath(newEntries))
+	return index.WriteLocked(lock, newEntries)
+}
+
+type localState int
+
+const (
+	localClean localState = iota
+	localModified
+	localUntracked
+)
+
+// Reports whether checking out the target version of path would lose a
+// change that's only in the index or the work tree.
+func (r *Repository) localChange(path string, entries map[string]index.IndexEntry, headFiles, targetFiles map[string]tree.TreeEntry, indexInfo os.FileInfo) (localState, error) {
+	entry, inIndex := entries[path]
+	head, inHead := headFiles[path]
+	target, inTarget := targetFiles[path]
+
+	// A staged change is lost unless it already matches the target.
+	if inIndex != inHead || (inIndex && !sameIndexEntry(entry, head)) {
+		if inIndex != inTarget || (inIndex && !sameIndexEntry(entry, target)) {
+			return localModified, nil
+		}
+	}
+
+	info, err := os.Lstat(filepath.Join(r.WorkTree, path))
+	if os.IsNotExist(err) {
+		return localClean, nil
+	}
+	if err != nil {
+		return localClean, err
+	}
+	if info.IsDir() || !info.Mode().IsRegular() {
+		if inIndex {
+			return localModified, nil
+		}
+		return localUntracked, nil
+	}
+	if inIndex && entry.StatMatches(info) && !entry.IsRacy(indexInfo.ModTime()) {
+		return localClean, nil
+	}
+
+	sum, err := r.writeBlob(filepath.Join(r.WorkTree, path), info.Size(), false)
+	if err != nil {
+		return localClean, err
+	}
+	// The file already has the content it's going to get.
+	if inTarget && string(sum[:]) == string(target.Hash) {
+		return localClean, nil
+	}
+	if !inIndex {
+		return localUntracked, nil
+	}
+	if sum != entry.Hash {
+		return localModified, nil
+	}
+	return localClean, nil
+}
+
+// Writes the blob of the entry to path and returns the index entry for it.
+func (r *Repository) checkoutFile(path string, target tree.TreeEntry) (index.IndexEntry, error) {
+	entry := index.IndexEntry{Path: path}
+	copy(entry.Hash[:], target.Hash)
+
+	_, content, err := r.Store.Get(hex.EncodeToString(target.Hash))
+	if err != nil {
+		return entry, err
+	}
+	absPath := filepath.Join(r.WorkTree, path)
+	// A directory in the way is only removed once it's empty.
+	if info, err := os.Lstat(absPath); err == nil && info.IsDir() {
+		if err := os.Remove(absPath); err != nil {
+			return entry, fmt.Errorf("can't replace directory %s with a file: %w", path, err)
+		}
+	}
+	if err := os.MkdirAll(filepath.Dir(absPath), 0755); err != nil {
+		return entry, err
+	}
+	perm := os.FileMode(0644)
+	if target.Mode == object.ModeExecutable {
+		perm = 0755
+	}
+	// Removing the file first makes the new permissions apply.
+	if err := os.Remove(absPath); err != nil && !os.IsNotExist(err) {
+		return entry, err
+	}
+	if err := os.WriteFile(absPath, content, perm); err != nil {
+		return entry, err
+	}
+	info, err := os.Lstat(absPath)
+	if err != nil {
+		return entry, err
+	}
+	entry.SetStat(info)
+	return entry, nil
+}
+
+// Removes dir and its parents up to the work tree while they're empty.
+func (r *Repository) removeEmptyDirs(dir string) {
+	for ; dir != "." && dir != string(filepath.Separator); dir = filepath.Dir(dir) {
+		if os.Remove(filepath.Join(r.WorkTree, dir)) != nil {
+			return
+		}
+	}
+}
+
+func sameIndexEntry(entry index.IndexEntry, t tree.TreeEntry) bool {
+	return entry.Mode == t.Mode && string(entry.Hash[:]) == string(t.Hash)
+}
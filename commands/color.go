@@ -0,0 +1,64 @@
+package commands
+
+import (
+	"fmt"
+	"os"
+)
+
+const (
+	colorReset  = "\033[0m"
+	colorRed    = "\033[31m"
+	colorGreen  = "\033[32m"
+	colorYellow = "\033[33m"
+	colorBlue   = "\033[34m"
+	colorCyan   = "\033[36m"
+	colorBold   = "\033[1m"
+)
+
+// Reports whether the output of the command should be colored, from
+// color.<command> or else color.ui: always, never, auto or a boolean.
+// auto colors the output only when it's a terminal.
+func (r *Repository) useColor(command string) (bool, error) {
+	key := "color." + command
+	value, ok := r.Config.Get(key)
+	if !ok {
+		key = "color.ui"
+		value, ok = r.Config.Get(key)
+	}
+	if !ok {
+		value = "auto"
+	}
+	switch value {
+	case "always":
+		return true, nil
+	case "never":
+		return false, nil
+	case "auto":
+		return r.isTerminal(), nil
+	}
+	enabled, err := r.Config.Bool(key, false)
+	if err != nil {
+		return false, fmt.Errorf("bad %s, expected always, never, auto or a boolean: %w", key, err)
+	}
+	// Like git, true means auto.
+	return enabled && r.isTerminal(), nil
+}
+
+func (r *Repository) isTerminal() bool {
+	file, ok := r.Out.(*os.File)
+	if !ok {
+		return false
+	}
+	info, err := file.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// Returns a function that wraps text in the color when colors are enabled.
+func colorizer(enabled bool) func(color, text string) string {
+	return func(color, text string) string {
+		if !enabled {
+			return text
+		}
+		return color + text + colorReset
+	}
+}
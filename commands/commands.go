@@ -1,106 +1,146 @@
 package commands
 
 import (
-	"crypto/sha1"
-	"encoding/binary"
 	"encoding/hex"
 	"errors"
 	"fmt"
-	"io/fs"
+	"io"
 	"maps"
 	"os"
+	"os/user"
 	"path/filepath"
+	"slices"
 	"sort"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/f1-surya/git-go/commit"
+	"github.com/f1-surya/git-go/ignore"
 	"github.com/f1-surya/git-go/index"
+	"github.com/f1-surya/git-go/lockfile"
 	"github.com/f1-surya/git-go/object"
+	"github.com/f1-surya/git-go/pathspec"
+	"github.com/f1-surya/git-go/refs"
 	"github.com/f1-surya/git-go/tree"
 )
 
-func Init() {
-	dirs := []string{
-		filepath.Join(".git-go", "refs", "heads"),
-		filepath.Join(".git-go", "objects"),
-	}
+type AddOptions struct {
+	// Stage additions, modifications and deletions in the whole work tree
+	// when no paths are given.
+	All bool
+	// Only stage modifications and deletions of files that are already tracked.
+	Update bool
+	// Print what would be staged without changing the index.
+	DryRun bool
+	// Stage files even if they are ignored.
+	Force bool
+}
 
-	for _, dir := range dirs {
-		if err := os.MkdirAll(dir, 0755); err != nil {
-			failed := fmt.Errorf("failed to create %s: %v", dir, err)
-			fmt.Println(failed)
-			return
-		}
-	}
+// Adds the entered files to index and creates objects for them.
+func (r *Repository) Add(files []string) error {
+	return r.Stage(files, AddOptions{})
+}
 
-	indexFile, err := os.Create(filepath.Join(".git-go", "index"))
+// Stages the files matching the pathspecs: files and directories relative to
+// Cwd or glob patterns. Deleted files that match are removed from the index.
+func (r *Repository) Stage(paths []string, opts AddOptions) error {
+	if opts.All && opts.Update {
+		return errors.New("-A and -u are mutually incompatible")
+	}
+	if len(paths) == 0 && !opts.All && !opts.Update {
+		return errors.New("no files are provided to stage")
+	}
+	spec, err := r.Pathspec(paths)
 	if err != nil {
-		fmt.Printf("Error while creating the index file error: %v", err)
-		return
+		return err
 	}
-	defer indexFile.Close()
 
-	headFile, err := os.Create(filepath.Join(".git-go", "refs", "heads", "main"))
+	lock, err := lockfile.Acquire(r.IndexPath(), r.LockOptions)
 	if err != nil {
-		fmt.Printf("Error while creating the head file: %v", err)
-		return
+		return err
 	}
-	defer headFile.Close()
+	defer lock.Rollback()
 
-	header := []byte("DIRC")
-	if _, err := indexFile.Write(header); err != nil {
-		fmt.Printf("Error while writing index header, error: %v", err)
-		return
-	}
+	uniqueEntries := make(map[string]index.IndexEntry)
 
-	if err := binary.Write(indexFile, binary.BigEndian, uint32(0)); err != nil {
-		fmt.Printf("Error while writing index entry count, error: %v", err)
-		return
+	oldEntries, err := index.ReadIndex(r.IndexPath())
+	if err != nil {
+		return err
 	}
 
-	fmt.Println("Successfully created repo")
-}
-
-// Adds the entered files to index and creates objects for them.
-func Add(files []string) error {
-	if len(files) == 0 {
-		return errors.New("no files are provided to stage")
+	for _, oldEntry := range oldEntries {
+		uniqueEntries[oldEntry.Path] = oldEntry
+	}
+	var indexModTime time.Time
+	if info, err := os.Stat(r.IndexPath()); err == nil {
+		indexModTime = info.ModTime()
 	}
 
-	uniqueEntries := make(map[string]index.IndexEntry)
-
-	oldEntries, err := index.ReadIndex()
+	var ignored *ignore.Matcher
+	if !opts.Force {
+		if ignored, err = r.Ignore(); err != nil {
+			return err
+		}
+	}
+	files, err := r.workTreeFiles(spec, oldEntries, ignored)
 	if err != nil {
 		return err
 	}
 
-	for _, oldEntry := range oldEntries {
-		uniqueEntries[oldEntry.Path] = oldEntry
+	matched := make([]bool, len(spec))
+	markMatched := func(file string) {
+		for i, pattern := range spec {
+			matched[i] = matched[i] || pattern.Match(file)
+		}
 	}
 
-	for _, file := range files {
-		if _, err := os.Stat(file); os.IsNotExist(err) {
-			_, ok := uniqueEntries[file]
-			if ok {
-				delete(uniqueEntries, file)
-				continue
-			}
-			return fmt.Errorf("file does not exist %s", file)
+	for _, file := range slices.Sorted(maps.Keys(files)) {
+		info := files[file]
+		markMatched(file)
+		old, tracked := uniqueEntries[file]
+		if opts.Update && !tracked {
+			continue
+		}
+		// Files whose stat data didn't change since they were staged are skipped.
+		if tracked && old.StatMatches(info) && !old.IsRacy(indexModTime) {
+			continue
 		}
 
-		fileContent, err := os.ReadFile(file)
-		if err != nil {
+		entry := index.IndexEntry{Path: file}
+		entry.SetStat(info)
+		if entry.Hash, err = r.writeBlob(filepath.Join(r.WorkTree, file), info.Size(), !opts.DryRun); err != nil {
 			return err
 		}
+		if opts.DryRun && (!tracked || entry.Hash != old.Hash || entry.Mode != old.Mode) {
+			fmt.Fprintf(r.Out, "add '%s'\n", filepath.ToSlash(file))
+		}
+		uniqueEntries[file] = entry
+	}
 
-		uniqueEntries[file] = index.IndexEntry{
-			Mode:    0o100644,
-			Size:    uint32(len(fileContent)),
-			Hash:    sha1.Sum(fileContent),
-			Path:    filepath.Clean(file),
-			Content: fileContent,
+	for _, entry := range oldEntries {
+		if _, ok := files[entry.Path]; ok || !spec.Match(entry.Path) {
+			continue
 		}
+		markMatched(entry.Path)
+		if opts.DryRun {
+			fmt.Fprintf(r.Out, "remove '%s'\n", filepath.ToSlash(entry.Path))
+		}
+		delete(uniqueEntries, entry.Path)
+	}
+
+	for i, pattern := range spec {
+		if matched[i] {
+			continue
+		}
+		if info, err := os.Stat(filepath.Join(r.WorkTree, filepath.FromSlash(pattern.String()))); err == nil && ignored != nil &&
+			ignored.Ignored(pattern.String(), info.IsDir()) {
+			return fmt.Errorf("the path '%s' is ignored by one of your .gitignore files, use -f if you really want to add it", paths[i])
+		}
+		return fmt.Errorf("pathspec '%s' did not match any files", paths[i])
+	}
+	if opts.DryRun {
+		return nil
 	}
 
 	var entries []index.IndexEntry
@@ -109,252 +149,352 @@ func Add(files []string) error {
 	}
 
 	sort.Sort(index.ByPath(entries))
-	return index.WriteIndex(entries)
+	return index.WriteLocked(lock, entries)
+}
+
+// Compiles the paths given to a command, which are relative to Cwd.
+func (r *Repository) Pathspec(paths []string) (pathspec.Pathspec, error) {
+	prefix, err := r.RepoPath(".")
+	if err != nil {
+		return nil, err
+	}
+	spec := make(pathspec.Pathspec, 0, len(paths))
+	for _, path := range paths {
+		base := prefix
+		if filepath.IsAbs(path) {
+			if path, err = r.RepoPath(path); err != nil {
+				return nil, err
+			}
+			base = ""
+		}
+		pattern, err := pathspec.Compile(base, path)
+		if err != nil {
+			return nil, err
+		}
+		spec = append(spec, pattern)
+	}
+	return spec, nil
+}
+
+// Hashes the file as a blob and stores it unless write is false or the store
+// already has it. The file is streamed from disk, never read into memory as a whole.
+func (r *Repository) writeBlob(path string, size int64, write bool) ([20]byte, error) {
+	var sum [20]byte
+	file, err := os.Open(path)
+	if err != nil {
+		return sum, err
+	}
+	defer file.Close()
+
+	hash, err := object.HashReader(object.TypeBlob, size, file)
+	if err != nil {
+		return sum, err
+	}
+	if write && !r.Store.Has(hash) {
+		if _, err := file.Seek(0, io.SeekStart); err != nil {
+			return sum, err
+		}
+		if hash, err = object.PutReader(r.Store, object.TypeBlob, size, file); err != nil {
+			return sum, err
+		}
+	}
+	_, err = hex.Decode(sum[:], []byte(hash))
+	return sum, err
 }
 
-func Commit(args []string) error {
-	if len(args) < 2 {
+// Commits the index with the message given by one or more -m options, each
+// its own paragraph.
+func (r *Repository) Commit(args []string) error {
+	var paragraphs []string
+	for i := 0; i < len(args); i++ {
+		switch {
+		case args[i] == "-m" || args[i] == "--message":
+			if i+1 == len(args) {
+				return fmt.Errorf("%s needs a value", args[i])
+			}
+			i++
+			paragraphs = append(paragraphs, args[i])
+		case strings.HasPrefix(args[i], "--message="):
+			paragraphs = append(paragraphs, strings.TrimPrefix(args[i], "--message="))
+		default:
+			return fmt.Errorf("unknown commit argument %q", args[i])
+		}
+	}
+	if paragraphs == nil {
 		return errors.New("missing commit message")
 	}
+	message := commit.JoinMessage(paragraphs)
+	if message == "" {
+		return errors.New("aborting commit due to empty commit message")
+	}
 
-	newCommit, err := commit.CreateCommit(args)
+	newCommit, err := commit.CreateCommit(r.Store, r.GitDir, message)
 	if err != nil {
 		return err
 	}
+	if newCommit.Author, newCommit.Committer, err = r.signatures(); err != nil {
+		return err
+	}
 
-	err = commit.WriteCommit(newCommit)
+	err = commit.WriteCommit(r.Store, r.GitDir, newCommit, "commit", r.LockOptions)
 	if err != nil {
 		return err
 	}
 	return nil
 }
 
-func Log() error {
-	head := ""
-	var commits []*commit.Commit
-	if headBytes, err := os.ReadFile(filepath.Join(".git-go", "refs", "heads", "main")); err != nil {
-		return err
-	} else {
-		head = string(headBytes)
+// Returns the author and committer of a new commit.
+func (r *Repository) signatures() (commit.Signature, commit.Signature, error) {
+	name, email := defaultIdentity()
+	name = r.Config.GetString("user.name", name)
+	email = r.Config.GetString("user.email", email)
+	now := time.Now()
+	author, err := commit.SignatureFromEnv("AUTHOR", name, email, now)
+	if err != nil {
+		return author, author, err
 	}
+	committer, err := commit.SignatureFromEnv("COMMITTER", name, email, now)
+	return author, committer, err
+}
 
-	if head == "" {
-		fmt.Println("There are no commits yet")
-		return nil
+// Returns the reason recorded in reflogs for a ref update by the committer.
+func (r *Repository) reason(format string, args ...any) (*refs.Reason, error) {
+	_, committer, err := r.signatures()
+	if err != nil {
+		return nil, err
 	}
+	return &refs.Reason{Who: committer.Identity(), When: committer.When, Message: fmt.Sprintf(format, args...)}, nil
+}
 
-	for head != "" {
-		currCommit, err := commit.ParseCommit(head)
-		if err != nil {
-			return err
-		}
-		commits = append([]*commit.Commit{currCommit}, commits...)
-		head = currCommit.Parent
+// Returns the identity used when nothing else is set: the full name of the
+// user, or their user name, and user@host as email.
+func defaultIdentity() (string, string) {
+	var name, username string
+	if current, err := user.Current(); err == nil {
+		username = current.Username
+		// The GECOS field may list more than the name, separated by commas.
+		name, _, _ = strings.Cut(current.Name, ",")
 	}
-
-	for _, currCommit := range commits {
-		fmt.Printf("\033[33mcommit %s\n\033[0m", currCommit.Hash)
-		fmt.Printf("Author: %s\n", currCommit.Author)
-		fmt.Printf("Date: %s\n\n", currCommit.CreatedAt.Format("Mon Jan 2 15:04:05 2006 MST"))
-		fmt.Printf("   %s\n\n", currCommit.Message)
+	if name == "" {
+		name = username
 	}
-	return nil
+	host, err := os.Hostname()
+	if err != nil || host == "" {
+		host = "localhost"
+	}
+	return name, username + "@" + host
 }
 
-func Status() error {
-	allFiles := make(map[string]string)
-	var filesInCommit map[string]string
-	indexEntries, err := index.ReadIndex()
+func (r *Repository) Status() error {
+	indexEntries, err := index.ReadIndex(r.IndexPath())
 	if err != nil {
 		return err
 	}
 	entries := make(map[string]index.IndexEntry)
-
+	indexFiles := make(map[string]tree.TreeEntry)
 	for _, entry := range indexEntries {
 		entries[entry.Path] = entry
-		allFiles[entry.Path] = hex.EncodeToString(entry.Hash[:])
+		indexFiles[entry.Path] = indexTreeEntry(entry)
 	}
 
-	latestCommit, err := commit.GetLatest()
+	latestCommit, err := commit.GetLatest(r.Store, r.GitDir)
 	if err != nil {
 		return err
 	}
+	headTree := ""
 	if latestCommit != nil {
-		trees, err := tree.GetTreesRecursive(latestCommit.Tree)
-		if err != nil {
-			return fmt.Errorf("error while parsing root: %v", err)
-		}
-		filesInCommit = tree.GetAllFiles(trees)
-		maps.Copy(allFiles, filesInCommit)
+		headTree = latestCommit.Tree
+	}
+	filesInCommit, err := r.treeEntries(headTree)
+	if err != nil {
+		return fmt.Errorf("error while parsing root: %v", err)
 	}
 
-	walkedFiles := make(map[string]string)
+	indexInfo, err := os.Stat(r.IndexPath())
+	if err != nil {
+		return err
+	}
+
+	ignored, err := r.Ignore()
+	if err != nil {
+		return err
+	}
+	files, err := r.workTreeFiles(nil, indexEntries, ignored)
+	if err != nil {
+		return err
+	}
+
+	walkedFiles := make(map[string]tree.TreeEntry)
 
 	var wg sync.WaitGroup
 	var mu sync.Mutex
-	err = filepath.Walk(".", func(path string, info fs.FileInfo, err error) error {
-		if err != nil {
-			return err
+	for path, info := range files {
+		// Files whose stat data didn't change since they were staged don't need to be hashed.
+		if entry, ok := entries[path]; ok && entry.StatMatches(info) && !entry.IsRacy(indexInfo.ModTime()) {
+			mu.Lock()
+			walkedFiles[path] = indexFiles[path]
+			mu.Unlock()
+			continue
 		}
-		if !info.IsDir() {
-			if strings.Contains(path, ".git") {
-				return nil
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			fileContent, err := os.ReadFile(filepath.Join(r.WorkTree, path))
+			if err != nil {
+				fmt.Fprintf(r.Out, "reading %s errored, e: %v", path, err)
+				return
 			}
-			wg.Add(1)
-			go func() {
-				defer wg.Done()
-				fileContent, err := os.ReadFile(path)
-				if err != nil {
-					fmt.Printf("reading %s errored, e: %v", path, err)
-					return
-				}
-				fileHash := sha1.Sum(fileContent)
-				hashString := hex.EncodeToString(fileHash[:])
-				mu.Lock()
-				walkedFiles[path] = hashString
-				allFiles[path] = hashString
-				mu.Unlock()
-			}()
-		}
-		return nil
-	})
+			var entry index.IndexEntry
+			entry.Path = path
+			entry.SetStat(info)
+			hex.Decode(entry.Hash[:], []byte(object.Hash(object.TypeBlob, fileContent)))
+			mu.Lock()
+			walkedFiles[path] = indexTreeEntry(entry)
+			mu.Unlock()
+		}()
+	}
 	wg.Wait()
+
+	renames, err := r.renameOptions(DiffOptions{})
 	if err != nil {
 		return err
 	}
-
-	var staged []string
-	var notStaged []string
-
-	for file := range allFiles {
-		fsHash, inFs := walkedFiles[file]
-		commitHash, inCommit := filesInCommit[file]
-		indexEntry, inIndex := entries[file]
-		indexHash := hex.EncodeToString(indexEntry.Hash[:])
-
-		if fsHash == indexHash && indexHash == commitHash {
-			continue
-		}
-		if !inFs && inIndex && inCommit {
-			notStaged = append(notStaged, "deleted: "+file)
-		} else if !inFs && !inIndex && inCommit {
-			staged = append(staged, "deleted: "+file)
-		} else if fsHash == indexHash && !inCommit {
-			staged = append(staged, "created: "+file)
-		} else if fsHash == indexHash && indexHash != commitHash {
-			staged = append(staged, "modified: "+file)
-		} else if fsHash != indexHash && !inIndex {
-			notStaged = append(notStaged, "created: "+file)
-		} else if fsHash != indexHash && inIndex {
-			notStaged = append(notStaged, "modified: "+file)
-		}
+	stagedChanges, err := tree.DiffEntries(r.Store, filesInCommit, indexFiles, renames)
+	if err != nil {
+		return err
+	}
+	// Files only in the work tree aren't in the store, so renames aren't
+	// detected there.
+	workTreeChanges, err := tree.DiffEntries(nil, indexFiles, walkedFiles, tree.DiffOptions{})
+	if err != nil {
+		return err
 	}
+	staged := statusLines(stagedChanges)
+	notStaged := statusLines(workTreeChanges)
 
 	sort.Strings(staged)
 	sort.Strings(notStaged)
 
 	if len(staged) == 0 && len(notStaged) == 0 {
-		fmt.Println("No changes detected")
+		fmt.Fprintln(r.Out, "No changes detected")
 		return nil
 	}
 
+	enabled, err := r.useColor("status")
+	if err != nil {
+		return err
+	}
+	color := colorizer(enabled)
+
 	if len(staged) > 0 {
-		fmt.Println("Changes staged for commit:\033[32m")
-		fmt.Println("")
+		fmt.Fprintln(r.Out, "Changes staged for commit:")
+		fmt.Fprintln(r.Out, "")
 		for _, path := range staged {
-			fmt.Println("    " + path)
+			fmt.Fprintln(r.Out, "    "+color(colorGreen, path))
 		}
-		fmt.Println("\033[0m")
+		fmt.Fprintln(r.Out, "")
 	}
 
 	if len(notStaged) > 0 {
-		fmt.Println("Changes not staged for commit:\033[31m")
-		fmt.Println("")
+		fmt.Fprintln(r.Out, "Changes not staged for commit:")
+		fmt.Fprintln(r.Out, "")
 		for _, path := range notStaged {
-			fmt.Println("    " + path)
+			fmt.Fprintln(r.Out, "    "+color(colorRed, path))
 		}
-		fmt.Println("\033[0m")
+		fmt.Fprintln(r.Out, "")
 	}
 
 	return nil
 }
 
-func Revert() {
-	latestCommit, err := commit.GetLatest()
+// Returns the changes as they're listed by Status.
+func statusLines(changes []tree.Change) []string {
+	lines := make([]string, 0, len(changes))
+	for _, change := range changes {
+		switch change.Type {
+		case tree.Added:
+			lines = append(lines, "created: "+change.NewPath)
+		case tree.Deleted:
+			lines = append(lines, "deleted: "+change.OldPath)
+		case tree.Renamed, tree.Copied:
+			lines = append(lines, change.Type.String()+": "+change.OldPath+" -> "+change.NewPath)
+		default:
+			lines = append(lines, "modified: "+change.NewPath)
+		}
+	}
+	return lines
+}
+
+// Reverts the latest commit by restoring the files of its parent and recording a new commit.
+func (r *Repository) Revert() error {
+	latestCommit, err := commit.GetLatest(r.Store, r.GitDir)
 	if err != nil {
-		fmt.Printf("An error occured while reading the last commit: %v", err)
-		return
+		return fmt.Errorf("an error occured while reading the last commit: %w", err)
 	}
 	if latestCommit == nil {
-		fmt.Println("Nothing to revert")
-		return
+		fmt.Fprintln(r.Out, "Nothing to revert")
+		return nil
 	}
-	latestRoot, err := tree.GetTreesRecursive(latestCommit.Tree)
-	if err != nil {
-		fmt.Printf("An error occured while parsing the tree for %s. E: %v", latestCommit.Hash, err)
-		return
+	// Merges are reverted relative to their first parent.
+	var prevCommit *commit.Commit
+	prevTree := ""
+	if len(latestCommit.Parents) > 0 {
+		prevCommit, err = commit.ParseCommit(r.Store, latestCommit.Parents[0])
+		if err != nil {
+			return fmt.Errorf("an error occured while reading the previous commit: %w", err)
+		}
+		prevTree = prevCommit.Tree
 	}
-	lcFiles := tree.GetAllFiles(latestRoot)
-
-	prevCommit, err := commit.ParseCommit(latestCommit.Parent)
+	changes, err := tree.Diff(r.Store, latestCommit.Tree, prevTree, tree.DiffOptions{})
 	if err != nil {
-		fmt.Printf("An error occured while reading the previous commit: %v", err)
-		return
+		return fmt.Errorf("an error occured while comparing %s to its parent: %w", latestCommit.Hash, err)
 	}
 
-	if prevCommit == nil {
-		err = filepath.Walk(".", func(path string, info fs.FileInfo, err error) error {
-			_, inLatest := lcFiles[path]
-			if inLatest {
-				os.Remove(path)
-			}
-			return err
-		})
-		if err != nil {
-			fmt.Printf("Deleting files errored: %v", err)
-		}
-		return
+	lock, err := lockfile.Acquire(r.IndexPath(), r.LockOptions)
+	if err != nil {
+		return err
 	}
-	prevTrees, err := tree.GetTreesRecursive(prevCommit.Tree)
+	defer lock.Rollback()
+	indexEntries, err := index.ReadIndex(r.IndexPath())
 	if err != nil {
-		fmt.Printf("An error occured while parsing the tree for %s. E: %v", prevCommit.Hash, err)
-		return
+		return err
+	}
+	entries := make(map[string]index.IndexEntry)
+	for _, entry := range indexEntries {
+		entries[entry.Path] = entry
 	}
-	prevFiles := tree.GetAllFiles(prevTrees)
-
-	allFiles := make(map[string]string)
-	maps.Copy(allFiles, lcFiles)
-	maps.Copy(allFiles, prevFiles)
 
 	var wg sync.WaitGroup
+	var mu sync.Mutex
 	errs := make(chan error)
-	for path := range allFiles {
-		_, inLc := lcFiles[path]
-		prevHash, inPrev := prevFiles[path]
-		if inLc && !inPrev {
+	for _, change := range changes {
+		if change.Type == tree.Deleted {
 			wg.Add(1)
 			go func() {
-				delError := os.Remove(path)
-				if delError != nil {
+				defer wg.Done()
+				delError := os.Remove(filepath.Join(r.WorkTree, change.OldPath))
+				if delError != nil && !os.IsNotExist(delError) {
 					errs <- delError
-				}
-				wg.Done()
-			}()
-		} else if inPrev {
-			wg.Add(1)
-			go func() {
-				fileObject, err := object.ReadObject(prevHash)
-				if err != nil {
-					errs <- err
 					return
 				}
-				writeErr := os.WriteFile(path, fileObject, 0644)
-				if writeErr != nil {
-					errs <- writeErr
-				}
-				wg.Done()
+				mu.Lock()
+				delete(entries, change.OldPath)
+				mu.Unlock()
 			}()
+			continue
 		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			entry, err := r.checkoutFile(change.NewPath, change.New)
+			if err != nil {
+				errs <- err
+				return
+			}
+			mu.Lock()
+			entries[change.NewPath] = entry
+			mu.Unlock()
+		}()
 	}
 
 	go func() {
@@ -362,18 +502,38 @@ func Revert() {
 		close(errs)
 	}()
 
-	for err = range errs {
-		fmt.Println(err)
+	var restoreErr error
+	for err := range errs {
+		restoreErr = errors.Join(restoreErr, err)
+	}
+	if restoreErr != nil {
+		return restoreErr
+	}
+	newEntries := slices.Collect(maps.Values(entries))
+	sort.Sort(index.ByPath(newEntries))
+	if err := index.WriteLocked(lock, newEntries); err != nil {
+		return err
+	}
+	// The first commit is only undone in the work tree.
+	if prevCommit == nil {
+		return nil
 	}
 
 	newCommit := commit.Commit{
-		Tree:    prevCommit.Tree,
-		Message: "Revert \"" + latestCommit.Message + "\"",
-		Parent:  latestCommit.Hash,
+		Tree: prevCommit.Tree,
+		Message: commit.JoinMessage([]string{
+			"Revert \"" + commitSubject(latestCommit.Message) + "\"",
+			"This reverts commit " + latestCommit.Hash + ".",
+		}),
+		Parents: []string{latestCommit.Hash},
+	}
+	if newCommit.Author, newCommit.Committer, err = r.signatures(); err != nil {
+		return err
 	}
 
-	err = commit.WriteCommit(newCommit)
+	err = commit.WriteCommit(r.Store, r.GitDir, newCommit, "revert", r.LockOptions)
 	if err != nil {
-		fmt.Printf("An error occured while writing the new commit: %v", err)
+		return fmt.Errorf("an error occured while writing the new commit: %w", err)
 	}
+	return nil
 }
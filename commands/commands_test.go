@@ -1,18 +1,49 @@
 package commands_test
 
 import (
+	"bytes"
+	"compress/zlib"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
 	"io/fs"
 	"os"
 	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/f1-surya/git-go/commands"
 	"github.com/f1-surya/git-go/commit"
+	"github.com/f1-surya/git-go/config"
 	"github.com/f1-surya/git-go/index"
+	"github.com/f1-surya/git-go/lockfile"
+	"github.com/f1-surya/git-go/object"
+	"github.com/f1-surya/git-go/pack"
+	"github.com/f1-surya/git-go/refs"
+	"github.com/f1-surya/git-go/tree"
 )
 
+func initRepo(t *testing.T) *commands.Repository {
+	t.Helper()
+	repo, err := commands.Init(".", commands.InitOptions{})
+	if err != nil {
+		t.Fatalf("Init errored: %v", err)
+	}
+	return repo
+}
+
 func TestCommitWithoutMessage(t *testing.T) {
-	err := commands.Commit([]string{})
+	t.Cleanup(func() {
+		os.RemoveAll(".git-go")
+	})
+	repo := initRepo(t)
+	err := repo.Commit([]string{})
 	if err == nil {
 		t.Fatalf("No args are provided but the function didn't return any errors")
 	}
@@ -23,7 +54,7 @@ func TestCommit(t *testing.T) {
 		os.RemoveAll(".git-go")
 		os.RemoveAll("test")
 	})
-	commands.Init()
+	repo := initRepo(t)
 
 	err := os.Mkdir("test", 0755)
 	if err != nil {
@@ -36,12 +67,12 @@ func TestCommit(t *testing.T) {
 	}
 	defer file.Close()
 
-	err = commands.Add([]string{"commands.go", "test/test.txt"})
+	err = repo.Add([]string{"commands.go", "test/test.txt"})
 	if err != nil {
 		t.Fatalf("Add errored: %v", err)
 	}
 
-	err = commands.Commit([]string{"-m", "Init"})
+	err = repo.Commit([]string{"-m", "Init"})
 	if err != nil {
 		t.Fatalf("Commit errored: %v", err)
 	}
@@ -66,12 +97,12 @@ func TestLog(t *testing.T) {
 		os.RemoveAll("test")
 	})
 
-	commands.Init()
-	err := commands.Add([]string{"commands.go"})
+	repo := initRepo(t)
+	err := repo.Add([]string{"commands.go"})
 	if err != nil {
 		t.Fatalf("Add errored: %v", err)
 	}
-	err = commands.Commit([]string{"-m", "Init"})
+	err = repo.Commit([]string{"-m", "Init"})
 	if err != nil {
 		t.Fatalf("Commit errored: %v", err)
 	}
@@ -85,17 +116,17 @@ func TestLog(t *testing.T) {
 		t.Fatalf("File creation errored: %v", err)
 	}
 	defer file.Close()
-	err = commands.Add([]string{"test/test.txt"})
+	err = repo.Add([]string{"test/test.txt"})
 	if err != nil {
 		t.Fatalf("Add 2 errored: %v", err)
 	}
 
-	err = commands.Commit([]string{"-m", "Second"})
+	err = repo.Commit([]string{"-m", "Second"})
 	if err != nil {
 		t.Fatalf("Commit 2 errored: %v", err)
 	}
 
-	err = commands.Log()
+	err = repo.Log(commands.LogOptions{})
 	if err != nil {
 		t.Fatalf("Log errored: %v", err)
 	}
@@ -107,7 +138,7 @@ func TestDeletes(t *testing.T) {
 		os.RemoveAll("test")
 	})
 
-	commands.Init()
+	repo := initRepo(t)
 	err := os.Mkdir("test", 0755)
 	if err != nil {
 		t.Fatalf("Dir creation errored: %v", err)
@@ -117,7 +148,7 @@ func TestDeletes(t *testing.T) {
 		t.Fatalf("File creation errored: %v", err)
 	}
 	defer file.Close()
-	err = commands.Add([]string{"commands.go", "test/test.txt"})
+	err = repo.Add([]string{"commands.go", "test/test.txt"})
 	if err != nil {
 		t.Fatalf("Add 2 errored: %v", err)
 	}
@@ -127,12 +158,12 @@ func TestDeletes(t *testing.T) {
 		t.Fatalf("Deleting test errored: %v", err)
 	}
 
-	err = commands.Add([]string{"test/test.txt"})
+	err = repo.Add([]string{"test/test.txt"})
 	if err != nil {
 		t.Fatalf("Add 2 errored: %v", err)
 	}
 
-	entries, err := index.ReadIndex()
+	entries, err := index.ReadIndex(repo.IndexPath())
 	if err != nil {
 		t.Fatalf("Read index errored: %v", err)
 	}
@@ -148,7 +179,7 @@ func TestStatus(t *testing.T) {
 		os.RemoveAll("test")
 	})
 	os.Chdir("..")
-	commands.Init()
+	repo := initRepo(t)
 
 	err := os.Mkdir("test", 0755)
 	if err != nil {
@@ -161,12 +192,12 @@ func TestStatus(t *testing.T) {
 	}
 	defer file.Close()
 
-	err = commands.Add([]string{"commands/commands.go", "test/test.txt"})
+	err = repo.Add([]string{"commands/commands.go", "test/test.txt"})
 	if err != nil {
 		t.Fatalf("Add errored: %v", err)
 	}
 
-	err = commands.Status()
+	err = repo.Status()
 	if err != nil {
 		t.Fatalf("status errored: %v", err)
 	}
@@ -182,18 +213,18 @@ func TestRevert(t *testing.T) {
 	os.Mkdir("test", 0755)
 
 	// Init
-	commands.Init()
+	repo := initRepo(t)
 
 	// Create new files in test and commit them.
 	err := os.WriteFile("test/hi.txt", []byte("hi"), 0644)
 	if err != nil {
 		t.Fatalf("file creation errored: %v", err)
 	}
-	err = commands.Add([]string{"test/hi.txt"})
+	err = repo.Add([]string{"test/hi.txt"})
 	if err != nil {
 		t.Fatalf("add errored: %v", err)
 	}
-	err = commands.Commit([]string{"-m", "Init"})
+	err = repo.Commit([]string{"-m", "Init"})
 	if err != nil {
 		t.Fatalf("commit errored: %v", err)
 	}
@@ -207,17 +238,19 @@ func TestRevert(t *testing.T) {
 	if err != nil {
 		t.Fatalf("hi modification errored: %v", err)
 	}
-	err = commands.Add([]string{"test/hello.txt", "test/hi.txt"})
+	err = repo.Add([]string{"test/hello.txt", "test/hi.txt"})
 	if err != nil {
 		t.Fatalf("add hello errored: %v", err)
 	}
-	err = commands.Commit([]string{"-m", "hello"})
+	err = repo.Commit([]string{"-m", "hello"})
 	if err != nil {
 		t.Fatalf("commit hello errored: %v", err)
 	}
 
 	// Call revert and check if the file that was added later exists or not.
-	commands.Revert()
+	if err := repo.Revert(); err != nil {
+		t.Fatalf("Revert errored: %v", err)
+	}
 	// Read the content of the first file and make sure it matches the content before the second commit.
 	hiContent, err := os.ReadFile(filepath.Join("test", "hi.txt"))
 	if err != nil {
@@ -232,12 +265,1730 @@ func TestRevert(t *testing.T) {
 		t.Fatal("hello.txt exists")
 	}
 
-	lcCommit, err := commit.GetLatest()
+	lcCommit, err := commit.GetLatest(repo.Store, repo.GitDir)
 	if err != nil {
 		t.Fatalf("GetLatest errored: %v", err)
 	}
 
-	if lcCommit.Message != "Revert \"hello\"" {
+	if lcCommit.Message != "Revert \"hello\"\n\nThis reverts commit "+lcCommit.Parents[0]+".\n" {
 		t.Fatalf("wrong commit message: %s", lcCommit.Message)
 	}
 }
+
+func TestRevertModeAndIndex(t *testing.T) {
+	dir := t.TempDir()
+	repo, err := commands.Init(dir, commands.InitOptions{})
+	if err != nil {
+		t.Fatalf("Init errored: %v", err)
+	}
+	var out bytes.Buffer
+	repo.Out = &out
+	script := filepath.Join(dir, "run.sh")
+	os.WriteFile(script, []byte("echo v1\n"), 0644)
+	if err := repo.Add([]string{"run.sh"}); err != nil {
+		t.Fatalf("Add errored: %v", err)
+	}
+	if err := repo.Commit([]string{"-m", "first"}); err != nil {
+		t.Fatalf("Commit errored: %v", err)
+	}
+
+	os.WriteFile(script, []byte("echo v2\n"), 0644)
+	os.Chmod(script, 0755)
+	os.WriteFile(filepath.Join(dir, "new.txt"), []byte("new"), 0644)
+	if err := repo.Stage(nil, commands.AddOptions{All: true}); err != nil {
+		t.Fatalf("Stage errored: %v", err)
+	}
+	if err := repo.Commit([]string{"-m", "second"}); err != nil {
+		t.Fatalf("Commit errored: %v", err)
+	}
+
+	if err := repo.Revert(); err != nil {
+		t.Fatalf("Revert errored: %v", err)
+	}
+	info, err := os.Stat(script)
+	if err != nil || info.Mode().Perm() != 0644 {
+		t.Fatalf("run.sh after revert = %v, %v", info.Mode(), err)
+	}
+	if content, _ := os.ReadFile(script); string(content) != "echo v1\n" {
+		t.Fatalf("run.sh after revert = %q", content)
+	}
+	entries, err := index.ReadIndex(repo.IndexPath())
+	if err != nil || len(entries) != 1 || entries[0].Path != "run.sh" || entries[0].Mode != object.ModeRegular {
+		t.Fatalf("Index after revert = %+v, %v", entries, err)
+	}
+	out.Reset()
+	if err := repo.Status(); err != nil || !strings.Contains(out.String(), "No changes detected") {
+		t.Fatalf("Status after revert = %q, %v", out.String(), err)
+	}
+}
+
+func TestCommitMessages(t *testing.T) {
+	dir := t.TempDir()
+	repo, err := commands.Init(dir, commands.InitOptions{})
+	if err != nil {
+		t.Fatalf("Init errored: %v", err)
+	}
+	for _, role := range []string{"AUTHOR", "COMMITTER"} {
+		t.Setenv("GIT_GO_"+role+"_NAME", "Someone")
+		t.Setenv("GIT_GO_"+role+"_EMAIL", "someone@example.com")
+		t.Setenv("GIT_GO_"+role+"_DATE", "1700000000 +0000")
+	}
+	os.WriteFile(filepath.Join(dir, "file.txt"), []byte("hello\n"), 0644)
+	if err := repo.Add([]string{"file.txt"}); err != nil {
+		t.Fatalf("Add errored: %v", err)
+	}
+	for _, args := range [][]string{nil, {"msg"}, {"-m"}, {"-m", "\n"}} {
+		if err := repo.Commit(args); err == nil {
+			t.Errorf("Commit(%q) didn't error", args)
+		}
+	}
+
+	// The hash git commit-tree and git commit give the same commit.
+	const want = "aa98d9514e1459fec3acffd4cd09eff0dbb28849"
+	if err := repo.Commit([]string{"-m", "first", "-m", "second"}); err != nil {
+		t.Fatalf("Commit errored: %v", err)
+	}
+	if head, _ := repo.Head(); head != want {
+		t.Fatalf("Commit made %s, want %s", head, want)
+	}
+	plumbing, err := repo.CommitTree("HEAD^{tree}", nil, commit.JoinMessage([]string{"first", "second"}))
+	if err != nil || plumbing != want {
+		t.Fatalf("CommitTree = %s, %v, want %s", plumbing, err, want)
+	}
+}
+
+func TestRevertMissingParent(t *testing.T) {
+	dir := t.TempDir()
+	repo, err := commands.Init(dir, commands.InitOptions{})
+	if err != nil {
+		t.Fatalf("Init errored: %v", err)
+	}
+	for _, message := range []string{"first", "second"} {
+		os.WriteFile(filepath.Join(dir, "file.txt"), []byte(message), 0644)
+		if err := repo.Add([]string{"file.txt"}); err != nil {
+			t.Fatalf("Add errored: %v", err)
+		}
+		if err := repo.Commit([]string{"-m", message}); err != nil {
+			t.Fatalf("Commit errored: %v", err)
+		}
+	}
+	parent, err := repo.Revisions().Resolve("HEAD^")
+	if err != nil {
+		t.Fatalf("Resolve errored: %v", err)
+	}
+	os.Remove(filepath.Join(repo.GitDir, "objects", parent[:2], parent[2:]))
+
+	if err := repo.Revert(); !errors.Is(err, object.ErrNotFound) {
+		t.Fatalf("Revert with a missing parent = %v", err)
+	}
+}
+
+// Writes an object the way older versions of git-go did, objects/<last two chars>/<hash>.
+func writeLegacyObject(t *testing.T, data []byte) [20]byte {
+	t.Helper()
+	hash := sha1.Sum(data)
+	name := hex.EncodeToString(hash[:])
+	var buffer bytes.Buffer
+	w := zlib.NewWriter(&buffer)
+	w.Write(data)
+	w.Close()
+	dir := filepath.Join(".git-go", "objects", name[38:])
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatalf("Dir creation errored: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, name), buffer.Bytes(), 0644); err != nil {
+		t.Fatalf("Object creation errored: %v", err)
+	}
+	return hash
+}
+
+func TestMigrate(t *testing.T) {
+	t.Cleanup(func() {
+		os.RemoveAll(".git-go")
+	})
+	repo := initRepo(t)
+
+	blobHash := writeLegacyObject(t, []byte("hi"))
+	treeContent := append([]byte("100644 hi.txt\x00"), blobHash[:]...)
+	treeHash := writeLegacyObject(t, append(fmt.Appendf(nil, "tree %d\x00", len(treeContent)), treeContent...))
+	commitContent := fmt.Appendf(nil, "parent \ntree %x\nauthor someone 1700000000\nInit", treeHash)
+	commitHash := writeLegacyObject(t, append(fmt.Appendf(nil, "commit %d\n", len(commitContent)), commitContent...))
+	err := os.WriteFile(filepath.Join(".git-go", "refs", "heads", "main"), fmt.Appendf(nil, "%x", commitHash), 0644)
+	if err != nil {
+		t.Fatalf("Writing head errored: %v", err)
+	}
+
+	if err := repo.Migrate(); err != nil {
+		t.Fatalf("Migrate errored: %v", err)
+	}
+
+	latestCommit, err := commit.GetLatest(repo.Store, repo.GitDir)
+	if err != nil {
+		t.Fatalf("GetLatest errored: %v", err)
+	}
+	if latestCommit == nil || latestCommit.Message != "Init" {
+		t.Fatalf("Migrated commit is wrong: %+v", latestCommit)
+	}
+	trees, err := tree.GetTreesRecursive(repo.Store, latestCommit.Tree)
+	if err != nil {
+		t.Fatalf("Parsing migrated tree errored: %v", err)
+	}
+	if hash := tree.GetFileHash(trees, "hi.txt"); hash != object.Hash(object.TypeBlob, []byte("hi")) {
+		t.Fatalf("Migrated tree points at the wrong blob: %s", hash)
+	}
+
+	legacyPath := filepath.Join(".git-go", "objects", fmt.Sprintf("%x", blobHash)[38:], fmt.Sprintf("%x", blobHash))
+	if _, err := os.Stat(legacyPath); !os.IsNotExist(err) {
+		t.Fatalf("Legacy object wasn't removed")
+	}
+}
+
+func TestConcurrentRepositories(t *testing.T) {
+	var wg sync.WaitGroup
+	for i, store := range []object.ObjectStore{nil, object.NewMemoryStore()} {
+		dir := t.TempDir()
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			repo, err := commands.Init(dir, commands.InitOptions{Store: store})
+			if err != nil {
+				t.Errorf("Init errored: %v", err)
+				return
+			}
+			repo.Out = io.Discard
+			content := fmt.Sprintf("repo %d", i)
+			if err := os.WriteFile(filepath.Join(dir, "file.txt"), []byte(content), 0644); err != nil {
+				t.Errorf("File creation errored: %v", err)
+				return
+			}
+			if err := repo.Add([]string{"file.txt"}); err != nil {
+				t.Errorf("Add errored: %v", err)
+				return
+			}
+			if err := repo.Commit([]string{"-m", content}); err != nil {
+				t.Errorf("Commit errored: %v", err)
+				return
+			}
+
+			latestCommit, err := commit.GetLatest(repo.Store, repo.GitDir)
+			if err != nil || latestCommit == nil || latestCommit.Message != content+"\n" {
+				t.Errorf("Wrong latest commit %+v: %v", latestCommit, err)
+			}
+			if store != nil {
+				objects, _ := os.ReadDir(filepath.Join(repo.GitDir, "objects"))
+				if len(objects) != 0 {
+					t.Errorf("In-memory repository wrote %d object dirs to disk", len(objects))
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestDiscover(t *testing.T) {
+	dir := t.TempDir()
+	if _, err := commands.Init(dir, commands.InitOptions{}); err != nil {
+		t.Fatalf("Init errored: %v", err)
+	}
+	deep := filepath.Join(dir, "a", "b")
+	if err := os.MkdirAll(deep, 0755); err != nil {
+		t.Fatalf("Dir creation errored: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "a", "foo.go"), []byte("package a"), 0644); err != nil {
+		t.Fatalf("File creation errored: %v", err)
+	}
+
+	repo, err := commands.Discover(deep)
+	if err != nil {
+		t.Fatalf("Discover errored: %v", err)
+	}
+	if repo.GitDir != filepath.Join(dir, ".git-go") || repo.WorkTree != dir {
+		t.Fatalf("Discovered the wrong repo: %s %s", repo.GitDir, repo.WorkTree)
+	}
+
+	if err := repo.Add([]string{"../foo.go"}); err != nil {
+		t.Fatalf("Add from a subdirectory errored: %v", err)
+	}
+	entries, err := index.ReadIndex(repo.IndexPath())
+	if err != nil {
+		t.Fatalf("Read index errored: %v", err)
+	}
+	if len(entries) != 1 || entries[0].Path != filepath.Join("a", "foo.go") {
+		t.Fatalf("Path wasn't made relative to the repo: %+v", entries)
+	}
+
+	if _, err := repo.RepoPath("../../.."); err == nil {
+		t.Fatalf("Path outside of the repo was accepted")
+	}
+
+	t.Setenv("GIT_GO_DIR", filepath.Join(dir, ".git-go"))
+	t.Setenv("GIT_GO_WORK_TREE", dir)
+	repo, err = commands.Discover(t.TempDir())
+	if err != nil {
+		t.Fatalf("Discover with environment overrides errored: %v", err)
+	}
+	if repo.GitDir != filepath.Join(dir, ".git-go") || repo.WorkTree != dir {
+		t.Fatalf("Environment overrides were ignored: %s %s", repo.GitDir, repo.WorkTree)
+	}
+}
+
+func TestGC(t *testing.T) {
+	dir := t.TempDir()
+	repo, err := commands.Init(dir, commands.InitOptions{})
+	if err != nil {
+		t.Fatalf("Init errored: %v", err)
+	}
+	repo.Out = io.Discard
+
+	path := filepath.Join(dir, "file.txt")
+	for _, content := range []string{"never committed", "committed"} {
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("File creation errored: %v", err)
+		}
+		if err := repo.Add([]string{"file.txt"}); err != nil {
+			t.Fatalf("Add errored: %v", err)
+		}
+	}
+	if err := repo.Commit([]string{"-m", "Init"}); err != nil {
+		t.Fatalf("Commit errored: %v", err)
+	}
+	unreachable := object.Hash(object.TypeBlob, []byte("never committed"))
+	store := repo.Store.(*object.LooseStore)
+
+	// Only one gc runs at a time.
+	lockPath := filepath.Join(repo.GitDir, "gc.pid.lock")
+	os.WriteFile(lockPath, []byte("12345\n"), 0644)
+	if err := repo.GC(commands.GCOptions{}); !errors.Is(err, lockfile.ErrLocked) {
+		t.Fatalf("GC while another gc runs = %v", err)
+	}
+	if !store.HasLoose(unreachable) {
+		t.Fatalf("Locked out GC pruned objects")
+	}
+	os.Remove(lockPath)
+
+	// Within the grace period nothing unreachable is deleted.
+	var out bytes.Buffer
+	repo.Out = &out
+	if err := repo.GC(commands.GCOptions{PruneExpire: time.Hour}); err != nil {
+		t.Fatalf("GC errored: %v", err)
+	}
+	repo.Out = io.Discard
+	// The pack of a few small objects is bigger than they were.
+	if !strings.Contains(out.String(), "\nGrew by ") {
+		t.Fatalf("GC of a tiny repo reported %q", out.String())
+	}
+	if !store.HasLoose(unreachable) {
+		t.Fatalf("Recent unreachable object was pruned")
+	}
+
+	if err := repo.GC(commands.GCOptions{}); err != nil {
+		t.Fatalf("GC errored: %v", err)
+	}
+	if store.Has(unreachable) {
+		t.Fatalf("Unreachable object wasn't pruned")
+	}
+	loose := 0
+	store.IterateLoose(func(string) error {
+		loose++
+		return nil
+	})
+	if loose != 0 {
+		t.Fatalf("%d loose objects left after gc", loose)
+	}
+	packs, err := store.Packs()
+	if err != nil || len(packs) != 1 {
+		t.Fatalf("Expected a single pack, got %d: %v", len(packs), err)
+	}
+
+	latestCommit, err := commit.GetLatest(repo.Store, repo.GitDir)
+	if err != nil || latestCommit == nil || latestCommit.Message != "Init\n" {
+		t.Fatalf("Commit isn't readable after gc: %+v %v", latestCommit, err)
+	}
+	trees, err := tree.GetTreesRecursive(repo.Store, latestCommit.Tree)
+	if err != nil {
+		t.Fatalf("Tree isn't readable after gc: %v", err)
+	}
+	if tree.GetFileHash(trees, "file.txt") != object.Hash(object.TypeBlob, []byte("committed")) {
+		t.Fatalf("Wrong blob after gc")
+	}
+
+	// Unreachable objects of a recent pack are loosened with the age of the
+	// pack, so they expire when the pack would have.
+	packed := pack.Object{Type: object.TypeBlob, Content: []byte("packed an hour ago")}
+	packPath, err := pack.WriteFiles(filepath.Join(store.Dir, "pack"), []pack.Object{packed}, pack.DefaultWriteOptions)
+	if err != nil {
+		t.Fatalf("WriteFiles errored: %v", err)
+	}
+	hourAgo := time.Now().Add(-time.Hour)
+	os.Chtimes(packPath, hourAgo, hourAgo)
+	packedHash := object.Hash(packed.Type, packed.Content)
+	if err := repo.GC(commands.GCOptions{PruneExpire: 2 * time.Hour}); err != nil {
+		t.Fatalf("GC errored: %v", err)
+	}
+	if !store.HasLoose(packedHash) {
+		t.Fatalf("Object of a recent pack wasn't loosened")
+	}
+	if err := repo.GC(commands.GCOptions{PruneExpire: 30 * time.Minute}); err != nil {
+		t.Fatalf("GC errored: %v", err)
+	}
+	if store.Has(packedHash) {
+		t.Fatalf("Loosened object outlived the grace period of its pack")
+	}
+}
+
+func TestFsck(t *testing.T) {
+	dir := t.TempDir()
+	repo, err := commands.Init(dir, commands.InitOptions{})
+	if err != nil {
+		t.Fatalf("Init errored: %v", err)
+	}
+	for _, name := range []string{"a.txt", "b.txt"} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(name), 0644); err != nil {
+			t.Fatalf("File creation errored: %v", err)
+		}
+	}
+	if err := repo.Add([]string{"a.txt", "b.txt"}); err != nil {
+		t.Fatalf("Add errored: %v", err)
+	}
+	if err := repo.Commit([]string{"-m", "Init"}); err != nil {
+		t.Fatalf("Commit errored: %v", err)
+	}
+
+	report, err := repo.Fsck()
+	if err != nil {
+		t.Fatalf("Fsck errored: %v", err)
+	}
+	if !report.OK() {
+		t.Fatalf("Healthy repo has problems: %v", report.Problems)
+	}
+
+	dangling, _ := repo.Store.Put(object.TypeBlob, []byte("nobody points here"))
+	objectPath := func(hash string) string {
+		return filepath.Join(repo.GitDir, "objects", hash[:2], hash[2:])
+	}
+	missing := object.Hash(object.TypeBlob, []byte("a.txt"))
+	if err := os.Remove(objectPath(missing)); err != nil {
+		t.Fatalf("Removing object errored: %v", err)
+	}
+	// Store the content of one blob under the name of another.
+	mismatched := object.Hash(object.TypeBlob, []byte("b.txt"))
+	content, _ := os.ReadFile(objectPath(dangling))
+	if err := os.WriteFile(objectPath(mismatched), content, 0644); err != nil {
+		t.Fatalf("Corrupting object errored: %v", err)
+	}
+
+	report, err = repo.Fsck()
+	if err != nil {
+		t.Fatalf("Fsck errored: %v", err)
+	}
+	if report.OK() {
+		t.Fatalf("Broken repo reported as healthy")
+	}
+	found := make(map[string]string)
+	for _, problem := range report.Problems {
+		found[problem.Kind+" "+problem.Object] = problem.Message
+	}
+	for _, want := range []string{
+		commands.FsckMissing + " " + missing,
+		commands.FsckBadIndexEntry + " " + missing,
+		commands.FsckHashMismatch + " " + mismatched,
+		commands.FsckDangling + " " + dangling,
+	} {
+		if _, ok := found[want]; !ok {
+			t.Errorf("Missing problem %q in %v", want, report.Problems)
+		}
+	}
+}
+
+func TestFsckReflog(t *testing.T) {
+	dir := t.TempDir()
+	repo, err := commands.Init(dir, commands.InitOptions{})
+	if err != nil {
+		t.Fatalf("Init errored: %v", err)
+	}
+	for _, message := range []string{"first", "second"} {
+		os.WriteFile(filepath.Join(dir, "file.txt"), []byte(message), 0644)
+		if err := repo.Add([]string{"file.txt"}); err != nil {
+			t.Fatalf("Add errored: %v", err)
+		}
+		if err := repo.Commit([]string{"-m", message}); err != nil {
+			t.Fatalf("Commit errored: %v", err)
+		}
+	}
+	// Reset main to the first commit, the second is only in the reflogs.
+	if err := repo.UpdateRef(commands.UpdateRefOptions{Ref: "refs/heads/main", NewValue: "HEAD^", Message: "reset"}); err != nil {
+		t.Fatalf("UpdateRef errored: %v", err)
+	}
+	os.WriteFile(filepath.Join(dir, "file.txt"), []byte("first"), 0644)
+	if err := repo.Add([]string{"file.txt"}); err != nil {
+		t.Fatalf("Add errored: %v", err)
+	}
+
+	report, err := repo.Fsck()
+	if err != nil {
+		t.Fatalf("Fsck errored: %v", err)
+	}
+	for _, problem := range report.Problems {
+		if problem.Kind == commands.FsckDangling && problem.Type == object.TypeCommit {
+			t.Errorf("Commit in the reflog reported as dangling: %v", problem)
+		}
+	}
+}
+
+func TestParallelAdd(t *testing.T) {
+	dir := t.TempDir()
+	repo, err := commands.Init(dir, commands.InitOptions{})
+	if err != nil {
+		t.Fatalf("Init errored: %v", err)
+	}
+	repo.LockOptions.Timeout = 10 * time.Second
+
+	const files = 20
+	var wg sync.WaitGroup
+	for i := range files {
+		name := fmt.Sprintf("file%d.txt", i)
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(name), 0644); err != nil {
+			t.Fatalf("File creation errored: %v", err)
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := repo.Add([]string{name}); err != nil {
+				t.Errorf("Add errored: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	entries, err := index.ReadIndex(repo.IndexPath())
+	if err != nil {
+		t.Fatalf("ReadIndex errored: %v", err)
+	}
+	if len(entries) != files {
+		t.Fatalf("Index has %d entries after %d parallel adds", len(entries), files)
+	}
+
+	lock, err := os.Create(repo.IndexPath() + ".lock")
+	if err != nil {
+		t.Fatalf("Lock creation errored: %v", err)
+	}
+	lock.Close()
+	repo.LockOptions.Timeout = 0
+	if err := repo.Add([]string{"file0.txt"}); !errors.Is(err, lockfile.ErrLocked) {
+		t.Fatalf("Add with a held lock returned %v", err)
+	}
+}
+
+func TestRestageKeepsBlobs(t *testing.T) {
+	dir := t.TempDir()
+	repo, err := commands.Init(dir, commands.InitOptions{})
+	if err != nil {
+		t.Fatalf("Init errored: %v", err)
+	}
+	for _, name := range []string{"a.txt", "b.txt"} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(name+" content"), 0644); err != nil {
+			t.Fatalf("File creation errored: %v", err)
+		}
+	}
+	if err := repo.Add([]string{"a.txt", "b.txt"}); err != nil {
+		t.Fatalf("Add errored: %v", err)
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, "a.txt"), []byte("changed"), 0644); err != nil {
+		t.Fatalf("File update errored: %v", err)
+	}
+	if err := repo.Add([]string{"a.txt"}); err != nil {
+		t.Fatalf("Add errored: %v", err)
+	}
+
+	entries, err := index.ReadIndex(repo.IndexPath())
+	if err != nil {
+		t.Fatalf("ReadIndex errored: %v", err)
+	}
+	want := map[string]string{"a.txt": "changed", "b.txt": "b.txt content"}
+	for _, entry := range entries {
+		_, content, err := repo.Store.Get(hex.EncodeToString(entry.Hash[:]))
+		if err != nil || string(content) != want[entry.Path] {
+			t.Fatalf("Blob of %s is %q: %v", entry.Path, content, err)
+		}
+	}
+	if repo.Store.Has(object.Hash(object.TypeBlob, nil)) {
+		t.Fatalf("Re-staging wrote an empty blob")
+	}
+}
+
+func TestStagePathspecs(t *testing.T) {
+	dir := t.TempDir()
+	repo, err := commands.Init(dir, commands.InitOptions{})
+	if err != nil {
+		t.Fatalf("Init errored: %v", err)
+	}
+	var out bytes.Buffer
+	repo.Out = &out
+	for _, name := range []string{"main.go", "README.md", "src/a.go", "src/b.txt", "src/testdata/x", "lib/testdata/y", "lib/c.go"} {
+		path := filepath.Join(dir, name)
+		os.MkdirAll(filepath.Dir(path), 0755)
+		if err := os.WriteFile(path, []byte(name), 0644); err != nil {
+			t.Fatalf("File creation errored: %v", err)
+		}
+	}
+	staged := func() []string {
+		t.Helper()
+		entries, err := index.ReadIndex(repo.IndexPath())
+		if err != nil {
+			t.Fatalf("ReadIndex errored: %v", err)
+		}
+		var paths []string
+		for _, entry := range entries {
+			paths = append(paths, filepath.ToSlash(entry.Path))
+		}
+		return paths
+	}
+
+	if err := repo.Stage([]string{"src"}, commands.AddOptions{}); err != nil {
+		t.Fatalf("Adding a directory errored: %v", err)
+	}
+	if got := staged(); !reflect.DeepEqual(got, []string{"src/a.go", "src/b.txt", "src/testdata/x"}) {
+		t.Fatalf("Directory staged %q", got)
+	}
+
+	if err := repo.Stage([]string{"*.go", "**/testdata/*"}, commands.AddOptions{}); err != nil {
+		t.Fatalf("Adding globs errored: %v", err)
+	}
+	if got := staged(); !reflect.DeepEqual(got, []string{"lib/c.go", "lib/testdata/y", "main.go", "src/a.go", "src/b.txt", "src/testdata/x"}) {
+		t.Fatalf("Globs staged %q", got)
+	}
+
+	if err := repo.Stage([]string{"nothing*"}, commands.AddOptions{}); err == nil {
+		t.Fatalf("Pathspec matching nothing didn't error")
+	}
+
+	os.Remove(filepath.Join(dir, "src", "b.txt"))
+	os.WriteFile(filepath.Join(dir, "main.go"), []byte("changed"), 0644)
+	if err := repo.Stage(nil, commands.AddOptions{Update: true, DryRun: true}); err != nil {
+		t.Fatalf("Dry run errored: %v", err)
+	}
+	if out.String() != "add 'main.go'\nremove 'src/b.txt'\n" {
+		t.Fatalf("Wrong dry run output %q", out.String())
+	}
+	if got := staged(); len(got) != 6 {
+		t.Fatalf("Dry run changed the index: %q", got)
+	}
+
+	if err := repo.Stage(nil, commands.AddOptions{Update: true}); err != nil {
+		t.Fatalf("Update errored: %v", err)
+	}
+	if got := staged(); slices.Contains(got, "README.md") || slices.Contains(got, "src/b.txt") {
+		t.Fatalf("-u staged untracked or kept deleted files: %q", got)
+	}
+
+	repo.Cwd = filepath.Join(dir, "src")
+	if err := repo.Stage([]string{"."}, commands.AddOptions{}); err != nil {
+		t.Fatalf("Adding . errored: %v", err)
+	}
+	if got := staged(); slices.Contains(got, "README.md") {
+		t.Fatalf("add . in a subdirectory staged %q", got)
+	}
+	if err := repo.Stage(nil, commands.AddOptions{All: true}); err != nil {
+		t.Fatalf("Adding all errored: %v", err)
+	}
+	if got := staged(); !slices.Contains(got, "README.md") {
+		t.Fatalf("-A didn't stage the whole tree: %q", got)
+	}
+}
+
+func TestIgnore(t *testing.T) {
+	dir := t.TempDir()
+	repo, err := commands.Init(dir, commands.InitOptions{})
+	if err != nil {
+		t.Fatalf("Init errored: %v", err)
+	}
+	var out bytes.Buffer
+	repo.Out = &out
+	files := map[string]string{
+		".gitignore":           "node_modules/\n*.log\n",
+		"node_modules/x/a.js":  "a",
+		"debug.log":            "log",
+		"my.github.txt":        "not ignored",
+		"tracked/ignored.log":  "tracked anyway",
+		".git-go/info/exclude": "*.local\n",
+		"settings.local":       "local",
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		os.MkdirAll(filepath.Dir(path), 0755)
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("File creation errored: %v", err)
+		}
+	}
+
+	if err := repo.Stage([]string{"debug.log"}, commands.AddOptions{}); err == nil {
+		t.Fatalf("Adding an ignored file didn't error")
+	}
+	if err := repo.Stage([]string{"tracked/ignored.log"}, commands.AddOptions{Force: true}); err != nil {
+		t.Fatalf("Forced add errored: %v", err)
+	}
+	if err := repo.Stage(nil, commands.AddOptions{All: true}); err != nil {
+		t.Fatalf("Adding all errored: %v", err)
+	}
+	entries, err := index.ReadIndex(repo.IndexPath())
+	if err != nil {
+		t.Fatalf("ReadIndex errored: %v", err)
+	}
+	var staged []string
+	for _, entry := range entries {
+		staged = append(staged, filepath.ToSlash(entry.Path))
+	}
+	if !reflect.DeepEqual(staged, []string{".gitignore", "my.github.txt", "tracked/ignored.log"}) {
+		t.Fatalf("add -A staged %q", staged)
+	}
+
+	os.WriteFile(filepath.Join(dir, "tracked", "ignored.log"), []byte("changed"), 0644)
+	if err := repo.Status(); err != nil {
+		t.Fatalf("Status errored: %v", err)
+	}
+	status := out.String()
+	if !strings.Contains(status, "modified: tracked/ignored.log") || !strings.Contains(status, "created: my.github.txt") {
+		t.Fatalf("Status misses changes: %q", status)
+	}
+	for _, ignored := range []string{"node_modules", "debug.log", "settings.local"} {
+		if strings.Contains(status, ignored) {
+			t.Fatalf("Status lists ignored %s: %q", ignored, status)
+		}
+	}
+
+	matches, err := repo.CheckIgnore([]string{"node_modules/x/a.js", "my.github.txt", "tracked/ignored.log", "settings.local"}, false)
+	if err != nil {
+		t.Fatalf("CheckIgnore errored: %v", err)
+	}
+	if !matches[0].Ignored() || matches[0].Rule.Source != ".gitignore" || matches[0].Rule.Line != 1 {
+		t.Fatalf("Wrong match for node_modules: %+v", matches[0].Rule)
+	}
+	if matches[1].Ignored() || matches[2].Ignored() || !matches[3].Ignored() {
+		t.Fatalf("Wrong matches %+v", matches)
+	}
+
+	// core.excludesFile replaces the global excludes file, relative to the
+	// work tree.
+	os.WriteFile(filepath.Join(dir, "my-excludes"), []byte("*.secret\n"), 0644)
+	err = config.Edit(repo.ConfigPath(), func(f *config.File) error {
+		return f.Set("core.excludesFile", "my-excludes")
+	})
+	if err != nil {
+		t.Fatalf("Edit errored: %v", err)
+	}
+	if repo, err = commands.Open(dir); err != nil {
+		t.Fatalf("Open errored: %v", err)
+	}
+	matches, err = repo.CheckIgnore([]string{"key.secret"}, false)
+	if err != nil || !matches[0].Ignored() || matches[0].Rule.Source != filepath.Join(dir, "my-excludes") {
+		t.Fatalf("core.excludesFile wasn't used: %+v, %v", matches, err)
+	}
+}
+
+func TestConfig(t *testing.T) {
+	configDir := t.TempDir()
+	global := filepath.Join(configDir, "global")
+	t.Setenv("GIT_GO_CONFIG_SYSTEM", filepath.Join(configDir, "system"))
+	t.Setenv("GIT_GO_CONFIG_GLOBAL", global)
+	os.WriteFile(global, []byte("[init]\n\tdefaultBranch = trunk\n[user]\n\tname = Global User\n\temail = global@example.com\n[color]\n\tui = always\n"), 0644)
+
+	dir := t.TempDir()
+	repo, err := commands.Init(dir, commands.InitOptions{})
+	if err != nil {
+		t.Fatalf("Init errored: %v", err)
+	}
+	if head, _ := os.ReadFile(filepath.Join(repo.GitDir, "HEAD")); string(head) != "ref: refs/heads/trunk\n" {
+		t.Fatalf("HEAD is %q", head)
+	}
+	err = config.Edit(repo.ConfigPath(), func(f *config.File) error {
+		return f.Set("user.email", "local@example.com")
+	})
+	if err != nil {
+		t.Fatalf("Edit errored: %v", err)
+	}
+	// The config is read when the repository is opened.
+	if repo, err = commands.Open(dir); err != nil {
+		t.Fatalf("Open errored: %v", err)
+	}
+	var out bytes.Buffer
+	repo.Out = &out
+
+	os.WriteFile(filepath.Join(dir, "a.txt"), []byte("a"), 0644)
+	if err := repo.Add([]string{"a.txt"}); err != nil {
+		t.Fatalf("Add errored: %v", err)
+	}
+	if err := repo.Status(); err != nil {
+		t.Fatalf("Status errored: %v", err)
+	}
+	if !strings.Contains(out.String(), "\033[32mcreated: a.txt\033[0m") {
+		t.Fatalf("Status isn't colored: %q", out.String())
+	}
+
+	t.Setenv("GIT_GO_AUTHOR_NAME", "Env Author")
+	if err := repo.Commit([]string{"-m", "Init"}); err != nil {
+		t.Fatalf("Commit errored: %v", err)
+	}
+	latest, err := commit.GetLatest(repo.Store, repo.GitDir)
+	if err != nil || latest == nil {
+		t.Fatalf("GetLatest = %v, %v", latest, err)
+	}
+	if latest.Author.Name != "Env Author" || latest.Author.Email != "local@example.com" {
+		t.Fatalf("Wrong author %v", latest.Author)
+	}
+	if latest.Committer.Name != "Global User" || latest.Committer.Email != "local@example.com" {
+		t.Fatalf("Wrong committer %v", latest.Committer)
+	}
+	if _, err := os.Stat(filepath.Join(repo.GitDir, "refs", "heads", "trunk")); err != nil {
+		t.Fatalf("The commit wasn't recorded on trunk: %v", err)
+	}
+}
+
+func TestBranches(t *testing.T) {
+	dir := t.TempDir()
+	repo, err := commands.Init(dir, commands.InitOptions{})
+	if err != nil {
+		t.Fatalf("Init errored: %v", err)
+	}
+	commitFile := func(name string) string {
+		t.Helper()
+		os.WriteFile(filepath.Join(dir, name), []byte(name), 0644)
+		if err := repo.Add([]string{name}); err != nil {
+			t.Fatalf("Add errored: %v", err)
+		}
+		if err := repo.Commit([]string{"-m", name}); err != nil {
+			t.Fatalf("Commit errored: %v", err)
+		}
+		head, err := repo.Head()
+		if err != nil {
+			t.Fatalf("Head errored: %v", err)
+		}
+		return head
+	}
+	branchNames := func() string {
+		t.Helper()
+		branches, err := repo.Branches()
+		if err != nil {
+			t.Fatalf("Branches errored: %v", err)
+		}
+		var names []string
+		for _, b := range branches {
+			if b.Current {
+				names = append(names, "*"+b.Name)
+			} else {
+				names = append(names, b.Name)
+			}
+		}
+		return strings.Join(names, " ")
+	}
+
+	if err := repo.CreateBranch("early", "", false); err == nil {
+		t.Fatalf("Creating a branch without commits didn't error")
+	}
+	if err := repo.RenameBranch("", "trunk", false); err != nil {
+		t.Fatalf("Renaming the unborn branch errored: %v", err)
+	}
+	first := commitFile("a.txt")
+	if got := branchNames(); got != "*trunk" {
+		t.Fatalf("Branches = %q", got)
+	}
+
+	if err := repo.CreateBranch("feature", "", false); err != nil {
+		t.Fatalf("CreateBranch errored: %v", err)
+	}
+	if err := repo.CreateBranch("feature", "", false); err == nil {
+		t.Fatalf("Creating an existing branch didn't error")
+	}
+	if err := repo.CreateBranch("bad..name", "", false); err == nil {
+		t.Fatalf("Creating an invalid branch didn't error")
+	}
+	second := commitFile("b.txt")
+	if got := branchNames(); got != "feature *trunk" {
+		t.Fatalf("Branches = %q", got)
+	}
+	if err := repo.CreateBranch("old", first, false); err != nil {
+		t.Fatalf("CreateBranch at a commit errored: %v", err)
+	}
+
+	// Commits advance the branch HEAD points to, and only that one.
+	if hash, _ := os.ReadFile(filepath.Join(repo.GitDir, "refs", "heads", "trunk")); string(hash) != second {
+		t.Fatalf("trunk is at %s, want %s", hash, second)
+	}
+	if hash, _ := os.ReadFile(filepath.Join(repo.GitDir, "refs", "heads", "feature")); string(hash) != first {
+		t.Fatalf("feature moved to %s", hash)
+	}
+
+	if _, err := repo.DeleteBranch("trunk", true); err == nil {
+		t.Fatalf("Deleting the current branch didn't error")
+	}
+	if err := repo.RenameBranch("trunk", "main", false); err != nil {
+		t.Fatalf("RenameBranch errored: %v", err)
+	}
+	if current, _ := repo.CurrentBranch(); current != "main" {
+		t.Fatalf("HEAD didn't follow the rename, current is %q", current)
+	}
+	if err := repo.RenameBranch("feature", "main", false); err == nil {
+		t.Fatalf("Renaming onto an existing branch didn't error")
+	}
+	if was, err := repo.DeleteBranch("feature", false); err != nil || was != first {
+		t.Fatalf("DeleteBranch = %q, %v", was, err)
+	}
+
+	// A branch with commits HEAD doesn't have needs force.
+	if err := repo.CreateBranch("side", "", false); err != nil {
+		t.Fatalf("CreateBranch errored: %v", err)
+	}
+	os.WriteFile(filepath.Join(repo.GitDir, "HEAD"), []byte("ref: refs/heads/side\n"), 0644)
+	commitFile("c.txt")
+	os.WriteFile(filepath.Join(repo.GitDir, "HEAD"), []byte("ref: refs/heads/main\n"), 0644)
+	if _, err := repo.DeleteBranch("side", false); err == nil {
+		t.Fatalf("Deleting an unmerged branch didn't error")
+	}
+	if _, err := repo.DeleteBranch("side", true); err != nil {
+		t.Fatalf("Forced delete errored: %v", err)
+	}
+	if got := branchNames(); got != "*main old" {
+		t.Fatalf("Branches = %q", got)
+	}
+}
+
+func TestCheckout(t *testing.T) {
+	dir := t.TempDir()
+	repo, err := commands.Init(dir, commands.InitOptions{})
+	if err != nil {
+		t.Fatalf("Init errored: %v", err)
+	}
+	var out bytes.Buffer
+	repo.Out = &out
+	write := func(name, content string) {
+		t.Helper()
+		path := filepath.Join(dir, name)
+		os.MkdirAll(filepath.Dir(path), 0755)
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("File creation errored: %v", err)
+		}
+	}
+	read := func(name string) string {
+		content, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			return "<missing>"
+		}
+		return string(content)
+	}
+	commitAll := func(message string) string {
+		t.Helper()
+		if err := repo.Stage(nil, commands.AddOptions{All: true}); err != nil {
+			t.Fatalf("Stage errored: %v", err)
+		}
+		if err := repo.Commit([]string{"-m", message}); err != nil {
+			t.Fatalf("Commit errored: %v", err)
+		}
+		head, _ := repo.Head()
+		return head
+	}
+
+	write("shared.txt", "shared")
+	write("deep/dir/main.txt", "main")
+	first := commitAll("first")
+	if err := repo.Checkout("", commands.CheckoutOptions{NewBranch: "feature"}); err != nil {
+		t.Fatalf("Checkout -b errored: %v", err)
+	}
+	os.RemoveAll(filepath.Join(dir, "deep"))
+	write("feature.txt", "feature")
+	write("shared.txt", "changed on feature")
+	commitAll("feature")
+
+	if err := repo.Switch("main", commands.CheckoutOptions{}); err != nil {
+		t.Fatalf("Switch errored: %v", err)
+	}
+	if read("shared.txt") != "shared" || read("deep/dir/main.txt") != "main" || read("feature.txt") != "<missing>" {
+		t.Fatalf("Work tree not updated: %q %q %q", read("shared.txt"), read("deep/dir/main.txt"), read("feature.txt"))
+	}
+	if current, _ := repo.CurrentBranch(); current != "main" {
+		t.Fatalf("HEAD points to %q", current)
+	}
+	out.Reset()
+	if err := repo.Status(); err != nil || !strings.Contains(out.String(), "No changes detected") {
+		t.Fatalf("Status after switching = %q, %v", out.String(), err)
+	}
+
+	// Local changes to files that differ between the branches are kept safe.
+	write("shared.txt", "local change")
+	write("feature.txt", "untracked")
+	err = repo.Switch("feature", commands.CheckoutOptions{})
+	if err == nil || !strings.Contains(err.Error(), "shared.txt") || !strings.Contains(err.Error(), "feature.txt") {
+		t.Fatalf("Switching over local changes = %v", err)
+	}
+	if read("shared.txt") != "local change" || read("deep/dir/main.txt") != "main" {
+		t.Fatalf("Failed switch changed the work tree")
+	}
+	// Local changes to other files are carried over.
+	os.Remove(filepath.Join(dir, "feature.txt"))
+	write("shared.txt", "shared")
+	write("deep/dir/main.txt", "edited")
+	if err := repo.Switch("feature", commands.CheckoutOptions{}); err == nil {
+		t.Fatalf("Switching over a change to a removed file didn't error")
+	}
+	write("deep/dir/main.txt", "main")
+	write("untracked.txt", "kept")
+	if err := repo.Switch("feature", commands.CheckoutOptions{}); err != nil {
+		t.Fatalf("Switch errored: %v", err)
+	}
+	if read("untracked.txt") != "kept" || read("shared.txt") != "changed on feature" {
+		t.Fatalf("Work tree not updated")
+	}
+	if _, err := os.Stat(filepath.Join(dir, "deep")); !os.IsNotExist(err) {
+		t.Fatalf("Empty directories were left behind: %v", err)
+	}
+
+	write("shared.txt", "discarded")
+	if err := repo.Checkout(first, commands.CheckoutOptions{Force: true}); err != nil {
+		t.Fatalf("Forced checkout errored: %v", err)
+	}
+	if read("shared.txt") != "shared" {
+		t.Fatalf("Forced checkout kept %q", read("shared.txt"))
+	}
+	if current, _ := repo.CurrentBranch(); current != "" {
+		t.Fatalf("HEAD isn't detached, it points to %q", current)
+	}
+	if head, _ := repo.Head(); head != first {
+		t.Fatalf("HEAD is at %s, want %s", head, first)
+	}
+	if !strings.Contains(out.String(), "HEAD is now at "+first[:7]+" first") {
+		t.Fatalf("Output is %q", out.String())
+	}
+
+	// Commits on a detached HEAD move HEAD only.
+	write("detached.txt", "detached")
+	detached := commitAll("detached")
+	if hash, _ := os.ReadFile(filepath.Join(repo.GitDir, "HEAD")); string(hash) != detached {
+		t.Fatalf("HEAD is %q", hash)
+	}
+	if hash, _ := os.ReadFile(filepath.Join(repo.GitDir, "refs", "heads", "main")); string(hash) != first {
+		t.Fatalf("main moved to %s", hash)
+	}
+	if err := repo.Switch(detached, commands.CheckoutOptions{}); err == nil {
+		t.Fatalf("Switching to a commit without --detach didn't error")
+	}
+
+	// The work tree is only touched once the refs that move are locked.
+	for _, tc := range []struct {
+		lock string
+		opts commands.CheckoutOptions
+	}{
+		{"HEAD.lock", commands.CheckoutOptions{}},
+		{"refs/heads/new.lock", commands.CheckoutOptions{NewBranch: "new"}},
+	} {
+		lockPath := filepath.Join(repo.GitDir, filepath.FromSlash(tc.lock))
+		os.WriteFile(lockPath, nil, 0644)
+		if err := repo.Checkout("main", tc.opts); !errors.Is(err, lockfile.ErrLocked) {
+			t.Fatalf("Checkout with %s held = %v", tc.lock, err)
+		}
+		os.Remove(lockPath)
+		if read("detached.txt") != "detached" {
+			t.Fatalf("Checkout with %s held changed the work tree", tc.lock)
+		}
+		if head, _ := repo.Head(); head != detached {
+			t.Fatalf("Checkout with %s held moved HEAD to %s", tc.lock, head)
+		}
+		if _, err := refs.Read(repo.GitDir, "refs/heads/new"); !errors.Is(err, refs.ErrNotFound) {
+			t.Fatalf("Checkout with %s held created the branch: %v", tc.lock, err)
+		}
+	}
+	if err := repo.Checkout("main", commands.CheckoutOptions{}); err != nil || read("detached.txt") != "<missing>" {
+		t.Fatalf("Checkout after the locks are gone = %v", err)
+	}
+}
+
+func TestTags(t *testing.T) {
+	dir := t.TempDir()
+	repo, err := commands.Init(dir, commands.InitOptions{})
+	if err != nil {
+		t.Fatalf("Init errored: %v", err)
+	}
+	repo.Out = io.Discard
+	commitFile := func(name string) string {
+		t.Helper()
+		os.WriteFile(filepath.Join(dir, name), []byte(name), 0644)
+		if err := repo.Add([]string{name}); err != nil {
+			t.Fatalf("Add errored: %v", err)
+		}
+		if err := repo.Commit([]string{"-m", name}); err != nil {
+			t.Fatalf("Commit errored: %v", err)
+		}
+		head, _ := repo.Head()
+		return head
+	}
+	tagNames := func(patterns []string, sortKey string) string {
+		t.Helper()
+		tags, err := repo.Tags(patterns, sortKey)
+		if err != nil {
+			t.Fatalf("Tags errored: %v", err)
+		}
+		var names []string
+		for _, info := range tags {
+			names = append(names, info.Name)
+		}
+		return strings.Join(names, " ")
+	}
+
+	t.Setenv("GIT_GO_COMMITTER_DATE", "1700000000 +0000")
+	first := commitFile("a.txt")
+	t.Setenv("GIT_GO_COMMITTER_DATE", "1700000100 +0000")
+	second := commitFile("b.txt")
+
+	if err := repo.CreateTag("v1.10", "", commands.TagOptions{}); err != nil {
+		t.Fatalf("CreateTag errored: %v", err)
+	}
+	t.Setenv("GIT_GO_COMMITTER_DATE", "1600000000 +0000")
+	if err := repo.CreateTag("v1.9", first, commands.TagOptions{Message: "Old release"}); err != nil {
+		t.Fatalf("Annotated CreateTag errored: %v", err)
+	}
+	if err := repo.CreateTag("v1.9", "", commands.TagOptions{}); err == nil {
+		t.Fatalf("Creating an existing tag didn't error")
+	}
+	if err := repo.CreateTag("nightly", "v1.9", commands.TagOptions{Annotate: true}); err == nil {
+		t.Fatalf("Annotated tag without a message didn't error")
+	}
+	if err := repo.CreateTag("nightly", "v1.9", commands.TagOptions{}); err != nil {
+		t.Fatalf("Tagging a tag errored: %v", err)
+	}
+
+	if got := tagNames(nil, ""); got != "nightly v1.10 v1.9" {
+		t.Fatalf("Tags = %q", got)
+	}
+	if got := tagNames([]string{"v1.*"}, "version:refname"); got != "v1.9 v1.10" {
+		t.Fatalf("Tags by version = %q", got)
+	}
+	if got := tagNames([]string{"v*"}, "-creatordate"); got != "v1.10 v1.9" {
+		t.Fatalf("Tags by date = %q", got)
+	}
+
+	tags, _ := repo.Tags([]string{"v1.9", "nightly"}, "")
+	for _, info := range tags {
+		if info.Annotation == nil || info.Annotation.Message != "Old release\n" || info.Target != first {
+			t.Fatalf("Wrong tag %+v", info)
+		}
+		if info.Annotation.Tagger.When.Unix() != 1600000000 {
+			t.Fatalf("Tagger date is %v", info.Annotation.Tagger.When)
+		}
+	}
+
+	// Tags are accepted wherever a commit is.
+	if err := repo.CreateBranch("from-tag", "v1.9", false); err != nil {
+		t.Fatalf("CreateBranch at a tag errored: %v", err)
+	}
+	if err := repo.Checkout("nightly", commands.CheckoutOptions{}); err != nil {
+		t.Fatalf("Checkout of a tag errored: %v", err)
+	}
+	if head, _ := repo.Head(); head != first {
+		t.Fatalf("HEAD is at %s, want %s", head, first)
+	}
+
+	report, err := repo.Fsck()
+	if err != nil || !report.OK() {
+		t.Fatalf("Fsck = %v, %v", report, err)
+	}
+	if was, err := repo.DeleteTag("v1.10"); err != nil || was != second {
+		t.Fatalf("DeleteTag = %s, %v", was, err)
+	}
+	if _, err := repo.DeleteTag("v1.10"); err == nil {
+		t.Fatalf("Deleting a missing tag didn't error")
+	}
+}
+
+func TestReflog(t *testing.T) {
+	dir := t.TempDir()
+	repo, err := commands.Init(dir, commands.InitOptions{})
+	if err != nil {
+		t.Fatalf("Init errored: %v", err)
+	}
+	repo.Out = io.Discard
+	commitFile := func(name string, date int64) string {
+		t.Helper()
+		t.Setenv("GIT_GO_COMMITTER_DATE", fmt.Sprintf("%d +0000", date))
+		os.WriteFile(filepath.Join(dir, name), []byte(name), 0644)
+		if err := repo.Add([]string{name}); err != nil {
+			t.Fatalf("Add errored: %v", err)
+		}
+		if err := repo.Commit([]string{"-m", name}); err != nil {
+			t.Fatalf("Commit errored: %v", err)
+		}
+		head, _ := repo.Head()
+		return head
+	}
+	messages := func(name string) string {
+		t.Helper()
+		_, entries, err := repo.Reflog(name)
+		if err != nil {
+			t.Fatalf("Reflog errored: %v", err)
+		}
+		var messages []string
+		for _, entry := range entries {
+			messages = append(messages, entry.Message)
+		}
+		return strings.Join(messages, "; ")
+	}
+
+	first := commitFile("a.txt", 1700000000)
+	commitFile("b.txt", 1700000100)
+	if err := repo.Switch("", commands.CheckoutOptions{NewBranch: "feat"}); err != nil {
+		t.Fatalf("Switch errored: %v", err)
+	}
+	lost := commitFile("c.txt", 1700000200)
+	if err := repo.Switch("main", commands.CheckoutOptions{}); err != nil {
+		t.Fatalf("Switch errored: %v", err)
+	}
+	if err := repo.RenameBranch("feat", "topic", false); err != nil {
+		t.Fatalf("RenameBranch errored: %v", err)
+	}
+
+	want := "checkout: moving from feat to main; commit: c.txt; checkout: moving from main to feat; commit: b.txt; commit (initial): a.txt"
+	if got := messages(""); got != want {
+		t.Fatalf("HEAD reflog = %q", got)
+	}
+	want = "Branch: renamed refs/heads/feat to refs/heads/topic; commit: c.txt; branch: Created from HEAD"
+	if got := messages("topic"); got != want {
+		t.Fatalf("Branch reflog = %q", got)
+	}
+	if _, err := os.Stat(filepath.Join(repo.GitDir, "logs", "refs", "heads", "feat")); !os.IsNotExist(err) {
+		t.Fatalf("Reflog of the old branch name is left: %v", err)
+	}
+	if hash, err := repo.Revisions().Resolve("topic@{1}"); err != nil || hash != lost {
+		t.Fatalf("topic@{1} = %s, %v", hash, err)
+	}
+
+	// The commit is only in the reflog after the branch is reset, gc keeps it.
+	if err := repo.CreateBranch("topic", first, true); err != nil {
+		t.Fatalf("CreateBranch errored: %v", err)
+	}
+	// The entries are too old for the default expiry of gc.
+	err = config.Edit(repo.ConfigPath(), func(f *config.File) error {
+		return f.Set("gc.reflogExpire", "never")
+	})
+	if err != nil {
+		t.Fatalf("Edit errored: %v", err)
+	}
+	if repo, err = commands.Open(dir); err != nil {
+		t.Fatalf("Open errored: %v", err)
+	}
+	repo.Out = io.Discard
+	if !strings.HasPrefix(messages("topic"), "branch: Reset to "+first) {
+		t.Fatalf("Reset isn't logged: %q", messages("topic"))
+	}
+	if err := repo.GC(commands.GCOptions{}); err != nil {
+		t.Fatalf("GC errored: %v", err)
+	}
+	if !repo.Store.Has(lost) {
+		t.Fatalf("GC pruned a commit in the reflog")
+	}
+
+	removed, err := repo.ExpireReflogs(nil, time.Unix(1700000150, 0))
+	if err != nil || removed != 6 {
+		t.Fatalf("ExpireReflogs = %d, %v", removed, err)
+	}
+	if got := messages("main"); got != "" {
+		t.Fatalf("main reflog after expiry = %q", got)
+	}
+	if _, err := repo.ExpireReflogs(nil, time.Now().Add(time.Hour)); err != nil {
+		t.Fatalf("ExpireReflogs errored: %v", err)
+	}
+	if err := repo.GC(commands.GCOptions{}); err != nil {
+		t.Fatalf("GC errored: %v", err)
+	}
+	if repo.Store.Has(lost) {
+		t.Fatalf("GC kept a commit whose reflog entries expired")
+	}
+
+	if _, err := repo.DeleteBranch("topic", true); err != nil {
+		t.Fatalf("DeleteBranch errored: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(repo.GitDir, "logs", "refs", "heads", "topic")); !os.IsNotExist(err) {
+		t.Fatalf("Reflog of a deleted branch is left: %v", err)
+	}
+}
+
+func TestDiff(t *testing.T) {
+	dir := t.TempDir()
+	repo, err := commands.Init(dir, commands.InitOptions{})
+	if err != nil {
+		t.Fatalf("Init errored: %v", err)
+	}
+	var out bytes.Buffer
+	repo.Out = &out
+	write := func(name, content string) {
+		t.Helper()
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatalf("WriteFile errored: %v", err)
+		}
+	}
+	diff := func(opts commands.DiffOptions) string {
+		t.Helper()
+		out.Reset()
+		if err := repo.Diff(opts); err != nil {
+			t.Fatalf("Diff errored: %v", err)
+		}
+		return out.String()
+	}
+
+	write("a.txt", "1\n2\n3\n4\n5\n6\n7\n8\n")
+	write("gone.txt", "bye\n")
+	write("image.png", "PNG\x00\x01")
+	if err := repo.Add([]string{"a.txt", "gone.txt", "image.png"}); err != nil {
+		t.Fatalf("Add errored: %v", err)
+	}
+	if err := repo.Commit([]string{"-m", "First"}); err != nil {
+		t.Fatalf("Commit errored: %v", err)
+	}
+	first, _ := repo.Head()
+
+	if got := diff(commands.DiffOptions{Context: -1}); got != "" {
+		t.Fatalf("Diff of a clean work tree = %q", got)
+	}
+	write("a.txt", "1\n2\nthree\n4\n5\n6\n7\n8")
+	want := "diff --git a/a.txt b/a.txt\n" +
+		"index 535d2b0..1b5f87e 100644\n" +
+		"--- a/a.txt\n" +
+		"+++ b/a.txt\n" +
+		"@@ -1,8 +1,8 @@\n 1\n 2\n-3\n+three\n 4\n 5\n 6\n 7\n-8\n+8\n\\ No newline at end of file\n"
+	if got := diff(commands.DiffOptions{Context: -1}); got != want {
+		t.Fatalf("Work tree diff:\n%s\nwant:\n%s", got, want)
+	}
+	want = "diff --git a/a.txt b/a.txt\n" +
+		"index 535d2b0..1b5f87e 100644\n" +
+		"--- a/a.txt\n" +
+		"+++ b/a.txt\n" +
+		"@@ -3 +3 @@\n-3\n+three\n" +
+		"@@ -8 +8 @@\n-8\n+8\n\\ No newline at end of file\n"
+	if got := diff(commands.DiffOptions{Context: 0, Algorithm: "patience"}); got != want {
+		t.Fatalf("Diff without context:\n%s\nwant:\n%s", got, want)
+	}
+	if got := diff(commands.DiffOptions{Context: -1, Staged: true}); got != "" {
+		t.Fatalf("Staged diff before add = %q", got)
+	}
+
+	write("image.png", "PNG\x00\x02")
+	write("new.txt", "hello\n")
+	os.Remove(filepath.Join(dir, "gone.txt"))
+	if err := repo.Add([]string{"."}); err != nil {
+		t.Fatalf("Add errored: %v", err)
+	}
+	if got := diff(commands.DiffOptions{Context: -1}); got != "" {
+		t.Fatalf("Work tree diff after add = %q", got)
+	}
+	staged := diff(commands.DiffOptions{Context: -1, Staged: true})
+	for _, want := range []string{
+		"diff --git a/gone.txt b/gone.txt\ndeleted file mode 100644\nindex b023018..0000000\n--- a/gone.txt\n+++ /dev/null\n@@ -1 +0,0 @@\n-bye\n",
+		"diff --git a/image.png b/image.png\nindex ",
+		"Binary files a/image.png and b/image.png differ\n",
+		"diff --git a/new.txt b/new.txt\nnew file mode 100644\nindex 0000000..ce01362\n--- /dev/null\n+++ b/new.txt\n@@ -0,0 +1 @@\n+hello\n",
+	} {
+		if !strings.Contains(staged, want) {
+			t.Fatalf("Staged diff:\n%s\nis missing:\n%s", staged, want)
+		}
+	}
+	if err := repo.Commit([]string{"-m", "Second"}); err != nil {
+		t.Fatalf("Commit errored: %v", err)
+	}
+
+	// Commits compare the same way, with pathspecs limiting the files.
+	if got := diff(commands.DiffOptions{Context: -1, Revisions: []string{first, "HEAD"}}); got != staged {
+		t.Fatalf("Diff of two commits:\n%s\nwant:\n%s", got, staged)
+	}
+	if got := diff(commands.DiffOptions{Context: -1, Revisions: []string{"HEAD~1..HEAD"}, Paths: []string{"new.txt"}}); !strings.HasPrefix(got, "diff --git a/new.txt") || strings.Count(got, "diff --git") != 1 {
+		t.Fatalf("Diff of a range with a path = %q", got)
+	}
+	if got := diff(commands.DiffOptions{Context: -1, Revisions: []string{"HEAD", first}}); !strings.Contains(got, "diff --git a/gone.txt b/gone.txt\nnew file mode 100644\nindex 0000000..b023018") {
+		t.Fatalf("Reversed diff = %q", got)
+	}
+
+	// Staged renames are detected unless they're turned off.
+	os.Rename(filepath.Join(dir, "new.txt"), filepath.Join(dir, "hello.txt"))
+	if err := repo.Add([]string{"."}); err != nil {
+		t.Fatalf("Add errored: %v", err)
+	}
+	want = "diff --git a/new.txt b/hello.txt\nsimilarity index 100%\nrename from new.txt\nrename to hello.txt\n"
+	if got := diff(commands.DiffOptions{Context: -1, Staged: true}); got != want {
+		t.Fatalf("Diff of a rename:\n%s\nwant:\n%s", got, want)
+	}
+	if got := diff(commands.DiffOptions{Context: -1, Staged: true, Renames: "false"}); strings.Count(got, "diff --git") != 2 {
+		t.Fatalf("Diff without renames = %q", got)
+	}
+	out.Reset()
+	if err := repo.Status(); err != nil || !strings.Contains(out.String(), "renamed: new.txt -> hello.txt") {
+		t.Fatalf("Status = %q, %v", out.String(), err)
+	}
+	if err := repo.Diff(commands.DiffOptions{Context: -1, Algorithm: "fast"}); err == nil {
+		t.Fatalf("Diff with an unknown algorithm didn't error")
+	}
+}
+
+func TestDiffStagedRename(t *testing.T) {
+	dir := t.TempDir()
+	repo, err := commands.Init(dir, commands.InitOptions{})
+	if err != nil {
+		t.Fatalf("Init errored: %v", err)
+	}
+	var out bytes.Buffer
+	repo.Out = &out
+	content := "1\n2\n3\n4\n5\n6\n7\n8\n"
+	os.WriteFile(filepath.Join(dir, "old.txt"), []byte(content), 0644)
+	if err := repo.Add([]string{"old.txt"}); err != nil {
+		t.Fatalf("Add errored: %v", err)
+	}
+	if err := repo.Commit([]string{"-m", "First"}); err != nil {
+		t.Fatalf("Commit errored: %v", err)
+	}
+	os.Rename(filepath.Join(dir, "old.txt"), filepath.Join(dir, "new.txt"))
+	if err := repo.Stage(nil, commands.AddOptions{All: true}); err != nil {
+		t.Fatalf("Stage errored: %v", err)
+	}
+
+	if err := repo.Diff(commands.DiffOptions{Revisions: []string{"HEAD"}}); err != nil {
+		t.Fatalf("Diff errored: %v", err)
+	}
+	if got, want := out.String(), "diff --git a/old.txt b/new.txt\nsimilarity index 100%\nrename from old.txt\nrename to new.txt\n"; got != want {
+		t.Fatalf("Diff of a staged rename = %q, want %q", got, want)
+	}
+
+	// Edited after staging, only the work tree has the new content.
+	os.WriteFile(filepath.Join(dir, "new.txt"), []byte(content+"9\n"), 0644)
+	out.Reset()
+	if err := repo.Diff(commands.DiffOptions{Revisions: []string{"HEAD"}}); err != nil {
+		t.Fatalf("Diff errored: %v", err)
+	}
+	if got := out.String(); !strings.HasPrefix(got, "diff --git a/old.txt b/new.txt\nsimilarity index 88%\nrename from old.txt\nrename to new.txt\n") || !strings.HasSuffix(got, "\n+9\n") {
+		t.Fatalf("Diff of an edited rename = %q", got)
+	}
+}
+
+func TestLogOptions(t *testing.T) {
+	dir := t.TempDir()
+	repo, err := commands.Init(dir, commands.InitOptions{})
+	if err != nil {
+		t.Fatalf("Init errored: %v", err)
+	}
+	var out bytes.Buffer
+	repo.Out = &out
+	setDate := func(date int64) {
+		t.Setenv("GIT_GO_AUTHOR_DATE", fmt.Sprintf("%d +0000", date))
+		t.Setenv("GIT_GO_COMMITTER_DATE", fmt.Sprintf("%d +0000", date))
+	}
+	commitFile := func(name, content, message string, date int64) string {
+		t.Helper()
+		setDate(date)
+		os.WriteFile(filepath.Join(dir, name), []byte(content), 0644)
+		if err := repo.Add([]string{name}); err != nil {
+			t.Fatalf("Add errored: %v", err)
+		}
+		if err := repo.Commit([]string{"-m", message}); err != nil {
+			t.Fatalf("Commit errored: %v", err)
+		}
+		head, _ := repo.Head()
+		return head
+	}
+	log := func(opts commands.LogOptions) string {
+		t.Helper()
+		out.Reset()
+		if err := repo.Log(opts); err != nil {
+			t.Fatalf("Log errored: %v", err)
+		}
+		return out.String()
+	}
+	oneline := func(opts commands.LogOptions) string {
+		t.Helper()
+		opts.Format = "format:%s"
+		return strings.TrimSuffix(strings.ReplaceAll(log(opts), "\n", ", "), ", ")
+	}
+
+	first := commitFile("a.txt", "one\n", "Add a", 1700000000)
+	commitFile("b.txt", "b\n", "Add b", 1700000100)
+	if err := repo.CreateBranch("side", "", false); err != nil {
+		t.Fatalf("CreateBranch errored: %v", err)
+	}
+	if err := repo.Switch("side", commands.CheckoutOptions{}); err != nil {
+		t.Fatalf("Switch errored: %v", err)
+	}
+	t.Setenv("GIT_GO_AUTHOR_NAME", "Other")
+	t.Setenv("GIT_GO_AUTHOR_EMAIL", "other@example.com")
+	side := commitFile("side.txt", "side\n", "Add side\n\nWith a body.", 1700000200)
+	os.Unsetenv("GIT_GO_AUTHOR_NAME")
+	os.Unsetenv("GIT_GO_AUTHOR_EMAIL")
+	if err := repo.Switch("main", commands.CheckoutOptions{}); err != nil {
+		t.Fatalf("Switch errored: %v", err)
+	}
+	edit := commitFile("a.txt", "uno\n", "Edit a", 1700000300)
+
+	// A merge of side, written by hand.
+	os.WriteFile(filepath.Join(dir, "side.txt"), []byte("side\n"), 0644)
+	if err := repo.Add([]string{"side.txt"}); err != nil {
+		t.Fatalf("Add errored: %v", err)
+	}
+	entries, err := index.ReadIndex(repo.IndexPath())
+	if err != nil {
+		t.Fatalf("ReadIndex errored: %v", err)
+	}
+	mergeTree, err := tree.WriteTrees(repo.Store, entries)
+	if err != nil {
+		t.Fatalf("WriteTrees errored: %v", err)
+	}
+	sig := commit.Signature{Name: "Someone", Email: "someone@example.com", When: time.Unix(1700000400, 0).UTC()}
+	merge := commit.Commit{Tree: mergeTree, Parents: []string{edit, side}, Author: sig, Committer: sig, Message: "Merge side\n"}
+	if err := commit.WriteCommit(repo.Store, repo.GitDir, merge, "merge", repo.LockOptions); err != nil {
+		t.Fatalf("WriteCommit errored: %v", err)
+	}
+	head, _ := repo.Head()
+
+	want := "*   " + head[:7] + " Merge side\n" +
+		"|\\\n" +
+		"* | " + edit[:7] + " Edit a\n" +
+		"| * " + side[:7] + " Add side\n" +
+		"|/\n" +
+		"* " + "XXXXXXX" + " Add b\n" +
+		"* " + first[:7] + " Add a\n"
+	got := log(commands.LogOptions{Format: "oneline", AbbrevCommit: true, Graph: true})
+	second := strings.Fields(strings.Split(got, "\n")[5])[1]
+	if want = strings.Replace(want, "XXXXXXX", second, 1); got != want {
+		t.Fatalf("Graph:\n%s\nwant:\n%s", got, want)
+	}
+
+	for _, c := range []struct {
+		opts commands.LogOptions
+		want string
+	}{
+		{commands.LogOptions{}, "Merge side, Edit a, Add side, Add b, Add a"},
+		{commands.LogOptions{MaxCount: 2}, "Merge side, Edit a"},
+		{commands.LogOptions{Paths: []string{"side.txt"}}, "Add side"},
+		{commands.LogOptions{Paths: []string{"a.txt"}}, "Edit a, Add a"},
+		{commands.LogOptions{Revisions: []string{"main..side"}}, ""},
+		{commands.LogOptions{Revisions: []string{first + "..side"}}, "Add side, Add b"},
+		{commands.LogOptions{Revisions: []string{"side", "^" + first}}, "Add side, Add b"},
+		{commands.LogOptions{Author: "^Other "}, "Add side"},
+		{commands.LogOptions{Grep: "Edit|Merge"}, "Merge side, Edit a"},
+		{commands.LogOptions{Since: time.Unix(1700000150, 0), Until: time.Unix(1700000350, 0)}, "Edit a, Add side"},
+	} {
+		if got := oneline(c.opts); got != c.want {
+			t.Errorf("Log(%+v) = %q, want %q", c.opts, got, c.want)
+		}
+	}
+
+	want = "commit " + side + "\nAuthor: Other <other@example.com>\n" +
+		"Date:   Tue Nov 14 22:16:40 2023 +0000\n\n    Add side\n\n    With a body.\n\n" +
+		" side.txt | 1 +\n 1 file changed, 1 insertion(+)\n\n" +
+		"diff --git a/side.txt b/side.txt\nnew file mode 100644\nindex 0000000..2299c37\n--- /dev/null\n+++ b/side.txt\n@@ -0,0 +1 @@\n+side\n"
+	if got := log(commands.LogOptions{Revisions: []string{side}, MaxCount: 1, Stat: true, Patch: true}); got != want {
+		t.Fatalf("Log with stat and patch:\n%s\nwant:\n%s", got, want)
+	}
+	if got := log(commands.LogOptions{Revisions: []string{head}, MaxCount: 1, Format: "tformat:%h %p|%an <%ae> %at|%b|%x"}); got != head[:7]+" "+edit[:7]+" "+side[:7]+"|Someone <someone@example.com> 1700000400||%x\n" {
+		t.Fatalf("Log with a format = %q", got)
+	}
+	if got := log(commands.LogOptions{Revisions: []string{head}, MaxCount: 1, Format: "%h%x09%x3a%xZZ"}); got != head[:7]+"\t:%xZZ\n" {
+		t.Fatalf("Log with hex escapes = %q", got)
+	}
+	if err := repo.Log(commands.LogOptions{Format: "weird"}); err == nil {
+		t.Fatalf("Log with an unknown format didn't error")
+	}
+
+	now := time.Date(2024, 3, 10, 12, 0, 0, 0, time.UTC)
+	for value, want := range map[string]time.Time{
+		"2 days ago":          now.AddDate(0, 0, -2),
+		"3.weeks.ago":         now.AddDate(0, 0, -21),
+		"yesterday":           now.AddDate(0, 0, -1),
+		"2024-01-02":          time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC),
+		"2024-01-02 03:04:05": time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC),
+		"1700000000 +0000":    time.Unix(1700000000, 0),
+		"2w":                  now.Add(-14 * 24 * time.Hour),
+	} {
+		if got, err := commands.ParseApproxDate(value, now); err != nil || !got.Equal(want) {
+			t.Errorf("ParseApproxDate(%q) = %v, %v, want %v", value, got, err, want)
+		}
+	}
+	if _, err := commands.ParseApproxDate("someday", now); err == nil {
+		t.Errorf("ParseApproxDate of an unknown date didn't error")
+	}
+}
+
+func TestShow(t *testing.T) {
+	dir := t.TempDir()
+	repo, err := commands.Init(dir, commands.InitOptions{})
+	if err != nil {
+		t.Fatalf("Init errored: %v", err)
+	}
+	var out bytes.Buffer
+	repo.Out = &out
+	show := func(opts commands.ShowOptions) string {
+		t.Helper()
+		out.Reset()
+		if err := repo.Show(opts); err != nil {
+			t.Fatalf("Show errored: %v", err)
+		}
+		return out.String()
+	}
+
+	t.Setenv("GIT_GO_AUTHOR_NAME", "Someone")
+	t.Setenv("GIT_GO_AUTHOR_EMAIL", "someone@example.com")
+	t.Setenv("GIT_GO_AUTHOR_DATE", "1700000000 +0000")
+	t.Setenv("GIT_GO_COMMITTER_DATE", "1700000000 +0000")
+	os.Mkdir(filepath.Join(dir, "src"), 0755)
+	os.WriteFile(filepath.Join(dir, "src", "main.go"), []byte("package main\n"), 0644)
+	os.WriteFile(filepath.Join(dir, "README"), []byte("hello\n"), 0644)
+	if err := repo.Add([]string{"."}); err != nil {
+		t.Fatalf("Add errored: %v", err)
+	}
+	if err := repo.Commit([]string{"-m", "Init"}); err != nil {
+		t.Fatalf("Commit errored: %v", err)
+	}
+	head, _ := repo.Head()
+	if err := repo.CreateTag("v1", "", commands.TagOptions{Message: "First release"}); err != nil {
+		t.Fatalf("CreateTag errored: %v", err)
+	}
+
+	commitText := "commit " + head + "\nAuthor: Someone <someone@example.com>\nDate:   Tue Nov 14 22:13:20 2023 +0000\n\n    Init\n\n"
+	patch := "diff --git a/README b/README\nnew file mode 100644\nindex 0000000..ce01362\n--- /dev/null\n+++ b/README\n@@ -0,0 +1 @@\n+hello\n" +
+		"diff --git a/src/main.go b/src/main.go\nnew file mode 100644\nindex 0000000..06ab7d0\n--- /dev/null\n+++ b/src/main.go\n@@ -0,0 +1 @@\n+package main\n"
+	if got := show(commands.ShowOptions{}); got != commitText+patch {
+		t.Fatalf("Show of HEAD:\n%s\nwant:\n%s", got, commitText+patch)
+	}
+	if got := show(commands.ShowOptions{Objects: []string{"v1"}, NoPatch: true}); !strings.HasPrefix(got, "tag v1\nTagger: ") || !strings.HasSuffix(got, "\n\nFirst release\n\n"+strings.TrimSuffix(commitText, "\n")) {
+		t.Fatalf("Show of a tag:\n%s", got)
+	}
+	if got := show(commands.ShowOptions{Objects: []string{"HEAD:src/main.go", "HEAD:README"}}); got != "package main\n\nhello\n" {
+		t.Fatalf("Show of blobs = %q", got)
+	}
+	srcTree, _ := repo.Revisions().Resolve("HEAD:src")
+	want := "100644 blob ce013625030ba8dba906f756967f9e9ca394464a\tREADME\n040000 tree " + srcTree + "\tsrc\n"
+	if got := show(commands.ShowOptions{Objects: []string{"HEAD^{tree}"}}); got != want {
+		t.Fatalf("Show of a tree = %q, want %q", got, want)
+	}
+	if got := show(commands.ShowOptions{Format: "oneline", AbbrevCommit: true, Stat: true}); got != head[:7]+" Init\n README      | 1 +\n src/main.go | 1 +\n 2 files changed, 2 insertions(+)\n" {
+		t.Fatalf("Show with a stat = %q", got)
+	}
+	if err := repo.Show(commands.ShowOptions{Objects: []string{"HEAD:missing"}}); err == nil {
+		t.Fatalf("Show of a missing path didn't error")
+	}
+}
+
+func TestPlumbing(t *testing.T) {
+	dir := t.TempDir()
+	repo, err := commands.Init(dir, commands.InitOptions{})
+	if err != nil {
+		t.Fatalf("Init errored: %v", err)
+	}
+	var out bytes.Buffer
+	repo.Out = &out
+	run := func(name string, fn func() error) string {
+		t.Helper()
+		out.Reset()
+		if err := fn(); err != nil {
+			t.Fatalf("%s errored: %v", name, err)
+		}
+		return out.String()
+	}
+
+	os.Mkdir(filepath.Join(dir, "src"), 0755)
+	os.WriteFile(filepath.Join(dir, "src", "main.go"), []byte("package main\n"), 0644)
+	os.WriteFile(filepath.Join(dir, "README"), []byte("hello\n"), 0644)
+	if err := repo.Add([]string{"."}); err != nil {
+		t.Fatalf("Add errored: %v", err)
+	}
+
+	blob, err := repo.HashObject("", []byte("hello\n"), false)
+	if err != nil || blob != "ce013625030ba8dba906f756967f9e9ca394464a" {
+		t.Fatalf("HashObject = %s, %v", blob, err)
+	}
+	if _, err := repo.HashObject(object.TypeCommit, []byte("not a commit"), true); err == nil {
+		t.Fatalf("HashObject of an invalid commit didn't error")
+	}
+	if got := run("LsFiles", func() error { return repo.LsFiles(commands.LsFilesOptions{Stage: true}) }); got != "100644 "+blob+" 0\tREADME\n100644 06ab7d0f9a35a7d1070711496d6ca1cb892a258f 0\tsrc/main.go\n" {
+		t.Fatalf("LsFiles -s = %q", got)
+	}
+	if got := run("LsFiles", func() error { return repo.LsFiles(commands.LsFilesOptions{Paths: []string{"src"}}) }); got != "src/main.go\n" {
+		t.Fatalf("LsFiles src = %q", got)
+	}
+
+	treeHash, err := repo.WriteTree()
+	if err != nil {
+		t.Fatalf("WriteTree errored: %v", err)
+	}
+	if got := run("LsTree", func() error { return repo.LsTree(commands.LsTreeOptions{Tree: treeHash, Recursive: true, Long: true}) }); got != "100644 blob "+blob+"       6\tREADME\n100644 blob 06ab7d0f9a35a7d1070711496d6ca1cb892a258f      13\tsrc/main.go\n" {
+		t.Fatalf("LsTree -r -l = %q", got)
+	}
+	if got := run("LsTree", func() error { return repo.LsTree(commands.LsTreeOptions{Tree: treeHash, NameOnly: true}) }); got != "README\nsrc\n" {
+		t.Fatalf("LsTree --name-only = %q", got)
+	}
+
+	t.Setenv("GIT_GO_AUTHOR_DATE", "1700000000 +0000")
+	t.Setenv("GIT_GO_COMMITTER_DATE", "1700000000 +0000")
+	root, err := repo.CommitTree(treeHash, nil, "Root")
+	if err != nil {
+		t.Fatalf("CommitTree errored: %v", err)
+	}
+	child, err := repo.CommitTree(treeHash, []string{root}, "Child\n")
+	if err != nil {
+		t.Fatalf("CommitTree errored: %v", err)
+	}
+	if _, err := repo.Head(); err == nil {
+		t.Fatalf("CommitTree moved HEAD")
+	}
+	if got := run("CatFile", func() error { return repo.CatFile("-p", child) }); !strings.HasPrefix(got, "tree "+treeHash+"\nparent "+root+"\n") || !strings.HasSuffix(got, "\n\nChild\n") {
+		t.Fatalf("CatFile -p of a commit = %q", got)
+	}
+	if got := run("CatFile", func() error { return repo.CatFile("-t", child) }); got != "commit\n" {
+		t.Fatalf("CatFile -t = %q", got)
+	}
+	if got := run("CatFile", func() error { return repo.CatFile("-s", blob) }); got != "6\n" {
+		t.Fatalf("CatFile -s = %q", got)
+	}
+	if got := run("CatFile", func() error { return repo.CatFile("tree", child) }); !strings.HasPrefix(got, "100644 README\x00") {
+		t.Fatalf("CatFile tree of a commit = %q", got)
+	}
+	if err := repo.CatFile("-e", "0123456789"); err == nil {
+		t.Fatalf("CatFile -e of a missing object didn't error")
+	}
+
+	if err := repo.UpdateRef(commands.UpdateRefOptions{Ref: "refs/heads/main", NewValue: root, OldValue: refs.ZeroHash, Message: "root"}); err != nil {
+		t.Fatalf("UpdateRef errored: %v", err)
+	}
+	err = repo.UpdateRef(commands.UpdateRefOptions{Ref: "HEAD", NewValue: child, OldValue: refs.ZeroHash})
+	if !errors.Is(err, refs.ErrRefChanged) {
+		t.Fatalf("UpdateRef with a stale old value = %v", err)
+	}
+	if err := repo.UpdateRef(commands.UpdateRefOptions{Ref: "HEAD", NewValue: child, OldValue: root}); err != nil {
+		t.Fatalf("UpdateRef through HEAD errored: %v", err)
+	}
+	if head, _ := repo.Head(); head != child {
+		t.Fatalf("HEAD = %s, want %s", head, child)
+	}
+	_, entries, err := repo.Reflog("main")
+	if err != nil || len(entries) != 2 || entries[1].Message != "root" || entries[1].Old != refs.ZeroHash {
+		t.Fatalf("Reflog = %v, %v", entries, err)
+	}
+	if got := run("CatFileBatch", func() error { return repo.CatFileBatch(strings.NewReader("HEAD:README\nnope\n"), false) }); got != blob+" blob 6\nhello\n\nnope missing\n" {
+		t.Fatalf("CatFileBatch = %q", got)
+	}
+	if got := run("CatFileBatch", func() error { return repo.CatFileBatch(strings.NewReader("main^{tree}\n"), true) }); got != treeHash+" tree 64\n" {
+		t.Fatalf("CatFileBatch check = %q", got)
+	}
+	if err := repo.UpdateRef(commands.UpdateRefOptions{Ref: "refs/heads/main", Delete: true, OldValue: root}); !errors.Is(err, refs.ErrRefChanged) {
+		t.Fatalf("Delete with a stale old value = %v", err)
+	}
+	if err := repo.UpdateRef(commands.UpdateRefOptions{Ref: "refs/heads/main", Delete: true}); err != nil {
+		t.Fatalf("Delete errored: %v", err)
+	}
+	victim := filepath.Join(dir, "victim")
+	os.WriteFile(victim, []byte(root+"\n"), 0644)
+	for _, name := range []string{"../victim", "refs/../../victim"} {
+		for _, remove := range []bool{true, false} {
+			err := repo.UpdateRef(commands.UpdateRefOptions{Ref: name, NewValue: root, Delete: remove})
+			if !errors.Is(err, refs.ErrInvalidRef) {
+				t.Errorf("UpdateRef of %q = %v, want ErrInvalidRef", name, err)
+			}
+		}
+	}
+	if content, err := os.ReadFile(victim); err != nil || string(content) != root+"\n" {
+		t.Fatalf("File outside the git directory was touched: %q, %v", content, err)
+	}
+	if _, err := repo.Head(); err == nil {
+		t.Fatalf("main still exists after delete")
+	}
+}
@@ -0,0 +1,430 @@
+package commands
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/f1-surya/git-go/commit"
+	"github.com/f1-surya/git-go/diff"
+	"github.com/f1-surya/git-go/index"
+	"github.com/f1-surya/git-go/object"
+	"github.com/f1-surya/git-go/pathspec"
+	"github.com/f1-surya/git-go/refs"
+	"github.com/f1-surya/git-go/tree"
+)
+
+// The abbreviated hash of a missing file in index lines.
+const nullAbbrev = "0000000"
+
+type DiffOptions struct {
+	// Compares the index to HEAD, or to the one revision given, instead of
+	// the work tree to the index.
+	Staged bool
+	// No revisions compare the work tree to the index. One revision is
+	// compared to the work tree, two revisions, or A..B, to each other, and
+	// A...B compares the merge base of A and B to B.
+	Revisions []string
+	// Only files matching these paths are compared.
+	Paths []string
+	// Unchanged lines shown around changes, -1 for diff.context or 3.
+	Context int
+	// myers, patience or histogram, "" for diff.algorithm or myers.
+	Algorithm string
+	// "true" to detect renames, "copies" to detect copies too and "false"
+	// for neither, "" for diff.renames or true.
+	Renames string
+	// The similarity in percent a rename or copy needs, 0 for 50.
+	RenameThreshold int
+}
+
+// Prints the differences between two versions of the files as a unified diff.
+func (r *Repository) Diff(opts DiffOptions) error {
+	spec, err := r.Pathspec(opts.Paths)
+	if err != nil {
+		return err
+	}
+	revisions, err := r.diffRevisions(opts.Revisions)
+	if err != nil {
+		return err
+	}
+	renames, err := r.renameOptions(opts)
+	if err != nil {
+		return err
+	}
+
+	var changes []tree.Change
+	contents := make(map[string][]byte)
+	switch {
+	case len(revisions) == 2:
+		var oldTree, newTree string
+		if oldTree, err = r.revisionTree(revisions[0]); err != nil {
+			return err
+		}
+		if newTree, err = r.revisionTree(revisions[1]); err != nil {
+			return err
+		}
+		if changes, err = tree.Diff(r.Store, oldTree, newTree, renames); err != nil {
+			return err
+		}
+		changes = slices.DeleteFunc(changes, func(c tree.Change) bool {
+			return !spec.Match(filepath.ToSlash(c.OldPath)) && !spec.Match(filepath.ToSlash(c.NewPath))
+		})
+	case opts.Staged:
+		base := refs.Head
+		if len(revisions) == 1 {
+			base = revisions[0]
+		}
+		oldFiles, err := r.revisionFiles(base, spec)
+		if err != nil {
+			return err
+		}
+		newFiles, err := r.indexFiles(spec)
+		if err != nil {
+			return err
+		}
+		if changes, err = tree.DiffEntries(r.Store, oldFiles, newFiles, renames); err != nil {
+			return err
+		}
+	default:
+		var oldFiles map[string]tree.TreeEntry
+		if len(revisions) == 1 {
+			oldFiles, err = r.revisionFiles(revisions[0], spec)
+		} else {
+			oldFiles, err = r.indexFiles(spec)
+		}
+		if err != nil {
+			return err
+		}
+		newFiles, err := r.workTreeDiffFiles(spec, contents)
+		if err != nil {
+			return err
+		}
+		store := workTreeStore{r.Store, contents}
+		if changes, err = tree.DiffEntries(store, oldFiles, newFiles, renames); err != nil {
+			return err
+		}
+	}
+	return r.writeDiff(r.Out, changes, contents, opts)
+}
+
+// Serves the blobs of changed work tree files, which aren't stored, on top of
+// the store, so renames to them can be detected.
+type workTreeStore struct {
+	object.ObjectStore
+	contents map[string][]byte
+}
+
+func (s workTreeStore) Get(hash string) (string, []byte, error) {
+	if content, ok := s.contents[hash]; ok {
+		return object.TypeBlob, content, nil
+	}
+	return s.ObjectStore.Get(hash)
+}
+
+// Splits A..B and A...B into the two revisions they compare.
+func (r *Repository) diffRevisions(args []string) ([]string, error) {
+	var revisions []string
+	for _, arg := range args {
+		if left, right, ok := strings.Cut(arg, "..."); ok {
+			left, right = orHead(left), orHead(right)
+			a, err := r.resolveCommit(left)
+			if err != nil {
+				return nil, err
+			}
+			b, err := r.resolveCommit(right)
+			if err != nil {
+				return nil, err
+			}
+			bases, err := commit.MergeBases(r.Store, a, b)
+			if err != nil {
+				return nil, err
+			}
+			if len(bases) == 0 {
+				return nil, fmt.Errorf("%s and %s have no merge base", left, right)
+			}
+			revisions = append(revisions, bases[0], right)
+		} else if left, right, ok := strings.Cut(arg, ".."); ok {
+			revisions = append(revisions, orHead(left), orHead(right))
+		} else {
+			revisions = append(revisions, arg)
+		}
+	}
+	if len(revisions) > 2 {
+		return nil, errors.New("diff compares at most two revisions")
+	}
+	return revisions, nil
+}
+
+func orHead(rev string) string {
+	if rev == "" {
+		return refs.Head
+	}
+	return rev
+}
+
+// Returns the tree of the revision, "" for the empty tree of a branch without
+// commits.
+func (r *Repository) revisionTree(rev string) (string, error) {
+	treeHash, err := r.Revisions().Resolve(rev + "^{tree}")
+	if rev == refs.Head && err != nil {
+		if _, headErr := refs.Resolve(r.GitDir, refs.Head); errors.Is(headErr, refs.ErrNotFound) {
+			return "", nil
+		}
+	}
+	return treeHash, err
+}
+
+// Returns the files in the tree of the revision that match spec.
+func (r *Repository) revisionFiles(rev string, spec pathspec.Pathspec) (map[string]tree.TreeEntry, error) {
+	treeHash, err := r.revisionTree(rev)
+	if err != nil {
+		return nil, err
+	}
+	entries, err := r.treeEntries(treeHash)
+	if err != nil {
+		return nil, err
+	}
+	for path := range entries {
+		if !spec.Match(filepath.ToSlash(path)) {
+			delete(entries, path)
+		}
+	}
+	return entries, nil
+}
+
+// Returns the staged files that match spec.
+func (r *Repository) indexFiles(spec pathspec.Pathspec) (map[string]tree.TreeEntry, error) {
+	entries, err := index.ReadIndex(r.IndexPath())
+	if err != nil {
+		return nil, err
+	}
+	files := make(map[string]tree.TreeEntry)
+	for _, entry := range entries {
+		if spec.Match(filepath.ToSlash(entry.Path)) {
+			files[entry.Path] = indexTreeEntry(entry)
+		}
+	}
+	return files, nil
+}
+
+func indexTreeEntry(entry index.IndexEntry) tree.TreeEntry {
+	return tree.TreeEntry{Mode: entry.Mode, Type: "blob", Name: filepath.Base(entry.Path), Hash: entry.Hash[:]}
+}
+
+// Returns the tracked files in the work tree that match spec, and adds the
+// content of the files that were read to contents, keyed by hash. Like in
+// Status, files whose stat data matches the index aren't read.
+func (r *Repository) workTreeDiffFiles(spec pathspec.Pathspec, contents map[string][]byte) (map[string]tree.TreeEntry, error) {
+	entries, err := index.ReadIndex(r.IndexPath())
+	if err != nil {
+		return nil, err
+	}
+	indexInfo, err := os.Stat(r.IndexPath())
+	if err != nil {
+		return nil, err
+	}
+	files := make(map[string]tree.TreeEntry)
+	for _, entry := range entries {
+		if !spec.Match(filepath.ToSlash(entry.Path)) {
+			continue
+		}
+		info, err := os.Lstat(filepath.Join(r.WorkTree, entry.Path))
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if !info.Mode().IsRegular() {
+			continue
+		}
+		if entry.StatMatches(info) && !entry.IsRacy(indexInfo.ModTime()) {
+			files[entry.Path] = indexTreeEntry(entry)
+			continue
+		}
+		content, err := os.ReadFile(filepath.Join(r.WorkTree, entry.Path))
+		if err != nil {
+			return nil, err
+		}
+		hash := object.Hash(object.TypeBlob, content)
+		contents[hash] = content
+		file := tree.TreeEntry{Mode: object.ModeRegular, Type: "blob", Name: filepath.Base(entry.Path)}
+		if info.Mode()&0o111 != 0 {
+			file.Mode = object.ModeExecutable
+		}
+		file.Hash, _ = hex.DecodeString(hash)
+		files[entry.Path] = file
+	}
+	return files, nil
+}
+
+// Returns how renames are detected, from opts or diff.renames.
+func (r *Repository) renameOptions(opts DiffOptions) (tree.DiffOptions, error) {
+	setting := opts.Renames
+	if setting == "" {
+		setting = r.Config.GetString("diff.renames", "true")
+	}
+	renames := tree.DiffOptions{Threshold: opts.RenameThreshold}
+	switch strings.ToLower(setting) {
+	case "copies", "copy":
+		renames.Copies = true
+	case "true", "yes", "on", "1":
+		renames.Renames = true
+	case "false", "no", "off", "0":
+	default:
+		return renames, fmt.Errorf("bad diff.renames %q", setting)
+	}
+	if opts.RenameThreshold < 0 || opts.RenameThreshold > 100 {
+		return renames, fmt.Errorf("bad rename threshold %d", opts.RenameThreshold)
+	}
+	return renames, nil
+}
+
+// Returns the lines of context and the algorithm, from opts or the config.
+func (r *Repository) diffSettings(opts DiffOptions) (int, diff.Algorithm, error) {
+	context := opts.Context
+	if context < 0 {
+		n, err := r.Config.Int("diff.context", 3)
+		if err != nil {
+			return 0, diff.Myers, err
+		}
+		if n < 0 {
+			return 0, diff.Myers, fmt.Errorf("bad diff.context %d", n)
+		}
+		context = int(n)
+	}
+	name := opts.Algorithm
+	if name == "" {
+		name = r.Config.GetString("diff.algorithm", "myers")
+	}
+	algorithm, err := diff.ParseAlgorithm(name)
+	return context, algorithm, err
+}
+
+// Writes the changes, which are sorted by path, to w.
+func (r *Repository) writeDiff(w io.Writer, changes []tree.Change, contents map[string][]byte, opts DiffOptions) error {
+	context, algorithm, err := r.diffSettings(opts)
+	if err != nil {
+		return err
+	}
+	enabled, err := r.useColor("diff")
+	if err != nil {
+		return err
+	}
+	color := colorizer(enabled)
+	for _, change := range changes {
+		if err := r.writeFileDiff(w, change, contents, context, algorithm, color); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Returns the content of the file, from contents or the store. A missing
+// file has none.
+func (r *Repository) fileContent(entry tree.TreeEntry, contents map[string][]byte) ([]byte, error) {
+	if entry.Hash == nil {
+		return nil, nil
+	}
+	hash := hex.EncodeToString(entry.Hash)
+	if content, ok := contents[hash]; ok {
+		return content, nil
+	}
+	_, content, err := r.Store.Get(hash)
+	return content, err
+}
+
+// Writes the diff of one changed file to w.
+func (r *Repository) writeFileDiff(w io.Writer, change tree.Change, contents map[string][]byte, context int, algorithm diff.Algorithm, color func(string, string) string) error {
+	meta := func(format string, args ...any) {
+		fmt.Fprintln(w, color(colorBold, fmt.Sprintf(format, args...)))
+	}
+	oldPath, newPath := filepath.ToSlash(change.OldPath), filepath.ToSlash(change.NewPath)
+	switch change.Type {
+	case tree.Added:
+		oldPath = newPath
+	case tree.Deleted:
+		newPath = oldPath
+	}
+	oldName, newName := "a/"+oldPath, "b/"+newPath
+	meta("diff --git %s %s", oldName, newName)
+	old, new := change.Old, change.New
+	switch change.Type {
+	case tree.Added:
+		meta("new file mode %o", new.Mode)
+		oldName = "/dev/null"
+	case tree.Deleted:
+		meta("deleted file mode %o", old.Mode)
+		newName = "/dev/null"
+	default:
+		if old.Mode != new.Mode {
+			meta("old mode %o", old.Mode)
+			meta("new mode %o", new.Mode)
+		}
+	}
+	switch change.Type {
+	case tree.Renamed:
+		meta("similarity index %d%%", change.Similarity)
+		meta("rename from %s", oldPath)
+		meta("rename to %s", newPath)
+	case tree.Copied:
+		meta("similarity index %d%%", change.Similarity)
+		meta("copy from %s", oldPath)
+		meta("copy to %s", newPath)
+	}
+	if old.Hash != nil && new.Hash != nil && string(old.Hash) == string(new.Hash) {
+		// Only the mode or the path changed.
+		return nil
+	}
+	oldHash, newHash := nullAbbrev, nullAbbrev
+	if old.Hash != nil {
+		oldHash = hex.EncodeToString(old.Hash)[:7]
+	}
+	if new.Hash != nil {
+		newHash = hex.EncodeToString(new.Hash)[:7]
+	}
+	if old.Hash != nil && new.Hash != nil && old.Mode == new.Mode {
+		meta("index %s..%s %o", oldHash, newHash, old.Mode)
+	} else {
+		meta("index %s..%s", oldHash, newHash)
+	}
+
+	oldContent, err := r.fileContent(old, contents)
+	if err != nil {
+		return err
+	}
+	newContent, err := r.fileContent(new, contents)
+	if err != nil {
+		return err
+	}
+	if diff.IsBinary(oldContent) || diff.IsBinary(newContent) {
+		fmt.Fprintf(w, "Binary files %s and %s differ\n", oldName, newName)
+		return nil
+	}
+	hunks := diff.Hunks(diff.Diff(diff.Lines(oldContent), diff.Lines(newContent), algorithm), context)
+	if len(hunks) == 0 {
+		return nil
+	}
+	meta("--- %s", oldName)
+	meta("+++ %s", newName)
+	for _, h := range hunks {
+		fmt.Fprintln(w, color(colorCyan, h.Header()))
+		for _, e := range h.Edits {
+			line, marker, _ := strings.Cut(e.Line(), "\n")
+			switch e.Op {
+			case diff.Delete:
+				line = color(colorRed, line)
+			case diff.Insert:
+				line = color(colorGreen, line)
+			}
+			fmt.Fprint(w, line+"\n"+marker)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,222 @@
+package commands
+
+import (
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/f1-surya/git-go/commit"
+	"github.com/f1-surya/git-go/index"
+	"github.com/f1-surya/git-go/object"
+	"github.com/f1-surya/git-go/tag"
+	"github.com/f1-surya/git-go/tree"
+)
+
+// Kinds of problems fsck reports.
+const (
+	// The object can't be read or parsed.
+	FsckCorrupt = "corrupt"
+	// The content of the object doesn't hash to its name.
+	FsckHashMismatch = "hash-mismatch"
+	// An object refers to an object that isn't in the store.
+	FsckMissing = "missing"
+	// An object refers to an object of the wrong type.
+	FsckBrokenLink = "broken-link"
+	// A ref points to a missing object or to something other than a commit.
+	FsckBadRef = "bad-ref"
+	// An index entry points to a missing blob.
+	FsckBadIndexEntry = "bad-index-entry"
+	// Nothing refers to the object. Not an error, gc will eventually prune it.
+	FsckDangling = "dangling"
+)
+
+type FsckProblem struct {
+	Kind    string `json:"kind"`
+	Type    string `json:"type,omitempty"`
+	Object  string `json:"object,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+func (p FsckProblem) String() string {
+	line := p.Kind
+	if p.Type != "" {
+		line += " " + p.Type
+	}
+	if p.Object != "" {
+		line += " " + p.Object
+	}
+	if p.Message != "" {
+		line += ": " + p.Message
+	}
+	return line
+}
+
+type FsckReport struct {
+	// Number of objects that were checked.
+	Checked  int           `json:"checked"`
+	Problems []FsckProblem `json:"problems"`
+}
+
+// Reports whether the repository is healthy, dangling objects are not a problem.
+func (r *FsckReport) OK() bool {
+	for _, problem := range r.Problems {
+		if problem.Kind != FsckDangling {
+			return false
+		}
+	}
+	return true
+}
+
+// A reference from one object to another, used to find missing and dangling objects.
+type objectLink struct {
+	from     string
+	fromType string
+	to       string
+	toType   string
+}
+
+// Verifies the hash and structure of every object in the store and checks that
+// every commit, tree, ref and index entry points at an object of the right type.
+func (r *Repository) Fsck() (*FsckReport, error) {
+	report := &FsckReport{Problems: []FsckProblem{}}
+	types := make(map[string]string)
+	var links []objectLink
+
+	if store, ok := r.Store.(*object.LooseStore); ok {
+		packs, err := store.Packs()
+		if err != nil {
+			return nil, err
+		}
+		for _, p := range packs {
+			if err := p.Verify(); err != nil {
+				report.Problems = append(report.Problems, FsckProblem{Kind: FsckCorrupt, Message: err.Error()})
+			}
+		}
+	}
+
+	err := r.Store.Iterate(func(hash string) error {
+		report.Checked++
+		objType, content, err := r.Store.Get(hash)
+		if err != nil {
+			report.Problems = append(report.Problems, FsckProblem{Kind: FsckCorrupt, Object: hash, Message: err.Error()})
+			return nil
+		}
+		types[hash] = objType
+		if actual := object.Hash(objType, content); actual != hash {
+			report.Problems = append(report.Problems, FsckProblem{
+				Kind:    FsckHashMismatch,
+				Type:    objType,
+				Object:  hash,
+				Message: "content hashes to " + actual,
+			})
+			return nil
+		}
+
+		switch objType {
+		case object.TypeTree:
+			t, err := tree.ParseTree(content)
+			if err != nil {
+				report.Problems = append(report.Problems, FsckProblem{Kind: FsckCorrupt, Type: objType, Object: hash, Message: err.Error()})
+				return nil
+			}
+			for _, child := range t.Children {
+				links = append(links, objectLink{hash, objType, hex.EncodeToString(child.Hash), child.Type})
+			}
+		case object.TypeCommit:
+			c, err := commit.Parse(hash, content)
+			if err != nil {
+				report.Problems = append(report.Problems, FsckProblem{Kind: FsckCorrupt, Type: objType, Object: hash, Message: err.Error()})
+				return nil
+			}
+			links = append(links, objectLink{hash, objType, c.Tree, object.TypeTree})
+			for _, parent := range c.Parents {
+				links = append(links, objectLink{hash, objType, parent, object.TypeCommit})
+			}
+		case object.TypeTag:
+			t, err := tag.Parse(hash, content)
+			if err != nil {
+				report.Problems = append(report.Problems, FsckProblem{Kind: FsckCorrupt, Type: objType, Object: hash, Message: err.Error()})
+				return nil
+			}
+			links = append(links, objectLink{hash, objType, t.Object, t.Type})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	referenced := make(map[string]bool)
+	for _, link := range links {
+		referenced[link.to] = true
+		actualType, ok := types[link.to]
+		if !ok {
+			if r.Store.Has(link.to) {
+				// Unreadable, already reported as corrupt.
+				continue
+			}
+			report.Problems = append(report.Problems, FsckProblem{
+				Kind:    FsckMissing,
+				Type:    link.toType,
+				Object:  link.to,
+				Message: fmt.Sprintf("broken link from %s %s", link.fromType, link.from),
+			})
+		} else if actualType != link.toType {
+			report.Problems = append(report.Problems, FsckProblem{
+				Kind:    FsckBrokenLink,
+				Type:    actualType,
+				Object:  link.to,
+				Message: fmt.Sprintf("%s %s expects a %s", link.fromType, link.from, link.toType),
+			})
+		}
+	}
+
+	tips, err := r.refTips()
+	if err != nil {
+		return nil, err
+	}
+	for name, hash := range tips {
+		referenced[hash] = true
+		if actualType, ok := types[hash]; !ok {
+			report.Problems = append(report.Problems, FsckProblem{Kind: FsckBadRef, Object: hash, Message: name + " points to a missing object"})
+		} else if actualType != object.TypeCommit && !strings.HasPrefix(name, tagsPrefix) {
+			report.Problems = append(report.Problems, FsckProblem{Kind: FsckBadRef, Type: actualType, Object: hash, Message: name + " doesn't point to a commit"})
+		}
+	}
+	// Like for gc, commits a ref used to point to aren't dangling.
+	logged, err := r.reflogHashes()
+	if err != nil {
+		return nil, err
+	}
+	for _, hash := range logged {
+		referenced[hash] = true
+	}
+
+	entries, err := index.ReadIndex(r.IndexPath())
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range entries {
+		hash := hex.EncodeToString(entry.Hash[:])
+		referenced[hash] = true
+		if actualType, ok := types[hash]; !ok || actualType != object.TypeBlob {
+			report.Problems = append(report.Problems, FsckProblem{Kind: FsckBadIndexEntry, Object: hash, Message: entry.Path + " doesn't point to a blob"})
+		}
+	}
+
+	for hash, objType := range types {
+		if !referenced[hash] {
+			report.Problems = append(report.Problems, FsckProblem{Kind: FsckDangling, Type: objType, Object: hash})
+		}
+	}
+
+	sort.SliceStable(report.Problems, func(i, j int) bool {
+		a, b := report.Problems[i], report.Problems[j]
+		if a.Kind != b.Kind {
+			return a.Kind < b.Kind
+		}
+		return a.Object < b.Object
+	})
+	return report, nil
+}
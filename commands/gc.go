@@ -0,0 +1,201 @@
+package commands
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/f1-surya/git-go/lockfile"
+	"github.com/f1-surya/git-go/object"
+	"github.com/f1-surya/git-go/pack"
+)
+
+// Unreachable objects younger than this are kept, they may belong to an
+// operation that is still running.
+const DefaultPruneExpire = 14 * 24 * time.Hour
+
+type GCOptions struct {
+	// Unreachable loose objects modified within this duration are kept.
+	PruneExpire time.Duration
+}
+
+// Parses a grace period like "now", "2w", "3d" or any time.ParseDuration value.
+func ParseExpire(value string) (time.Duration, error) {
+	if value == "now" {
+		return 0, nil
+	}
+	for suffix, unit := range map[string]time.Duration{"d": 24 * time.Hour, "w": 7 * 24 * time.Hour} {
+		if n, ok := strings.CutSuffix(value, suffix); ok {
+			if count, err := strconv.Atoi(n); err == nil && count >= 0 {
+				return time.Duration(count) * unit, nil
+			}
+		}
+	}
+	duration, err := time.ParseDuration(value)
+	if err != nil || duration < 0 {
+		return 0, fmt.Errorf("invalid expiry %q", value)
+	}
+	return duration, nil
+}
+
+func formatSize(size int64) string {
+	switch {
+	case size >= 1<<20:
+		return fmt.Sprintf("%.2f MiB", float64(size)/(1<<20))
+	case size >= 1<<10:
+		return fmt.Sprintf("%.2f KiB", float64(size)/(1<<10))
+	default:
+		return fmt.Sprintf("%d bytes", size)
+	}
+}
+
+// Returns the total size of the loose objects and packs in the store.
+func storeSize(store *object.LooseStore) (int64, error) {
+	var total int64
+	err := filepath.Walk(store.Dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() {
+			total += info.Size()
+		}
+		return nil
+	})
+	return total, err
+}
+
+// Expires old reflog entries, then packs every reachable object into a single
+// new pack and deletes the unreachable loose objects older than the grace
+// period. Unreachable objects from old packs are turned into loose objects
+// while their pack is within the grace period, so they get the same chance to
+// be recovered.
+func (r *Repository) GC(opts GCOptions) error {
+	store, ok := r.Store.(*object.LooseStore)
+	if !ok {
+		return errors.New("gc only works on repositories using loose objects")
+	}
+	// Two collections at once would delete each other's packs. Like git, the
+	// lock holds the pid of the running gc.
+	lock, err := lockfile.Acquire(filepath.Join(r.GitDir, "gc.pid"), r.LockOptions)
+	if err != nil {
+		return err
+	}
+	defer lock.Rollback()
+	fmt.Fprintf(lock, "%d\n", os.Getpid())
+
+	sizeBefore, err := storeSize(store)
+	if err != nil {
+		return err
+	}
+
+	if err := r.expireReflogsForGC(); err != nil {
+		return err
+	}
+	roots, err := r.roots()
+	if err != nil {
+		return err
+	}
+	reachable, err := reachableObjects(store, roots)
+	if err != nil {
+		return err
+	}
+
+	oldPacks, err := store.Packs()
+	if err != nil {
+		return err
+	}
+
+	var objects []pack.Object
+	for hash := range reachable {
+		objType, content, err := store.Get(hash)
+		if err != nil {
+			return err
+		}
+		objects = append(objects, pack.Object{Type: objType, Content: content})
+	}
+	newPack := ""
+	if len(objects) > 0 {
+		newPack, err = pack.WriteFiles(filepath.Join(store.Dir, "pack"), objects, pack.DefaultWriteOptions)
+		if err != nil {
+			return err
+		}
+	}
+
+	cutoff := time.Now().Add(-opts.PruneExpire)
+	for _, oldPack := range oldPacks {
+		if oldPack.Path == newPack {
+			continue
+		}
+		info, err := os.Stat(oldPack.Path)
+		if err != nil {
+			return err
+		}
+		if info.ModTime().After(cutoff) {
+			for _, hash := range oldPack.Hashes() {
+				if _, ok := reachable[hash]; ok || store.HasLoose(hash) {
+					continue
+				}
+				objType, content, err := oldPack.Get(hash)
+				if err != nil {
+					return err
+				}
+				if _, err := store.PutLoose(objType, content); err != nil {
+					return err
+				}
+				// The grace period of the object starts when its pack was written,
+				// not now, or each gc would keep it around for another period.
+				path := filepath.Join(store.Dir, hash[:2], hash[2:])
+				if err := os.Chtimes(path, info.ModTime(), info.ModTime()); err != nil {
+					return err
+				}
+			}
+		}
+		if err := os.Remove(strings.TrimSuffix(oldPack.Path, ".pack") + ".idx"); err != nil {
+			return err
+		}
+		if err := os.Remove(oldPack.Path); err != nil {
+			return err
+		}
+	}
+
+	pruned := 0
+	err = store.IterateLoose(func(hash string) error {
+		path := filepath.Join(store.Dir, hash[:2], hash[2:])
+		if _, ok := reachable[hash]; !ok {
+			info, err := os.Stat(path)
+			if err != nil {
+				return err
+			}
+			if info.ModTime().After(cutoff) {
+				return nil
+			}
+			pruned++
+		}
+		if err := os.Remove(path); err != nil {
+			return err
+		}
+		// Only succeeds once the fan-out directory is empty.
+		os.Remove(filepath.Dir(path))
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	sizeAfter, err := storeSize(store)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(r.Out, "Packed %d objects, pruned %d unreachable objects\n", len(objects), pruned)
+	// A pack of few objects can be bigger than the objects were.
+	if sizeAfter <= sizeBefore {
+		fmt.Fprintf(r.Out, "Reclaimed %s (%s -> %s)\n", formatSize(sizeBefore-sizeAfter), formatSize(sizeBefore), formatSize(sizeAfter))
+	} else {
+		fmt.Fprintf(r.Out, "Grew by %s (%s -> %s)\n", formatSize(sizeAfter-sizeBefore), formatSize(sizeBefore), formatSize(sizeAfter))
+	}
+	return nil
+}
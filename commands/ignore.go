@@ -0,0 +1,147 @@
+package commands
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/f1-surya/git-go/ignore"
+	"github.com/f1-surya/git-go/index"
+	"github.com/f1-surya/git-go/pathspec"
+)
+
+// Returns the default of core.excludesFile, the ignore file that applies to
+// every repository of the user: $XDG_CONFIG_HOME/git-go/ignore.
+func defaultExcludesFile() string {
+	configDir := os.Getenv("XDG_CONFIG_HOME")
+	if configDir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return ""
+		}
+		configDir = filepath.Join(home, ".config")
+	}
+	return filepath.Join(configDir, "git-go", "ignore")
+}
+
+// Returns the matcher for the ignore rules of the repository: the file of
+// core.excludesFile, .git-go/info/exclude and the .gitignore files of the work
+// tree.
+func (r *Repository) Ignore() (*ignore.Matcher, error) {
+	global, ok, err := r.Config.Path("core.excludesFile")
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		global = defaultExcludesFile()
+	} else if global != "" && !filepath.IsAbs(global) {
+		// Like for Git, relative paths start at the top of the work tree.
+		global = filepath.Join(r.WorkTree, global)
+	}
+	var excludes []string
+	if global != "" {
+		excludes = append(excludes, global)
+	}
+	excludes = append(excludes, filepath.Join(r.GitDir, "info", "exclude"))
+	return ignore.New(r.WorkTree, excludes...)
+}
+
+// Returns the files in the work tree matching the pathspec, keyed by their
+// path relative to the work tree. The git dirs of git-go and Git are skipped,
+// and so are ignored files unless they are tracked or ignored is nil.
+func (r *Repository) workTreeFiles(spec pathspec.Pathspec, tracked []index.IndexEntry, ignored *ignore.Matcher) (map[string]fs.FileInfo, error) {
+	trackedPaths := make(map[string]bool)
+	for _, entry := range tracked {
+		for path := entry.Path; path != "."; path = filepath.Dir(path) {
+			trackedPaths[path] = true
+		}
+	}
+
+	files := make(map[string]fs.FileInfo)
+	for _, root := range spec.Roots() {
+		err := filepath.Walk(filepath.Join(r.WorkTree, filepath.FromSlash(root)), func(absPath string, info fs.FileInfo, err error) error {
+			if err != nil {
+				if os.IsNotExist(err) && absPath != r.WorkTree {
+					return nil
+				}
+				return err
+			}
+			if absPath == r.WorkTree {
+				return nil
+			}
+			path, err := filepath.Rel(r.WorkTree, absPath)
+			if err != nil {
+				return err
+			}
+			// Ignored directories are still searched for tracked files.
+			isIgnored := ignored != nil && !trackedPaths[path] && ignored.Ignored(path, info.IsDir())
+			if info.IsDir() {
+				if absPath == r.GitDir || info.Name() == ".git" {
+					return filepath.SkipDir
+				}
+				if isIgnored {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if info.Mode().IsRegular() && !isIgnored && spec.Match(path) {
+				files[path] = info
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return files, nil
+}
+
+type IgnoreMatch struct {
+	// The path as it was given.
+	Path string
+	// The rule deciding whether the path is ignored, nil if no rule matches.
+	Rule *ignore.Rule
+}
+
+// Reports whether the path is ignored.
+func (m IgnoreMatch) Ignored() bool {
+	return m.Rule != nil && !m.Rule.Negate
+}
+
+// Finds the rule that decides whether each path is ignored. Tracked files
+// are never ignored, unless noIndex is set.
+func (r *Repository) CheckIgnore(paths []string, noIndex bool) ([]IgnoreMatch, error) {
+	ignored, err := r.Ignore()
+	if err != nil {
+		return nil, err
+	}
+	tracked := make(map[string]bool)
+	if !noIndex {
+		entries, err := index.ReadIndex(r.IndexPath())
+		if err != nil {
+			return nil, err
+		}
+		for _, entry := range entries {
+			tracked[entry.Path] = true
+		}
+	}
+
+	matches := make([]IgnoreMatch, 0, len(paths))
+	for _, arg := range paths {
+		path, err := r.RepoPath(arg)
+		if err != nil {
+			return nil, err
+		}
+		match := IgnoreMatch{Path: arg}
+		if !tracked[path] && path != "." {
+			isDir := strings.HasSuffix(filepath.ToSlash(arg), "/")
+			if info, err := os.Stat(filepath.Join(r.WorkTree, path)); err == nil {
+				isDir = info.IsDir()
+			}
+			match.Rule = ignored.Match(path, isDir)
+		}
+		matches = append(matches, match)
+	}
+	return matches, nil
+}
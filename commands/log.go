@@ -0,0 +1,766 @@
+package commands
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/f1-surya/git-go/commit"
+	"github.com/f1-surya/git-go/diff"
+	"github.com/f1-surya/git-go/pathspec"
+	"github.com/f1-surya/git-go/refs"
+	"github.com/f1-surya/git-go/tree"
+)
+
+// The date format of git log.
+const logDateFormat = "Mon Jan 2 15:04:05 2006 -0700"
+
+type LogOptions struct {
+	// Revisions and ranges like A..B or ^A to list, HEAD if none.
+	Revisions []string
+	// Only commits that change files matching these paths are listed.
+	Paths []string
+	// At most this many commits are listed, all of them if 0.
+	MaxCount int
+	// Only commits with a committer date after Since and before Until, when
+	// they're set.
+	Since, Until time.Time
+	// Regular expressions the author's "Name <email>" and the message must
+	// match, when they're set.
+	Author, Grep string
+	// oneline, short, medium, full, fuller, or format:<template> with
+	// placeholders like %h and %s. "" is medium.
+	Format string
+	// Shows abbreviated hashes in the commit lines.
+	AbbrevCommit bool
+	// Draws the history as a graph next to the commits.
+	Graph bool
+	// Shows the files changed by every commit that isn't a merge, with the
+	// number of changed lines.
+	Stat bool
+	// Shows the changes of every commit that isn't a merge as a unified diff.
+	Patch bool
+}
+
+// The compiled filters of a log.
+type logFilter struct {
+	opts   LogOptions
+	spec   pathspec.Pathspec
+	author *regexp.Regexp
+	grep   *regexp.Regexp
+}
+
+// Prints the commits, newest first. Without a graph, commits are printed as
+// they are read.
+func (r *Repository) Log(opts LogOptions) error {
+	revisions := opts.Revisions
+	if len(revisions) == 0 {
+		if _, err := refs.Resolve(r.GitDir, refs.Head); errors.Is(err, refs.ErrNotFound) {
+			fmt.Fprintln(r.Out, "There are no commits yet")
+			return nil
+		} else if err != nil {
+			return err
+		}
+		revisions = []string{refs.Head}
+	}
+	commitRange, err := r.Revisions().ParseRange(revisions)
+	if err != nil {
+		return err
+	}
+
+	filter := logFilter{opts: opts}
+	if filter.spec, err = r.Pathspec(opts.Paths); err != nil {
+		return err
+	}
+	if opts.Author != "" {
+		if filter.author, err = regexp.Compile(opts.Author); err != nil {
+			return fmt.Errorf("bad --author pattern: %w", err)
+		}
+	}
+	if opts.Grep != "" {
+		if filter.grep, err = regexp.Compile(opts.Grep); err != nil {
+			return fmt.Errorf("bad --grep pattern: %w", err)
+		}
+	}
+	colored, err := r.useColor("diff")
+	if err != nil {
+		return err
+	}
+
+	walkOpts := commit.WalkOptions{Exclude: commitRange.Exclude}
+	if !opts.Graph {
+		count := 0
+		return commit.Walk(r.Store, commitRange.Include, walkOpts, func(c *commit.Commit) error {
+			if opts.MaxCount > 0 && count == opts.MaxCount {
+				return commit.ErrStopWalk
+			}
+			if shown, err := r.logShows(c, filter); err != nil || !shown {
+				return err
+			}
+			text, err := r.logEntry(c, opts, colored)
+			if err != nil {
+				return err
+			}
+			if count > 0 && logSeparated(opts) {
+				fmt.Fprintln(r.Out)
+			}
+			count++
+			_, err = r.Out.Write(text)
+			return err
+		})
+	}
+
+	// The graph needs the parents of every commit among the listed ones, so
+	// the whole history is read first, children before their parents.
+	walkOpts.Order = commit.OrderTopo
+	var walked []*commit.Commit
+	shown := make(map[string]bool)
+	err = commit.Walk(r.Store, commitRange.Include, walkOpts, func(c *commit.Commit) error {
+		walked = append(walked, c)
+		ok, err := r.logShows(c, filter)
+		shown[c.Hash] = ok
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	parents := rewriteParents(walked, shown)
+
+	g := &graph{}
+	count := 0
+	for _, c := range walked {
+		if !shown[c.Hash] {
+			continue
+		}
+		if opts.MaxCount > 0 && count == opts.MaxCount {
+			break
+		}
+		text, err := r.logEntry(c, opts, colored)
+		if err != nil {
+			return err
+		}
+		if count > 0 && logSeparated(opts) {
+			fmt.Fprintln(r.Out, strings.TrimRight(g.padding(), " "))
+		}
+		count++
+		g.write(r.Out, c.Hash, parents[c.Hash], text)
+	}
+	return nil
+}
+
+// Reports whether the commits are separated by blank lines, which is the case
+// for the formats that take several lines.
+func logSeparated(opts LogOptions) bool {
+	return opts.Format != "oneline" && !strings.HasPrefix(opts.Format, "tformat:") &&
+		!strings.HasPrefix(opts.Format, "format:") && !strings.Contains(opts.Format, "%")
+}
+
+// Reports whether the commit passes the filters of the log.
+func (r *Repository) logShows(c *commit.Commit, filter logFilter) (bool, error) {
+	opts := filter.opts
+	if !opts.Since.IsZero() && c.Committer.When.Before(opts.Since) {
+		return false, nil
+	}
+	if !opts.Until.IsZero() && c.Committer.When.After(opts.Until) {
+		return false, nil
+	}
+	if filter.author != nil && !filter.author.MatchString(c.Author.Identity()) {
+		return false, nil
+	}
+	if filter.grep != nil && !filter.grep.MatchString(c.Message) {
+		return false, nil
+	}
+	if len(opts.Paths) == 0 {
+		return true, nil
+	}
+
+	// Like in git, a commit is left out when it has a parent with the same
+	// version of the files, so merges that take them from one side are too.
+	parents := c.Parents
+	if len(parents) == 0 {
+		parents = []string{""}
+	}
+	for _, parent := range parents {
+		parentTree := ""
+		if parent != "" {
+			p, err := commit.ParseCommit(r.Store, parent)
+			if err != nil {
+				return false, err
+			}
+			parentTree = p.Tree
+		}
+		changes, err := tree.Diff(r.Store, parentTree, c.Tree, tree.DiffOptions{})
+		if err != nil {
+			return false, err
+		}
+		if len(filter.matching(changes)) == 0 {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// Returns the changes to files that match the paths of the log.
+func (f logFilter) matching(changes []tree.Change) []tree.Change {
+	if len(f.opts.Paths) == 0 {
+		return changes
+	}
+	var matching []tree.Change
+	for _, change := range changes {
+		if f.spec.Match(filepath.ToSlash(change.OldPath)) || f.spec.Match(filepath.ToSlash(change.NewPath)) {
+			matching = append(matching, change)
+		}
+	}
+	return matching
+}
+
+// Returns the parents of every listed commit among the listed commits: a
+// parent that isn't listed is replaced by its nearest listed ancestors. The
+// commits are children first.
+func rewriteParents(commits []*commit.Commit, shown map[string]bool) map[string][]string {
+	// The nearest listed commits from every commit, itself if it's listed.
+	nearest := make(map[string][]string)
+	parents := make(map[string][]string)
+	for i := len(commits) - 1; i >= 0; i-- {
+		c := commits[i]
+		var rewritten []string
+		seen := make(map[string]bool)
+		for _, parent := range c.Parents {
+			for _, hash := range nearest[parent] {
+				if !seen[hash] {
+					seen[hash] = true
+					rewritten = append(rewritten, hash)
+				}
+			}
+		}
+		if shown[c.Hash] {
+			parents[c.Hash] = rewritten
+			nearest[c.Hash] = []string{c.Hash}
+		} else {
+			nearest[c.Hash] = rewritten
+		}
+	}
+	return parents
+}
+
+// Returns the text printed for the commit: its header in the format of the
+// log, followed by the stat or patch.
+func (r *Repository) logEntry(c *commit.Commit, opts LogOptions, colored bool) ([]byte, error) {
+	color := colorizer(colored)
+	var buf bytes.Buffer
+	hash := c.Hash
+	if opts.AbbrevCommit {
+		hash = hash[:7]
+	}
+
+	message := strings.TrimRight(c.Message, "\n")
+	indented := func() {
+		buf.WriteString("\n")
+		for _, line := range strings.Split(message, "\n") {
+			if line != "" {
+				line = "    " + line
+			}
+			buf.WriteString(line + "\n")
+		}
+	}
+	header := func() {
+		buf.WriteString(color(colorYellow, "commit "+hash) + "\n")
+		if len(c.Parents) > 1 {
+			abbrevs := make([]string, len(c.Parents))
+			for i, parent := range c.Parents {
+				abbrevs[i] = parent[:7]
+			}
+			fmt.Fprintf(&buf, "Merge: %s\n", strings.Join(abbrevs, " "))
+		}
+	}
+	format := opts.Format
+	switch {
+	case format == "oneline":
+		fmt.Fprintf(&buf, "%s %s\n", color(colorYellow, hash), commitSubject(c.Message))
+	case format == "short":
+		header()
+		fmt.Fprintf(&buf, "Author: %s\n\n", c.Author.Identity())
+		fmt.Fprintf(&buf, "    %s\n", commitSubject(c.Message))
+	case format == "" || format == "medium":
+		header()
+		fmt.Fprintf(&buf, "Author: %s\n", c.Author.Identity())
+		fmt.Fprintf(&buf, "Date:   %s\n", c.Author.When.Format(logDateFormat))
+		indented()
+	case format == "full":
+		header()
+		fmt.Fprintf(&buf, "Author: %s\n", c.Author.Identity())
+		fmt.Fprintf(&buf, "Commit: %s\n", c.Committer.Identity())
+		indented()
+	case format == "fuller":
+		header()
+		fmt.Fprintf(&buf, "Author:     %s\n", c.Author.Identity())
+		fmt.Fprintf(&buf, "AuthorDate: %s\n", c.Author.When.Format(logDateFormat))
+		fmt.Fprintf(&buf, "Commit:     %s\n", c.Committer.Identity())
+		fmt.Fprintf(&buf, "CommitDate: %s\n", c.Committer.When.Format(logDateFormat))
+		indented()
+	default:
+		template, ok := strings.CutPrefix(format, "format:")
+		if !ok {
+			template, ok = strings.CutPrefix(format, "tformat:")
+		}
+		if !ok && !strings.Contains(format, "%") {
+			return nil, fmt.Errorf("unknown log format %q", format)
+		}
+		buf.WriteString(expandFormat(template, c, colored, time.Now()) + "\n")
+	}
+
+	if (!opts.Stat && !opts.Patch) || len(c.Parents) > 1 {
+		return buf.Bytes(), nil
+	}
+	parentTree := ""
+	if len(c.Parents) == 1 {
+		parent, err := commit.ParseCommit(r.Store, c.Parents[0])
+		if err != nil {
+			return nil, err
+		}
+		parentTree = parent.Tree
+	}
+	renames, err := r.renameOptions(DiffOptions{})
+	if err != nil {
+		return nil, err
+	}
+	changes, err := tree.Diff(r.Store, parentTree, c.Tree, renames)
+	if err != nil {
+		return nil, err
+	}
+	if len(changes) == 0 {
+		return buf.Bytes(), nil
+	}
+	if logSeparated(opts) {
+		buf.WriteString("\n")
+	}
+	if opts.Stat {
+		if err := r.writeStat(&buf, changes, color); err != nil {
+			return nil, err
+		}
+		if opts.Patch {
+			buf.WriteString("\n")
+		}
+	}
+	if opts.Patch {
+		if err := r.writeDiff(&buf, changes, nil, DiffOptions{Context: -1}); err != nil {
+			return nil, err
+		}
+	}
+	return buf.Bytes(), nil
+}
+
+// Returns the first paragraph of the message on one line, like %s.
+func commitSubject(message string) string {
+	paragraph, _, _ := strings.Cut(strings.TrimLeft(message, "\n"), "\n\n")
+	return strings.Join(strings.Fields(strings.ReplaceAll(paragraph, "\n", " ")), " ")
+}
+
+// Returns the message after its first paragraph, like %b.
+func commitBody(message string) string {
+	_, body, _ := strings.Cut(strings.TrimLeft(message, "\n"), "\n\n")
+	body = strings.TrimLeft(body, "\n")
+	if body != "" && !strings.HasSuffix(body, "\n") {
+		body += "\n"
+	}
+	return body
+}
+
+var formatColors = map[string]string{
+	"red":    colorRed,
+	"green":  colorGreen,
+	"yellow": colorYellow,
+	"blue":   colorBlue,
+	"cyan":   colorCyan,
+	"bold":   colorBold,
+	"reset":  colorReset,
+}
+
+// Expands the placeholders of a --format template for the commit:
+//
+//	%H %h      commit hash, abbreviated
+//	%T %t      tree hash, abbreviated
+//	%P %p      parent hashes, abbreviated
+//	%an %ae    author name and email, %cn and %ce for the committer
+//	%ad %ar    author date and relative date, %at as a timestamp and %ai in
+//	           ISO 8601, %aI strictly; %cd, %cr, %ct, %ci, %cI for the committer
+//	%s %b %B   subject, body and raw message
+//	%n %%      newline and %
+//	%Cred %Cgreen %Cblue %Creset, %C(<color>)   colors, when they're enabled
+//
+// Unknown placeholders are kept as they are.
+func expandFormat(template string, c *commit.Commit, colored bool, now time.Time) string {
+	var out strings.Builder
+	for i := 0; i < len(template); i++ {
+		if template[i] != '%' || i+1 == len(template) {
+			out.WriteByte(template[i])
+			continue
+		}
+		rest := template[i+1:]
+		value, n := "", 0
+		switch {
+		case strings.HasPrefix(rest, "C("):
+			if end := strings.IndexByte(rest, ')'); end != -1 {
+				value, n = formatColors[rest[2:end]], end+1
+			}
+		case strings.HasPrefix(rest, "Cred"):
+			value, n = colorRed, 4
+		case strings.HasPrefix(rest, "Cgreen"):
+			value, n = colorGreen, 6
+		case strings.HasPrefix(rest, "Cblue"):
+			value, n = colorBlue, 5
+		case strings.HasPrefix(rest, "Creset"):
+			value, n = colorReset, 6
+		case rest[0] == 'x' && len(rest) > 2:
+			if b, err := strconv.ParseUint(rest[1:3], 16, 8); err == nil {
+				value, n = string([]byte{byte(b)}), 3
+			}
+		case rest[0] == 'a' || rest[0] == 'c':
+			if len(rest) > 1 {
+				sig := c.Author
+				if rest[0] == 'c' {
+					sig = c.Committer
+				}
+				value, n = signaturePlaceholder(sig, rest[1], now), 2
+				if value == "" && rest[1] != 'n' && rest[1] != 'e' {
+					n = 0
+				}
+			}
+		default:
+			n = 1
+			switch rest[0] {
+			case 'H':
+				value = c.Hash
+			case 'h':
+				value = c.Hash[:7]
+			case 'T':
+				value = c.Tree
+			case 't':
+				value = c.Tree[:7]
+			case 'P':
+				value = strings.Join(c.Parents, " ")
+			case 'p':
+				abbrevs := make([]string, len(c.Parents))
+				for i, parent := range c.Parents {
+					abbrevs[i] = parent[:7]
+				}
+				value = strings.Join(abbrevs, " ")
+			case 's':
+				value = commitSubject(c.Message)
+			case 'b':
+				value = commitBody(c.Message)
+			case 'B':
+				value = c.Message
+			case 'n':
+				value = "\n"
+			case '%':
+				value = "%"
+			default:
+				n = 0
+			}
+		}
+		if n == 0 {
+			out.WriteByte('%')
+			continue
+		}
+		// Colors are left out when they're disabled.
+		if rest[0] == 'C' && !colored {
+			value = ""
+		}
+		out.WriteString(value)
+		i += n
+	}
+	return out.String()
+}
+
+// Returns the value of the %a<field> or %c<field> placeholder, "" for an
+// unknown field.
+func signaturePlaceholder(sig commit.Signature, field byte, now time.Time) string {
+	switch field {
+	case 'n':
+		return sig.Name
+	case 'e':
+		return sig.Email
+	case 'd':
+		return sig.When.Format(logDateFormat)
+	case 'r':
+		return relativeDate(sig.When, now)
+	case 't':
+		return strconv.FormatInt(sig.When.Unix(), 10)
+	case 'i':
+		return sig.When.Format("2006-01-02 15:04:05 -0700")
+	case 'I':
+		return sig.When.Format(time.RFC3339)
+	}
+	return ""
+}
+
+// Returns how long before now the date was, like "3 days ago".
+func relativeDate(when, now time.Time) string {
+	seconds := int64(now.Sub(when) / time.Second)
+	if seconds < 0 {
+		return "in the future"
+	}
+	plural := func(n int64, unit string) string {
+		if n == 1 {
+			return fmt.Sprintf("%d %s ago", n, unit)
+		}
+		return fmt.Sprintf("%d %ss ago", n, unit)
+	}
+	days := seconds / 86400
+	switch {
+	case seconds < 90:
+		return plural(seconds, "second")
+	case seconds < 90*60:
+		return plural((seconds+30)/60, "minute")
+	case seconds < 36*3600:
+		return plural((seconds+1800)/3600, "hour")
+	case days < 14:
+		return plural(days, "day")
+	case days < 70:
+		return plural((days+3)/7, "week")
+	case days < 365:
+		return plural((days+15)/30, "month")
+	}
+	return plural((days+183)/365, "year")
+}
+
+// Parses the date of --since or --until: a date ParseDate accepts, YYYY-MM-DD
+// with an optional HH:MM:SS, a unix timestamp, "now", "yesterday", "<n>
+// <unit>s ago" or a period like "2w" before now.
+func ParseApproxDate(value string, now time.Time) (time.Time, error) {
+	value = strings.TrimSpace(value)
+	if when, err := commit.ParseDate(value); err == nil {
+		return when, nil
+	}
+	for _, layout := range []string{"2006-01-02 15:04:05", "2006-01-02T15:04:05", "2006-01-02"} {
+		if when, err := time.ParseInLocation(layout, value, now.Location()); err == nil {
+			return when, nil
+		}
+	}
+	if seconds, err := strconv.ParseInt(strings.TrimPrefix(value, "@"), 10, 64); err == nil {
+		return time.Unix(seconds, 0), nil
+	}
+	switch value {
+	case "now":
+		return now, nil
+	case "yesterday":
+		return now.AddDate(0, 0, -1), nil
+	}
+
+	fields := strings.Fields(strings.ReplaceAll(value, ".", " "))
+	if len(fields) == 3 && fields[2] == "ago" {
+		n, err := strconv.Atoi(fields[0])
+		if err == nil && n >= 0 {
+			switch strings.TrimSuffix(fields[1], "s") {
+			case "second":
+				return now.Add(-time.Duration(n) * time.Second), nil
+			case "minute":
+				return now.Add(-time.Duration(n) * time.Minute), nil
+			case "hour":
+				return now.Add(-time.Duration(n) * time.Hour), nil
+			case "day":
+				return now.AddDate(0, 0, -n), nil
+			case "week":
+				return now.AddDate(0, 0, -7*n), nil
+			case "month":
+				return now.AddDate(0, -n, 0), nil
+			case "year":
+				return now.AddDate(-n, 0, 0), nil
+			}
+		}
+	}
+	if period, err := ParseExpire(value); err == nil {
+		return now.Add(-period), nil
+	}
+	return time.Time{}, fmt.Errorf("unknown date %q", value)
+}
+
+// Writes the files that changed with the number of added and removed lines,
+// like git diff --stat.
+func (r *Repository) writeStat(w io.Writer, changes []tree.Change, color func(string, string) string) error {
+	type fileStat struct {
+		name             string
+		added, removed   int
+		binary           bool
+		oldSize, newSize int
+	}
+	stats := make([]fileStat, len(changes))
+	nameWidth, mostChanges, insertions, deletions := 0, 0, 0, 0
+	for i, change := range changes {
+		stat := fileStat{name: filepath.ToSlash(change.Path())}
+		if change.Type == tree.Renamed || change.Type == tree.Copied {
+			stat.name = filepath.ToSlash(change.OldPath) + " => " + filepath.ToSlash(change.NewPath)
+		}
+		oldContent, err := r.fileContent(change.Old, nil)
+		if err != nil {
+			return err
+		}
+		newContent, err := r.fileContent(change.New, nil)
+		if err != nil {
+			return err
+		}
+		if diff.IsBinary(oldContent) || diff.IsBinary(newContent) {
+			stat.binary, stat.oldSize, stat.newSize = true, len(oldContent), len(newContent)
+		} else {
+			for _, e := range diff.Diff(diff.Lines(oldContent), diff.Lines(newContent), diff.Myers) {
+				switch e.Op {
+				case diff.Insert:
+					stat.added++
+				case diff.Delete:
+					stat.removed++
+				}
+			}
+		}
+		insertions += stat.added
+		deletions += stat.removed
+		nameWidth = max(nameWidth, len(stat.name))
+		mostChanges = max(mostChanges, stat.added+stat.removed)
+		stats[i] = stat
+	}
+
+	countWidth := len(strconv.Itoa(mostChanges))
+	for _, stat := range stats {
+		if stat.binary {
+			countWidth = max(countWidth, len("Bin"))
+		}
+	}
+	// The bars are scaled down to fit in 80 columns.
+	barWidth := max(80-nameWidth-countWidth-5, 10)
+	scale := func(n int) int {
+		if mostChanges <= barWidth || n == 0 {
+			return n
+		}
+		return max(n*barWidth/mostChanges, 1)
+	}
+	for _, stat := range stats {
+		if stat.binary {
+			fmt.Fprintf(w, " %-*s | %*s %d -> %d bytes\n", nameWidth, stat.name, countWidth, "Bin", stat.oldSize, stat.newSize)
+			continue
+		}
+		bar := color(colorGreen, strings.Repeat("+", scale(stat.added))) + color(colorRed, strings.Repeat("-", scale(stat.removed)))
+		if stat.added == 0 && stat.removed == 0 {
+			bar = ""
+		}
+		line := fmt.Sprintf(" %-*s | %*d %s", nameWidth, stat.name, countWidth, stat.added+stat.removed, bar)
+		fmt.Fprintln(w, strings.TrimRight(line, " "))
+	}
+
+	summary := fmt.Sprintf(" %d file%s changed", len(stats), pluralS(len(stats)))
+	if insertions > 0 || deletions == 0 {
+		summary += fmt.Sprintf(", %d insertion%s(+)", insertions, pluralS(insertions))
+	}
+	if deletions > 0 || insertions == 0 {
+		summary += fmt.Sprintf(", %d deletion%s(-)", deletions, pluralS(deletions))
+	}
+	_, err := fmt.Fprintln(w, summary)
+	return err
+}
+
+func pluralS(n int) string {
+	if n == 1 {
+		return ""
+	}
+	return "s"
+}
+
+// Draws the lines of history next to the commits of a log, like git log
+// --graph. Every column is a line of history waiting for the commit in it.
+type graph struct {
+	columns []string
+}
+
+// Returns the prefix of the lines between commits.
+func (g *graph) padding() string {
+	return strings.Repeat("| ", len(g.columns))
+}
+
+// Writes the commit's text next to its row of the graph, followed by the
+// lines that lead to its parents.
+func (g *graph) write(w io.Writer, hash string, parents []string, text []byte) {
+	idx := -1
+	for i, column := range g.columns {
+		if column == hash {
+			idx = i
+			break
+		}
+	}
+	if idx == -1 {
+		g.columns = append(g.columns, hash)
+		idx = len(g.columns) - 1
+	}
+	old := g.columns
+
+	// The commit's column continues with its parents that aren't waited for
+	// in another column already.
+	next := append([]string{}, old[:idx]...)
+	for _, parent := range parents {
+		if !slices.Contains(old, parent) && !slices.Contains(next, parent) {
+			next = append(next, parent)
+		}
+	}
+	next = append(next, old[idx+1:]...)
+	position := make(map[string]int)
+	for i, column := range next {
+		position[column] = i
+	}
+
+	width := 2 * max(len(old), len(next))
+	row := []byte(strings.Repeat("| ", len(old)))
+	row[2*idx] = '*'
+	connector := bytes.Repeat([]byte(" "), width)
+	straight := true
+	for i, column := range old {
+		targets := []string{column}
+		if i == idx {
+			targets = parents
+		}
+		for _, target := range targets {
+			j := position[target]
+			switch {
+			case j == i:
+				connector[2*i] = '|'
+			case j < i:
+				connector[2*i-1] = '/'
+				straight = false
+			default:
+				connector[2*i+1] = '\\'
+				straight = false
+			}
+		}
+	}
+	g.columns = next
+
+	prefixes := []string{padTo(string(row), width)}
+	if !straight {
+		prefixes = append(prefixes, string(connector))
+	}
+	lines := strings.Split(strings.TrimSuffix(string(text), "\n"), "\n")
+	for len(lines) < len(prefixes) {
+		lines = append(lines, "")
+	}
+	for i, line := range lines {
+		prefix := padTo(g.padding(), width)
+		if i < len(prefixes) {
+			prefix = prefixes[i]
+		}
+		if line == "" {
+			prefix = strings.TrimRight(prefix, " ")
+		}
+		fmt.Fprintln(w, prefix+line)
+	}
+}
+
+func padTo(s string, width int) string {
+	if len(s) >= width {
+		return s
+	}
+	return s + strings.Repeat(" ", width-len(s))
+}
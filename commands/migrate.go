@@ -0,0 +1,196 @@
+package commands
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"github.com/f1-surya/git-go/commit"
+	"github.com/f1-surya/git-go/index"
+	"github.com/f1-surya/git-go/object"
+	"github.com/f1-surya/git-go/refs"
+	"github.com/f1-surya/git-go/tree"
+)
+
+// An object written by older versions of git-go, stored as objects/<last two chars>/<full hash>.
+type legacyObject struct {
+	objType string
+	content []byte
+	path    string
+}
+
+// Returns the type and content of an object in the legacy format. Trees were written with
+// a "tree <n>\0" header, commits with "commit <n>\n" and blobs without any header.
+func parseLegacyObject(data []byte) (string, []byte) {
+	for _, header := range []struct {
+		objType    string
+		terminator byte
+	}{
+		{object.TypeTree, 0},
+		{object.TypeCommit, '\n'},
+	} {
+		prefix := []byte(header.objType + " ")
+		if !bytes.HasPrefix(data, prefix) {
+			continue
+		}
+		end := bytes.IndexByte(data, header.terminator)
+		if end == -1 {
+			continue
+		}
+		size, err := strconv.Atoi(string(data[len(prefix):end]))
+		if err == nil && size == len(data)-end-1 {
+			return header.objType, data[end+1:]
+		}
+	}
+	return object.TypeBlob, data
+}
+
+// Rewrites the objects of a repository created by older versions of git-go into Git's
+// loose object format. Every object gets a typed header and moves to objects/ab/cdef...,
+// which changes the hash of every object, so trees, commits, refs and the index are
+// rewritten to point at the new hashes.
+func (r *Repository) Migrate() error {
+	store, ok := r.Store.(*object.LooseStore)
+	if !ok {
+		return errors.New("only repositories using loose objects can be migrated")
+	}
+	legacy := make(map[string]legacyObject)
+
+	err := filepath.WalkDir(store.Dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		name := d.Name()
+		if d.IsDir() || len(name) != 40 || filepath.Base(filepath.Dir(path)) != name[38:] {
+			return nil
+		}
+		compressed, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		data, err := object.Inflate(compressed)
+		if err != nil {
+			return fmt.Errorf("could not decompress %s: %w", path, err)
+		}
+		objType, content := parseLegacyObject(data)
+		legacy[name] = legacyObject{objType: objType, content: content, path: path}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if len(legacy) == 0 {
+		fmt.Fprintln(r.Out, "Nothing to migrate")
+		return nil
+	}
+
+	migrated := make(map[string]string)
+	var migrate func(string) (string, error)
+	migrate = func(oldHash string) (string, error) {
+		if newHash, ok := migrated[oldHash]; ok {
+			return newHash, nil
+		}
+		obj, ok := legacy[oldHash]
+		if !ok {
+			// Either already in the new format or missing, nothing to rewrite.
+			return oldHash, nil
+		}
+
+		content := obj.content
+		switch obj.objType {
+		case object.TypeTree:
+			oldTree, err := tree.ParseTree(content)
+			if err != nil {
+				return "", fmt.Errorf("could not parse tree %s: %w", oldHash, err)
+			}
+			newTree := tree.Tree{}
+			for _, child := range oldTree.Children {
+				childHash, err := migrate(hex.EncodeToString(child.Hash))
+				if err != nil {
+					return "", err
+				}
+				child.Hash, _ = hex.DecodeString(childHash)
+				newTree.Children = append(newTree.Children, child)
+			}
+			content = newTree.GetBlob()
+			content = content[bytes.IndexByte(content, 0)+1:]
+		case object.TypeCommit:
+			// Old commits are rewritten in Git's commit format on the way.
+			c, err := commit.Parse(oldHash, content)
+			if err != nil {
+				return "", fmt.Errorf("could not parse commit %s: %w", oldHash, err)
+			}
+			if c.Tree, err = migrate(c.Tree); err != nil {
+				return "", err
+			}
+			for i, parent := range c.Parents {
+				if c.Parents[i], err = migrate(parent); err != nil {
+					return "", err
+				}
+			}
+			content = c.ToBytes()
+		}
+
+		newHash, err := store.Put(obj.objType, content)
+		if err != nil {
+			return "", err
+		}
+		migrated[oldHash] = newHash
+		return newHash, nil
+	}
+
+	for oldHash := range legacy {
+		if _, err := migrate(oldHash); err != nil {
+			return err
+		}
+	}
+
+	tips, err := r.refTips()
+	if err != nil {
+		return err
+	}
+	reason, err := r.reason("migrate: rewrite objects in git's format")
+	if err != nil {
+		return err
+	}
+	for name, oldHash := range tips {
+		if newHash, ok := migrated[oldHash]; ok {
+			if err := refs.UpdateNoDeref(r.GitDir, name, newHash, oldHash, reason, r.LockOptions); err != nil {
+				return err
+			}
+		}
+	}
+
+	entries, err := index.ReadIndex(r.IndexPath())
+	if err != nil {
+		return err
+	}
+	for i, entry := range entries {
+		newHash, err := migrate(hex.EncodeToString(entry.Hash[:]))
+		if err != nil {
+			return err
+		}
+		hash, _ := hex.DecodeString(newHash)
+		copy(entries[i].Hash[:], hash)
+	}
+	if err := index.WriteIndex(r.IndexPath(), entries); err != nil {
+		return err
+	}
+
+	for _, obj := range legacy {
+		if err := os.Remove(obj.path); err != nil {
+			return err
+		}
+		// Only succeeds once the old fan-out directory is empty.
+		os.Remove(filepath.Dir(obj.path))
+	}
+
+	fmt.Fprintf(r.Out, "Migrated %d objects\n", len(legacy))
+	return nil
+}
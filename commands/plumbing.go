@@ -0,0 +1,315 @@
+package commands
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/f1-surya/git-go/commit"
+	"github.com/f1-surya/git-go/index"
+	"github.com/f1-surya/git-go/object"
+	"github.com/f1-surya/git-go/refs"
+	"github.com/f1-surya/git-go/tag"
+	"github.com/f1-surya/git-go/tree"
+)
+
+// Prints what mode asks for about the object: its type for -t, its size for -s
+// and its content for -p, with trees listed like ls-tree. -e prints nothing and
+// fails if the object doesn't exist. A type, like blob, prints the content of
+// the object of that type, following tags and commits to their tree.
+func (r *Repository) CatFile(mode, rev string) error {
+	if mode == "-e" {
+		_, err := r.Revisions().Resolve(rev)
+		return err
+	}
+	switch mode {
+	case "-t", "-s", "-p":
+	case object.TypeBlob, object.TypeTree, object.TypeCommit, object.TypeTag:
+		hash, err := r.Revisions().ResolveType(rev, mode)
+		if err != nil {
+			return err
+		}
+		_, content, err := r.Store.Get(hash)
+		if err != nil {
+			return err
+		}
+		_, err = r.Out.Write(content)
+		return err
+	default:
+		return fmt.Errorf("unknown cat-file mode %q", mode)
+	}
+
+	hash, err := r.Revisions().Resolve(rev)
+	if err != nil {
+		return err
+	}
+	if mode != "-p" {
+		objType, size, err := r.Store.Stat(hash)
+		if err != nil {
+			return err
+		}
+		if mode == "-t" {
+			_, err = fmt.Fprintln(r.Out, objType)
+		} else {
+			_, err = fmt.Fprintln(r.Out, size)
+		}
+		return err
+	}
+
+	objType, content, err := r.Store.Get(hash)
+	if err != nil {
+		return err
+	}
+	if objType == object.TypeTree {
+		t, err := tree.ParseTree(content)
+		if err != nil {
+			return err
+		}
+		return r.writeTreeEntries(t.Children, "")
+	}
+	_, err = r.Out.Write(content)
+	return err
+}
+
+// Reads revisions from in, one per line, and prints "<hash> <type> <size>"
+// for each followed by the content and a newline, or "<rev> missing" if it
+// doesn't exist. check leaves out the content, like --batch-check.
+func (r *Repository) CatFileBatch(in io.Reader, check bool) error {
+	out := bufio.NewWriter(r.Out)
+	resolver := r.Revisions()
+	scanner := bufio.NewScanner(in)
+	for scanner.Scan() {
+		rev := scanner.Text()
+		hash, err := resolver.Resolve(rev)
+		if err != nil {
+			fmt.Fprintf(out, "%s missing\n", rev)
+			continue
+		}
+		if check {
+			objType, size, err := r.Store.Stat(hash)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(out, "%s %s %d\n", hash, objType, size)
+			continue
+		}
+		objType, content, err := r.Store.Get(hash)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "%s %s %d\n", hash, objType, len(content))
+		out.Write(content)
+		out.WriteByte('\n')
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	return out.Flush()
+}
+
+// Returns the hash of content as an object of the given type, "" is blob, and
+// stores it when write is true. Trees, commits and tags must parse.
+func (r *Repository) HashObject(objType string, content []byte, write bool) (string, error) {
+	var err error
+	switch objType {
+	case "", object.TypeBlob:
+		objType = object.TypeBlob
+	case object.TypeTree:
+		_, err = tree.ParseTree(content)
+	case object.TypeCommit:
+		_, err = commit.Parse("", content)
+	case object.TypeTag:
+		_, err = tag.Parse("", content)
+	default:
+		return "", fmt.Errorf("unknown object type %q", objType)
+	}
+	if err != nil {
+		return "", fmt.Errorf("invalid %s: %w", objType, err)
+	}
+	if !write {
+		return object.Hash(objType, content), nil
+	}
+	return r.Store.Put(objType, content)
+}
+
+type LsTreeOptions struct {
+	// The tree to list, or a commit or tag pointing to one.
+	Tree string
+	// Lists the files of subtrees instead of the subtrees.
+	Recursive bool
+	// Adds the size of blobs, "-" for the others.
+	Long bool
+	// Prints only the paths.
+	NameOnly bool
+}
+
+// Prints the entries of the tree as "<mode> <type> <hash>\t<path>".
+func (r *Repository) LsTree(opts LsTreeOptions) error {
+	hash, err := r.Revisions().ResolveType(opts.Tree, object.TypeTree)
+	if err != nil {
+		return err
+	}
+	out := bufio.NewWriter(r.Out)
+	if err := r.lsTree(out, hash, "", opts); err != nil {
+		return err
+	}
+	return out.Flush()
+}
+
+func (r *Repository) lsTree(w io.Writer, hash, dir string, opts LsTreeOptions) error {
+	t, err := tree.ParseTreeObject(r.Store, hash)
+	if err != nil {
+		return err
+	}
+	for _, entry := range t.Children {
+		entryHash := fmt.Sprintf("%x", entry.Hash)
+		if opts.Recursive && entry.Mode == object.ModeDirectory {
+			if err := r.lsTree(w, entryHash, dir+entry.Name+"/", opts); err != nil {
+				return err
+			}
+			continue
+		}
+		if opts.NameOnly {
+			fmt.Fprintf(w, "%s%s\n", dir, entry.Name)
+			continue
+		}
+		objType := entryType(entry.Mode)
+		if !opts.Long {
+			fmt.Fprintf(w, "%06o %s %s\t%s%s\n", entry.Mode, objType, entryHash, dir, entry.Name)
+			continue
+		}
+		size := "-"
+		if objType == object.TypeBlob {
+			_, n, err := r.Store.Stat(entryHash)
+			if err != nil {
+				return err
+			}
+			size = fmt.Sprint(n)
+		}
+		fmt.Fprintf(w, "%06o %s %s %7s\t%s%s\n", entry.Mode, objType, entryHash, size, dir, entry.Name)
+	}
+	return nil
+}
+
+type LsFilesOptions struct {
+	// Limits the files to these paths, relative to Cwd.
+	Paths []string
+	// Prints "<mode> <hash> <stage>\t<path>" instead of only the path.
+	Stage bool
+}
+
+// Prints the files in the index.
+func (r *Repository) LsFiles(opts LsFilesOptions) error {
+	spec, err := r.Pathspec(opts.Paths)
+	if err != nil {
+		return err
+	}
+	entries, err := index.ReadIndex(r.IndexPath())
+	if err != nil {
+		return err
+	}
+	out := bufio.NewWriter(r.Out)
+	for _, entry := range entries {
+		if !spec.Match(entry.Path) {
+			continue
+		}
+		if opts.Stage {
+			fmt.Fprintf(out, "%06o %x 0\t%s\n", entry.Mode, entry.Hash, entry.Path)
+		} else {
+			fmt.Fprintln(out, entry.Path)
+		}
+	}
+	return out.Flush()
+}
+
+// Writes the trees of the index and returns the hash of the root tree.
+func (r *Repository) WriteTree() (string, error) {
+	entries, err := index.ReadIndex(r.IndexPath())
+	if err != nil {
+		return "", err
+	}
+	return tree.WriteTrees(r.Store, entries)
+}
+
+// Creates a commit of the tree with the given parents and returns its hash.
+// The message is stored as it is, use commit.JoinMessage for -m. No ref is
+// moved.
+func (r *Repository) CommitTree(treeRev string, parents []string, message string) (string, error) {
+	resolver := r.Revisions()
+	treeHash, err := resolver.ResolveType(treeRev, object.TypeTree)
+	if err != nil {
+		return "", err
+	}
+	c := commit.Commit{Tree: treeHash, Message: message}
+	for _, parent := range parents {
+		hash, err := resolver.ResolveCommit(parent)
+		if err != nil {
+			return "", err
+		}
+		c.Parents = append(c.Parents, hash)
+	}
+	if c.Author, c.Committer, err = r.signatures(); err != nil {
+		return "", err
+	}
+	return r.Store.Put(object.TypeCommit, c.ToBytes())
+}
+
+type UpdateRefOptions struct {
+	// The full name of the ref, like refs/heads/main or HEAD.
+	Ref string
+	// The revision to point the ref at.
+	NewValue string
+	// Unless "", the ref must still point at this revision. refs.ZeroHash
+	// means it must not exist.
+	OldValue string
+	// Deletes the ref instead.
+	Delete bool
+	// Replaces a symbolic ref, like HEAD, instead of the ref it points to.
+	NoDeref bool
+	// Recorded in the reflog.
+	Message string
+}
+
+// Points a ref at a revision, or deletes it, without touching the work tree.
+func (r *Repository) UpdateRef(opts UpdateRefOptions) error {
+	resolver := r.Revisions()
+	oldHash := opts.OldValue
+	if oldHash != "" && oldHash != refs.ZeroHash {
+		var err error
+		if oldHash, err = resolver.Resolve(oldHash); err != nil {
+			return err
+		}
+	}
+
+	name := opts.Ref
+	if err := refs.CheckName(name); err != nil {
+		return err
+	}
+	if !opts.NoDeref {
+		target, err := refs.Deref(r.GitDir, name)
+		if err != nil {
+			return err
+		}
+		name = target
+	}
+	if opts.Delete {
+		if _, err := refs.Read(r.GitDir, name); err != nil {
+			if errors.Is(err, refs.ErrNotFound) {
+				return fmt.Errorf("ref %s doesn't exist", name)
+			}
+			return err
+		}
+		return refs.Delete(r.GitDir, name, oldHash, r.LockOptions)
+	}
+
+	hash, err := resolver.Resolve(opts.NewValue)
+	if err != nil {
+		return err
+	}
+	reason, err := r.reason("%s", opts.Message)
+	if err != nil {
+		return err
+	}
+	return refs.UpdateNoDeref(r.GitDir, name, hash, oldHash, reason, r.LockOptions)
+}
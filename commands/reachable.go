@@ -0,0 +1,108 @@
+package commands
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+
+	"github.com/f1-surya/git-go/commit"
+	"github.com/f1-surya/git-go/index"
+	"github.com/f1-surya/git-go/object"
+	"github.com/f1-surya/git-go/refs"
+	"github.com/f1-surya/git-go/tag"
+	"github.com/f1-surya/git-go/tree"
+)
+
+// Returns the hash every ref points to, keyed by the ref name (refs/heads/main).
+// A detached HEAD is included too.
+func (r *Repository) refTips() (map[string]string, error) {
+	tips := make(map[string]string)
+	all, err := refs.List(r.GitDir, "refs/")
+	if err != nil {
+		return nil, err
+	}
+	for _, ref := range all {
+		if !ref.IsSymbolic() {
+			tips[ref.Name] = ref.Hash
+		}
+	}
+	head, err := refs.Read(r.GitDir, refs.Head)
+	if err == nil && !head.IsSymbolic() {
+		tips[refs.Head] = head.Hash
+	} else if err != nil && !errors.Is(err, refs.ErrNotFound) {
+		return nil, err
+	}
+	return tips, nil
+}
+
+// Returns the objects everything else is reachable from: the targets of all
+// refs, the entries of their reflogs and the blobs staged in the index.
+func (r *Repository) roots() ([]string, error) {
+	var roots []string
+	tips, err := r.refTips()
+	if err != nil {
+		return nil, err
+	}
+	for _, hash := range tips {
+		roots = append(roots, hash)
+	}
+	logged, err := r.reflogHashes()
+	if err != nil {
+		return nil, err
+	}
+	roots = append(roots, logged...)
+
+	entries, err := index.ReadIndex(r.IndexPath())
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range entries {
+		roots = append(roots, hex.EncodeToString(entry.Hash[:]))
+	}
+	return roots, nil
+}
+
+// Walks the object graph from roots and returns the type of every reachable object.
+func reachableObjects(store object.ObjectStore, roots []string) (map[string]string, error) {
+	reachable := make(map[string]string)
+	pending := append([]string{}, roots...)
+
+	for len(pending) > 0 {
+		hash := pending[len(pending)-1]
+		pending = pending[:len(pending)-1]
+		if _, ok := reachable[hash]; ok {
+			continue
+		}
+
+		objType, _, err := store.Stat(hash)
+		if err != nil {
+			return nil, fmt.Errorf("reachable object %s is missing: %w", hash, err)
+		}
+		reachable[hash] = objType
+
+		switch objType {
+		case object.TypeCommit:
+			c, err := commit.ParseCommit(store, hash)
+			if err != nil {
+				return nil, err
+			}
+			pending = append(pending, c.Tree)
+			pending = append(pending, c.Parents...)
+		case object.TypeTag:
+			t, err := tag.ParseTag(store, hash)
+			if err != nil {
+				return nil, err
+			}
+			pending = append(pending, t.Object)
+		case object.TypeTree:
+			t, err := tree.ParseTreeObject(store, hash)
+			if err != nil {
+				return nil, err
+			}
+			for _, child := range t.Children {
+				pending = append(pending, hex.EncodeToString(child.Hash))
+			}
+		}
+	}
+	return reachable, nil
+}
@@ -0,0 +1,136 @@
+package commands
+
+import (
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/f1-surya/git-go/refs"
+)
+
+// Reflog entries older than this are removed by gc, unless gc.reflogExpire
+// says otherwise.
+const DefaultReflogExpire = 90 * 24 * time.Hour
+
+// Returns the full name of the ref, HEAD for "", and its reflog, newest first.
+func (r *Repository) Reflog(name string) (string, []refs.LogEntry, error) {
+	if name == "" {
+		name = refs.Head
+	}
+	ref, err := r.Revisions().RefName(name)
+	if err != nil {
+		return "", nil, err
+	}
+	entries, err := refs.ReadLog(r.GitDir, ref)
+	if err != nil {
+		return "", nil, err
+	}
+	slices.Reverse(entries)
+	return ref, entries, nil
+}
+
+// Prints the reflog of the ref, HEAD for "", like git reflog show.
+func (r *Repository) ShowReflog(name string) error {
+	if name == "" {
+		name = refs.Head
+	}
+	_, entries, err := r.Reflog(name)
+	if err != nil {
+		return err
+	}
+	enabled, err := r.useColor("diff")
+	if err != nil {
+		return err
+	}
+	color := colorizer(enabled)
+	resolver := r.Revisions()
+	for i, entry := range entries {
+		hash, err := resolver.Abbrev(entry.New, 7)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(r.Out, "%s %s@{%d}: %s\n", color(colorYellow, hash), name, i, entry.Message)
+	}
+	return nil
+}
+
+// Removes the entries made before cutoff from the reflogs of the refs, of
+// every ref if refNames is nil, and returns how many were removed.
+func (r *Repository) ExpireReflogs(refNames []string, cutoff time.Time) (int, error) {
+	var names []string
+	if refNames == nil {
+		all, err := refs.ListLogs(r.GitDir)
+		if err != nil {
+			return 0, err
+		}
+		names = all
+	}
+	for _, name := range refNames {
+		ref, err := r.Revisions().RefName(name)
+		if err != nil {
+			return 0, err
+		}
+		names = append(names, ref)
+	}
+
+	removed := 0
+	for _, name := range names {
+		entries, err := refs.ReadLog(r.GitDir, name)
+		if err != nil {
+			return removed, err
+		}
+		kept := slices.DeleteFunc(slices.Clone(entries), func(entry refs.LogEntry) bool {
+			return entry.When.Before(cutoff)
+		})
+		if len(kept) == len(entries) {
+			continue
+		}
+		if err := refs.WriteLog(r.GitDir, name, kept, r.LockOptions); err != nil {
+			return removed, err
+		}
+		removed += len(entries) - len(kept)
+	}
+	return removed, nil
+}
+
+// Expires the reflogs before gc, keeping the entries from the duration in
+// gc.reflogExpire, or DefaultReflogExpire. "never" keeps every entry.
+func (r *Repository) expireReflogsForGC() error {
+	value := r.Config.GetString("gc.reflogExpire", "")
+	if value == "never" || value == "false" {
+		return nil
+	}
+	expire := DefaultReflogExpire
+	if value != "" {
+		var err error
+		if expire, err = ParseExpire(value); err != nil {
+			return fmt.Errorf("bad gc.reflogExpire: %w", err)
+		}
+	}
+	_, err := r.ExpireReflogs(nil, time.Now().Add(-expire))
+	return err
+}
+
+// Returns the hashes in every reflog that are still in the store, so the
+// commits a ref used to point to can be recovered until their entry expires.
+func (r *Repository) reflogHashes() ([]string, error) {
+	names, err := refs.ListLogs(r.GitDir)
+	if err != nil {
+		return nil, err
+	}
+	var hashes []string
+	for _, name := range names {
+		entries, err := refs.ReadLog(r.GitDir, name)
+		if err != nil {
+			return nil, err
+		}
+		for _, entry := range entries {
+			for _, hash := range []string{entry.Old, entry.New} {
+				if hash != refs.ZeroHash && r.Store.Has(hash) {
+					hashes = append(hashes, hash)
+				}
+			}
+		}
+	}
+	return hashes, nil
+}
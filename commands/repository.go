@@ -0,0 +1,197 @@
+package commands
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/f1-surya/git-go/config"
+	"github.com/f1-surya/git-go/index"
+	"github.com/f1-surya/git-go/lockfile"
+	"github.com/f1-surya/git-go/object"
+	"github.com/f1-surya/git-go/refs"
+)
+
+// Returned by Discover when neither dir nor its parents contain a repository.
+var ErrNoRepo = errors.New("no repo found")
+
+// A git-go repository. It owns everything a command needs so several
+// repositories can be used at the same time from one process, none of the
+// methods depend on the current working directory.
+type Repository struct {
+	// Path of the .git-go directory.
+	GitDir string
+	// Root of the checked out files.
+	WorkTree string
+	Store    object.ObjectStore
+	// Where commands print their output, defaults to os.Stdout.
+	Out io.Writer
+	// Directory the paths given to commands are relative to, defaults to WorkTree.
+	Cwd string
+	// How long commands wait for the index and ref locks held by other processes.
+	LockOptions lockfile.Options
+	// The merged system, global and local configuration.
+	Config *config.Config
+}
+
+type InitOptions struct {
+	// Object store to use instead of the loose objects in the git dir.
+	Store object.ObjectStore
+}
+
+// Opens the repository whose work tree is at path.
+func Open(path string) (*Repository, error) {
+	workTree, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+	gitDir := filepath.Join(workTree, ".git-go")
+	if info, err := os.Stat(gitDir); err != nil || !info.IsDir() {
+		return nil, fmt.Errorf("no repo initialized in %s", workTree)
+	}
+	return openGitDir(gitDir, workTree)
+}
+
+func openGitDir(gitDir, workTree string) (*Repository, error) {
+	if info, err := os.Stat(gitDir); err != nil || !info.IsDir() {
+		return nil, fmt.Errorf("%s is not a git-go directory", gitDir)
+	}
+
+	cfg, err := config.Load(filepath.Join(gitDir, "config"))
+	if err != nil {
+		return nil, err
+	}
+
+	return &Repository{
+		GitDir:      gitDir,
+		WorkTree:    workTree,
+		Store:       object.NewLooseStore(filepath.Join(gitDir, "objects")),
+		Out:         os.Stdout,
+		Cwd:         workTree,
+		LockOptions: lockfile.DefaultOptions,
+		Config:      cfg,
+	}, nil
+}
+
+// Finds the repository containing dir by looking for the nearest .git-go
+// directory in dir and its parents. GIT_GO_DIR overrides the git dir, in which
+// case dir is the work tree, and GIT_GO_WORK_TREE overrides the work tree.
+// Paths given to the commands of the returned repository are relative to dir.
+func Discover(dir string) (*Repository, error) {
+	cwd, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var gitDir, workTree string
+	if envGitDir := os.Getenv("GIT_GO_DIR"); envGitDir != "" {
+		gitDir = absFrom(cwd, envGitDir)
+		workTree = cwd
+	} else {
+		for current := cwd; ; current = filepath.Dir(current) {
+			candidate := filepath.Join(current, ".git-go")
+			if info, err := os.Stat(candidate); err == nil && info.IsDir() {
+				gitDir, workTree = candidate, current
+				break
+			}
+			if filepath.Dir(current) == current {
+				return nil, fmt.Errorf("%w in %s or any of its parents", ErrNoRepo, cwd)
+			}
+		}
+	}
+	if envWorkTree := os.Getenv("GIT_GO_WORK_TREE"); envWorkTree != "" {
+		workTree = absFrom(cwd, envWorkTree)
+	}
+
+	repo, err := openGitDir(gitDir, workTree)
+	if err != nil {
+		return nil, err
+	}
+	repo.Cwd = cwd
+	return repo, nil
+}
+
+func absFrom(base, path string) string {
+	if filepath.IsAbs(path) {
+		return filepath.Clean(path)
+	}
+	return filepath.Join(base, path)
+}
+
+// Creates a new repository with its work tree at path and opens it.
+func Init(path string, opts InitOptions) (*Repository, error) {
+	workTree, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+	gitDir := filepath.Join(workTree, ".git-go")
+
+	dirs := []string{
+		filepath.Join(gitDir, "refs", "heads"),
+		filepath.Join(gitDir, "objects"),
+	}
+
+	for _, dir := range dirs {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return nil, fmt.Errorf("failed to create %s: %w", dir, err)
+		}
+	}
+
+	// Only the system and global config exist before the repository does.
+	cfg, err := config.Load("")
+	if err != nil {
+		return nil, err
+	}
+	branch := cfg.GetString("init.defaultBranch", "main")
+	if !refs.ValidName(refs.HeadsPrefix + branch) {
+		return nil, fmt.Errorf("invalid init.defaultBranch %q", branch)
+	}
+	// The branch itself is created by the first commit.
+	headPath := filepath.Join(gitDir, refs.Head)
+	if _, err := os.Stat(headPath); os.IsNotExist(err) {
+		if err := os.WriteFile(headPath, []byte("ref: "+refs.HeadsPrefix+branch+"\n"), 0644); err != nil {
+			return nil, fmt.Errorf("error while creating HEAD: %w", err)
+		}
+	}
+
+	if err := os.WriteFile(filepath.Join(gitDir, "index"), index.Encode(nil), 0644); err != nil {
+		return nil, fmt.Errorf("error while creating the index file: %w", err)
+	}
+
+	repo, err := Open(workTree)
+	if err != nil {
+		return nil, err
+	}
+	if opts.Store != nil {
+		repo.Store = opts.Store
+	}
+	return repo, nil
+}
+
+func (r *Repository) ConfigPath() string {
+	return filepath.Join(r.GitDir, "config")
+}
+
+func (r *Repository) IndexPath() string {
+	return filepath.Join(r.GitDir, "index")
+}
+
+// Translates a path given by the user, relative to Cwd, into a path relative
+// to the work tree. Fails for paths outside of the work tree.
+func (r *Repository) RepoPath(path string) (string, error) {
+	cwd := r.Cwd
+	if cwd == "" {
+		cwd = r.WorkTree
+	}
+	rel, err := filepath.Rel(r.WorkTree, absFrom(cwd, path))
+	if err != nil {
+		return "", err
+	}
+	if rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("%s is outside repository at %s", path, r.WorkTree)
+	}
+	return rel, nil
+}
@@ -0,0 +1,125 @@
+package commands
+
+import (
+	"fmt"
+
+	"github.com/f1-surya/git-go/commit"
+	"github.com/f1-surya/git-go/object"
+	"github.com/f1-surya/git-go/refs"
+	"github.com/f1-surya/git-go/tag"
+	"github.com/f1-surya/git-go/tree"
+)
+
+type ShowOptions struct {
+	// The objects to show, like HEAD~2, v1.0 or main:README.md. HEAD if none.
+	Objects []string
+	// The format of commits, like for Log. "" is medium.
+	Format       string
+	AbbrevCommit bool
+	// Shows the files changed by commits instead of their patch.
+	Stat bool
+	// Leaves out the patch of commits.
+	NoPatch bool
+}
+
+// Prints the objects: commits with their changes, trees like ls-tree, blobs
+// as they are and annotated tags followed by the object they point to.
+func (r *Repository) Show(opts ShowOptions) error {
+	revisions := opts.Objects
+	if len(revisions) == 0 {
+		revisions = []string{refs.Head}
+	}
+	colored, err := r.useColor("diff")
+	if err != nil {
+		return err
+	}
+	for i, rev := range revisions {
+		hash, err := r.Revisions().Resolve(rev)
+		if err != nil {
+			return err
+		}
+		if i > 0 {
+			fmt.Fprintln(r.Out)
+		}
+		if err := r.showObject(hash, opts, colored); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *Repository) showObject(hash string, opts ShowOptions, colored bool) error {
+	objType, content, err := r.Store.Get(hash)
+	if err != nil {
+		return err
+	}
+	switch objType {
+	case object.TypeCommit:
+		c, err := commit.Parse(hash, content)
+		if err != nil {
+			return err
+		}
+		logOpts := LogOptions{
+			Format:       opts.Format,
+			AbbrevCommit: opts.AbbrevCommit,
+			Stat:         opts.Stat,
+			Patch:        !opts.Stat && !opts.NoPatch,
+		}
+		text, err := r.logEntry(c, logOpts, colored)
+		if err != nil {
+			return err
+		}
+		_, err = r.Out.Write(text)
+		return err
+	case object.TypeTree:
+		t, err := tree.ParseTree(content)
+		if err != nil {
+			return err
+		}
+		return r.writeTreeEntries(t.Children, "")
+	case object.TypeTag:
+		t, err := tag.Parse(hash, content)
+		if err != nil {
+			return err
+		}
+		color := colorizer(colored)
+		fmt.Fprintln(r.Out, color(colorYellow, "tag "+t.Name))
+		if t.Tagger.Name != "" || t.Tagger.Email != "" {
+			fmt.Fprintf(r.Out, "Tagger: %s\n", t.Tagger.Identity())
+			fmt.Fprintf(r.Out, "Date:   %s\n", t.Tagger.When.Format(logDateFormat))
+		}
+		fmt.Fprintf(r.Out, "\n%s\n", t.Message)
+		if t.Message != "" && t.Message[len(t.Message)-1] != '\n' {
+			fmt.Fprintln(r.Out)
+		}
+		return r.showObject(t.Object, opts, colored)
+	default:
+		_, err := r.Out.Write(content)
+		return err
+	}
+}
+
+// Prints the entries like ls-tree, with the names under dir.
+func (r *Repository) writeTreeEntries(entries []tree.TreeEntry, dir string) error {
+	for _, entry := range entries {
+		_, err := fmt.Fprintf(r.Out, "%06o %s %x\t%s%s\n", entry.Mode, entryType(entry.Mode), entry.Hash, dir, entry.Name)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Returns the type of the object a tree entry with the mode points to.
+func entryType(mode uint32) string {
+	switch mode {
+	case object.ModeDirectory:
+		return object.TypeTree
+	case modeGitlink:
+		return object.TypeCommit
+	}
+	return object.TypeBlob
+}
+
+// The mode of submodules, which point to a commit of another repository.
+const modeGitlink = 0o160000
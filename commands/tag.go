@@ -0,0 +1,202 @@
+package commands
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/f1-surya/git-go/commit"
+	"github.com/f1-surya/git-go/object"
+	"github.com/f1-surya/git-go/refs"
+	"github.com/f1-surya/git-go/tag"
+)
+
+const tagsPrefix = "refs/tags/"
+
+type TagOptions struct {
+	// Creates an annotated tag object with this message instead of a
+	// lightweight tag.
+	Message  string
+	Annotate bool
+	// Replace an existing tag.
+	Force bool
+}
+
+type TagInfo struct {
+	Name string
+	// The hash the ref points to, a tag object for annotated tags.
+	Hash string
+	// The commit or other object the tag ends at.
+	Target string
+	// Nil for lightweight tags.
+	Annotation *tag.Tag
+}
+
+// The tagger date for annotated tags, the committer date of the target for
+// lightweight ones, like git's creatordate.
+func (r *Repository) tagDate(info TagInfo) time.Time {
+	if info.Annotation != nil {
+		return info.Annotation.Tagger.When
+	}
+	if c, err := commit.ParseCommit(r.Store, info.Target); err == nil {
+		return c.Committer.When
+	}
+	return time.Time{}
+}
+
+// Creates a tag for target, any revision, or HEAD if target is "".
+func (r *Repository) CreateTag(name, target string, opts TagOptions) error {
+	if name == "" || strings.HasPrefix(name, "-") || !refs.ValidName(tagsPrefix+name) {
+		return fmt.Errorf("'%s' is not a valid tag name", name)
+	}
+	if target == "" {
+		target = refs.Head
+	}
+	hash, err := r.Revisions().Resolve(target)
+	if err != nil {
+		return err
+	}
+	objType, _, err := r.Store.Stat(hash)
+	if err != nil {
+		return err
+	}
+
+	if opts.Annotate || opts.Message != "" {
+		if opts.Message == "" {
+			return errors.New("annotated tags need a message")
+		}
+		_, tagger, err := r.signatures()
+		if err != nil {
+			return err
+		}
+		t := tag.Tag{Object: hash, Type: objType, Name: name, Tagger: tagger, Message: opts.Message}
+		if !strings.HasSuffix(t.Message, "\n") {
+			t.Message += "\n"
+		}
+		if hash, err = r.Store.Put(object.TypeTag, t.ToBytes()); err != nil {
+			return err
+		}
+	}
+
+	oldHash := refs.ZeroHash
+	if opts.Force {
+		oldHash = ""
+	}
+	err = refs.Update(r.GitDir, tagsPrefix+name, hash, oldHash, nil, r.LockOptions)
+	if errors.Is(err, refs.ErrRefChanged) {
+		return fmt.Errorf("tag '%s' already exists", name)
+	}
+	return err
+}
+
+// Deletes the tag and returns the hash it pointed to.
+func (r *Repository) DeleteTag(name string) (string, error) {
+	hash, err := refs.Resolve(r.GitDir, tagsPrefix+name)
+	if errors.Is(err, refs.ErrNotFound) {
+		return "", fmt.Errorf("tag '%s' not found", name)
+	}
+	if err != nil {
+		return "", err
+	}
+	return hash, refs.Delete(r.GitDir, tagsPrefix+name, hash, r.LockOptions)
+}
+
+// Returns the tags whose names match any of the glob patterns, all of them
+// without patterns. sortKey is refname (the default), version:refname or
+// creatordate, prefixed with - to reverse the order.
+func (r *Repository) Tags(patterns []string, sortKey string) ([]TagInfo, error) {
+	all, err := refs.List(r.GitDir, tagsPrefix)
+	if err != nil {
+		return nil, err
+	}
+	var tags []TagInfo
+	for _, ref := range all {
+		name := strings.TrimPrefix(ref.Name, tagsPrefix)
+		if !matchesAny(patterns, name) {
+			continue
+		}
+		info := TagInfo{Name: name, Hash: ref.Hash}
+		if objType, _, err := r.Store.Stat(ref.Hash); err == nil && objType == object.TypeTag {
+			if info.Annotation, err = tag.ParseTag(r.Store, ref.Hash); err != nil {
+				return nil, err
+			}
+		}
+		if info.Target, _, err = tag.Peel(r.Store, ref.Hash); err != nil {
+			return nil, err
+		}
+		tags = append(tags, info)
+	}
+
+	reverse := strings.HasPrefix(sortKey, "-")
+	sortKey = strings.TrimPrefix(sortKey, "-")
+	var less func(a, b TagInfo) bool
+	switch sortKey {
+	case "", "refname":
+		less = func(a, b TagInfo) bool { return a.Name < b.Name }
+	case "version:refname", "v:refname":
+		less = func(a, b TagInfo) bool { return compareVersions(a.Name, b.Name) < 0 }
+	case "creatordate", "taggerdate":
+		less = func(a, b TagInfo) bool { return r.tagDate(a).Before(r.tagDate(b)) }
+	default:
+		return nil, fmt.Errorf("unsupported sort key %s", sortKey)
+	}
+	sort.SliceStable(tags, func(i, j int) bool {
+		if reverse {
+			return less(tags[j], tags[i])
+		}
+		return less(tags[i], tags[j])
+	})
+	return tags, nil
+}
+
+func matchesAny(patterns []string, name string) bool {
+	if len(patterns) == 0 {
+		return true
+	}
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// Compares names like v1.10.0 and v1.9.2 by the numbers in them, so the first
+// one sorts last.
+func compareVersions(a, b string) int {
+	for a != "" && b != "" {
+		aDigits, bDigits := leadingDigits(a), leadingDigits(b)
+		if aDigits > 0 && bDigits > 0 {
+			aNum, _ := strconv.ParseUint(a[:aDigits], 10, 64)
+			bNum, _ := strconv.ParseUint(b[:bDigits], 10, 64)
+			if aNum != bNum {
+				if aNum < bNum {
+					return -1
+				}
+				return 1
+			}
+			a, b = a[aDigits:], b[bDigits:]
+			continue
+		}
+		if a[0] != b[0] {
+			if a[0] < b[0] {
+				return -1
+			}
+			return 1
+		}
+		a, b = a[1:], b[1:]
+	}
+	return len(a) - len(b)
+}
+
+func leadingDigits(s string) int {
+	n := 0
+	for n < len(s) && s[n] >= '0' && s[n] <= '9' {
+		n++
+	}
+	return n
+}
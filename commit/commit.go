@@ -2,146 +2,253 @@ package commit
 
 import (
 	"bytes"
-	"crypto/sha1"
-	"encoding/hex"
+	"errors"
 	"fmt"
-	"os"
-	"os/user"
 	"path/filepath"
 	"strconv"
+	"strings"
 	"time"
 
+	"github.com/f1-surya/git-go/index"
+	"github.com/f1-surya/git-go/lockfile"
 	"github.com/f1-surya/git-go/object"
+	"github.com/f1-surya/git-go/refs"
 	"github.com/f1-surya/git-go/tree"
 )
 
+// Returned when the branch moved while a commit was made.
+var ErrRefChanged = refs.ErrRefChanged
+
 type Commit struct {
-	Author    string
-	CreatedAt time.Time
-	Message   string
-	Tree      string
-	Parent    string
-	Hash      string
+	Tree string
+	// The first parent is the commit the branch pointed to when this one was
+	// made, merges have more, root commits have none.
+	Parents   []string
+	Author    Signature
+	Committer Signature
+	// Headers other than the ones above, like encoding or gpgsig, in the
+	// order they appeared so the commit hashes the same when it's written again.
+	ExtraHeaders []Header
+	Message      string
+	Hash         string
 }
 
-func (c *Commit) ToBytes() ([]byte, error) {
-	var buff bytes.Buffer
-	buff.Write(fmt.Appendf(nil, "parent %s\n", c.Parent))
-	buff.Write(fmt.Appendf(nil, "tree %s\n", c.Tree))
+// A header line of a commit. Values spanning several lines are written with
+// every following line indented by a space.
+type Header struct {
+	Key   string
+	Value string
+}
 
-	user, err := user.Current()
-	if err != nil {
-		return nil, err
+// Returns the content of the commit object, without the header.
+func (c *Commit) ToBytes() []byte {
+	var buff bytes.Buffer
+	fmt.Fprintf(&buff, "tree %s\n", c.Tree)
+	for _, parent := range c.Parents {
+		fmt.Fprintf(&buff, "parent %s\n", parent)
 	}
+	fmt.Fprintf(&buff, "author %s\n", c.Author)
+	fmt.Fprintf(&buff, "committer %s\n", c.Committer)
+	for _, header := range c.ExtraHeaders {
+		fmt.Fprintf(&buff, "%s %s\n", header.Key, strings.ReplaceAll(header.Value, "\n", "\n "))
+	}
+	buff.WriteString("\n")
+	buff.WriteString(c.Message)
+	return buff.Bytes()
+}
 
-	now := time.Now()
-	buff.Write(fmt.Appendf(nil, "author %v %d\n", user.Username, now.Unix()))
-	buff.Write([]byte(c.Message))
-
-	content := buff.Bytes()
-	commit := fmt.Appendf(nil, "commit %d\n", len(content))
-	commit = append(commit, content...)
-
-	return commit, nil
+// Joins the paragraphs given with -m by blank lines and ends the message with
+// a newline, like git commit does.
+func JoinMessage(paragraphs []string) string {
+	message := strings.TrimRight(strings.Join(paragraphs, "\n\n"), "\n")
+	if message == "" {
+		return ""
+	}
+	return message + "\n"
 }
 
-func CreateCommit(args []string) (Commit, error) {
+// Returns a commit of the index on top of HEAD with the given message.
+func CreateCommit(store object.ObjectStore, gitDir string, message string) (Commit, error) {
 	var newCommit Commit
-	root, err := tree.WriteTrees()
+	entries, err := index.ReadIndex(filepath.Join(gitDir, "index"))
+	if err != nil {
+		return newCommit, err
+	}
+	root, err := tree.WriteTrees(store, entries)
 	if err != nil {
 		return newCommit, err
 	}
 
 	newCommit.Tree = root
-	newCommit.Message = args[1]
+	newCommit.Message = message
 
-	headPath := filepath.Join(".git-go", "refs", "heads", "main")
-	if _, err := os.Stat(headPath); err == nil {
-		head, err := os.ReadFile(headPath)
-		if err != nil {
-			return newCommit, err
-		}
-		newCommit.Parent = string(head)
+	head, err := refs.Resolve(gitDir, refs.Head)
+	if err == nil {
+		newCommit.Parents = []string{head}
+	} else if !errors.Is(err, refs.ErrNotFound) {
+		return newCommit, err
 	}
 	return newCommit, nil
 }
 
-// Writes the commit to the ObjectDB
-func WriteCommit(commit Commit) error {
-	commitBytes, err := commit.ToBytes()
+// Writes the commit to the ObjectDB and advances HEAD, or the branch it points
+// to, to it. The branch must still point at the commit's first parent, otherwise
+// another commit was made in the meantime and ErrRefChanged is returned. action,
+// like commit or revert, starts the reflog message.
+func WriteCommit(store object.ObjectStore, gitDir string, commit Commit, action string, lockOpts lockfile.Options) error {
+	var err error
+	commit.Hash, err = store.Put(object.TypeCommit, commit.ToBytes())
 	if err != nil {
 		return err
 	}
 
-	if commit.Hash == "" {
-		hash := sha1.Sum(commitBytes)
-		commit.Hash = hex.EncodeToString(hash[:])
+	expected := refs.ZeroHash
+	if len(commit.Parents) > 0 {
+		expected = commit.Parents[0]
 	}
+	switch {
+	case len(commit.Parents) == 0:
+		action += " (initial)"
+	case len(commit.Parents) > 1:
+		action += " (merge)"
+	}
+	subject, _, _ := strings.Cut(commit.Message, "\n")
+	reason := &refs.Reason{
+		Who:     commit.Committer.Identity(),
+		When:    commit.Committer.When,
+		Message: action + ": " + subject,
+	}
+	return refs.Update(gitDir, refs.Head, commit.Hash, expected, reason, lockOpts)
+}
 
-	err = object.WriteObject(commitBytes, commit.Hash)
+// Reads the commit object of the given hash. Fails with object.ErrNotFound if
+// the store doesn't have it.
+func ParseCommit(store object.ObjectStore, commitHash string) (*Commit, error) {
+	objType, commitObject, err := store.Get(commitHash)
 	if err != nil {
-		return err
+		return nil, fmt.Errorf("commit %s: %w", commitHash, err)
+	}
+	if objType != object.TypeCommit {
+		return nil, fmt.Errorf("object %s is a %s, not a commit", commitHash, objType)
 	}
+	return Parse(commitHash, commitObject)
+}
 
-	tempHeadPath := filepath.Join(".git-go", "refs", "heads", "main.temp")
-	tempHead, err := os.Create(tempHeadPath)
-	if err != nil {
-		return err
+// Parses the content of a commit object (without the header).
+func Parse(commitHash string, content []byte) (*Commit, error) {
+	if bytes.HasPrefix(content, []byte("parent ")) {
+		return parseLegacy(commitHash, content)
 	}
-	defer tempHead.Close()
 
-	if _, err := tempHead.Write([]byte(commit.Hash)); err != nil {
-		return err
+	commit := Commit{Hash: commitHash}
+	headers, message, ok := bytes.Cut(content, []byte("\n\n"))
+	if !ok {
+		if !bytes.HasSuffix(content, []byte("\n")) {
+			return nil, fmt.Errorf("commit %s is truncated", commitHash)
+		}
+		headers = content[:len(content)-1]
 	}
-	if err = os.Rename(tempHeadPath, filepath.Join(".git-go", "refs", "heads", "main")); err != nil {
-		return err
+	commit.Message = string(message)
+
+	var seenAuthor, seenCommitter bool
+	for i, line := range strings.Split(string(headers), "\n") {
+		if strings.HasPrefix(line, " ") {
+			if len(commit.ExtraHeaders) == 0 || i == 0 {
+				return nil, fmt.Errorf("commit %s: unexpected continuation line %q", commitHash, line)
+			}
+			last := &commit.ExtraHeaders[len(commit.ExtraHeaders)-1]
+			last.Value += "\n" + line[1:]
+			continue
+		}
+		key, value, ok := strings.Cut(line, " ")
+		if !ok {
+			return nil, fmt.Errorf("commit %s: malformed header %q", commitHash, line)
+		}
+		if i == 0 && key != "tree" {
+			return nil, fmt.Errorf("commit %s: expected tree line, got %q", commitHash, line)
+		}
+
+		var err error
+		switch key {
+		case "tree":
+			if i != 0 {
+				return nil, fmt.Errorf("commit %s: unexpected tree line", commitHash)
+			}
+			commit.Tree = value
+		case "parent":
+			commit.Parents = append(commit.Parents, value)
+		case "author":
+			seenAuthor = true
+			commit.Author, err = ParseSignature(value)
+		case "committer":
+			seenCommitter = true
+			commit.Committer, err = ParseSignature(value)
+		default:
+			commit.ExtraHeaders = append(commit.ExtraHeaders, Header{Key: key, Value: value})
+		}
+		if err != nil {
+			return nil, fmt.Errorf("commit %s: %w", commitHash, err)
+		}
 	}
-	return nil
+
+	if !seenAuthor || !seenCommitter {
+		return nil, fmt.Errorf("commit %s: missing author or committer", commitHash)
+	}
+	return &commit, nil
 }
 
-// Reads the commit object of the given hash and returns the Commit struct if there are no errors
-func ParseCommit(commitHash string) (*Commit, error) {
+// Parses commits written by older versions of git-go: parent, tree and
+// "author <username> <unix>" lines directly followed by the message.
+func parseLegacy(commitHash string, content []byte) (*Commit, error) {
 	var commit Commit
-	commitObject, err := object.ReadObject(commitHash)
-	if err != nil {
-		if os.IsNotExist(err) {
-			return nil, nil
-		}
-		return nil, err
+	commitParts := bytes.SplitN(content, []byte("\n"), 4)
+	if len(commitParts) < 3 {
+		return nil, fmt.Errorf("commit %s is truncated", commitHash)
 	}
 
-	commitParts := bytes.Split(commitObject, []byte("\n"))
+	fields := make([][]byte, 3)
+	for i, key := range []string{"parent", "tree", "author"} {
+		value, ok := bytes.CutPrefix(commitParts[i], []byte(key+" "))
+		if !ok {
+			return nil, fmt.Errorf("commit %s: expected %s line, got %q", commitHash, key, commitParts[i])
+		}
+		fields[i] = value
+	}
 
-	spaceByte := []byte(" ")
-	parent := bytes.Split(commitParts[1], spaceByte)[1]
-	tree := bytes.Split(commitParts[2], spaceByte)[1]
-	metadata := bytes.Split(commitParts[3], spaceByte)
-	timestamp, err := strconv.ParseInt(string(metadata[2]), 10, 64)
+	metadata := bytes.Split(fields[2], []byte(" "))
+	if len(metadata) != 2 {
+		return nil, fmt.Errorf("commit %s: malformed author line %q", commitHash, fields[2])
+	}
+	timestamp, err := strconv.ParseInt(string(metadata[1]), 10, 64)
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("commit %s: malformed timestamp: %w", commitHash, err)
 	}
 
-	commit.Author = string(metadata[1])
-	commit.CreatedAt = time.Unix(timestamp, 0)
-	commit.Tree = string(tree)
-	commit.Message = string(commitParts[4])
-	commit.Parent = string(parent)
+	commit.Author = Signature{Name: string(metadata[0]), When: time.Unix(timestamp, 0).UTC()}
+	commit.Committer = commit.Author
+	commit.Tree = string(fields[1])
+	if len(commitParts) == 4 {
+		commit.Message = string(commitParts[3])
+	}
+	if len(fields[0]) > 0 {
+		commit.Parents = []string{string(fields[0])}
+	}
 	commit.Hash = commitHash
 
 	return &commit, nil
 }
 
-func GetLatest() (*Commit, error) {
+func GetLatest(store object.ObjectStore, gitDir string) (*Commit, error) {
 	var result *Commit
 
-	head, err := os.ReadFile(filepath.Join(".git-go", "refs", "heads", "main"))
+	head, err := refs.Resolve(gitDir, refs.Head)
+	if errors.Is(err, refs.ErrNotFound) {
+		return nil, nil
+	}
 	if err != nil {
 		return nil, err
 	}
-	if len(head) == 0 {
-		return nil, nil
-	}
-	result, err = ParseCommit(string(head))
+	result, err = ParseCommit(store, head)
 	if err != nil {
 		return nil, err
 	}
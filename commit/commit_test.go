@@ -1,20 +1,34 @@
 package commit_test
 
 import (
+	"bytes"
 	"os"
 	"path/filepath"
+	"reflect"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/f1-surya/git-go/commands"
 	"github.com/f1-surya/git-go/commit"
+	"github.com/f1-surya/git-go/object"
 )
 
+func initRepo(t *testing.T) *commands.Repository {
+	t.Helper()
+	repo, err := commands.Init(".", commands.InitOptions{})
+	if err != nil {
+		t.Fatalf("Init errored: %v", err)
+	}
+	return repo
+}
+
 func TestParseCommit(t *testing.T) {
 	t.Cleanup(func() {
 		os.RemoveAll(".git-go")
 		os.RemoveAll("test")
 	})
-	commands.Init()
+	repo := initRepo(t)
 
 	err := os.Mkdir("test", 0755)
 	if err != nil {
@@ -27,12 +41,12 @@ func TestParseCommit(t *testing.T) {
 	}
 	defer file.Close()
 
-	err = commands.Add([]string{"commit.go", "test/test.txt"})
+	err = repo.Add([]string{"commit.go", "test/test.txt"})
 	if err != nil {
 		t.Fatalf("Add errored: %v", err)
 	}
 
-	err = commands.Commit([]string{"-m", "Init"})
+	err = repo.Commit([]string{"-m", "Init"})
 	if err != nil {
 		t.Fatalf("Commit errored: %v", err)
 	}
@@ -42,12 +56,12 @@ func TestParseCommit(t *testing.T) {
 		t.Fatalf("Error while reading the HEAD: %v", err)
 	}
 
-	latestCommit, err := commit.ParseCommit(string(head))
+	latestCommit, err := commit.ParseCommit(repo.Store, string(head))
 	if err != nil {
 		t.Fatalf("Error while parsing the commit: %v", err)
 	}
 
-	if latestCommit.Message != "Init" {
+	if latestCommit.Message != "Init\n" {
 		t.Fatalf("Wrong message %s", latestCommit.Message)
 	}
 
@@ -57,12 +71,12 @@ func TestParseCommit(t *testing.T) {
 	}
 	defer file.Close()
 
-	err = commands.Add([]string{"test/test-2.txt"})
+	err = repo.Add([]string{"test/test-2.txt"})
 	if err != nil {
 		t.Fatalf("Add 2 errored: %v", err)
 	}
 
-	err = commands.Commit([]string{"-m", "Second file"})
+	err = repo.Commit([]string{"-m", "Second file"})
 	if err != nil {
 		t.Fatalf("Second commit errored: %v", err)
 	}
@@ -72,16 +86,171 @@ func TestParseCommit(t *testing.T) {
 		t.Fatalf("Error while reading the HEAD: %v", err)
 	}
 
-	latestCommit, err = commit.ParseCommit(string(head))
+	latestCommit, err = commit.ParseCommit(repo.Store, string(head))
 	if err != nil {
 		t.Fatalf("Error while parsing the commit: %v", err)
 	}
 
-	if latestCommit.Message != "Second file" {
+	if latestCommit.Message != "Second file\n" {
 		t.Fatalf("Wrong message %s", latestCommit.Message)
 	}
 
-	if latestCommit.Parent == "" {
+	if len(latestCommit.Parents) == 0 {
 		t.Fatalf("Parent commit missing")
 	}
 }
+
+func TestFormatRoundTrip(t *testing.T) {
+	content := "tree 4b825dc642cb6eb9a060e54bf8d69288fbee4904\n" +
+		"parent 1d3e5a2b1f0f6c3f8d0b9c2e5a7f6b4c3d2e1f00\n" +
+		"author A U Thor <author@example.com> 1700000000 +0530\n" +
+		"committer C O Mitter <committer@example.com> 1700000100 -0800\n" +
+		"encoding ISO-8859-1\n" +
+		"gpgsig -----BEGIN PGP SIGNATURE-----\n \n iQEzBAABCAAdFiEE\n -----END PGP SIGNATURE-----\n" +
+		"\n" +
+		"Subject line\n\nBody with\nseveral lines\n"
+
+	c, err := commit.Parse("hash", []byte(content))
+	if err != nil {
+		t.Fatalf("Parse errored: %v", err)
+	}
+	if c.Author.Name != "A U Thor" || c.Author.Email != "author@example.com" || c.Author.When.Unix() != 1700000000 {
+		t.Fatalf("Wrong author %+v", c.Author)
+	}
+	if _, offset := c.Committer.When.Zone(); offset != -8*3600 {
+		t.Fatalf("Wrong committer time zone offset %d", offset)
+	}
+	if len(c.ExtraHeaders) != 2 || c.ExtraHeaders[1].Key != "gpgsig" || !strings.HasSuffix(c.ExtraHeaders[1].Value, "\n-----END PGP SIGNATURE-----") {
+		t.Fatalf("Wrong extra headers %q", c.ExtraHeaders)
+	}
+	if c.Message != "Subject line\n\nBody with\nseveral lines\n" {
+		t.Fatalf("Wrong message %q", c.Message)
+	}
+	if encoded := string(c.ToBytes()); encoded != content {
+		t.Fatalf("Commit didn't round trip:\n%s", encoded)
+	}
+
+	root := commit.Commit{Tree: c.Tree, Author: c.Author, Committer: c.Committer, Message: "Root\n"}
+	if bytes.Contains(root.ToBytes(), []byte("parent")) {
+		t.Fatalf("Root commit has a parent line:\n%s", root.ToBytes())
+	}
+	parsed, err := commit.Parse("root", root.ToBytes())
+	if err != nil || len(parsed.Parents) != 0 || parsed.Message != "Root\n" {
+		t.Fatalf("Root commit didn't round trip: %+v, %v", parsed, err)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, content := range []string{
+		"tree abc\n",
+		"author A <a> 1 +0000\ntree abc\ncommitter A <a> 1 +0000\n\nmsg",
+		"tree abc\nauthor A <a> 1 +0000\ncommitter A <a> noon +0000\n\nmsg",
+		"tree abc\nauthor A a 1 +0000\ncommitter A <a> 1 +0000\n\nmsg",
+	} {
+		if _, err := commit.Parse("hash", []byte(content)); err == nil {
+			t.Errorf("Parse(%q) didn't error", content)
+		}
+	}
+}
+
+func TestParseLegacy(t *testing.T) {
+	c, err := commit.Parse("hash", []byte("parent \ntree abc\nauthor someone 1700000000\nfirst\nsecond"))
+	if err != nil {
+		t.Fatalf("Parse errored: %v", err)
+	}
+	if len(c.Parents) != 0 || c.Tree != "abc" || c.Author.Name != "someone" || c.Committer.When.Unix() != 1700000000 || c.Message != "first\nsecond" {
+		t.Fatalf("Wrong legacy commit %+v", c)
+	}
+}
+
+func TestSignatureFromEnv(t *testing.T) {
+	t.Setenv("GIT_GO_AUTHOR_NAME", "Env Name")
+	t.Setenv("GIT_GO_AUTHOR_DATE", "2023-11-14T22:13:20+01:00")
+	now := time.Unix(42, 0)
+	author, err := commit.SignatureFromEnv("AUTHOR", "Default", "default@example.com", now)
+	if err != nil {
+		t.Fatalf("SignatureFromEnv errored: %v", err)
+	}
+	if author.String() != "Env Name <default@example.com> 1699996400 +0100" {
+		t.Fatalf("Wrong author %s", author)
+	}
+	committer, err := commit.SignatureFromEnv("COMMITTER", "Default", "default@example.com", now)
+	if err != nil || committer.String() != "Default <default@example.com> 42 "+now.Format("-0700") {
+		t.Fatalf("Wrong committer %s: %v", committer, err)
+	}
+
+	t.Setenv("GIT_GO_COMMITTER_EMAIL", "bad>email")
+	if _, err := commit.SignatureFromEnv("COMMITTER", "Default", "default@example.com", now); err == nil {
+		t.Fatalf("Invalid email was accepted")
+	}
+}
+
+func TestWalk(t *testing.T) {
+	store := object.NewMemoryStore()
+	hashes := make(map[string]string)
+	names := make(map[string]string)
+	// R <- A <- M <- C, with B branching off R and merged in M.
+	for i, c := range []struct{ name, parents string }{
+		{"R", ""}, {"A", "R"}, {"B", "R"}, {"M", "A B"}, {"C", "M"},
+	} {
+		when := time.Unix(int64(1700000000+i), 0).UTC()
+		sig := commit.Signature{Name: "Someone", Email: "someone@example.com", When: when}
+		newCommit := commit.Commit{Tree: "4b825dc642cb6eb9a060e54bf8d69288fbee4904", Author: sig, Committer: sig, Message: c.name}
+		for _, parent := range strings.Fields(c.parents) {
+			newCommit.Parents = append(newCommit.Parents, hashes[parent])
+		}
+		hash, err := store.Put(object.TypeCommit, newCommit.ToBytes())
+		if err != nil {
+			t.Fatalf("Put errored: %v", err)
+		}
+		hashes[c.name], names[hash] = hash, c.name
+	}
+
+	walk := func(opts commit.WalkOptions, limit int) string {
+		t.Helper()
+		var order []string
+		err := commit.Walk(store, []string{hashes["C"]}, opts, func(c *commit.Commit) error {
+			order = append(order, names[c.Hash])
+			if len(order) == limit {
+				return commit.ErrStopWalk
+			}
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("Walk errored: %v", err)
+		}
+		return strings.Join(order, " ")
+	}
+
+	if order := walk(commit.WalkOptions{Order: commit.OrderDate}, 0); order != "C M B A R" {
+		t.Fatalf("Wrong date order %s", order)
+	}
+	if order := walk(commit.WalkOptions{Order: commit.OrderTopo}, 0); order != "C M A B R" {
+		t.Fatalf("Wrong topological order %s", order)
+	}
+	if order := walk(commit.WalkOptions{FirstParent: true}, 0); order != "C M A R" {
+		t.Fatalf("Wrong first parent order %s", order)
+	}
+	for _, order := range []commit.Order{commit.OrderDate, commit.OrderTopo} {
+		if got := walk(commit.WalkOptions{Order: order, Exclude: []string{hashes["B"]}}, 0); got != "C M A" {
+			t.Fatalf("Walk excluding B = %s", got)
+		}
+	}
+	if order := walk(commit.WalkOptions{}, 2); order != "C M" {
+		t.Fatalf("Walk didn't stop: %s", order)
+	}
+
+	merge, err := commit.ParseCommit(store, hashes["M"])
+	if err != nil || !reflect.DeepEqual(merge.Parents, []string{hashes["A"], hashes["B"]}) {
+		t.Fatalf("Merge parents didn't round trip: %+v, %v", merge, err)
+	}
+
+	for _, c := range []struct{ a, b, want string }{
+		{"A", "B", "R"}, {"C", "B", "B"}, {"B", "C", "B"}, {"A", "A", "A"},
+	} {
+		bases, err := commit.MergeBases(store, hashes[c.a], hashes[c.b])
+		if err != nil || !reflect.DeepEqual(bases, []string{hashes[c.want]}) {
+			t.Errorf("MergeBases(%s, %s) = %v, %v, want %s", c.a, c.b, bases, err, c.want)
+		}
+	}
+}
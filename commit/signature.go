@@ -0,0 +1,108 @@
+package commit
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The author or committer of a commit, encoded as "Name <email> <unix> <tz>".
+type Signature struct {
+	Name  string
+	Email string
+	// The time in the time zone of the person, the offset is part of the encoding.
+	When time.Time
+}
+
+func (s Signature) String() string {
+	return fmt.Sprintf("%s <%s> %d %s", s.Name, s.Email, s.When.Unix(), s.When.Format("-0700"))
+}
+
+// Returns "Name <email>", the signature without the date.
+func (s Signature) Identity() string {
+	return fmt.Sprintf("%s <%s>", s.Name, s.Email)
+}
+
+func ParseSignature(line string) (Signature, error) {
+	var s Signature
+	open := strings.IndexByte(line, '<')
+	end := strings.LastIndexByte(line, '>')
+	if open == -1 || end < open {
+		return s, fmt.Errorf("malformed signature %q", line)
+	}
+	s.Name = strings.TrimSpace(line[:open])
+	s.Email = line[open+1 : end]
+
+	fields := strings.Fields(line[end+1:])
+	if len(fields) != 2 {
+		return s, fmt.Errorf("malformed signature date %q", line[end+1:])
+	}
+	when, err := parseGitDate(fields[0], fields[1])
+	if err != nil {
+		return s, err
+	}
+	s.When = when
+	return s, nil
+}
+
+// Parses the "<unix> <+hhmm>" date of a signature.
+func parseGitDate(timestamp, zone string) (time.Time, error) {
+	seconds, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("malformed timestamp %q", timestamp)
+	}
+	if len(zone) != 5 || (zone[0] != '+' && zone[0] != '-') {
+		return time.Time{}, fmt.Errorf("malformed time zone %q", zone)
+	}
+	hours, errHours := strconv.Atoi(zone[1:3])
+	minutes, errMinutes := strconv.Atoi(zone[3:])
+	if errHours != nil || errMinutes != nil {
+		return time.Time{}, fmt.Errorf("malformed time zone %q", zone)
+	}
+	offset := hours*3600 + minutes*60
+	if zone[0] == '-' {
+		offset = -offset
+	}
+	return time.Unix(seconds, 0).In(time.FixedZone("", offset)), nil
+}
+
+// Parses a date given by the user: Git's "<unix> <+hhmm>", RFC 3339 or RFC 2822.
+func ParseDate(date string) (time.Time, error) {
+	if fields := strings.Fields(date); len(fields) == 2 {
+		if when, err := parseGitDate(fields[0], fields[1]); err == nil {
+			return when, nil
+		}
+	}
+	for _, layout := range []string{time.RFC3339, time.RFC1123Z, "Mon, 2 Jan 2006 15:04:05 -0700"} {
+		if when, err := time.Parse(layout, date); err == nil {
+			return when, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("unknown date format %q", date)
+}
+
+// Returns the signature for the given role (AUTHOR or COMMITTER) of a new
+// commit. GIT_GO_<role>_NAME, GIT_GO_<role>_EMAIL and GIT_GO_<role>_DATE
+// override the given name, email and time.
+func SignatureFromEnv(role, name, email string, now time.Time) (Signature, error) {
+	s := Signature{Name: name, Email: email, When: now}
+	if value := os.Getenv("GIT_GO_" + role + "_NAME"); value != "" {
+		s.Name = value
+	}
+	if value := os.Getenv("GIT_GO_" + role + "_EMAIL"); value != "" {
+		s.Email = value
+	}
+	if value := os.Getenv("GIT_GO_" + role + "_DATE"); value != "" {
+		when, err := ParseDate(value)
+		if err != nil {
+			return s, fmt.Errorf("GIT_GO_%s_DATE: %w", role, err)
+		}
+		s.When = when
+	}
+	if strings.ContainsAny(s.Name, "<>\n") || strings.ContainsAny(s.Email, "<>\n") {
+		return s, fmt.Errorf("invalid %s identity %q <%s>", strings.ToLower(role), s.Name, s.Email)
+	}
+	return s, nil
+}
@@ -0,0 +1,260 @@
+package commit
+
+import (
+	"container/heap"
+	"errors"
+
+	"github.com/f1-surya/git-go/object"
+)
+
+// Returned by the function passed to Walk to stop the walk without an error.
+var ErrStopWalk = errors.New("stop walk")
+
+type Order int
+
+const (
+	// Newest commits first by committer date, like git log. Commits are
+	// read as they are needed, so stopping early on a long history is cheap.
+	OrderDate Order = iota
+	// Children before their parents, keeping the commits of a line of history
+	// together, like git log --topo-order. Reads the whole history first.
+	OrderTopo
+)
+
+type WalkOptions struct {
+	Order Order
+	// Only follow the first parent of merges.
+	FirstParent bool
+	// Commits reachable from these are skipped, like ^A in git log.
+	Exclude []string
+}
+
+// Calls fn once for every commit reachable from the tips, in the given order.
+func Walk(store object.ObjectStore, tips []string, opts WalkOptions, fn func(*Commit) error) error {
+	hidden := make(map[string]bool)
+	if len(opts.Exclude) > 0 {
+		err := walkDate(store, opts.Exclude, WalkOptions{}, hidden, func(c *Commit) error {
+			hidden[c.Hash] = true
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	var err error
+	if opts.Order == OrderTopo {
+		err = walkTopo(store, tips, opts, hidden, fn)
+	} else {
+		err = walkDate(store, tips, opts, hidden, fn)
+	}
+	if errors.Is(err, ErrStopWalk) {
+		return nil
+	}
+	return err
+}
+
+func (c *Commit) walkParents(opts WalkOptions) []string {
+	if opts.FirstParent && len(c.Parents) > 1 {
+		return c.Parents[:1]
+	}
+	return c.Parents
+}
+
+// A queue of commits with the newest committer date first, ties are broken
+// by the order the commits were found in.
+type dateQueue struct {
+	commits []*Commit
+	order   []int
+	pushed  int
+}
+
+func (q *dateQueue) Len() int { return len(q.commits) }
+func (q *dateQueue) Less(i, j int) bool {
+	a, b := q.commits[i].Committer.When, q.commits[j].Committer.When
+	if a.Equal(b) {
+		return q.order[i] < q.order[j]
+	}
+	return a.After(b)
+}
+func (q *dateQueue) Swap(i, j int) {
+	q.commits[i], q.commits[j] = q.commits[j], q.commits[i]
+	q.order[i], q.order[j] = q.order[j], q.order[i]
+}
+func (q *dateQueue) Push(x any) {
+	q.commits = append(q.commits, x.(*Commit))
+	q.order = append(q.order, q.pushed)
+	q.pushed++
+}
+func (q *dateQueue) Pop() any {
+	last := len(q.commits) - 1
+	c := q.commits[last]
+	q.commits, q.order = q.commits[:last], q.order[:last]
+	return c
+}
+
+func walkDate(store object.ObjectStore, tips []string, opts WalkOptions, hidden map[string]bool, fn func(*Commit) error) error {
+	seen := make(map[string]bool)
+	queue := &dateQueue{}
+	push := func(hash string) error {
+		if seen[hash] || hidden[hash] {
+			return nil
+		}
+		seen[hash] = true
+		c, err := ParseCommit(store, hash)
+		if err != nil {
+			return err
+		}
+		heap.Push(queue, c)
+		return nil
+	}
+
+	for _, tip := range tips {
+		if err := push(tip); err != nil {
+			return err
+		}
+	}
+	for queue.Len() > 0 {
+		c := heap.Pop(queue).(*Commit)
+		if err := fn(c); err != nil {
+			return err
+		}
+		for _, parent := range c.walkParents(opts) {
+			if err := push(parent); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func walkTopo(store object.ObjectStore, tips []string, opts WalkOptions, hidden map[string]bool, fn func(*Commit) error) error {
+	commits := make(map[string]*Commit)
+	// Number of children of every commit that haven't been emitted yet.
+	children := make(map[string]int)
+	var visible []string
+	for _, tip := range tips {
+		if !hidden[tip] {
+			visible = append(visible, tip)
+		}
+	}
+	tips = visible
+	pending := append([]string{}, tips...)
+	for len(pending) > 0 {
+		hash := pending[len(pending)-1]
+		pending = pending[:len(pending)-1]
+		if _, ok := commits[hash]; ok {
+			continue
+		}
+		c, err := ParseCommit(store, hash)
+		if err != nil {
+			return err
+		}
+		commits[hash] = c
+		for _, parent := range c.walkParents(opts) {
+			if hidden[parent] {
+				continue
+			}
+			children[parent]++
+			pending = append(pending, parent)
+		}
+	}
+
+	// A commit is ready once all its children were emitted. Ready commits are
+	// a stack, so the parents of a commit come next and lines stay together.
+	var ready []*Commit
+	emitted := make(map[string]bool)
+	for i := len(tips) - 1; i >= 0; i-- {
+		if c := commits[tips[i]]; children[c.Hash] == 0 && !emitted[c.Hash] {
+			emitted[c.Hash] = true
+			ready = append(ready, c)
+		}
+	}
+	for len(ready) > 0 {
+		c := ready[len(ready)-1]
+		ready = ready[:len(ready)-1]
+		if err := fn(c); err != nil {
+			return err
+		}
+		parents := c.walkParents(opts)
+		// Pushed in reverse so the first parent is handled first.
+		for i := len(parents) - 1; i >= 0; i-- {
+			if hidden[parents[i]] {
+				continue
+			}
+			children[parents[i]]--
+			if children[parents[i]] == 0 && !emitted[parents[i]] {
+				emitted[parents[i]] = true
+				ready = append(ready, commits[parents[i]])
+			}
+		}
+	}
+	return nil
+}
+
+// Returns the best common ancestors of a and b: the commits reachable from
+// both that aren't ancestors of another such commit. Usually there is one,
+// criss-cross merges can have several, unrelated histories have none.
+func MergeBases(store object.ObjectStore, a, b string) ([]string, error) {
+	fromA := make(map[string]bool)
+	err := Walk(store, []string{a}, WalkOptions{}, func(c *Commit) error {
+		fromA[c.Hash] = true
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Common ancestors found walking from b. Their parents aren't followed,
+	// since those are common ancestors too but never the best ones.
+	var candidates []string
+	seen := map[string]bool{b: true}
+	pending := []string{b}
+	for len(pending) > 0 {
+		hash := pending[0]
+		pending = pending[1:]
+		if fromA[hash] {
+			candidates = append(candidates, hash)
+			continue
+		}
+		c, err := ParseCommit(store, hash)
+		if err != nil {
+			return nil, err
+		}
+		for _, parent := range c.Parents {
+			if !seen[parent] {
+				seen[parent] = true
+				pending = append(pending, parent)
+			}
+		}
+	}
+	if len(candidates) < 2 {
+		return candidates, nil
+	}
+
+	// A candidate reachable from another one isn't a best ancestor.
+	redundant := make(map[string]bool)
+	for _, candidate := range candidates {
+		if redundant[candidate] {
+			continue
+		}
+		c, err := ParseCommit(store, candidate)
+		if err != nil {
+			return nil, err
+		}
+		err = Walk(store, c.Parents, WalkOptions{}, func(ancestor *Commit) error {
+			redundant[ancestor.Hash] = true
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	var bases []string
+	for _, candidate := range candidates {
+		if !redundant[candidate] {
+			bases = append(bases, candidate)
+		}
+	}
+	return bases, nil
+}
@@ -0,0 +1,319 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+var ErrInvalidKey = errors.New("invalid config key")
+
+type Level int
+
+// Levels a value can be set at, later levels take precedence.
+const (
+	LevelSystem Level = iota
+	LevelGlobal
+	LevelLocal
+)
+
+func (l Level) String() string {
+	switch l {
+	case LevelSystem:
+		return "system"
+	case LevelGlobal:
+		return "global"
+	default:
+		return "local"
+	}
+}
+
+// Returns the system wide config file, GIT_GO_CONFIG_SYSTEM or /etc/gitgoconfig.
+func SystemPath() string {
+	if path := os.Getenv("GIT_GO_CONFIG_SYSTEM"); path != "" {
+		return path
+	}
+	return "/etc/gitgoconfig"
+}
+
+// Returns the config file of the user, GIT_GO_CONFIG_GLOBAL or ~/.gitgoconfig.
+func GlobalPath() string {
+	if path := os.Getenv("GIT_GO_CONFIG_GLOBAL"); path != "" {
+		return path
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".gitgoconfig")
+}
+
+// A value read from a config file.
+type Entry struct {
+	// The canonical key, section and name lowercased: section.subsection.name.
+	Key   string
+	Value string
+	Level Level
+	// The file the value was read from, an included file for included values.
+	Source string
+	// Set for a name without "= value", which is a true boolean.
+	implicit bool
+}
+
+// The merged values of all config files of a repository.
+type Config struct {
+	// In order of precedence, the last value of a key wins.
+	entries []Entry
+}
+
+// Reads the system, global and local config files, local may be "".
+// Missing files are skipped.
+func Load(localPath string) (*Config, error) {
+	c := &Config{}
+	for _, file := range []struct {
+		path  string
+		level Level
+	}{
+		{SystemPath(), LevelSystem},
+		{GlobalPath(), LevelGlobal},
+		{localPath, LevelLocal},
+	} {
+		if file.path == "" {
+			continue
+		}
+		if err := c.AddFile(file.path, file.level); err != nil {
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+// Adds the values of the file and the files it includes with a higher
+// precedence than the ones already loaded.
+func (c *Config) AddFile(path string, level Level) error {
+	return c.addFile(path, level, 0)
+}
+
+// Includes can't nest deeper than this, which also stops include cycles.
+const maxIncludeDepth = 10
+
+func (c *Config) addFile(path string, level Level, depth int) error {
+	if depth > maxIncludeDepth {
+		return fmt.Errorf("exceeded maximum include depth while including %s", path)
+	}
+	file, err := ReadFile(path)
+	if err != nil {
+		return err
+	}
+	for _, line := range file.lines {
+		if line.name == "" {
+			continue
+		}
+		entry := Entry{Key: line.key(), Value: line.value, Level: level, Source: path, implicit: line.implicit}
+		if entry.Key == "include.path" && !entry.implicit {
+			include, err := expandPath(entry.Value)
+			if err != nil {
+				return err
+			}
+			if !filepath.IsAbs(include) {
+				include = filepath.Join(filepath.Dir(path), include)
+			}
+			if err := c.addFile(include, level, depth+1); err != nil {
+				return err
+			}
+			continue
+		}
+		c.entries = append(c.entries, entry)
+	}
+	return nil
+}
+
+// Returns every value, lowest precedence first.
+func (c *Config) Entries() []Entry {
+	return c.entries
+}
+
+// Returns the value of the key with the highest precedence.
+func (c *Config) Get(key string) (string, bool) {
+	entry, ok := c.entry(key)
+	return entry.Value, ok
+}
+
+func (c *Config) entry(key string) (Entry, bool) {
+	canonical, err := CanonicalKey(key)
+	if err != nil {
+		return Entry{}, false
+	}
+	for i := len(c.entries) - 1; i >= 0; i-- {
+		if c.entries[i].Key == canonical {
+			return c.entries[i], true
+		}
+	}
+	return Entry{}, false
+}
+
+// Returns the value of the key or def if it isn't set.
+func (c *Config) GetString(key, def string) string {
+	if value, ok := c.Get(key); ok {
+		return value
+	}
+	return def
+}
+
+// Returns every value of a multi-valued key, lowest precedence first.
+func (c *Config) GetAll(key string) []string {
+	canonical, err := CanonicalKey(key)
+	if err != nil {
+		return nil
+	}
+	var values []string
+	for _, entry := range c.entries {
+		if entry.Key == canonical {
+			values = append(values, entry.Value)
+		}
+	}
+	return values
+}
+
+// Returns the key as a boolean: true, yes, on and 1 or false, no, off, 0 and "".
+// A name without a value is true.
+func (c *Config) Bool(key string, def bool) (bool, error) {
+	entry, ok := c.entry(key)
+	if !ok {
+		return def, nil
+	}
+	if entry.implicit {
+		return true, nil
+	}
+	value, ok := ParseBool(entry.Value)
+	if !ok {
+		return def, fmt.Errorf("bad boolean config value %q for %s", entry.Value, key)
+	}
+	return value, nil
+}
+
+func ParseBool(value string) (bool, bool) {
+	switch strings.ToLower(value) {
+	case "true", "yes", "on", "1":
+		return true, true
+	case "false", "no", "off", "0", "":
+		return false, true
+	}
+	return false, false
+}
+
+// Returns the key as an integer, which may have a k, m or g suffix.
+func (c *Config) Int(key string, def int64) (int64, error) {
+	value, ok := c.Get(key)
+	if !ok {
+		return def, nil
+	}
+	multiplier := int64(1)
+	if value != "" {
+		switch strings.ToLower(value[len(value)-1:]) {
+		case "k":
+			multiplier = 1 << 10
+		case "m":
+			multiplier = 1 << 20
+		case "g":
+			multiplier = 1 << 30
+		}
+		if multiplier != 1 {
+			value = value[:len(value)-1]
+		}
+	}
+	n, err := strconv.ParseInt(strings.TrimSpace(value), 10, 64)
+	if err != nil {
+		return def, fmt.Errorf("bad numeric config value %q for %s", value, key)
+	}
+	return n * multiplier, nil
+}
+
+// Returns the key as a path, a leading ~/ is expanded to the home directory.
+func (c *Config) Path(key string) (string, bool, error) {
+	value, ok := c.Get(key)
+	if !ok {
+		return "", false, nil
+	}
+	path, err := expandPath(value)
+	return path, true, err
+}
+
+func expandPath(path string) (string, error) {
+	if path != "~" && !strings.HasPrefix(path, "~/") {
+		return path, nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, path[1:]), nil
+}
+
+// Returns the key with the section and name lowercased, the subsection keeps
+// its case: Remote.Origin.URL becomes remote.Origin.url.
+func CanonicalKey(key string) (string, error) {
+	section, subsection, name, err := splitKey(key)
+	if err != nil {
+		return "", err
+	}
+	return joinKey(section, subsection, name), nil
+}
+
+func splitKey(key string) (section, subsection, name string, err error) {
+	first := strings.IndexByte(key, '.')
+	last := strings.LastIndexByte(key, '.')
+	if first <= 0 || last == len(key)-1 {
+		return "", "", "", fmt.Errorf("%w: %q, keys look like section.name", ErrInvalidKey, key)
+	}
+	section, name = strings.ToLower(key[:first]), strings.ToLower(key[last+1:])
+	if first != last {
+		subsection = key[first+1 : last]
+	}
+	if !validSection(section) || !validName(name) || strings.ContainsAny(subsection, "\n\x00") {
+		return "", "", "", fmt.Errorf("%w: %q", ErrInvalidKey, key)
+	}
+	return section, subsection, name, nil
+}
+
+func joinKey(section, subsection, name string) string {
+	if subsection != "" {
+		return section + "." + subsection + "." + name
+	}
+	return section + "." + name
+}
+
+func validSection(section string) bool {
+	if section == "" {
+		return false
+	}
+	for _, r := range section {
+		if !isAlnum(r) && r != '-' && r != '.' {
+			return false
+		}
+	}
+	return true
+}
+
+func validName(name string) bool {
+	if name == "" || !isLetter(rune(name[0])) {
+		return false
+	}
+	for _, r := range name {
+		if !isAlnum(r) && r != '-' {
+			return false
+		}
+	}
+	return true
+}
+
+func isLetter(r rune) bool {
+	return (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z')
+}
+
+func isAlnum(r rune) bool {
+	return isLetter(r) || (r >= '0' && r <= '9')
+}
@@ -0,0 +1,209 @@
+package config_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/f1-surya/git-go/config"
+)
+
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// Points the system and global config at files in a temporary directory.
+func isolate(t *testing.T) (string, string, string) {
+	t.Helper()
+	dir := t.TempDir()
+	system, global := filepath.Join(dir, "system"), filepath.Join(dir, "global")
+	t.Setenv("GIT_GO_CONFIG_SYSTEM", system)
+	t.Setenv("GIT_GO_CONFIG_GLOBAL", global)
+	return dir, system, global
+}
+
+func TestParse(t *testing.T) {
+	dir, _, _ := isolate(t)
+	local := filepath.Join(dir, "config")
+	writeFile(t, local, `# comment
+[core]
+	Bare = false ; trailing comment
+	enabled
+[remote "Origin"]
+	url = "  quoted # not a comment  "
+	escaped = a\tb\"c\\d
+	long = one \
+two
+[branch.main]
+	remote = origin
+[multi]
+	value = 1
+	value = 2
+`)
+	cfg, err := config.Load(local)
+	if err != nil {
+		t.Fatalf("Load errored: %v", err)
+	}
+
+	tests := map[string]string{
+		"core.bare":             "false",
+		"CORE.Bare":             "false",
+		"remote.Origin.url":     "  quoted # not a comment  ",
+		"remote.Origin.escaped": "a\tb\"c\\d",
+		"remote.Origin.long":    "one two",
+		"branch.main.remote":    "origin",
+		"multi.value":           "2",
+	}
+	for key, want := range tests {
+		if got, ok := cfg.Get(key); !ok || got != want {
+			t.Errorf("Get(%q) = %q, %v, want %q", key, got, ok, want)
+		}
+	}
+	if _, ok := cfg.Get("remote.origin.url"); ok {
+		t.Error("subsections should be case sensitive")
+	}
+	if got := cfg.GetAll("multi.value"); !reflect.DeepEqual(got, []string{"1", "2"}) {
+		t.Errorf("GetAll = %q", got)
+	}
+	if enabled, err := cfg.Bool("core.enabled", false); err != nil || !enabled {
+		t.Errorf("a name without a value should be true, got %v, %v", enabled, err)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, content := range []string{
+		"name = value\n",
+		"[core\n",
+		"[core]\n\tbad key = 1\n",
+		"[core]\n\tkey = \"unterminated\n",
+		"[core]\n\tkey = bad \\q escape\n",
+		"[core]\n\tkey = end \\",
+	} {
+		if _, err := config.Parse("config", []byte(content)); err == nil {
+			t.Errorf("Parse(%q) should fail", content)
+		}
+	}
+}
+
+func TestTypedGetters(t *testing.T) {
+	dir, _, _ := isolate(t)
+	local := filepath.Join(dir, "config")
+	writeFile(t, local, "[test]\n\tyes = yes\n\toff = off\n\tbad = maybe\n\tsize = 2k\n\tcount = 42\n\thome = ~/file\n")
+	cfg, err := config.Load(local)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if value, err := cfg.Bool("test.yes", false); err != nil || !value {
+		t.Errorf("Bool(test.yes) = %v, %v", value, err)
+	}
+	if value, err := cfg.Bool("test.off", true); err != nil || value {
+		t.Errorf("Bool(test.off) = %v, %v", value, err)
+	}
+	if _, err := cfg.Bool("test.bad", false); err == nil {
+		t.Error("Bool(test.bad) should fail")
+	}
+	if value, err := cfg.Bool("test.missing", true); err != nil || !value {
+		t.Errorf("Bool(test.missing) = %v, %v", value, err)
+	}
+	if value, err := cfg.Int("test.size", 0); err != nil || value != 2048 {
+		t.Errorf("Int(test.size) = %d, %v", value, err)
+	}
+	if value, err := cfg.Int("test.count", 0); err != nil || value != 42 {
+		t.Errorf("Int(test.count) = %d, %v", value, err)
+	}
+	if _, err := cfg.Int("test.yes", 0); err == nil {
+		t.Error("Int(test.yes) should fail")
+	}
+	home, _ := os.UserHomeDir()
+	if value, ok, err := cfg.Path("test.home"); err != nil || !ok || value != filepath.Join(home, "file") {
+		t.Errorf("Path(test.home) = %q, %v, %v", value, ok, err)
+	}
+}
+
+func TestPrecedenceAndIncludes(t *testing.T) {
+	dir, system, global := isolate(t)
+	local := filepath.Join(dir, "config")
+	writeFile(t, system, "[user]\n\tname = System\n\temail = system@example.com\n[core]\n\teditor = vi\n")
+	writeFile(t, global, "[user]\n\tname = Global\n[include]\n\tpath = included\n")
+	writeFile(t, filepath.Join(dir, "included"), "[user]\n\temail = included@example.com\n")
+	writeFile(t, local, "[user]\n\tname = Local\n")
+
+	cfg, err := config.Load(local)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for key, want := range map[string]string{
+		"user.name":   "Local",
+		"user.email":  "included@example.com",
+		"core.editor": "vi",
+	} {
+		if got, _ := cfg.Get(key); got != want {
+			t.Errorf("Get(%q) = %q, want %q", key, got, want)
+		}
+	}
+
+	var levels []config.Level
+	for _, entry := range cfg.Entries() {
+		if entry.Key == "user.name" {
+			levels = append(levels, entry.Level)
+		}
+	}
+	if !reflect.DeepEqual(levels, []config.Level{config.LevelSystem, config.LevelGlobal, config.LevelLocal}) {
+		t.Errorf("levels of user.name = %v", levels)
+	}
+
+	writeFile(t, local, "[include]\n\tpath = config\n")
+	if _, err := config.Load(local); err == nil {
+		t.Error("an include cycle should fail")
+	}
+}
+
+func TestEdit(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config")
+	writeFile(t, path, "# keep me\n[core]\n\tbare = false ; and me\n\n[multi]\n\tv = 1\n\tv = 2\n")
+
+	err := config.Edit(path, func(f *config.File) error {
+		if err := f.Set("core.editor", "my editor; vim"); err != nil {
+			return err
+		}
+		if err := f.Set("remote.origin.url", "https://example.com"); err != nil {
+			return err
+		}
+		if err := f.Set("multi.v", "3"); !errors.Is(err, config.ErrMultipleValues) {
+			t.Errorf("Set on a multi-valued key = %v", err)
+		}
+		if err := f.Unset("multi.v", false); !errors.Is(err, config.ErrMultipleValues) {
+			t.Errorf("Unset on a multi-valued key = %v", err)
+		}
+		if err := f.Unset("missing.key", false); !errors.Is(err, config.ErrNotSet) {
+			t.Errorf("Unset on a missing key = %v", err)
+		}
+		return f.Unset("multi.v", true)
+	})
+	if err != nil {
+		t.Fatalf("Edit errored: %v", err)
+	}
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "# keep me\n[core]\n\tbare = false ; and me\n\teditor = \"my editor; vim\"\n\n[multi]\n[remote \"origin\"]\n\turl = https://example.com\n"
+	if string(content) != want {
+		t.Errorf("file is\n%s\nwant\n%s", content, want)
+	}
+
+	f, err := config.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if values, _ := f.GetAll("core.editor"); !reflect.DeepEqual(values, []string{"my editor; vim"}) {
+		t.Errorf("editor after round trip = %q", values)
+	}
+}
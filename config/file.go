@@ -0,0 +1,369 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/f1-surya/git-go/lockfile"
+)
+
+var (
+	ErrNotSet         = errors.New("key is not set")
+	ErrMultipleValues = errors.New("key has multiple values")
+)
+
+// A line of a config file. Lines are kept as they were written so editing
+// a file doesn't change its comments or formatting.
+type line struct {
+	// The text of the line, several lines joined by \n for continued values.
+	raw        string
+	section    string
+	subsection string
+	// The lowercased name of a variable, "" for headers, comments and blank lines.
+	name     string
+	value    string
+	implicit bool
+}
+
+func (l line) key() string {
+	return joinKey(l.section, l.subsection, l.name)
+}
+
+// A config file in Git's INI syntax.
+type File struct {
+	Path  string
+	lines []line
+}
+
+// Reads and parses the file, a missing file is empty.
+func ReadFile(path string) (*File, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return &File{Path: path}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return Parse(path, data)
+}
+
+func Parse(path string, data []byte) (*File, error) {
+	f := &File{Path: path}
+	physical := strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+	if len(data) == 0 {
+		physical = nil
+	}
+
+	var section, subsection string
+	for i := 0; i < len(physical); i++ {
+		raw := strings.TrimSuffix(physical[i], "\r")
+		current := line{raw: raw, section: section, subsection: subsection}
+		trimmed := strings.TrimSpace(raw)
+
+		switch {
+		case trimmed == "" || trimmed[0] == '#' || trimmed[0] == ';':
+		case trimmed[0] == '[':
+			var err error
+			section, subsection, err = parseHeader(trimmed)
+			if err != nil {
+				return nil, fmt.Errorf("bad config line %d in %s: %w", i+1, path, err)
+			}
+			current.section, current.subsection = section, subsection
+		default:
+			if section == "" {
+				return nil, fmt.Errorf("bad config line %d in %s: variable outside of a section", i+1, path)
+			}
+			nameEnd := 0
+			for nameEnd < len(trimmed) && (isAlnum(rune(trimmed[nameEnd])) || trimmed[nameEnd] == '-') {
+				nameEnd++
+			}
+			current.name = strings.ToLower(trimmed[:nameEnd])
+			if !validName(current.name) {
+				return nil, fmt.Errorf("bad config line %d in %s: invalid name", i+1, path)
+			}
+			rest := strings.TrimSpace(trimmed[nameEnd:])
+			if rest == "" || rest[0] == '#' || rest[0] == ';' {
+				current.implicit = true
+				break
+			}
+			if rest[0] != '=' {
+				return nil, fmt.Errorf("bad config line %d in %s: expected =", i+1, path)
+			}
+			rest = rest[1:]
+			for {
+				value, continued, err := parseValue(rest)
+				if err != nil {
+					return nil, fmt.Errorf("bad config line %d in %s: %w", i+1, path, err)
+				}
+				if !continued {
+					current.value = value
+					break
+				}
+				if i+1 == len(physical) {
+					return nil, fmt.Errorf("bad config line %d in %s: continuation at end of file", i+1, path)
+				}
+				i++
+				next := strings.TrimSuffix(physical[i], "\r")
+				current.raw += "\n" + next
+				rest += "\n" + next
+			}
+		}
+		f.lines = append(f.lines, current)
+	}
+	return f, nil
+}
+
+// Parses [section], [section "subsection"] and the older [section.subsection].
+func parseHeader(header string) (string, string, error) {
+	end := strings.LastIndexByte(header, ']')
+	if end == -1 {
+		return "", "", errors.New("unterminated section header")
+	}
+	if rest := strings.TrimSpace(header[end+1:]); rest != "" && rest[0] != '#' && rest[0] != ';' {
+		return "", "", errors.New("unexpected text after section header")
+	}
+	content := header[1:end]
+
+	name, quoted, hasSubsection := strings.Cut(content, " ")
+	name = strings.ToLower(name)
+	if !hasSubsection {
+		section, subsection, _ := strings.Cut(name, ".")
+		if !validSection(section) {
+			return "", "", fmt.Errorf("invalid section name %q", name)
+		}
+		return section, subsection, nil
+	}
+
+	quoted = strings.TrimSpace(quoted)
+	if len(quoted) < 2 || quoted[0] != '"' || quoted[len(quoted)-1] != '"' {
+		return "", "", errors.New("subsection names must be quoted")
+	}
+	var subsection strings.Builder
+	for i := 1; i < len(quoted)-1; i++ {
+		if quoted[i] == '\\' && i+1 < len(quoted)-1 {
+			i++
+		} else if quoted[i] == '"' {
+			return "", "", errors.New("unescaped quote in subsection name")
+		}
+		subsection.WriteByte(quoted[i])
+	}
+	if !validSection(name) {
+		return "", "", fmt.Errorf("invalid section name %q", name)
+	}
+	return name, subsection.String(), nil
+}
+
+// Parses the text after the = of a variable. Reports whether the value
+// continues on the next line because the text ends with a backslash.
+func parseValue(text string) (string, bool, error) {
+	var value strings.Builder
+	// Whitespace outside quotes is only kept between other characters.
+	var space strings.Builder
+	started, quoted := false, false
+
+	flushSpace := func() {
+		if started {
+			value.WriteString(space.String())
+		}
+		space.Reset()
+	}
+
+loop:
+	for i := 0; i < len(text); i++ {
+		c := text[i]
+		switch {
+		case c == '\\':
+			if i+1 == len(text) {
+				return "", true, nil
+			}
+			i++
+			switch text[i] {
+			case '\n':
+				continue
+			case 'n':
+				c = '\n'
+			case 't':
+				c = '\t'
+			case 'b':
+				c = '\b'
+			case '\\', '"':
+				c = text[i]
+			default:
+				return "", false, fmt.Errorf("bad escape sequence \\%c", text[i])
+			}
+			flushSpace()
+			value.WriteByte(c)
+			started = true
+		case c == '"':
+			flushSpace()
+			quoted = !quoted
+			started = true
+		case quoted:
+			value.WriteByte(c)
+		case c == ';' || c == '#':
+			break loop
+		case c == ' ' || c == '\t':
+			space.WriteByte(c)
+		default:
+			flushSpace()
+			value.WriteByte(c)
+			started = true
+		}
+	}
+	if quoted {
+		return "", false, errors.New("unterminated quoted value")
+	}
+	return value.String(), false, nil
+}
+
+func formatValue(value string) string {
+	needsQuotes := value != strings.TrimSpace(value) || strings.ContainsAny(value, ";#")
+	replacer := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`, "\t", `\t`, "\b", `\b`)
+	value = replacer.Replace(value)
+	if needsQuotes {
+		return `"` + value + `"`
+	}
+	return value
+}
+
+func formatHeader(section, subsection string) string {
+	if subsection == "" {
+		return "[" + section + "]"
+	}
+	return fmt.Sprintf("[%s \"%s\"]", section, strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(subsection))
+}
+
+func variableLine(section, subsection, name, value string) line {
+	return line{
+		raw:        "\t" + name + " = " + formatValue(value),
+		section:    section,
+		subsection: subsection,
+		name:       name,
+		value:      value,
+	}
+}
+
+// Returns the values of the key in this file alone.
+func (f *File) GetAll(key string) ([]string, error) {
+	canonical, err := CanonicalKey(key)
+	if err != nil {
+		return nil, err
+	}
+	var values []string
+	for _, l := range f.lines {
+		if l.name != "" && l.key() == canonical {
+			values = append(values, l.value)
+		}
+	}
+	return values, nil
+}
+
+// Sets the key to value, replacing its current value. Fails with
+// ErrMultipleValues if the key has several values.
+func (f *File) Set(key, value string) error {
+	section, subsection, name, err := splitKey(key)
+	if err != nil {
+		return err
+	}
+	canonical := joinKey(section, subsection, name)
+	found := -1
+	for i, l := range f.lines {
+		if l.name != "" && l.key() == canonical {
+			if found != -1 {
+				return fmt.Errorf("%w: %s", ErrMultipleValues, key)
+			}
+			found = i
+		}
+	}
+	if found == -1 {
+		return f.Add(key, value)
+	}
+	f.lines[found] = variableLine(section, subsection, name, value)
+	return nil
+}
+
+// Adds a value to the key, keeping the values it already has.
+func (f *File) Add(key, value string) error {
+	section, subsection, name, err := splitKey(key)
+	if err != nil {
+		return err
+	}
+	newLine := variableLine(section, subsection, name, value)
+
+	last := -1
+	for i, l := range f.lines {
+		if l.section == section && l.subsection == subsection && (l.name != "" || strings.HasPrefix(strings.TrimSpace(l.raw), "[")) {
+			last = i
+		}
+	}
+	if last == -1 {
+		header := line{raw: formatHeader(section, subsection), section: section, subsection: subsection}
+		f.lines = append(f.lines, header, newLine)
+		return nil
+	}
+	f.lines = append(f.lines[:last+1], append([]line{newLine}, f.lines[last+1:]...)...)
+	return nil
+}
+
+// Removes the key. Fails with ErrMultipleValues if it has several values
+// and all is false, and with ErrNotSet if it isn't set in this file.
+func (f *File) Unset(key string, all bool) error {
+	canonical, err := CanonicalKey(key)
+	if err != nil {
+		return err
+	}
+	var kept []line
+	removed := 0
+	for _, l := range f.lines {
+		if l.name != "" && l.key() == canonical {
+			removed++
+			continue
+		}
+		kept = append(kept, l)
+	}
+	if removed == 0 {
+		return fmt.Errorf("%w: %s", ErrNotSet, key)
+	}
+	if removed > 1 && !all {
+		return fmt.Errorf("%w: %s", ErrMultipleValues, key)
+	}
+	f.lines = kept
+	return nil
+}
+
+func (f *File) Bytes() []byte {
+	var b strings.Builder
+	for _, l := range f.lines {
+		b.WriteString(l.raw)
+		b.WriteString("\n")
+	}
+	return []byte(b.String())
+}
+
+// Applies fn to the file at path and writes the result. The file is locked
+// while it's edited, so concurrent edits can't be lost.
+func Edit(path string, fn func(*File) error) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	lock, err := lockfile.Acquire(path, lockfile.DefaultOptions)
+	if err != nil {
+		return err
+	}
+	defer lock.Rollback()
+
+	f, err := ReadFile(path)
+	if err != nil {
+		return err
+	}
+	if err := fn(f); err != nil {
+		return err
+	}
+	if _, err := lock.Write(f.Bytes()); err != nil {
+		return err
+	}
+	return lock.Commit()
+}
@@ -0,0 +1,169 @@
+package diff
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// The algorithm finding the lines two files have in common. They all find a
+// minimal or close to minimal diff, but pick different lines to keep when
+// several choices are equally short.
+type Algorithm int
+
+const (
+	// Myers' O(ND) algorithm, git's default.
+	Myers Algorithm = iota
+	// Matches lines that are unique in both files first, which keeps
+	// function boundaries and braces from being matched up wrongly.
+	Patience
+	// Like patience, but matches the rarest lines first, which also works
+	// for lines that aren't unique.
+	Histogram
+)
+
+func (a Algorithm) String() string {
+	switch a {
+	case Patience:
+		return "patience"
+	case Histogram:
+		return "histogram"
+	}
+	return "myers"
+}
+
+// Returns the algorithm of the given name, as in git's diff.algorithm.
+func ParseAlgorithm(name string) (Algorithm, error) {
+	switch strings.ToLower(name) {
+	case "myers", "default", "minimal":
+		return Myers, nil
+	case "patience":
+		return Patience, nil
+	case "histogram":
+		return Histogram, nil
+	}
+	return Myers, fmt.Errorf("unknown diff algorithm %q", name)
+}
+
+type Op byte
+
+const (
+	Equal  Op = ' '
+	Delete Op = '-'
+	Insert Op = '+'
+)
+
+// A line of the edit script turning one file into another.
+type Edit struct {
+	Op Op
+	// The number of lines of the old and the new file before this line, which
+	// is the index of the line on the side it's on.
+	Old, New int
+	// The line with its newline, which the last line may not have.
+	Text string
+}
+
+// Splits content into lines, each ending with its newline except for a
+// last line without one.
+func Lines(content []byte) []string {
+	var lines []string
+	for len(content) > 0 {
+		end := bytes.IndexByte(content, '\n') + 1
+		if end == 0 {
+			end = len(content)
+		}
+		lines = append(lines, string(content[:end]))
+		content = content[end:]
+	}
+	return lines
+}
+
+// Git treats content with a NUL byte among its first 8000 bytes as binary.
+const binaryCheckSize = 8000
+
+// Reports whether the content looks like a binary file rather than text.
+func IsBinary(content []byte) bool {
+	return bytes.IndexByte(content[:min(len(content), binaryCheckSize)], 0) != -1
+}
+
+// Returns the edit script turning the lines of a into the lines of b, using
+// the given algorithm.
+func Diff(a, b []string, algorithm Algorithm) []Edit {
+	// Lines are compared as small integers.
+	ids := make(map[string]int)
+	intern := func(lines []string) []int {
+		result := make([]int, len(lines))
+		for i, line := range lines {
+			id, ok := ids[line]
+			if !ok {
+				id = len(ids)
+				ids[line] = id
+			}
+			result[i] = id
+		}
+		return result
+	}
+	d := differ{
+		a:       intern(a),
+		b:       intern(b),
+		removed: make([]bool, len(a)),
+		added:   make([]bool, len(b)),
+	}
+	switch algorithm {
+	case Patience:
+		d.patience(0, len(a), 0, len(b))
+	case Histogram:
+		d.histogram(0, len(a), 0, len(b))
+	default:
+		d.myers(0, len(a), 0, len(b))
+	}
+
+	var edits []Edit
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && d.removed[i]:
+			edits = append(edits, Edit{Op: Delete, Old: i, New: j, Text: a[i]})
+			i++
+		case j < len(b) && d.added[j]:
+			edits = append(edits, Edit{Op: Insert, Old: i, New: j, Text: b[j]})
+			j++
+		default:
+			edits = append(edits, Edit{Op: Equal, Old: i, New: j, Text: a[i]})
+			i++
+			j++
+		}
+	}
+	return edits
+}
+
+// Marks the lines of a that are removed and the lines of b that are added.
+// The algorithms work on the ranges a[aLo:aHi] and b[bLo:bHi] and leave the
+// lines they keep unmarked, so the unmarked lines of both sides pair up.
+type differ struct {
+	a, b           []int
+	removed, added []bool
+}
+
+// Narrows the ranges to the part between their common prefix and suffix.
+func (d *differ) trim(aLo, aHi, bLo, bHi int) (int, int, int, int) {
+	for aLo < aHi && bLo < bHi && d.a[aLo] == d.b[bLo] {
+		aLo++
+		bLo++
+	}
+	for aLo < aHi && bLo < bHi && d.a[aHi-1] == d.b[bHi-1] {
+		aHi--
+		bHi--
+	}
+	return aLo, aHi, bLo, bHi
+}
+
+// Marks the whole ranges as changed.
+func (d *differ) replace(aLo, aHi, bLo, bHi int) {
+	for i := aLo; i < aHi; i++ {
+		d.removed[i] = true
+	}
+	for j := bLo; j < bHi; j++ {
+		d.added[j] = true
+	}
+}
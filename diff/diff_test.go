@@ -0,0 +1,171 @@
+package diff_test
+
+import (
+	"bytes"
+	"math/rand"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/f1-surya/git-go/diff"
+)
+
+var algorithms = []diff.Algorithm{diff.Myers, diff.Patience, diff.Histogram}
+
+func TestLines(t *testing.T) {
+	for content, want := range map[string][]string{
+		"":           nil,
+		"a\nb\n":     {"a\n", "b\n"},
+		"a\nb":       {"a\n", "b"},
+		"\n\nlast\n": {"\n", "\n", "last\n"},
+	} {
+		if got := diff.Lines([]byte(content)); !reflect.DeepEqual(got, want) {
+			t.Errorf("Lines(%q) = %q, want %q", content, got, want)
+		}
+	}
+}
+
+// Applies the edit script and checks that it turns a into b.
+func checkEdits(t *testing.T, a, b []string, edits []diff.Edit) int {
+	t.Helper()
+	var old, new []string
+	changes := 0
+	for _, e := range edits {
+		if e.Op != diff.Insert {
+			if e.Old != len(old) || a[e.Old] != e.Text {
+				t.Fatalf("Edit %+v doesn't match old line %d", e, len(old))
+			}
+			old = append(old, e.Text)
+		}
+		if e.Op != diff.Delete {
+			if e.New != len(new) || b[e.New] != e.Text {
+				t.Fatalf("Edit %+v doesn't match new line %d", e, len(new))
+			}
+			new = append(new, e.Text)
+		}
+		if e.Op != diff.Equal {
+			changes++
+		}
+	}
+	if len(old) != len(a) || len(new) != len(b) {
+		t.Fatalf("Edits cover %d and %d lines, want %d and %d", len(old), len(new), len(a), len(b))
+	}
+	return changes
+}
+
+// The length of the longest common subsequence, the slow way.
+func lcs(a, b []string) int {
+	lengths := make([][]int, len(a)+1)
+	for i := range lengths {
+		lengths[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lengths[i][j] = lengths[i+1][j+1] + 1
+			} else {
+				lengths[i][j] = max(lengths[i+1][j], lengths[i][j+1])
+			}
+		}
+	}
+	return lengths[0][0]
+}
+
+func TestAlgorithms(t *testing.T) {
+	random := rand.New(rand.NewSource(1))
+	randomLines := func() []string {
+		lines := make([]string, random.Intn(30))
+		for i := range lines {
+			lines[i] = string(rune('a' + random.Intn(5)))
+		}
+		return lines
+	}
+	for range 500 {
+		a, b := randomLines(), randomLines()
+		for _, algorithm := range algorithms {
+			changes := checkEdits(t, a, b, diff.Diff(a, b, algorithm))
+			minimal := len(a) + len(b) - 2*lcs(a, b)
+			if algorithm == diff.Myers && changes != minimal {
+				t.Fatalf("Myers made %d changes for %q -> %q, the minimum is %d", changes, a, b, minimal)
+			}
+		}
+	}
+}
+
+func TestPatienceKeepsUniqueLines(t *testing.T) {
+	a := diff.Lines([]byte("void a() {\n  x();\n}\n\nvoid b() {\n  y();\n}\n"))
+	b := diff.Lines([]byte("void a() {\n  x();\n}\n\nvoid c() {\n  z();\n}\n\nvoid b() {\n  y();\n}\n"))
+	for _, algorithm := range []diff.Algorithm{diff.Patience, diff.Histogram} {
+		var added []string
+		for _, e := range diff.Diff(a, b, algorithm) {
+			if e.Op == diff.Insert {
+				added = append(added, e.Text)
+			} else if e.Op == diff.Delete {
+				t.Fatalf("%s deleted %q", algorithm, e.Text)
+			}
+		}
+		if got := strings.Join(added, ""); got != "void c() {\n  z();\n}\n\n" {
+			t.Fatalf("%s added %q", algorithm, got)
+		}
+	}
+}
+
+func TestUnified(t *testing.T) {
+	a := diff.Lines([]byte("1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n11\n12\nlast"))
+	b := diff.Lines([]byte("1\n2\nthree\n4\n5\n6\n7\n8\n9\n10\n11\n12\nlast\n"))
+	want := "@@ -1,6 +1,6 @@\n 1\n 2\n-3\n+three\n 4\n 5\n 6\n" +
+		"@@ -10,4 +10,4 @@\n 10\n 11\n 12\n-last\n\\ No newline at end of file\n+last\n"
+	for _, algorithm := range algorithms {
+		var out bytes.Buffer
+		if err := diff.WriteUnified(&out, diff.Hunks(diff.Diff(a, b, algorithm), 3)); err != nil {
+			t.Fatalf("WriteUnified errored: %v", err)
+		}
+		if out.String() != want {
+			t.Fatalf("%s unified diff:\n%s\nwant:\n%s", algorithm, out.String(), want)
+		}
+	}
+
+	// Wider context merges the hunks, no context leaves only the changes.
+	if hunks := diff.Hunks(diff.Diff(a, b, diff.Myers), 5); len(hunks) != 1 || hunks[0].Header() != "@@ -1,13 +1,13 @@" {
+		t.Fatalf("Hunks with 5 lines of context = %+v", hunks)
+	}
+	if hunks := diff.Hunks(diff.Diff(a, b, diff.Myers), 0); len(hunks) != 2 || hunks[0].Header() != "@@ -3 +3 @@" {
+		t.Fatalf("Hunks without context = %+v", hunks)
+	}
+
+	// Files that are created or emptied start at line 0 on the empty side.
+	added := diff.Hunks(diff.Diff(nil, []string{"x\n"}, diff.Myers), 3)
+	if len(added) != 1 || added[0].Header() != "@@ -0,0 +1 @@" {
+		t.Fatalf("Hunks of a new file = %+v", added)
+	}
+	removed := diff.Hunks(diff.Diff([]string{"x\n", "y\n"}, nil, diff.Myers), 3)
+	if len(removed) != 1 || removed[0].Header() != "@@ -1,2 +0,0 @@" {
+		t.Fatalf("Hunks of a removed file = %+v", removed)
+	}
+	if hunks := diff.Hunks(diff.Diff(a, a, diff.Myers), 3); len(hunks) != 0 {
+		t.Fatalf("Hunks of equal files = %+v", hunks)
+	}
+}
+
+func TestIsBinary(t *testing.T) {
+	if diff.IsBinary([]byte("plain text\n")) || diff.IsBinary(nil) {
+		t.Fatalf("Text detected as binary")
+	}
+	if !diff.IsBinary([]byte("PNG\x00\x01")) {
+		t.Fatalf("NUL byte not detected as binary")
+	}
+	if diff.IsBinary(append(bytes.Repeat([]byte("a"), 8000), 0)) {
+		t.Fatalf("NUL byte after the first 8000 bytes detected as binary")
+	}
+}
+
+func TestParseAlgorithm(t *testing.T) {
+	for _, algorithm := range algorithms {
+		if got, err := diff.ParseAlgorithm(algorithm.String()); err != nil || got != algorithm {
+			t.Fatalf("ParseAlgorithm(%s) = %v, %v", algorithm, got, err)
+		}
+	}
+	if _, err := diff.ParseAlgorithm("fast"); err == nil {
+		t.Fatalf("ParseAlgorithm of an unknown name didn't error")
+	}
+}
@@ -0,0 +1,60 @@
+package diff
+
+// Lines occurring more often than this in a range aren't used as anchors by
+// the histogram algorithm, like in JGit and git.
+const maxChainLength = 64
+
+// Finds the longest run of common lines that contains the line occurring
+// least often in a, keeps it and diffs the ranges before and after it the
+// same way. Ranges where every common line is too frequent fall back to Myers.
+func (d *differ) histogram(aLo, aHi, bLo, bHi int) {
+	aLo, aHi, bLo, bHi = d.trim(aLo, aHi, bLo, bHi)
+	if aLo == aHi || bLo == bHi {
+		d.replace(aLo, aHi, bLo, bHi)
+		return
+	}
+
+	positions := make(map[int][]int)
+	for i := aLo; i < aHi; i++ {
+		positions[d.a[i]] = append(positions[d.a[i]], i)
+	}
+	count := func(line int) int { return len(positions[line]) }
+
+	bestA, bestB, bestLen := 0, 0, 0
+	bestCount := maxChainLength + 1
+	for j := bLo; j < bHi; {
+		next := j + 1
+		candidates := positions[d.b[j]]
+		if len(candidates) == 0 || len(candidates) > bestCount {
+			j = next
+			continue
+		}
+		for _, i := range candidates {
+			// Grow the match in both directions.
+			startA, startB, endA, endB := i, j, i+1, j+1
+			lowest := len(candidates)
+			for startA > aLo && startB > bLo && d.a[startA-1] == d.b[startB-1] {
+				startA--
+				startB--
+				lowest = min(lowest, count(d.a[startA]))
+			}
+			for endA < aHi && endB < bHi && d.a[endA] == d.b[endB] {
+				lowest = min(lowest, count(d.a[endA]))
+				endA++
+				endB++
+			}
+			next = max(next, endB)
+			if endA-startA > bestLen || lowest < bestCount {
+				bestA, bestB, bestLen, bestCount = startA, startB, endA-startA, lowest
+			}
+		}
+		j = next
+	}
+
+	if bestLen == 0 {
+		d.myers(aLo, aHi, bLo, bHi)
+		return
+	}
+	d.histogram(aLo, bestA, bLo, bestB)
+	d.histogram(bestA+bestLen, aHi, bestB+bestLen, bHi)
+}
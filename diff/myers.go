@@ -0,0 +1,136 @@
+package diff
+
+import "math"
+
+// Finds a shortest edit script with Myers' algorithm in linear space: the
+// middle snake of an optimal path splits the problem in two halves that are
+// solved recursively.
+func (d *differ) myers(aLo, aHi, bLo, bHi int) {
+	aLo, aHi, bLo, bHi = d.trim(aLo, aHi, bLo, bHi)
+	if aLo == aHi || bLo == bHi {
+		d.replace(aLo, aHi, bLo, bHi)
+		return
+	}
+	x, y, ok := d.middleSnake(aLo, aHi, bLo, bHi)
+	if !ok {
+		d.replace(aLo, aHi, bLo, bHi)
+		return
+	}
+	d.myers(aLo, x, bLo, y)
+	d.myers(x, aHi, y, bHi)
+}
+
+// Like git, the search for the middle snake gives up after this many steps, or
+// the square root of the size of the ranges if that's more, and splits at the
+// furthest point the forward search reached instead. The diff may then be a
+// little longer than necessary, but finding it doesn't take quadratic time.
+const minMaxCost = 256
+
+// Searches forward from the start and backward from the end of the ranges at
+// the same time, and returns the point where the two paths meet, which is on
+// a shortest path. The ranges must not start or end with the same line.
+func (d *differ) middleSnake(aLo, aHi, bLo, bHi int) (int, int, bool) {
+	n, m := aHi-aLo, bHi-bLo
+	maxD := (n + m + 1) / 2
+	maxCost := max(minMaxCost, int(math.Sqrt(float64(n+m))))
+	offset := maxD
+	// The furthest x reached on every diagonal k = x - y, forward in v1 and
+	// backward, counted from the end, in v2.
+	v1 := make([]int, 2*maxD+2)
+	v2 := make([]int, 2*maxD+2)
+	for i := range v1 {
+		v1[i], v2[i] = -1, -1
+	}
+	v1[offset+1], v2[offset+1] = 0, 0
+	delta := n - m
+	// With an odd delta the forward path meets a backward path of one edit
+	// less, otherwise the backward path meets a forward path of as many edits.
+	front := delta%2 != 0
+	// Diagonals that ran off the edges are skipped from then on.
+	k1Start, k1End, k2Start, k2End := 0, 0, 0, 0
+
+	for step := 0; step < maxD; step++ {
+		if step >= maxCost {
+			return d.furthestPoint(aLo, bLo, n, m, v1, offset, step)
+		}
+		for k1 := -step + k1Start; k1 <= step-k1End; k1 += 2 {
+			i := offset + k1
+			var x int
+			if k1 == -step || (k1 != step && v1[i-1] < v1[i+1]) {
+				x = v1[i+1]
+			} else {
+				x = v1[i-1] + 1
+			}
+			y := x - k1
+			for x < n && y < m && d.a[aLo+x] == d.b[bLo+y] {
+				x++
+				y++
+			}
+			v1[i] = x
+			switch {
+			case x > n:
+				k1End += 2
+			case y > m:
+				k1Start += 2
+			case front:
+				j := offset + delta - k1
+				if j >= 0 && j < len(v2) && v2[j] != -1 && x >= n-v2[j] {
+					return aLo + x, bLo + y, true
+				}
+			}
+		}
+
+		for k2 := -step + k2Start; k2 <= step-k2End; k2 += 2 {
+			i := offset + k2
+			var x int
+			if k2 == -step || (k2 != step && v2[i-1] < v2[i+1]) {
+				x = v2[i+1]
+			} else {
+				x = v2[i-1] + 1
+			}
+			y := x - k2
+			for x < n && y < m && d.a[aHi-x-1] == d.b[bHi-y-1] {
+				x++
+				y++
+			}
+			v2[i] = x
+			switch {
+			case x > n:
+				k2End += 2
+			case y > m:
+				k2Start += 2
+			case !front:
+				j := offset + delta - k2
+				if j >= 0 && j < len(v1) && v1[j] != -1 {
+					x1 := v1[j]
+					y1 := offset + x1 - j
+					if x1 >= n-x {
+						return aLo + x1, bLo + y1, true
+					}
+				}
+			}
+		}
+	}
+	// Nothing in common.
+	return 0, 0, false
+}
+
+// Returns the point on the forward paths of the given length that got
+// furthest, which splits the ranges when the search takes too long.
+func (d *differ) furthestPoint(aLo, bLo, n, m int, v1 []int, offset, step int) (int, int, bool) {
+	bestX, bestY := -1, -1
+	for k := -step + 1; k <= step-1; k += 2 {
+		x := v1[offset+k]
+		y := x - k
+		if x < 0 || x > n || y < 0 || y > m || x+y == n+m {
+			continue
+		}
+		if x+y > bestX+bestY {
+			bestX, bestY = x, y
+		}
+	}
+	if bestX+bestY <= 0 {
+		return 0, 0, false
+	}
+	return aLo + bestX, bLo + bestY, true
+}
@@ -0,0 +1,75 @@
+package diff
+
+import "sort"
+
+// Matches the lines that appear exactly once in both ranges, keeping the
+// longest run of them in the same order, and diffs the gaps between them the
+// same way. Ranges without such lines fall back to Myers.
+func (d *differ) patience(aLo, aHi, bLo, bHi int) {
+	aLo, aHi, bLo, bHi = d.trim(aLo, aHi, bLo, bHi)
+	if aLo == aHi || bLo == bHi {
+		d.replace(aLo, aHi, bLo, bHi)
+		return
+	}
+
+	type occurrence struct{ countA, countB, indexA, indexB int }
+	lines := make(map[int]*occurrence)
+	for i := aLo; i < aHi; i++ {
+		o := lines[d.a[i]]
+		if o == nil {
+			o = &occurrence{}
+			lines[d.a[i]] = o
+		}
+		o.countA++
+		o.indexA = i
+	}
+	for j := bLo; j < bHi; j++ {
+		if o := lines[d.b[j]]; o != nil {
+			o.countB++
+			o.indexB = j
+		}
+	}
+	var unique [][2]int
+	for _, o := range lines {
+		if o.countA == 1 && o.countB == 1 {
+			unique = append(unique, [2]int{o.indexA, o.indexB})
+		}
+	}
+	if len(unique) == 0 {
+		d.myers(aLo, aHi, bLo, bHi)
+		return
+	}
+	sort.Slice(unique, func(i, j int) bool { return unique[i][0] < unique[j][0] })
+
+	prevA, prevB := aLo, bLo
+	for _, match := range longestIncreasing(unique) {
+		d.patience(prevA, match[0], prevB, match[1])
+		prevA, prevB = match[0]+1, match[1]+1
+	}
+	d.patience(prevA, aHi, prevB, bHi)
+}
+
+// Returns the longest subsequence of the pairs, which are sorted by their
+// first element, whose second elements increase too. Patience sorting deals
+// the pairs onto piles, each remembering the top of the pile before it.
+func longestIncreasing(pairs [][2]int) [][2]int {
+	var tops []int
+	prev := make([]int, len(pairs))
+	for i, pair := range pairs {
+		pile := sort.Search(len(tops), func(p int) bool { return pairs[tops[p]][1] > pair[1] })
+		prev[i] = -1
+		if pile > 0 {
+			prev[i] = tops[pile-1]
+		}
+		if pile == len(tops) {
+			tops = append(tops, i)
+		} else {
+			tops[pile] = i
+		}
+	}
+	result := make([][2]int, len(tops))
+	for i, p := len(tops)-1, tops[len(tops)-1]; i >= 0; i, p = i-1, prev[p] {
+		result[i] = pairs[p]
+	}
+	return result
+}
@@ -0,0 +1,107 @@
+package diff
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// A group of changes with the unchanged lines around them, as in a unified diff.
+type Hunk struct {
+	// The first line of the hunk in the old and the new file, counting from 1,
+	// or the line before it if the hunk has no lines on that side.
+	OldStart, OldLines int
+	NewStart, NewLines int
+	Edits              []Edit
+}
+
+// Returns the "@@ -1,3 +1,4 @@" line of the hunk.
+func (h Hunk) Header() string {
+	return fmt.Sprintf("@@ -%s +%s @@", hunkRange(h.OldStart, h.OldLines), hunkRange(h.NewStart, h.NewLines))
+}
+
+func hunkRange(start, lines int) string {
+	if lines == 1 {
+		return fmt.Sprint(start)
+	}
+	return fmt.Sprintf("%d,%d", start, lines)
+}
+
+// Groups the changes of the edit script into hunks with up to context
+// unchanged lines before and after them. Changes at most 2*context lines
+// apart share a hunk.
+func Hunks(edits []Edit, context int) []Hunk {
+	context = max(context, 0)
+	var hunks []Hunk
+	for i := 0; i < len(edits); {
+		if edits[i].Op == Equal {
+			i++
+			continue
+		}
+		start := max(i-context, 0)
+		// The end of the last change in the hunk.
+		end := i
+		for end < len(edits) {
+			next := end
+			for next < len(edits) && edits[next].Op == Equal {
+				next++
+			}
+			if next == len(edits) || (next-end > 2*context && end > i) {
+				break
+			}
+			for next < len(edits) && edits[next].Op != Equal {
+				next++
+			}
+			end = next
+		}
+		stop := min(end+context, len(edits))
+
+		h := Hunk{Edits: edits[start:stop]}
+		for _, e := range h.Edits {
+			if e.Op != Insert {
+				h.OldLines++
+			}
+			if e.Op != Delete {
+				h.NewLines++
+			}
+		}
+		h.OldStart, h.NewStart = edits[start].Old, edits[start].New
+		if h.OldLines > 0 {
+			h.OldStart++
+		}
+		if h.NewLines > 0 {
+			h.NewStart++
+		}
+		hunks = append(hunks, h)
+		i = stop
+	}
+	return hunks
+}
+
+// Writes the hunks as the body of a unified diff, without the file headers.
+func WriteUnified(w io.Writer, hunks []Hunk) error {
+	for _, h := range hunks {
+		if _, err := fmt.Fprintln(w, h.Header()); err != nil {
+			return err
+		}
+		for _, e := range h.Edits {
+			if _, err := fmt.Fprint(w, e.Line()); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Returns the line as it's written in a unified diff: the op, the text and a
+// newline, followed by a marker line if the text doesn't end with a newline.
+func (e Edit) Line() string {
+	line := string(e.Op) + e.Text
+	if !strings.HasSuffix(line, "\n") {
+		line += "\n" + NoNewline + "\n"
+	}
+	return line
+}
+
+// Follows the last line of a file in a unified diff when it has no newline.
+const NoNewline = `\ No newline at end of file`
@@ -0,0 +1,237 @@
+package ignore
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// A line of an ignore file.
+type Rule struct {
+	// The pattern as it was written, including a leading !.
+	Pattern string
+	// The file the rule was read from, relative to the work tree for
+	// .gitignore files, and its line number.
+	Source string
+	Line   int
+	// Re-includes paths a previous rule excluded.
+	Negate bool
+
+	// Directory of the ignore file relative to the work tree, rules only apply below it.
+	base     string
+	dirOnly  bool
+	anchored bool
+	segments []string
+}
+
+// Parses the rules of an ignore file in the directory base, a slash
+// separated path relative to the work tree.
+func Parse(r io.Reader, source, base string) ([]Rule, error) {
+	var rules []Rule
+	scanner := bufio.NewScanner(r)
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		line := scanner.Text()
+		if lineNumber == 1 {
+			line = strings.TrimPrefix(line, "\ufeff")
+		}
+		if rule, ok := parseRule(line); ok {
+			rule.Source, rule.Line, rule.base = source, lineNumber, base
+			rules = append(rules, rule)
+		}
+	}
+	return rules, scanner.Err()
+}
+
+func parseRule(line string) (Rule, bool) {
+	line = trimTrailingSpaces(line)
+	if line == "" || line[0] == '#' {
+		return Rule{}, false
+	}
+	rule := Rule{Pattern: line}
+
+	pattern := line
+	if pattern[0] == '!' {
+		rule.Negate = true
+		pattern = pattern[1:]
+	} else if strings.HasPrefix(pattern, `\!`) || strings.HasPrefix(pattern, `\#`) {
+		pattern = pattern[1:]
+	}
+	if strings.HasSuffix(pattern, "/") {
+		rule.dirOnly = true
+		pattern = strings.TrimRight(pattern, "/")
+	}
+	if pattern == "" {
+		return Rule{}, false
+	}
+
+	// A slash anywhere but at the end anchors the pattern to the directory of the file.
+	rule.anchored = strings.Contains(pattern, "/")
+	pattern = strings.TrimPrefix(pattern, "/")
+	// Git's [!...] is path.Match's [^...].
+	pattern = strings.ReplaceAll(pattern, "[!", "[^")
+
+	for _, segment := range strings.Split(pattern, "/") {
+		if segment != "**" {
+			// ** that isn't a whole segment is an ordinary *.
+			segment = strings.ReplaceAll(segment, "**", "*")
+		}
+		if _, err := path.Match(segment, ""); err != nil {
+			return Rule{}, false
+		}
+		rule.segments = append(rule.segments, segment)
+	}
+	return rule, true
+}
+
+// Removes unescaped trailing spaces.
+func trimTrailingSpaces(line string) string {
+	line = strings.TrimSuffix(line, "\r")
+	for strings.HasSuffix(line, " ") && !strings.HasSuffix(line, `\ `) {
+		line = line[:len(line)-1]
+	}
+	return line
+}
+
+// Reports whether the rule matches the slash separated path relative to the work tree.
+func (r *Rule) Matches(name string, isDir bool) bool {
+	if r.dirOnly && !isDir {
+		return false
+	}
+	if r.base != "" {
+		if !strings.HasPrefix(name, r.base+"/") {
+			return false
+		}
+		name = name[len(r.base)+1:]
+	}
+	if !r.anchored {
+		ok, _ := path.Match(r.segments[0], path.Base(name))
+		return ok
+	}
+	return matchSegments(r.segments, strings.Split(name, "/"))
+}
+
+func matchSegments(pattern, parts []string) bool {
+	if len(pattern) == 0 {
+		return len(parts) == 0
+	}
+	if pattern[0] == "**" {
+		// A trailing ** matches everything inside, but not the directory itself.
+		if len(pattern) == 1 {
+			return len(parts) > 0
+		}
+		for i := 0; i <= len(parts); i++ {
+			if matchSegments(pattern[1:], parts[i:]) {
+				return true
+			}
+		}
+		return false
+	}
+	if len(parts) == 0 {
+		return false
+	}
+	ok, _ := path.Match(pattern[0], parts[0])
+	return ok && matchSegments(pattern[1:], parts[1:])
+}
+
+// Decides which paths of a work tree are ignored. The .gitignore file of
+// every directory is read the first time a path inside it is matched.
+type Matcher struct {
+	workTree string
+	// Rules of the exclude files, the ones that take precedence last.
+	excludes []Rule
+
+	mu   sync.Mutex
+	dirs map[string][]Rule
+}
+
+// Creates a matcher for the work tree. The exclude files apply to the whole
+// tree with a lower precedence than .gitignore files, later ones take
+// precedence over earlier ones. Missing exclude files are skipped.
+func New(workTree string, excludeFiles ...string) (*Matcher, error) {
+	m := &Matcher{workTree: workTree, dirs: make(map[string][]Rule)}
+	for _, file := range excludeFiles {
+		rules, err := readFile(file, file, "")
+		if err != nil {
+			return nil, err
+		}
+		m.excludes = append(m.excludes, rules...)
+	}
+	return m, nil
+}
+
+func readFile(file, source, base string) ([]Rule, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	defer f.Close()
+	return Parse(f, source, base)
+}
+
+func (m *Matcher) dirRules(dir string) []Rule {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	rules, ok := m.dirs[dir]
+	if !ok {
+		// An unreadable .gitignore is treated like a missing one, as Git does.
+		source := path.Join(dir, ".gitignore")
+		rules, _ = readFile(filepath.Join(m.workTree, filepath.FromSlash(source)), source, dir)
+		m.dirs[dir] = rules
+	}
+	return rules
+}
+
+// Returns the rule deciding whether the path, relative to the work tree, is
+// ignored, or nil if no rule matches it. A negated rule means the path is
+// explicitly not ignored. Paths inside an ignored directory are ignored by
+// the directory's rule, they can't be re-included.
+func (m *Matcher) Match(name string, isDir bool) *Rule {
+	name = filepath.ToSlash(name)
+	for i := 0; i < len(name); i++ {
+		if name[i] == '/' {
+			if rule := m.match(name[:i], true); rule != nil && !rule.Negate {
+				return rule
+			}
+		}
+	}
+	return m.match(name, isDir)
+}
+
+func (m *Matcher) match(name string, isDir bool) *Rule {
+	// The .gitignore closest to the path takes precedence, later lines over earlier ones.
+	for dir := path.Dir(name); ; dir = path.Dir(dir) {
+		if dir == "." {
+			dir = ""
+		}
+		rules := m.dirRules(dir)
+		for i := len(rules) - 1; i >= 0; i-- {
+			if rules[i].Matches(name, isDir) {
+				return &rules[i]
+			}
+		}
+		if dir == "" {
+			break
+		}
+	}
+	for i := len(m.excludes) - 1; i >= 0; i-- {
+		if m.excludes[i].Matches(name, isDir) {
+			return &m.excludes[i]
+		}
+	}
+	return nil
+}
+
+// Reports whether the path, relative to the work tree, is ignored.
+func (m *Matcher) Ignored(name string, isDir bool) bool {
+	rule := m.Match(name, isDir)
+	return rule != nil && !rule.Negate
+}
@@ -0,0 +1,99 @@
+package ignore_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/f1-surya/git-go/ignore"
+)
+
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatalf("MkdirAll errored: %v", err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("File creation errored: %v", err)
+	}
+}
+
+func TestParse(t *testing.T) {
+	rules, err := ignore.Parse(strings.NewReader("# comment\n\n*.o\n!keep.o\n\\#hash\nbuild/  \n"), ".gitignore", "")
+	if err != nil {
+		t.Fatalf("Parse errored: %v", err)
+	}
+	if len(rules) != 4 {
+		t.Fatalf("Parsed %d rules", len(rules))
+	}
+	if !rules[1].Negate || rules[1].Line != 4 || rules[3].Pattern != "build/" {
+		t.Fatalf("Wrong rules %+v", rules)
+	}
+	if !rules[2].Matches("#hash", false) {
+		t.Fatalf("Escaped # isn't a pattern")
+	}
+}
+
+func TestMatch(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, ".gitignore"), strings.Join([]string{
+		"*.log",
+		"!important.log",
+		"node_modules/",
+		"/build",
+		"doc/*.txt",
+		"**/tmp/**",
+		"secret[!s].txt",
+		"logs/",
+		"!logs/keep.txt",
+	}, "\n"))
+	writeFile(t, filepath.Join(dir, "sub", ".gitignore"), "*.gen\n!debug.log\n")
+	exclude := filepath.Join(dir, "exclude")
+	writeFile(t, exclude, "*.gen\n*.local\n")
+
+	m, err := ignore.New(dir, exclude)
+	if err != nil {
+		t.Fatalf("New errored: %v", err)
+	}
+	tests := []struct {
+		path    string
+		isDir   bool
+		ignored bool
+	}{
+		{"app.log", false, true},
+		{"deep/dir/app.log", false, true},
+		{"important.log", false, false},
+		{"node_modules", true, true},
+		{"node_modules/pkg/index.js", false, true},
+		{"node_modules", false, false},
+		{"build", true, true},
+		{"build/out.bin", false, true},
+		{"src/build", true, false},
+		{"doc/notes.txt", false, true},
+		{"doc/deep/notes.txt", false, false},
+		{"a/tmp/b/c", false, true},
+		{"a/tmp", true, false},
+		{"secret1.txt", false, true},
+		{"secrets.txt", false, false},
+		{"logs/keep.txt", false, true},
+		{"my.github.txt", false, false},
+		{".github/workflows/ci.yml", false, false},
+		{"x.local", false, true},
+		{"sub/x.gen", false, true},
+		{"sub/debug.log", false, false},
+		{"sub/other.log", false, true},
+		{"other/x.gen", false, true},
+	}
+	for _, test := range tests {
+		if got := m.Ignored(test.path, test.isDir); got != test.ignored {
+			rule := m.Match(test.path, test.isDir)
+			t.Errorf("Ignored(%q, %v) = %v, want %v (rule %+v)", test.path, test.isDir, got, test.ignored, rule)
+		}
+	}
+
+	rule := m.Match("sub/debug.log", false)
+	if rule == nil || rule.Source != "sub/.gitignore" || rule.Line != 2 || !rule.Negate {
+		t.Fatalf("Wrong rule for sub/debug.log: %+v", rule)
+	}
+}
@@ -1,22 +1,32 @@
 package index
 
 import (
+	"bytes"
+	"crypto/sha1"
 	"encoding/binary"
-	"encoding/hex"
+	"errors"
 	"fmt"
 	"os"
-	"path/filepath"
 	"sort"
+	"time"
 
+	"github.com/f1-surya/git-go/lockfile"
 	"github.com/f1-surya/git-go/object"
 )
 
+// An entry of the index, laid out like Git's DIRC version 2 format. The stat
+// data lets commands tell whether a file changed without hashing it.
 type IndexEntry struct {
-	Mode    uint32
-	Size    uint32
-	Hash    [20]byte
-	Path    string
-	Content []byte
+	CTime time.Time
+	MTime time.Time
+	Dev   uint32
+	Ino   uint32
+	Mode  uint32
+	UID   uint32
+	GID   uint32
+	Size  uint32
+	Hash  [20]byte
+	Path  string
 }
 
 type ByPath []IndexEntry
@@ -25,23 +35,149 @@ func (a ByPath) Len() int           { return len(a) }
 func (a ByPath) Swap(i, j int)      { a[i], a[j] = a[j], a[i] }
 func (a ByPath) Less(i, j int) bool { return a[i].Path < a[j].Path }
 
-func ReadIndex() ([]IndexEntry, error) {
-	indexFile, err := os.Open(filepath.Join(".git-go", "index"))
+const (
+	indexVersion = 2
+	// ctime, mtime, dev, ino, mode, uid, gid, size, hash and flags.
+	entryHeaderSize = 10*4 + 20 + 2
+	// Paths longer than this store the maximum in the flags.
+	maxNameLength = 0xfff
+)
+
+// Records the stat data of the file the entry was created from.
+func (e *IndexEntry) SetStat(info os.FileInfo) {
+	e.MTime = info.ModTime()
+	e.CTime, e.Dev, e.Ino, e.UID, e.GID = sysStat(info)
+	e.Size = uint32(info.Size())
+	e.Mode = object.ModeRegular
+	if info.Mode()&0o111 != 0 {
+		e.Mode = object.ModeExecutable
+	}
+}
+
+func sameTime(a, b time.Time) bool {
+	return uint32(a.Unix()) == uint32(b.Unix()) && uint32(a.Nanosecond()) == uint32(b.Nanosecond())
+}
+
+// Reports whether the file still has the stat data recorded in the entry,
+// in which case its content is assumed to be unchanged.
+func (e *IndexEntry) StatMatches(info os.FileInfo) bool {
+	var current IndexEntry
+	current.SetStat(info)
+	return sameTime(e.MTime, current.MTime) &&
+		sameTime(e.CTime, current.CTime) &&
+		e.Dev == current.Dev &&
+		e.Ino == current.Ino &&
+		e.Mode == current.Mode &&
+		e.UID == current.UID &&
+		e.GID == current.GID &&
+		e.Size == current.Size
+}
+
+// Reports whether the file could have been modified in the same timestamp
+// granularity the index was written in, so its stat data can't be trusted.
+func (e *IndexEntry) IsRacy(indexModTime time.Time) bool {
+	return !e.MTime.Before(indexModTime)
+}
+
+func ReadIndex(path string) ([]IndexEntry, error) {
+	data, err := os.ReadFile(path)
 	if err != nil {
 		return nil, err
 	}
-	defer indexFile.Close()
 
-	header := make([]byte, 4)
-	if _, err := indexFile.Read(header); err != nil {
-		return nil, fmt.Errorf("error while parsing header: %v", err)
-	}
-	if string(header) != "DIRC" {
+	if len(data) < 8 || string(data[:4]) != "DIRC" {
 		return nil, fmt.Errorf("invalid index format")
 	}
 
+	// Legacy indexes share the signature but have the entry count where the
+	// version is and no checksum, so a file is only taken as one if it parses
+	// as one to the end.
+	version := binary.BigEndian.Uint32(data[4:])
+	var entries []IndexEntry
+	switch {
+	case hasChecksum(data) && version == indexVersion:
+		entries, err = parseVersion2(data)
+	case hasChecksum(data) && version > indexVersion && version <= 4:
+		return nil, fmt.Errorf("unsupported index version %d", version)
+	default:
+		entries, err = parseLegacy(data)
+		if err != nil && version >= indexVersion && version <= 4 {
+			return nil, errors.New("index file corrupt: bad checksum")
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Sort(ByPath(entries))
+	return entries, nil
+}
+
+// Reports whether the file ends with the checksum of the rest.
+func hasChecksum(data []byte) bool {
+	if len(data) < 12+sha1.Size {
+		return false
+	}
+	sum := sha1.Sum(data[:len(data)-sha1.Size])
+	return bytes.Equal(sum[:], data[len(data)-sha1.Size:])
+}
+
+func parseVersion2(data []byte) ([]IndexEntry, error) {
+	entryCount := binary.BigEndian.Uint32(data[8:])
+	content := data[:len(data)-sha1.Size]
+	pos := 12
+
+	entries := make([]IndexEntry, 0, entryCount)
+	for i := uint32(0); i < entryCount; i++ {
+		if pos+entryHeaderSize > len(content) {
+			return nil, errors.New("truncated index entry")
+		}
+		fields := make([]uint32, 10)
+		for j := range fields {
+			fields[j] = binary.BigEndian.Uint32(content[pos+j*4:])
+		}
+		var entry IndexEntry
+		entry.CTime = time.Unix(int64(fields[0]), int64(fields[1]))
+		entry.MTime = time.Unix(int64(fields[2]), int64(fields[3]))
+		entry.Dev, entry.Ino, entry.Mode = fields[4], fields[5], fields[6]
+		entry.UID, entry.GID, entry.Size = fields[7], fields[8], fields[9]
+		copy(entry.Hash[:], content[pos+40:])
+		flags := binary.BigEndian.Uint16(content[pos+60:])
+		if flags&0x4000 != 0 {
+			return nil, errors.New("extended index entries are not supported")
+		}
+
+		pathStart := pos + entryHeaderSize
+		pathEnd := bytes.IndexByte(content[pathStart:], 0)
+		if pathEnd == -1 {
+			return nil, errors.New("could not parse entry path")
+		}
+		entry.Path = string(content[pathStart : pathStart+pathEnd])
+
+		// Entries are padded with 1 to 8 NUL bytes to a multiple of 8.
+		entryLength := entryHeaderSize + len(entry.Path)
+		pos += (entryLength + 8) &^ 7
+		entries = append(entries, entry)
+	}
+
+	// Skip extensions, optional ones start with an uppercase letter.
+	for pos+8 <= len(content) {
+		signature := content[pos : pos+4]
+		if signature[0] < 'A' || signature[0] > 'Z' {
+			return nil, fmt.Errorf("unsupported index extension %q", signature)
+		}
+		pos += 8 + int(binary.BigEndian.Uint32(content[pos+4:]))
+	}
+	return entries, nil
+}
+
+// Parses the index written by older versions of git-go: the entry count
+// followed by mode, size, hash and NUL terminated path of every entry.
+func parseLegacy(data []byte) ([]IndexEntry, error) {
+	reader := bytes.NewReader(data[4:])
+
 	var entryCount uint32
-	if err := binary.Read(indexFile, binary.BigEndian, &entryCount); err != nil {
+	if err := binary.Read(reader, binary.BigEndian, &entryCount); err != nil {
 		return nil, fmt.Errorf("error while parsing entries count: %v", err)
 	}
 
@@ -50,25 +186,25 @@ func ReadIndex() ([]IndexEntry, error) {
 	for i := uint32(0); i < entryCount; i++ {
 		var entry IndexEntry
 
-		if err := binary.Read(indexFile, binary.BigEndian, &entry.Mode); err != nil {
+		if err := binary.Read(reader, binary.BigEndian, &entry.Mode); err != nil {
 			return nil, fmt.Errorf("could not parse entry mode: %v", err)
 		}
 
-		if err := binary.Read(indexFile, binary.BigEndian, &entry.Size); err != nil {
+		if err := binary.Read(reader, binary.BigEndian, &entry.Size); err != nil {
 			return nil, fmt.Errorf("could not parse entry size: %v", err)
 		}
 
-		if _, err := indexFile.Read(entry.Hash[:]); err != nil {
+		if _, err := reader.Read(entry.Hash[:]); err != nil {
 			return nil, fmt.Errorf("could not parse entry hash: %v", err)
 		}
 
 		path := ""
 		for {
-			b := make([]byte, 1)
-			if _, err := indexFile.Read(b); err != nil {
+			b, err := reader.ReadByte()
+			if err != nil {
 				return nil, fmt.Errorf("could not parse entry path: %v", err)
 			}
-			if b[0] == 0 {
+			if b == 0 {
 				break
 			}
 			path += string(b)
@@ -76,51 +212,62 @@ func ReadIndex() ([]IndexEntry, error) {
 		entry.Path = path
 		entries = append(entries, entry)
 	}
-
-	sort.Sort(ByPath(entries))
+	if reader.Len() != 0 {
+		return nil, errors.New("unexpected data after the last index entry")
+	}
 	return entries, nil
 }
 
-func WriteIndex(entries []IndexEntry) error {
-	tempFileName := filepath.Join(".git-go", "index.temp")
-
-	indexFile, err := os.Create(tempFileName)
-	if err != nil {
-		return err
-	}
-	defer indexFile.Close()
-
-	header := []byte("DIRC")
-	if _, err := indexFile.Write(header); err != nil {
-		fmt.Println("could not write the header: %w", err)
-		return err
-	}
-
-	if err := binary.Write(indexFile, binary.BigEndian, uint32(len(entries))); err != nil {
-		return fmt.Errorf("error while writing the length: %w", err)
-	}
+// Serializes the entries in the DIRC version 2 format, including the trailing checksum.
+func Encode(entries []IndexEntry) []byte {
+	var buffer bytes.Buffer
+	buffer.WriteString("DIRC")
+	binary.Write(&buffer, binary.BigEndian, uint32(indexVersion))
+	binary.Write(&buffer, binary.BigEndian, uint32(len(entries)))
 
 	for _, entry := range entries {
-		if err := binary.Write(indexFile, binary.BigEndian, entry.Mode); err != nil {
-			return fmt.Errorf("error while writing entry mode: %w", err)
-		}
-		if err := binary.Write(indexFile, binary.BigEndian, entry.Size); err != nil {
-			return fmt.Errorf("error while writing entry size: %w", err)
+		fields := []uint32{
+			uint32(entry.CTime.Unix()), uint32(entry.CTime.Nanosecond()),
+			uint32(entry.MTime.Unix()), uint32(entry.MTime.Nanosecond()),
+			entry.Dev, entry.Ino, entry.Mode, entry.UID, entry.GID, entry.Size,
 		}
-		if _, err := indexFile.Write(entry.Hash[:]); err != nil {
-			return fmt.Errorf("error while writing entry hash: %w", err)
+		if entry.CTime.IsZero() {
+			fields[0], fields[1] = 0, 0
 		}
-		if _, err := indexFile.WriteString(entry.Path + "\x00"); err != nil {
-			return fmt.Errorf("error while writing entry path: %w", err)
-		}
-		if err := object.WriteObject(entry.Content, hex.EncodeToString(entry.Hash[:])); err != nil {
-			return fmt.Errorf("error while creating object: %w", err)
+		if entry.MTime.IsZero() {
+			fields[2], fields[3] = 0, 0
 		}
+		binary.Write(&buffer, binary.BigEndian, fields)
+		buffer.Write(entry.Hash[:])
+		binary.Write(&buffer, binary.BigEndian, uint16(min(len(entry.Path), maxNameLength)))
+		buffer.WriteString(entry.Path)
+
+		entryLength := entryHeaderSize + len(entry.Path)
+		buffer.Write(make([]byte, ((entryLength+8)&^7)-entryLength))
 	}
 
-	if err := os.Rename(tempFileName, filepath.Join(".git-go", "index")); err != nil {
+	sum := sha1.Sum(buffer.Bytes())
+	buffer.Write(sum[:])
+	return buffer.Bytes()
+}
+
+// Writes the index at path, failing if another process holds its lock. Only
+// the entries are written, the blobs they point to must already be stored.
+func WriteIndex(path string, entries []IndexEntry) error {
+	lock, err := lockfile.Acquire(path, lockfile.DefaultOptions)
+	if err != nil {
 		return err
 	}
+	defer lock.Rollback()
+	return WriteLocked(lock, entries)
+}
 
-	return nil
+// Writes the entries through a held lock on the index and commits it. Callers
+// that modify the index take the lock before reading it, so concurrent writers
+// can't lose each other's entries.
+func WriteLocked(lock *lockfile.Lock, entries []IndexEntry) error {
+	if _, err := lock.Write(Encode(entries)); err != nil {
+		return err
+	}
+	return lock.Commit()
 }
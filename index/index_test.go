@@ -0,0 +1,148 @@
+package index_test
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/f1-surya/git-go/index"
+	"github.com/f1-surya/git-go/object"
+)
+
+func TestRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "index")
+	entries := []index.IndexEntry{
+		{
+			CTime: time.Unix(1700000000, 123),
+			MTime: time.Unix(1700000001, 456),
+			Dev:   1, Ino: 2, Mode: object.ModeRegular, UID: 3, GID: 4, Size: 5,
+			Hash: sha1.Sum([]byte("a")),
+			Path: "a.txt",
+		},
+		{
+			Mode: object.ModeExecutable,
+			Hash: sha1.Sum([]byte("b")),
+			Path: "some/deeper/path/b.sh",
+		},
+	}
+
+	if err := index.WriteIndex(path, entries); err != nil {
+		t.Fatalf("WriteIndex errored: %v", err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Reading index errored: %v", err)
+	}
+	if string(data[:4]) != "DIRC" || binary.BigEndian.Uint32(data[4:]) != 2 {
+		t.Fatalf("Wrong header %q", data[:8])
+	}
+	// Every entry is padded to a multiple of 8 bytes.
+	if (len(data)-12-20)%8 != 0 {
+		t.Fatalf("Entries aren't padded: %d bytes", len(data)-12-20)
+	}
+
+	read, err := index.ReadIndex(path)
+	if err != nil {
+		t.Fatalf("ReadIndex errored: %v", err)
+	}
+	if len(read) != 2 {
+		t.Fatalf("Read %d entries", len(read))
+	}
+	first := read[0]
+	if first.Path != "a.txt" || !first.CTime.Equal(entries[0].CTime) || !first.MTime.Equal(entries[0].MTime) ||
+		first.Dev != 1 || first.Ino != 2 || first.UID != 3 || first.GID != 4 || first.Size != 5 || first.Hash != entries[0].Hash {
+		t.Fatalf("Entry didn't round trip: %+v", first)
+	}
+	if read[1].Mode != object.ModeExecutable || read[1].Path != "some/deeper/path/b.sh" {
+		t.Fatalf("Second entry didn't round trip: %+v", read[1])
+	}
+}
+
+func TestReadLegacyIndex(t *testing.T) {
+	var buffer bytes.Buffer
+	buffer.WriteString("DIRC")
+	binary.Write(&buffer, binary.BigEndian, uint32(2))
+	for _, name := range []string{"b.txt", "a.txt"} {
+		binary.Write(&buffer, binary.BigEndian, object.ModeRegular)
+		binary.Write(&buffer, binary.BigEndian, uint32(1))
+		hash := sha1.Sum([]byte(name))
+		buffer.Write(hash[:])
+		buffer.WriteString(name + "\x00")
+	}
+	path := filepath.Join(t.TempDir(), "index")
+	if err := os.WriteFile(path, buffer.Bytes(), 0644); err != nil {
+		t.Fatalf("Writing index errored: %v", err)
+	}
+
+	entries, err := index.ReadIndex(path)
+	if err != nil {
+		t.Fatalf("ReadIndex errored: %v", err)
+	}
+	if len(entries) != 2 || entries[0].Path != "a.txt" || entries[1].Path != "b.txt" {
+		t.Fatalf("Legacy entries weren't read: %+v", entries)
+	}
+}
+
+func TestReadCorruptIndex(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "index")
+	entries := []index.IndexEntry{{Mode: object.ModeRegular, Hash: sha1.Sum([]byte("a")), Path: "a.txt"}}
+	if err := index.WriteIndex(path, entries); err != nil {
+		t.Fatalf("WriteIndex errored: %v", err)
+	}
+	data, _ := os.ReadFile(path)
+	// The header, an entry and the checksum itself.
+	for _, offset := range []int{12, 20, len(data) - 1} {
+		corrupt := bytes.Clone(data)
+		corrupt[offset] ^= 0xff
+		os.WriteFile(path, corrupt, 0644)
+		if _, err := index.ReadIndex(path); err == nil || err.Error() != "index file corrupt: bad checksum" {
+			t.Errorf("ReadIndex with byte %d flipped = %v", offset, err)
+		}
+	}
+
+	// A newer version with a valid checksum.
+	v3 := bytes.Clone(data[:len(data)-sha1.Size])
+	binary.BigEndian.PutUint32(v3[4:], 3)
+	sum := sha1.Sum(v3)
+	os.WriteFile(path, append(v3, sum[:]...), 0644)
+	if _, err := index.ReadIndex(path); err == nil || err.Error() != "unsupported index version 3" {
+		t.Errorf("ReadIndex of version 3 = %v", err)
+	}
+}
+
+func TestStatMatches(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "file.txt")
+	if err := os.WriteFile(path, []byte("hello"), 0644); err != nil {
+		t.Fatalf("File creation errored: %v", err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("Stat errored: %v", err)
+	}
+
+	var entry index.IndexEntry
+	entry.SetStat(info)
+	if !entry.StatMatches(info) {
+		t.Fatalf("Unchanged file doesn't match its own stat data")
+	}
+
+	later := info.ModTime().Add(time.Second)
+	if err := os.Chtimes(path, later, later); err != nil {
+		t.Fatalf("Chtimes errored: %v", err)
+	}
+	info, err = os.Stat(path)
+	if err != nil {
+		t.Fatalf("Stat errored: %v", err)
+	}
+	if entry.StatMatches(info) {
+		t.Fatalf("Touched file still matches")
+	}
+	if !entry.IsRacy(entry.MTime) {
+		t.Fatalf("Entry written in the same instant as the index isn't racy")
+	}
+}
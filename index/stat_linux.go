@@ -0,0 +1,19 @@
+//go:build linux
+
+package index
+
+import (
+	"os"
+	"syscall"
+	"time"
+)
+
+// Returns the ctime, device, inode, uid and gid of the file.
+func sysStat(info os.FileInfo) (time.Time, uint32, uint32, uint32, uint32) {
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return info.ModTime(), 0, 0, 0, 0
+	}
+	ctime := time.Unix(int64(stat.Ctim.Sec), int64(stat.Ctim.Nsec))
+	return ctime, uint32(stat.Dev), uint32(stat.Ino), stat.Uid, stat.Gid
+}
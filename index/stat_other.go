@@ -0,0 +1,14 @@
+//go:build !linux
+
+package index
+
+import (
+	"os"
+	"time"
+)
+
+// Platforms without a Linux style stat only get the modification time,
+// which is also used as the ctime.
+func sysStat(info os.FileInfo) (time.Time, uint32, uint32, uint32, uint32) {
+	return info.ModTime(), 0, 0, 0, 0
+}
@@ -0,0 +1,120 @@
+package lockfile
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"time"
+)
+
+var ErrLocked = errors.New("file is locked by another process")
+
+type Options struct {
+	// How long to wait for a lock held by someone else, 0 fails immediately.
+	Timeout time.Duration
+	// Locks older than this were left behind by a crashed process and are
+	// removed, 0 never removes them.
+	StaleAfter time.Duration
+}
+
+var DefaultOptions = Options{StaleAfter: 10 * time.Minute}
+
+// Makes the names stale locks are moved to unique within the process.
+var staleCount atomic.Int64
+
+// An exclusive lock on a file, taken like Git does by creating <path>.lock.
+// The new content is written to the lock file, Commit then moves it over the
+// original so readers see either the old or the new version, never a mix.
+type Lock struct {
+	Path     string
+	lockPath string
+	file     *os.File
+	done     bool
+}
+
+// Takes the lock on path, waiting up to opts.Timeout for the current holder.
+func Acquire(path string, opts Options) (*Lock, error) {
+	lockPath := path + ".lock"
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+
+	deadline := time.Now().Add(opts.Timeout)
+	wait := 5 * time.Millisecond
+	for {
+		file, err := os.OpenFile(lockPath, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0644)
+		if err == nil {
+			return &Lock{Path: path, lockPath: lockPath, file: file}, nil
+		}
+		if !os.IsExist(err) {
+			return nil, err
+		}
+
+		if opts.StaleAfter > 0 {
+			if info, err := os.Stat(lockPath); err == nil && time.Since(info.ModTime()) > opts.StaleAfter {
+				breakStale(lockPath, info, opts.StaleAfter)
+				continue
+			}
+		}
+
+		if !time.Now().Before(deadline) {
+			return nil, fmt.Errorf("%w: %s exists", ErrLocked, lockPath)
+		}
+		time.Sleep(min(wait, time.Until(deadline)))
+		wait = min(wait*2, 100*time.Millisecond)
+	}
+}
+
+// Removes the stale lock at lockPath. Another waiter may have broken it
+// already and taken the lock since, so removing lockPath could delete a live
+// lock. Instead the lock is renamed aside, which only one waiter can do for a
+// file, and put back unless it's still the stale one.
+func breakStale(lockPath string, stale os.FileInfo, staleAfter time.Duration) {
+	// Ending in .lock keeps listings, like the one of refs, skipping it.
+	aside := fmt.Sprintf("%s.stale-%d-%d.lock", lockPath, os.Getpid(), staleCount.Add(1))
+	if os.Rename(lockPath, aside) != nil {
+		return
+	}
+	// The inode of the stale lock can be reused by the new one, so its age is
+	// checked too.
+	if info, err := os.Stat(aside); err == nil && (!os.SameFile(info, stale) || time.Since(info.ModTime()) <= staleAfter) {
+		// Unlike rename, link doesn't replace a lock created in the meantime.
+		os.Link(aside, lockPath)
+	}
+	os.Remove(aside)
+}
+
+// Writes to the lock file, the content replaces the original on Commit.
+func (l *Lock) Write(p []byte) (int, error) {
+	return l.file.Write(p)
+}
+
+// Replaces the original file with what was written to the lock and releases it.
+func (l *Lock) Commit() error {
+	if l.done {
+		return errors.New("lock already released")
+	}
+	l.done = true
+	if err := l.file.Close(); err != nil {
+		os.Remove(l.lockPath)
+		return err
+	}
+	if err := os.Rename(l.lockPath, l.Path); err != nil {
+		os.Remove(l.lockPath)
+		return err
+	}
+	return nil
+}
+
+// Releases the lock without touching the original file. Does nothing if
+// the lock was already committed, so it can always be deferred.
+func (l *Lock) Rollback() error {
+	if l.done {
+		return nil
+	}
+	l.done = true
+	l.file.Close()
+	return os.Remove(l.lockPath)
+}
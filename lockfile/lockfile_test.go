@@ -0,0 +1,144 @@
+package lockfile_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/f1-surya/git-go/lockfile"
+)
+
+func TestCommitAndRollback(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "index")
+	if err := os.WriteFile(path, []byte("old"), 0644); err != nil {
+		t.Fatalf("File creation errored: %v", err)
+	}
+
+	lock, err := lockfile.Acquire(path, lockfile.DefaultOptions)
+	if err != nil {
+		t.Fatalf("Acquire errored: %v", err)
+	}
+	if _, err := lockfile.Acquire(path, lockfile.DefaultOptions); !errors.Is(err, lockfile.ErrLocked) {
+		t.Fatalf("Second Acquire returned %v", err)
+	}
+	lock.Write([]byte("discarded"))
+	if err := lock.Rollback(); err != nil {
+		t.Fatalf("Rollback errored: %v", err)
+	}
+	if content, _ := os.ReadFile(path); string(content) != "old" {
+		t.Fatalf("Rollback changed the file to %q", content)
+	}
+
+	lock, err = lockfile.Acquire(path, lockfile.DefaultOptions)
+	if err != nil {
+		t.Fatalf("Acquire after rollback errored: %v", err)
+	}
+	lock.Write([]byte("new"))
+	if err := lock.Commit(); err != nil {
+		t.Fatalf("Commit errored: %v", err)
+	}
+	if err := lock.Rollback(); err != nil {
+		t.Fatalf("Rollback after commit errored: %v", err)
+	}
+	if content, _ := os.ReadFile(path); string(content) != "new" {
+		t.Fatalf("Commit wrote %q", content)
+	}
+	if _, err := os.Stat(path + ".lock"); !os.IsNotExist(err) {
+		t.Fatalf("Lock file left behind")
+	}
+}
+
+func TestWait(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ref")
+	lock, err := lockfile.Acquire(path, lockfile.DefaultOptions)
+	if err != nil {
+		t.Fatalf("Acquire errored: %v", err)
+	}
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		lock.Commit()
+	}()
+
+	second, err := lockfile.Acquire(path, lockfile.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		t.Fatalf("Waiting Acquire errored: %v", err)
+	}
+	second.Rollback()
+
+	held, _ := lockfile.Acquire(path, lockfile.DefaultOptions)
+	defer held.Rollback()
+	start := time.Now()
+	if _, err := lockfile.Acquire(path, lockfile.Options{Timeout: 50 * time.Millisecond}); !errors.Is(err, lockfile.ErrLocked) {
+		t.Fatalf("Acquire didn't time out: %v", err)
+	}
+	if time.Since(start) < 50*time.Millisecond {
+		t.Fatalf("Acquire gave up before the timeout")
+	}
+}
+
+func TestStaleLock(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "index")
+	if err := os.WriteFile(path+".lock", nil, 0644); err != nil {
+		t.Fatalf("Lock creation errored: %v", err)
+	}
+	old := time.Now().Add(-time.Hour)
+	if err := os.Chtimes(path+".lock", old, old); err != nil {
+		t.Fatalf("Chtimes errored: %v", err)
+	}
+
+	if _, err := lockfile.Acquire(path, lockfile.Options{}); !errors.Is(err, lockfile.ErrLocked) {
+		t.Fatalf("Lock was removed without stale detection: %v", err)
+	}
+	lock, err := lockfile.Acquire(path, lockfile.Options{StaleAfter: time.Minute})
+	if err != nil {
+		t.Fatalf("Stale lock wasn't removed: %v", err)
+	}
+	lock.Rollback()
+}
+
+func TestStaleLockRace(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "index")
+	old := time.Now().Add(-time.Hour)
+	opts := lockfile.Options{StaleAfter: time.Minute}
+	for range 1000 {
+		if err := os.WriteFile(path+".lock", nil, 0644); err != nil {
+			t.Fatalf("Lock creation errored: %v", err)
+		}
+		os.Chtimes(path+".lock", old, old)
+
+		// Both waiters see the stale lock, but once one of them broke it and
+		// took the lock the other one must not remove it.
+		var locks [2]*lockfile.Lock
+		var start, wg sync.WaitGroup
+		start.Add(1)
+		for i := range locks {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				start.Wait()
+				locks[i], _ = lockfile.Acquire(path, opts)
+			}()
+		}
+		start.Done()
+		wg.Wait()
+		if locks[0] != nil && locks[1] != nil {
+			t.Fatalf("Both waiters got the lock")
+		}
+		if locks[0] == nil && locks[1] == nil {
+			t.Fatalf("Neither waiter got the lock")
+		}
+		for _, lock := range locks {
+			if lock != nil {
+				if err := lock.Rollback(); err != nil {
+					t.Fatalf("Rollback errored: %v", err)
+				}
+			}
+		}
+	}
+	if matches, _ := filepath.Glob(path + ".lock*"); len(matches) > 0 {
+		t.Fatalf("Left behind %v", matches)
+	}
+}
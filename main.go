@@ -1,54 +1,1132 @@
 package main
 
 import (
+	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
+	"io"
 	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/f1-surya/git-go/commands"
+	"github.com/f1-surya/git-go/commit"
+	"github.com/f1-surya/git-go/config"
+	"github.com/f1-surya/git-go/refs"
 )
 
-func checkRepo() error {
-	if _, err := os.Stat(".git-go"); os.IsNotExist(err) {
-		return fmt.Errorf("no repo initialized in this directory")
-	}
-	return nil
-}
+var builtins = []string{"init", "config", "add", "commit", "status", "revert", "migrate", "gc", "fsck", "check-ignore", "branch", "switch", "checkout", "tag", "rev-parse", "reflog", "diff", "log", "show", "cat-file", "hash-object", "ls-tree", "ls-files", "write-tree", "commit-tree", "update-ref"}
 
 func main() {
-	if len(os.Args) < 2 {
+	args := os.Args[1:]
+
+	// Like git, every -C <path> is applied relative to the previous one.
+	dir := "."
+	for len(args) >= 2 && args[0] == "-C" {
+		if filepath.IsAbs(args[1]) {
+			dir = args[1]
+		} else {
+			dir = filepath.Join(dir, args[1])
+		}
+		args = args[2:]
+	}
+
+	if len(args) < 1 {
 		fmt.Println("Please provide a command")
 		return
 	}
 
-	switch os.Args[1] {
-	case "init":
-		commands.Init()
+	args, err := expandAlias(dir, args)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+
+	if args[0] == "config" {
+		if err := configCommand(os.Stdout, dir, args[1:]); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	if args[0] == "init" {
+		if _, err := commands.Init(dir, commands.InitOptions{}); err != nil {
+			fmt.Println(err)
+			return
+		}
+		fmt.Println("Successfully created repo")
+		return
+	}
+
+	repo, err := commands.Discover(dir)
+	if errors.Is(err, commands.ErrNoRepo) {
+		fmt.Println("No repo initialized in this directory")
+		os.Exit(1)
+	}
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	// Scripts running git-go in parallel can wait for each other's locks.
+	if timeout := os.Getenv("GIT_GO_LOCK_TIMEOUT"); timeout != "" {
+		if repo.LockOptions.Timeout, err = time.ParseDuration(timeout); err != nil {
+			fmt.Println("Invalid GIT_GO_LOCK_TIMEOUT:", err)
+			os.Exit(1)
+		}
+	}
+
+	switch args[0] {
 	case "add":
-		if err := checkRepo(); err == nil {
-			if err := commands.Add(os.Args[2:]); err != nil {
-				fmt.Println(fmt.Errorf("%w", err))
+		err = add(repo, args[1:])
+	case "commit":
+		err = repo.Commit(args[1:])
+	case "status":
+		err = repo.Status()
+	case "revert":
+		err = repo.Revert()
+	case "migrate":
+		err = repo.Migrate()
+	case "gc":
+		err = gc(repo, args[1:])
+	case "fsck":
+		err = fsck(repo, args[1:])
+	case "check-ignore":
+		err = checkIgnore(repo, args[1:])
+	case "branch":
+		err = branch(repo, args[1:])
+	case "switch":
+		err = switchBranch(repo, args[1:])
+	case "checkout":
+		err = checkout(repo, args[1:])
+	case "tag":
+		err = tagCommand(repo, args[1:])
+	case "rev-parse":
+		err = revParse(repo, args[1:])
+	case "reflog":
+		err = reflog(repo, args[1:])
+	case "diff":
+		err = diffCommand(repo, args[1:])
+	case "log":
+		err = logCommand(repo, args[1:])
+	case "show":
+		err = show(repo, args[1:])
+	case "cat-file":
+		err = catFile(repo, args[1:])
+	case "hash-object":
+		err = hashObject(repo, args[1:])
+	case "ls-tree":
+		err = lsTree(repo, args[1:])
+	case "ls-files":
+		err = lsFiles(repo, args[1:])
+	case "write-tree":
+		err = writeTree(repo, args[1:])
+	case "commit-tree":
+		err = commitTree(repo, args[1:])
+	case "update-ref":
+		err = updateRef(repo, args[1:])
+	default:
+		fmt.Println("Unknown command")
+		os.Exit(1)
+	}
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+}
+
+func add(repo *commands.Repository, args []string) error {
+	flags := flag.NewFlagSet("add", flag.ContinueOnError)
+	var opts commands.AddOptions
+	flags.BoolVar(&opts.All, "A", false, "stage all changes, including deletions")
+	flags.BoolVar(&opts.All, "all", false, "same as -A")
+	flags.BoolVar(&opts.Update, "u", false, "only stage changes to tracked files")
+	flags.BoolVar(&opts.Update, "update", false, "same as -u")
+	flags.BoolVar(&opts.DryRun, "n", false, "print what would be staged")
+	flags.BoolVar(&opts.DryRun, "dry-run", false, "same as -n")
+	flags.BoolVar(&opts.Force, "f", false, "stage ignored files too")
+	flags.BoolVar(&opts.Force, "force", false, "same as -f")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	return repo.Stage(flags.Args(), opts)
+}
+
+func gc(repo *commands.Repository, args []string) error {
+	flags := flag.NewFlagSet("gc", flag.ContinueOnError)
+	prune := flags.String("prune", "2w", "prune unreachable loose objects older than this (e.g. now, 3d, 12h)")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	expire, err := commands.ParseExpire(*prune)
+	if err != nil {
+		return err
+	}
+	return repo.GC(commands.GCOptions{PruneExpire: expire})
+}
+
+func fsck(repo *commands.Repository, args []string) error {
+	flags := flag.NewFlagSet("fsck", flag.ContinueOnError)
+	asJSON := flags.Bool("json", false, "print the report as JSON")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	report, err := repo.Fsck()
+	if err != nil {
+		return err
+	}
+
+	if *asJSON {
+		encoder := json.NewEncoder(repo.Out)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(report); err != nil {
+			return err
+		}
+	} else {
+		for _, problem := range report.Problems {
+			fmt.Fprintln(repo.Out, problem)
+		}
+		fmt.Fprintf(repo.Out, "Checked %d objects\n", report.Checked)
+	}
+	if !report.OK() {
+		os.Exit(1)
+	}
+	return nil
+}
+
+func checkIgnore(repo *commands.Repository, args []string) error {
+	flags := flag.NewFlagSet("check-ignore", flag.ContinueOnError)
+	verbose := flags.Bool("v", false, "print the rule that matched each path")
+	noIndex := flags.Bool("no-index", false, "check tracked files too")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() == 0 {
+		return fmt.Errorf("no path specified")
+	}
+	matches, err := repo.CheckIgnore(flags.Args(), *noIndex)
+	if err != nil {
+		return err
+	}
+
+	anyIgnored := false
+	for _, match := range matches {
+		anyIgnored = anyIgnored || match.Ignored()
+		if *verbose && match.Rule != nil {
+			fmt.Fprintf(repo.Out, "%s:%d:%s\t%s\n", match.Rule.Source, match.Rule.Line, match.Rule.Pattern, match.Path)
+		} else if match.Ignored() {
+			fmt.Fprintln(repo.Out, match.Path)
+		}
+	}
+	// Like git, the exit code tells whether any of the paths is ignored.
+	if !anyIgnored {
+		os.Exit(1)
+	}
+	return nil
+}
+
+// git-go branch [-f] <name> [<start>], -d|-D <name>..., -m|-M [<old>] <new>,
+// --show-current, or no arguments to list the branches.
+func branch(repo *commands.Repository, args []string) error {
+	flags := flag.NewFlagSet("branch", flag.ContinueOnError)
+	remove := flags.Bool("d", false, "delete merged branches")
+	forceRemove := flags.Bool("D", false, "delete branches even if they aren't merged")
+	move := flags.Bool("m", false, "rename a branch")
+	forceMove := flags.Bool("M", false, "rename a branch even if the new name exists")
+	force := flags.Bool("f", false, "move an existing branch")
+	showCurrent := flags.Bool("show-current", false, "print the name of the current branch")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	args = flags.Args()
+
+	switch {
+	case *showCurrent:
+		current, err := repo.CurrentBranch()
+		if err != nil {
+			return err
+		}
+		if current != "" {
+			fmt.Fprintln(repo.Out, current)
+		}
+		return nil
+	case *remove || *forceRemove:
+		if len(args) == 0 {
+			return fmt.Errorf("branch name required")
+		}
+		for _, name := range args {
+			hash, err := repo.DeleteBranch(name, *forceRemove || *force)
+			if err != nil {
+				return err
 			}
-		} else {
-			fmt.Println("No repo initialized in this directory")
+			fmt.Fprintf(repo.Out, "Deleted branch %s (was %s).\n", name, hash[:7])
 		}
-	case "commit":
-		if err := checkRepo(); err == nil {
-			if err := commands.Commit(os.Args[2:]); err != nil {
-				fmt.Println(fmt.Errorf("%w", err))
+		return nil
+	case *move || *forceMove:
+		switch len(args) {
+		case 1:
+			return repo.RenameBranch("", args[0], *forceMove || *force)
+		case 2:
+			return repo.RenameBranch(args[0], args[1], *forceMove || *force)
+		}
+		return fmt.Errorf("usage: git-go branch -m [<old>] <new>")
+	case len(args) == 1:
+		return repo.CreateBranch(args[0], "", *force)
+	case len(args) == 2:
+		return repo.CreateBranch(args[0], args[1], *force)
+	case len(args) > 2:
+		return fmt.Errorf("too many arguments")
+	}
+
+	branches, err := repo.Branches()
+	if err != nil {
+		return err
+	}
+	current, err := repo.CurrentBranch()
+	if err != nil {
+		return err
+	}
+	if current == "" {
+		if head, err := repo.Head(); err == nil {
+			fmt.Fprintf(repo.Out, "* (HEAD detached at %s)\n", head[:7])
+		}
+	}
+	for _, b := range branches {
+		marker := "  "
+		if b.Current {
+			marker = "* "
+		}
+		fmt.Fprintln(repo.Out, marker+b.Name)
+	}
+	return nil
+}
+
+// git-go switch [-f] [-c <new>] [--detach] <branch>
+func switchBranch(repo *commands.Repository, args []string) error {
+	flags := flag.NewFlagSet("switch", flag.ContinueOnError)
+	var opts commands.CheckoutOptions
+	flags.BoolVar(&opts.Force, "f", false, "discard local changes")
+	flags.BoolVar(&opts.Force, "force", false, "same as -f")
+	flags.BoolVar(&opts.Force, "discard-changes", false, "same as -f")
+	flags.BoolVar(&opts.Detach, "detach", false, "switch to a commit with a detached HEAD")
+	flags.StringVar(&opts.NewBranch, "c", "", "create a branch and switch to it")
+	flags.StringVar(&opts.NewBranch, "create", "", "same as -c")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	target := "HEAD"
+	switch {
+	case flags.NArg() == 1:
+		target = flags.Arg(0)
+	case flags.NArg() > 1:
+		return fmt.Errorf("too many arguments")
+	case opts.NewBranch == "":
+		return fmt.Errorf("missing branch or commit argument")
+	}
+	return repo.Switch(target, opts)
+}
+
+// git-go checkout [-f] [-b <new>] [--detach] <branch or commit>
+func checkout(repo *commands.Repository, args []string) error {
+	flags := flag.NewFlagSet("checkout", flag.ContinueOnError)
+	var opts commands.CheckoutOptions
+	flags.BoolVar(&opts.Force, "f", false, "discard local changes")
+	flags.BoolVar(&opts.Force, "force", false, "same as -f")
+	flags.BoolVar(&opts.Detach, "detach", false, "detach HEAD even if the target is a branch")
+	flags.StringVar(&opts.NewBranch, "b", "", "create a branch and check it out")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	target := "HEAD"
+	switch {
+	case flags.NArg() == 1:
+		target = flags.Arg(0)
+	case flags.NArg() > 1:
+		return fmt.Errorf("too many arguments")
+	case opts.NewBranch == "" && !opts.Force:
+		return fmt.Errorf("missing branch or commit argument")
+	}
+	return repo.Checkout(target, opts)
+}
+
+// git-go tag [-a] [-m <message>] [-f] <name> [<commit>], -d <name>..., or
+// [-l] [--sort=<key>] [-n] [<pattern>...] to list tags.
+func tagCommand(repo *commands.Repository, args []string) error {
+	flags := flag.NewFlagSet("tag", flag.ContinueOnError)
+	var opts commands.TagOptions
+	flags.BoolVar(&opts.Annotate, "a", false, "create an annotated tag")
+	flags.StringVar(&opts.Message, "m", "", "message of an annotated tag")
+	flags.BoolVar(&opts.Force, "f", false, "replace an existing tag")
+	remove := flags.Bool("d", false, "delete tags")
+	list := flags.Bool("l", false, "list tags matching the patterns")
+	sortKey := flags.String("sort", "refname", "sort by refname, version:refname or creatordate, - reverses")
+	annotations := flags.Bool("n", false, "print the first line of the message of every tag")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	args = flags.Args()
+
+	switch {
+	case *remove:
+		if len(args) == 0 {
+			return fmt.Errorf("tag name required")
+		}
+		for _, name := range args {
+			hash, err := repo.DeleteTag(name)
+			if err != nil {
+				return err
 			}
-		} else {
-			fmt.Println("No repo initialized in this directory")
+			fmt.Fprintf(repo.Out, "Deleted tag '%s' (was %s)\n", name, hash[:7])
 		}
-	case "status":
-		if err := checkRepo(); err == nil {
-			err := commands.Status()
-			fmt.Println(fmt.Errorf("%w", err))
-		} else {
-			fmt.Println("No repo initialized in this directory")
+		return nil
+	case !*list && len(args) > 2:
+		return fmt.Errorf("too many arguments")
+	case !*list && len(args) == 2:
+		return repo.CreateTag(args[0], args[1], opts)
+	case !*list && len(args) == 1:
+		return repo.CreateTag(args[0], "", opts)
+	}
+
+	tags, err := repo.Tags(args, *sortKey)
+	if err != nil {
+		return err
+	}
+	for _, t := range tags {
+		if !*annotations {
+			fmt.Fprintln(repo.Out, t.Name)
+			continue
 		}
-	case "revert":
-		commands.Revert()
+		message := ""
+		if t.Annotation != nil {
+			message = t.Annotation.Message
+		} else if c, err := commit.ParseCommit(repo.Store, t.Target); err == nil {
+			message = c.Message
+		}
+		subject, _, _ := strings.Cut(message, "\n")
+		fmt.Fprintf(repo.Out, "%-15s %s\n", t.Name, subject)
+	}
+	return nil
+}
+
+// git-go diff [--staged] [-U<n>] [--diff-algorithm=<name>] [-M[<n>]|-C[<n>]|--no-renames] [<commit> [<commit>]] [--] [<path>...]
+// prints the changes as a unified diff. Arguments before -- that aren't
+// revisions must be existing paths.
+func diffCommand(repo *commands.Repository, args []string) error {
+	var paths []string
+	if i := slices.Index(args, "--"); i != -1 {
+		args, paths = args[:i], args[i+1:]
+	}
+	opts := commands.DiffOptions{}
+	var rest []string
+	for _, arg := range args {
+		if ok, err := renameFlag(arg, &opts); err != nil {
+			return err
+		} else if ok {
+			continue
+		}
+		// -U5 is written -U=5 for the flag package.
+		if strings.HasPrefix(arg, "-U") && len(arg) > 2 && arg[2] != '=' {
+			arg = "-U=" + arg[2:]
+		}
+		rest = append(rest, arg)
+	}
+	args = rest
+
+	flags := flag.NewFlagSet("diff", flag.ContinueOnError)
+	flags.BoolVar(&opts.Staged, "staged", false, "compare the index to HEAD or the given commit")
+	flags.BoolVar(&opts.Staged, "cached", false, "same as --staged")
+	flags.IntVar(&opts.Context, "U", -1, "lines of context around changes")
+	flags.IntVar(&opts.Context, "unified", -1, "same as -U")
+	flags.StringVar(&opts.Algorithm, "diff-algorithm", "", "myers, patience or histogram")
+	patience := flags.Bool("patience", false, "same as --diff-algorithm=patience")
+	histogram := flags.Bool("histogram", false, "same as --diff-algorithm=histogram")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *patience {
+		opts.Algorithm = "patience"
+	}
+	if *histogram {
+		opts.Algorithm = "histogram"
+	}
+	revisions, argPaths, err := splitRevisions(repo, flags.Args())
+	if err != nil {
+		return err
+	}
+	opts.Revisions, opts.Paths = revisions, append(argPaths, paths...)
+	return repo.Diff(opts)
+}
+
+// Splits the arguments given before -- into the revisions and the paths
+// after them. Like in git, a path must exist unless it's a pattern, so a
+// mistyped revision isn't taken for a path.
+func splitRevisions(repo *commands.Repository, args []string) ([]string, []string, error) {
+	resolver := repo.Revisions()
+	var revisions, paths []string
+	for _, arg := range args {
+		if paths == nil {
+			var err error
+			if strings.Contains(arg, "..") {
+				_, err = resolver.ParseRange([]string{arg})
+			} else {
+				_, err = resolver.Resolve(strings.TrimPrefix(arg, "^"))
+			}
+			if err == nil {
+				revisions = append(revisions, arg)
+				continue
+			}
+		}
+		path := arg
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(repo.Cwd, path)
+		}
+		if _, err := os.Lstat(path); err != nil && !strings.ContainsAny(arg, "*?[") {
+			return nil, nil, fmt.Errorf("ambiguous argument '%s': unknown revision or path not in the working tree\nUse '--' to separate paths from revisions", arg)
+		}
+		paths = append(paths, arg)
+	}
+	return revisions, paths, nil
+}
+
+// git-go log [-n <n>] [--oneline] [--graph] [--since=<date>] [--until=<date>]
+// [--author=<pattern>] [--grep=<pattern>] [--stat] [-p] [--format=<format>]
+// [<revision>...] [--] [<path>...] prints the commits, newest first.
+func logCommand(repo *commands.Repository, args []string) error {
+	var paths []string
+	if i := slices.Index(args, "--"); i != -1 {
+		args, paths = args[:i], args[i+1:]
+	}
+	// -5 and -n5 are written -n=5 for the flag package.
+	args = slices.Clone(args)
+	for i, arg := range args {
+		if len(arg) > 1 && arg[0] == '-' && arg[1] >= '0' && arg[1] <= '9' {
+			args[i] = "-n=" + arg[1:]
+		} else if strings.HasPrefix(arg, "-n") && len(arg) > 2 && arg[2] != '=' {
+			args[i] = "-n=" + arg[2:]
+		}
+	}
+
+	flags := flag.NewFlagSet("log", flag.ContinueOnError)
+	opts := commands.LogOptions{}
+	flags.IntVar(&opts.MaxCount, "n", 0, "limit the number of commits")
+	flags.IntVar(&opts.MaxCount, "max-count", 0, "same as -n")
+	oneline := flags.Bool("oneline", false, "show every commit on one line")
+	flags.BoolVar(&opts.Graph, "graph", false, "draw the history as a graph")
+	since := flags.String("since", "", "only commits more recent than the date")
+	flags.StringVar(since, "after", "", "same as --since")
+	until := flags.String("until", "", "only commits older than the date")
+	flags.StringVar(until, "before", "", "same as --until")
+	flags.StringVar(&opts.Author, "author", "", "only commits whose author matches the pattern")
+	flags.StringVar(&opts.Grep, "grep", "", "only commits whose message matches the pattern")
+	flags.BoolVar(&opts.Stat, "stat", false, "show the files changed by every commit")
+	flags.BoolVar(&opts.Patch, "p", false, "show the changes of every commit")
+	flags.BoolVar(&opts.Patch, "patch", false, "same as -p")
+	flags.StringVar(&opts.Format, "format", "", "oneline, short, medium, full, fuller or format:<template>")
+	flags.StringVar(&opts.Format, "pretty", "", "same as --format")
+	flags.BoolVar(&opts.AbbrevCommit, "abbrev-commit", false, "abbreviate the commit hashes")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *oneline {
+		opts.Format, opts.AbbrevCommit = "oneline", true
+	}
+	now := time.Now()
+	var err error
+	if *since != "" {
+		if opts.Since, err = commands.ParseApproxDate(*since, now); err != nil {
+			return err
+		}
+	}
+	if *until != "" {
+		if opts.Until, err = commands.ParseApproxDate(*until, now); err != nil {
+			return err
+		}
+	}
+	revisions, argPaths, err := splitRevisions(repo, flags.Args())
+	if err != nil {
+		return err
+	}
+	opts.Revisions, opts.Paths = revisions, append(argPaths, paths...)
+	return repo.Log(opts)
+}
+
+// git-go show [--stat] [-s] [--format=<format>] [--oneline] [<object>...]
+// prints commits with their changes, trees, blobs and tags.
+func show(repo *commands.Repository, args []string) error {
+	flags := flag.NewFlagSet("show", flag.ContinueOnError)
+	opts := commands.ShowOptions{}
+	flags.BoolVar(&opts.Stat, "stat", false, "show the files changed by commits instead of the patch")
+	flags.BoolVar(&opts.NoPatch, "s", false, "leave out the patch of commits")
+	flags.BoolVar(&opts.NoPatch, "no-patch", false, "same as -s")
+	flags.StringVar(&opts.Format, "format", "", "oneline, short, medium, full, fuller or format:<template>")
+	flags.StringVar(&opts.Format, "pretty", "", "same as --format")
+	flags.BoolVar(&opts.AbbrevCommit, "abbrev-commit", false, "abbreviate the commit hashes")
+	oneline := flags.Bool("oneline", false, "show commits on one line")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *oneline {
+		opts.Format, opts.AbbrevCommit = "oneline", true
+	}
+	opts.Objects = flags.Args()
+	return repo.Show(opts)
+}
+
+// git-go cat-file (-t|-s|-p|-e|<type>) <object>, or --batch or --batch-check
+// reading the objects from stdin.
+func catFile(repo *commands.Repository, args []string) error {
+	if len(args) == 1 && (args[0] == "--batch" || args[0] == "--batch-check") {
+		return repo.CatFileBatch(os.Stdin, args[0] == "--batch-check")
+	}
+	if len(args) != 2 {
+		return fmt.Errorf("usage: cat-file (-t|-s|-p|-e|<type>) <object>")
+	}
+	return repo.CatFile(args[0], args[1])
+}
+
+// git-go hash-object [-w] [-t <type>] (--stdin | <file>...) prints the hash
+// of every file.
+func hashObject(repo *commands.Repository, args []string) error {
+	flags := flag.NewFlagSet("hash-object", flag.ContinueOnError)
+	write := flags.Bool("w", false, "write the objects to the object database")
+	objType := flags.String("t", "blob", "the type of the objects")
+	stdin := flags.Bool("stdin", false, "read the object from stdin")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	var contents [][]byte
+	if *stdin {
+		content, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			return err
+		}
+		contents = append(contents, content)
+	}
+	for _, path := range flags.Args() {
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		contents = append(contents, content)
+	}
+	for _, content := range contents {
+		hash, err := repo.HashObject(*objType, content, *write)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(repo.Out, hash)
+	}
+	return nil
+}
+
+func lsTree(repo *commands.Repository, args []string) error {
+	flags := flag.NewFlagSet("ls-tree", flag.ContinueOnError)
+	var opts commands.LsTreeOptions
+	flags.BoolVar(&opts.Recursive, "r", false, "list the files of subtrees")
+	flags.BoolVar(&opts.Long, "l", false, "show the size of blobs")
+	flags.BoolVar(&opts.Long, "long", false, "same as -l")
+	flags.BoolVar(&opts.NameOnly, "name-only", false, "only print the paths")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 1 {
+		return fmt.Errorf("usage: ls-tree [-r] [-l] [--name-only] <tree>")
+	}
+	opts.Tree = flags.Arg(0)
+	return repo.LsTree(opts)
+}
+
+func lsFiles(repo *commands.Repository, args []string) error {
+	flags := flag.NewFlagSet("ls-files", flag.ContinueOnError)
+	var opts commands.LsFilesOptions
+	flags.BoolVar(&opts.Stage, "s", false, "show the mode, hash and stage of the files")
+	flags.BoolVar(&opts.Stage, "stage", false, "same as -s")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	opts.Paths = flags.Args()
+	return repo.LsFiles(opts)
+}
+
+func writeTree(repo *commands.Repository, args []string) error {
+	if len(args) > 0 {
+		return fmt.Errorf("write-tree takes no arguments")
+	}
+	hash, err := repo.WriteTree()
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(repo.Out, hash)
+	return nil
+}
+
+// git-go commit-tree <tree> [-p <parent>]... [-m <message>]... prints the hash
+// of the new commit. Like git, the message is read from stdin without -m.
+func commitTree(repo *commands.Repository, args []string) error {
+	var treeRev string
+	var parents, messages []string
+	for i := 0; i < len(args); i++ {
+		switch arg := args[i]; arg {
+		case "-p", "-m":
+			if i+1 == len(args) {
+				return fmt.Errorf("%s needs a value", arg)
+			}
+			i++
+			if arg == "-p" {
+				parents = append(parents, args[i])
+			} else {
+				messages = append(messages, args[i])
+			}
+		default:
+			if treeRev != "" || strings.HasPrefix(arg, "-") {
+				return fmt.Errorf("usage: commit-tree <tree> [-p <parent>]... [-m <message>]...")
+			}
+			treeRev = arg
+		}
+	}
+	if treeRev == "" {
+		return fmt.Errorf("usage: commit-tree <tree> [-p <parent>]... [-m <message>]...")
+	}
+
+	message := commit.JoinMessage(messages)
+	if messages == nil {
+		content, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			return err
+		}
+		message = string(content)
+	}
+	hash, err := repo.CommitTree(treeRev, parents, message)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(repo.Out, hash)
+	return nil
+}
+
+// git-go update-ref [-m <reason>] [--no-deref] <ref> <new> [<old>], or
+// -d <ref> [<old>] to delete it.
+func updateRef(repo *commands.Repository, args []string) error {
+	flags := flag.NewFlagSet("update-ref", flag.ContinueOnError)
+	var opts commands.UpdateRefOptions
+	flags.StringVar(&opts.Message, "m", "", "the reason recorded in the reflog")
+	flags.BoolVar(&opts.Delete, "d", false, "delete the ref")
+	flags.BoolVar(&opts.NoDeref, "no-deref", false, "replace a symbolic ref instead of its target")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	args = flags.Args()
+	switch {
+	case opts.Delete && (len(args) < 1 || len(args) > 2):
+		return fmt.Errorf("usage: update-ref -d <ref> [<old>]")
+	case opts.Delete:
+		opts.Ref = args[0]
+		if len(args) == 2 {
+			opts.OldValue = args[1]
+		}
+	case len(args) < 2 || len(args) > 3:
+		return fmt.Errorf("usage: update-ref [-m <reason>] [--no-deref] <ref> <new> [<old>]")
 	default:
-		fmt.Println("Unknown command")
+		opts.Ref, opts.NewValue = args[0], args[1]
+		if len(args) == 3 {
+			opts.OldValue = args[2]
+		}
+	}
+	return repo.UpdateRef(opts)
+}
+
+// Handles -M[<n>], --find-renames[=<n>], -C[<n>], --find-copies[=<n>] and
+// --no-renames, and reports whether arg was one of them. Like in git, -M5 and
+// -M50 are 50%, -M5% is 5%.
+func renameFlag(arg string, opts *commands.DiffOptions) (bool, error) {
+	var score string
+	switch {
+	case arg == "--no-renames":
+		opts.Renames = "false"
+		return true, nil
+	case strings.HasPrefix(arg, "-M"):
+		opts.Renames, score = "true", arg[2:]
+	case strings.HasPrefix(arg, "-C"):
+		opts.Renames, score = "copies", arg[2:]
+	case arg == "--find-renames" || strings.HasPrefix(arg, "--find-renames="):
+		opts.Renames, score = "true", strings.TrimPrefix(arg[len("--find-renames"):], "=")
+	case arg == "--find-copies" || strings.HasPrefix(arg, "--find-copies="):
+		opts.Renames, score = "copies", strings.TrimPrefix(arg[len("--find-copies"):], "=")
+	default:
+		return false, nil
+	}
+	if score == "" {
+		return true, nil
+	}
+	digits, percent := strings.CutSuffix(score, "%")
+	n, err := strconv.Atoi(digits)
+	if err != nil || n < 0 || len(digits) > 9 || strings.HasPrefix(digits, "+") {
+		return true, fmt.Errorf("bad similarity %q in %s", score, arg)
+	}
+	if !percent {
+		// The digits are a fraction.
+		scale := 1
+		for range digits {
+			scale *= 10
+		}
+		n = n * 100 / scale
+	}
+	if n > 100 {
+		return true, fmt.Errorf("bad similarity %q in %s", score, arg)
+	}
+	opts.RenameThreshold = n
+	return true, nil
+}
+
+// git-go reflog [show] [<ref>] prints the reflog of the ref, HEAD by default.
+// git-go reflog expire [--expire=<time>] [--all] [<ref>...] removes old entries.
+func reflog(repo *commands.Repository, args []string) error {
+	if len(args) == 0 || args[0] != "expire" {
+		if len(args) > 0 && args[0] == "show" {
+			args = args[1:]
+		}
+		if len(args) > 1 {
+			return fmt.Errorf("usage: git-go reflog [show] [<ref>]")
+		}
+		name := ""
+		if len(args) == 1 {
+			name = args[0]
+		}
+		return repo.ShowReflog(name)
+	}
+
+	flags := flag.NewFlagSet("reflog expire", flag.ContinueOnError)
+	expire := flags.String("expire", "90d", "remove entries older than this (e.g. now, 2w, never)")
+	all := flags.Bool("all", false, "expire the reflogs of all refs")
+	if err := flags.Parse(args[1:]); err != nil {
+		return err
+	}
+	names := flags.Args()
+	if !*all && len(names) == 0 {
+		return fmt.Errorf("no reflog specified, use --all to expire every reflog")
+	}
+	if *all {
+		names = nil
+	}
+	if *expire == "never" {
+		return nil
+	}
+	duration, err := commands.ParseExpire(*expire)
+	if err != nil {
+		return err
+	}
+	removed, err := repo.ExpireReflogs(names, time.Now().Add(-duration))
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(repo.Out, "Removed %d reflog entries\n", removed)
+	return nil
+}
+
+// git-go rev-parse [--verify] [--short[=<n>]] [--abbrev-ref]
+// [--symbolic-full-name] <rev>... prints the hash of every revision. Ranges
+// print their ends, with a ^ before the excluded ones.
+func revParse(repo *commands.Repository, args []string) error {
+	var verify, abbrevRef, fullName bool
+	short := 0
+	var revs []string
+	for _, arg := range args {
+		switch {
+		case arg == "--verify":
+			verify = true
+		case arg == "--abbrev-ref":
+			abbrevRef = true
+		case arg == "--symbolic-full-name":
+			fullName = true
+		case arg == "--short":
+			short = 7
+		case strings.HasPrefix(arg, "--short="):
+			n, err := strconv.Atoi(strings.TrimPrefix(arg, "--short="))
+			if err != nil {
+				return fmt.Errorf("invalid --short length %q", arg)
+			}
+			short = n
+		case strings.HasPrefix(arg, "--"):
+			return fmt.Errorf("unknown option %s", arg)
+		default:
+			revs = append(revs, arg)
+		}
+	}
+	if verify && len(revs) != 1 {
+		return fmt.Errorf("--verify needs exactly one revision")
+	}
+
+	resolver := repo.Revisions()
+	print := func(prefix, hash string) error {
+		if short > 0 {
+			abbrev, err := resolver.Abbrev(hash, short)
+			if err != nil {
+				return err
+			}
+			hash = abbrev
+		}
+		fmt.Fprintln(repo.Out, prefix+hash)
+		return nil
+	}
+	for _, rev := range revs {
+		if abbrevRef || fullName {
+			name, err := resolver.RefName(rev)
+			if err != nil {
+				return err
+			}
+			if name, err = refs.Deref(repo.GitDir, name); err != nil {
+				return err
+			}
+			if abbrevRef {
+				name = strings.TrimPrefix(strings.TrimPrefix(strings.TrimPrefix(name, refs.HeadsPrefix), "refs/tags/"), "refs/")
+			}
+			fmt.Fprintln(repo.Out, name)
+			continue
+		}
+		if !verify && (strings.Contains(rev, "..") || strings.HasPrefix(rev, "^")) {
+			r, err := resolver.ParseRange([]string{rev})
+			if err != nil {
+				return err
+			}
+			for i := len(r.Include) - 1; i >= 0; i-- {
+				if err := print("", r.Include[i]); err != nil {
+					return err
+				}
+			}
+			for _, hash := range r.Exclude {
+				if err := print("^", hash); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+		hash, err := resolver.Resolve(rev)
+		if err != nil {
+			return err
+		}
+		if err := print("", hash); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Replaces an alias.<name> command with its value. Aliases may refer to other
+// aliases. An alias starting with ! is run by the shell, with the remaining
+// arguments, and git-go exits with its exit code.
+func expandAlias(dir string, args []string) ([]string, error) {
+	seen := make(map[string]bool)
+	for !slices.Contains(builtins, args[0]) {
+		cfg, err := loadConfig(dir)
+		if err != nil {
+			return nil, err
+		}
+		value, ok := cfg.Get("alias." + args[0])
+		if !ok {
+			return args, nil
+		}
+		if seen[args[0]] {
+			return nil, fmt.Errorf("alias loop detected: expansion of '%s' does not terminate", args[0])
+		}
+		seen[args[0]] = true
+
+		if shell, ok := strings.CutPrefix(value, "!"); ok {
+			os.Exit(runShellAlias(dir, shell, args[1:]))
+		}
+		fields := strings.Fields(value)
+		if len(fields) == 0 {
+			return nil, fmt.Errorf("empty alias for %s", args[0])
+		}
+		args = append(fields, args[1:]...)
+	}
+	return args, nil
+}
+
+// Reads the config of the repository at dir, or only the system and global
+// config outside of a repository.
+func loadConfig(dir string) (*config.Config, error) {
+	repo, err := commands.Discover(dir)
+	if errors.Is(err, commands.ErrNoRepo) {
+		return config.Load("")
+	}
+	if err != nil {
+		return nil, err
+	}
+	return repo.Config, nil
+}
+
+func runShellAlias(dir, shell string, args []string) int {
+	// Like git, the arguments are passed to the command as "$@".
+	cmd := exec.Command("sh", append([]string{"-c", shell + ` "$@"`, shell}, args...)...)
+	cmd.Dir = dir
+	if repo, err := commands.Discover(dir); err == nil {
+		cmd.Dir = repo.WorkTree
+	}
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	if err := cmd.Run(); err != nil {
+		if exitErr, ok := err.(*exec.ExitError); ok {
+			return exitErr.ExitCode()
+		}
+		fmt.Println(err)
+		return 1
+	}
+	return 0
+}
+
+// git-go config [--system|--global|--local|--file <path>] get [--all] <key>,
+// set [--add] <key> <value>, unset [--all] <key> or list [--show-origin].
+// Values are printed to out, there may be no repository to take it from.
+func configCommand(out io.Writer, dir string, args []string) error {
+	flags := flag.NewFlagSet("config", flag.ContinueOnError)
+	system := flags.Bool("system", false, "use the system config file")
+	global := flags.Bool("global", false, "use the config file of the user")
+	local := flags.Bool("local", false, "use the config file of the repository")
+	file := flags.String("file", "", "use the given config file")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() == 0 {
+		return fmt.Errorf("usage: git-go config [--system|--global|--local|--file <path>] get|set|unset|list")
+	}
+
+	// The file to read from or write to, "" reads the merged config.
+	var path string
+	switch {
+	case *file != "":
+		path = *file
+	case *system:
+		path = config.SystemPath()
+	case *global:
+		path = config.GlobalPath()
+		if path == "" {
+			return fmt.Errorf("can't find the home directory for the global config")
+		}
+	case *local:
+		repo, err := commands.Discover(dir)
+		if err != nil {
+			return err
+		}
+		path = repo.ConfigPath()
+	}
+
+	command, args := flags.Arg(0), flags.Args()[1:]
+	sub := flag.NewFlagSet("config "+command, flag.ContinueOnError)
+	all := sub.Bool("all", false, "get or unset every value of the key")
+	add := sub.Bool("add", false, "add a value instead of replacing it")
+	showOrigin := sub.Bool("show-origin", false, "print the file of each value")
+	if err := sub.Parse(args); err != nil {
+		return err
+	}
+	args = sub.Args()
+
+	// Writes go to the repository config unless another file was chosen.
+	writePath := func() (string, error) {
+		if path != "" {
+			return path, nil
+		}
+		repo, err := commands.Discover(dir)
+		if err != nil {
+			return "", err
+		}
+		return repo.ConfigPath(), nil
+	}
+
+	switch command {
+	case "get":
+		if len(args) != 1 {
+			return fmt.Errorf("usage: git-go config get [--all] <key>")
+		}
+		values, err := configValues(dir, path, args[0])
+		if err != nil {
+			return err
+		}
+		// Like git, a missing key exits with 1 without a message.
+		if len(values) == 0 {
+			os.Exit(1)
+		}
+		if !*all {
+			values = values[len(values)-1:]
+		}
+		for _, value := range values {
+			fmt.Fprintln(out, value)
+		}
+		return nil
+	case "set":
+		if len(args) != 2 {
+			return fmt.Errorf("usage: git-go config set [--add] <key> <value>")
+		}
+		target, err := writePath()
+		if err != nil {
+			return err
+		}
+		return config.Edit(target, func(f *config.File) error {
+			if *add {
+				return f.Add(args[0], args[1])
+			}
+			return f.Set(args[0], args[1])
+		})
+	case "unset":
+		if len(args) != 1 {
+			return fmt.Errorf("usage: git-go config unset [--all] <key>")
+		}
+		target, err := writePath()
+		if err != nil {
+			return err
+		}
+		return config.Edit(target, func(f *config.File) error {
+			return f.Unset(args[0], *all)
+		})
+	case "list":
+		entries, err := configEntries(dir, path)
+		if err != nil {
+			return err
+		}
+		for _, entry := range entries {
+			if *showOrigin {
+				fmt.Fprintf(out, "file:%s\t", entry.Source)
+			}
+			fmt.Fprintf(out, "%s=%s\n", entry.Key, entry.Value)
+		}
+		return nil
+	}
+	return fmt.Errorf("unknown config command %s", command)
+}
+
+// Returns the entries of the file, or of the merged config if path is "".
+func configEntries(dir, path string) ([]config.Entry, error) {
+	if path == "" {
+		cfg, err := loadConfig(dir)
+		if err != nil {
+			return nil, err
+		}
+		return cfg.Entries(), nil
+	}
+	cfg := &config.Config{}
+	if err := cfg.AddFile(path, config.LevelLocal); err != nil {
+		return nil, err
+	}
+	return cfg.Entries(), nil
+}
+
+func configValues(dir, path, key string) ([]string, error) {
+	canonical, err := config.CanonicalKey(key)
+	if err != nil {
+		return nil, err
+	}
+	entries, err := configEntries(dir, path)
+	if err != nil {
+		return nil, err
+	}
+	var values []string
+	for _, entry := range entries {
+		if entry.Key == canonical {
+			values = append(values, entry.Value)
+		}
 	}
+	return values, nil
 }
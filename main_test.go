@@ -14,10 +14,19 @@ import (
 	"github.com/f1-surya/git-go/tree"
 )
 
+func initRepo(t *testing.T) *commands.Repository {
+	t.Helper()
+	repo, err := commands.Init(".", commands.InitOptions{})
+	if err != nil {
+		t.Fatalf("Init errored: %v", err)
+	}
+	return repo
+}
+
 func TestInit(t *testing.T) {
 	os.RemoveAll(".git-go")
 
-	commands.Init()
+	initRepo(t)
 
 	dirs := []string{
 		".git-go",
@@ -52,15 +61,15 @@ func TestInitCLI(t *testing.T) {
 
 func TestAdd(t *testing.T) {
 	os.RemoveAll(".git-go")
-	commands.Init()
+	repo := initRepo(t)
 
-	err := commands.Add([]string{"main.go", "main_test.go"})
+	err := repo.Add([]string{"main.go", "main_test.go"})
 
 	if err != nil {
 		t.Fatalf("Add failed: %v", err)
 	}
 
-	entries, err := index.ReadIndex()
+	entries, err := index.ReadIndex(repo.IndexPath())
 	if err != nil {
 		t.Fatalf("Read index errored: %v", err)
 	}
@@ -69,12 +78,12 @@ func TestAdd(t *testing.T) {
 		t.Fatalf("Entries' missing files")
 	}
 
-	err = commands.Add([]string{"go.mod"})
+	err = repo.Add([]string{"go.mod"})
 	if err != nil {
 		t.Fatalf("Adding to existing index errored, error: %v", err)
 	}
 
-	entries, err = index.ReadIndex()
+	entries, err = index.ReadIndex(repo.IndexPath())
 	if err != nil {
 		t.Fatalf("Read index errored: %v", err)
 	}
@@ -83,16 +92,17 @@ func TestAdd(t *testing.T) {
 		t.Fatalf("Entries' missing 3rd file")
 	}
 
-	err = commands.Add([]string{"go.mod"})
+	err = repo.Add([]string{"go.mod"})
 	if err != nil {
 		t.Fatalf("Adding to existing index the 2nd time errored, error: %v", err)
 	}
 
-	entries, err = index.ReadIndex()
+	entries, err = index.ReadIndex(repo.IndexPath())
 	if err != nil {
 		t.Fatalf("Read index errored: %v", err)
 	}
-	path := filepath.Join(".git-go", "objects", hex.EncodeToString(entries[0].Hash[:])[38:], hex.EncodeToString(entries[0].Hash[:]))
+	hash := hex.EncodeToString(entries[0].Hash[:])
+	path := filepath.Join(".git-go", "objects", hash[:2], hash[2:])
 	if _, err := os.Stat(path); os.IsNotExist(err) {
 		t.Fatalf("Object doesn't exist")
 	}
@@ -110,7 +120,7 @@ func TestTree(t *testing.T) {
 		os.RemoveAll("commands/test")
 	})
 
-	commands.Init()
+	repo := initRepo(t)
 	err := os.Mkdir("commands/test", 0755)
 	if err != nil {
 		t.Fatalf("Dir creation errored: %v", err)
@@ -122,12 +132,17 @@ func TestTree(t *testing.T) {
 	}
 	defer file.Close()
 
-	err = commands.Add([]string{"main.go", "commands/commands.go", "main_test.go", "commands/test/test.txt"})
+	err = repo.Add([]string{"main.go", "commands/commands.go", "main_test.go", "commands/test/test.txt"})
 	if err != nil {
 		t.Fatalf("Add errored: %v", err)
 	}
 
-	trees, err := tree.CreateRoot()
+	entries, err := index.ReadIndex(repo.IndexPath())
+	if err != nil {
+		t.Fatalf("Read index errored: %v", err)
+	}
+
+	trees, err := tree.CreateRoot(entries)
 	if err == nil {
 		rootLen := len(trees["."].Children)
 		if rootLen > 3 {
@@ -143,3 +158,73 @@ func TestTree(t *testing.T) {
 	}
 
 }
+
+func buildBinary(t *testing.T) string {
+	t.Helper()
+	binary := filepath.Join(t.TempDir(), "git-go")
+	if output, err := exec.Command("go", "build", "-o", binary, ".").CombinedOutput(); err != nil {
+		t.Fatalf("Build failed: %v\n%s", err, output)
+	}
+	return binary
+}
+
+func TestAmbiguousArguments(t *testing.T) {
+	binary := buildBinary(t)
+	dir := t.TempDir()
+	run := func(args ...string) (string, error) {
+		t.Helper()
+		command := exec.Command(binary, args...)
+		command.Dir = dir
+		output, err := command.CombinedOutput()
+		return string(output), err
+	}
+	if _, err := commands.Init(dir, commands.InitOptions{}); err != nil {
+		t.Fatalf("Init errored: %v", err)
+	}
+	os.WriteFile(filepath.Join(dir, "file.txt"), []byte("hello\n"), 0644)
+	for _, args := range [][]string{{"add", "file.txt"}, {"commit", "-m", "Init"}} {
+		if output, err := run(args...); err != nil {
+			t.Fatalf("%v failed: %v\n%s", args, err, output)
+		}
+	}
+
+	for _, args := range [][]string{{"diff", "mian"}, {"log", "HEAD~99"}, {"log", "HEAD", "file.txt", "mian"}} {
+		output, err := run(args...)
+		if err == nil || !strings.Contains(output, "ambiguous argument") {
+			t.Errorf("%v = %q, %v, want an ambiguous argument error", args, output, err)
+		}
+	}
+	for _, args := range [][]string{{"diff", "HEAD", "file.txt"}, {"log", "HEAD", "file.txt"}, {"log", "--", "mian"}, {"log", "*.txt"}} {
+		if output, err := run(args...); err != nil {
+			t.Errorf("%v failed: %v\n%s", args, err, output)
+		}
+	}
+}
+
+func TestBrokenRepo(t *testing.T) {
+	binary := buildBinary(t)
+	dir := t.TempDir()
+	run := func(args ...string) (string, error) {
+		t.Helper()
+		command := exec.Command(binary, args...)
+		command.Dir = dir
+		output, err := command.CombinedOutput()
+		return string(output), err
+	}
+
+	if output, err := run("status"); err == nil || !strings.Contains(output, "No repo initialized") {
+		t.Fatalf("status outside of a repo = %q, %v", output, err)
+	}
+
+	// Other errors are reported as they are, for commands and aliases alike.
+	if _, err := commands.Init(dir, commands.InitOptions{}); err != nil {
+		t.Fatalf("Init errored: %v", err)
+	}
+	os.WriteFile(filepath.Join(dir, ".git-go", "config"), []byte("[core\n"), 0644)
+	for _, args := range [][]string{{"status"}, {"st"}} {
+		output, err := run(args...)
+		if err == nil || output == "" || strings.Contains(output, "No repo initialized") {
+			t.Errorf("%v with a broken config = %q, %v", args, output, err)
+		}
+	}
+}
@@ -3,64 +3,83 @@ package object
 import (
 	"bytes"
 	"compress/zlib"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
 	"io"
-	"os"
-	"path/filepath"
+	"strconv"
 )
 
 const (
-	ModeDirectory uint32 = 0o40000 // Directory
-	ModeRegular   uint32 = 0100644 // Regular file
+	ModeDirectory  uint32 = 0o40000 // Directory
+	ModeRegular    uint32 = 0100644 // Regular file
+	ModeExecutable uint32 = 0100755 // Executable file
 )
 
-func WriteObject(fileContent []byte, name string) error {
-	var buffer bytes.Buffer
-	w := zlib.NewWriter(&buffer)
-	_, err := w.Write(fileContent)
-	if err != nil {
-		return err
-	}
-	w.Close()
-
-	compressedContent := buffer.Bytes()
+// Object types as they appear in the loose object header.
+const (
+	TypeBlob   = "blob"
+	TypeTree   = "tree"
+	TypeCommit = "commit"
+	TypeTag    = "tag"
+)
 
-	dirPath := filepath.Join(".git-go", "objects", name[38:])
+// Prepends the "<type> <size>\0" header Git expects in front of every object.
+func Encode(objType string, content []byte) []byte {
+	data := fmt.Appendf(nil, "%s %d\x00", objType, len(content))
+	return append(data, content...)
+}
 
-	if err = os.MkdirAll(dirPath, os.ModePerm); err != nil {
-		return err
+// Splits a decompressed object into its type and content and checks the size in the header.
+func Decode(data []byte) (string, []byte, error) {
+	headerEnd := bytes.IndexByte(data, 0)
+	if headerEnd == -1 {
+		return "", nil, errors.New("object header end not found")
 	}
-
-	file, err := os.Create(filepath.Join(dirPath, name))
+	objType, size, ok := bytes.Cut(data[:headerEnd], []byte(" "))
+	if !ok {
+		return "", nil, fmt.Errorf("malformed object header %q", data[:headerEnd])
+	}
+	switch string(objType) {
+	case TypeBlob, TypeTree, TypeCommit, TypeTag:
+	default:
+		return "", nil, fmt.Errorf("unknown object type %q", objType)
+	}
+	length, err := strconv.Atoi(string(size))
 	if err != nil {
-		return err
+		return "", nil, fmt.Errorf("malformed object size %q", size)
 	}
-	defer file.Close()
-
-	if _, err := file.Write(compressedContent); err != nil {
-		return err
+	content := data[headerEnd+1:]
+	if length != len(content) {
+		return "", nil, fmt.Errorf("object size mismatch: header says %d, got %d", length, len(content))
 	}
+	return string(objType), content, nil
+}
 
-	return nil
+// Returns the hex encoded SHA-1 Git would name an object of the given type and content.
+func Hash(objType string, content []byte) string {
+	sum := sha1.Sum(Encode(objType, content))
+	return hex.EncodeToString(sum[:])
 }
 
-func ReadObject(name string) ([]byte, error) {
-	path := filepath.Join(".git-go", "objects", name[38:], name)
-	compressedData, err := os.ReadFile(path)
-	if err != nil {
-		return nil, err
+// Hashes an object of the given size read from r without holding it in memory.
+func HashReader(objType string, size int64, r io.Reader) (string, error) {
+	hasher := sha1.New()
+	fmt.Fprintf(hasher, "%s %d\x00", objType, size)
+	if _, err := io.CopyN(hasher, r, size); err != nil {
+		return "", err
 	}
-	bytesReader := bytes.NewReader(compressedData)
-	reader, err := zlib.NewReader(bytesReader)
+	return hex.EncodeToString(hasher.Sum(nil)), nil
+}
+
+// Decompresses zlib data as found in a loose object file.
+func Inflate(compressedData []byte) ([]byte, error) {
+	reader, err := zlib.NewReader(bytes.NewReader(compressedData))
 	if err != nil {
 		return nil, err
 	}
-	reader.Close()
-
-	decompressedContent, err := io.ReadAll(reader)
-	return decompressedContent, err
-}
+	defer reader.Close()
 
-func ObjectExist(hash string) bool {
-	_, err := os.Stat(filepath.Join(".git-go", "objects", hash[38:], hash))
-	return err == nil
+	return io.ReadAll(reader)
 }
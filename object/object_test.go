@@ -1,24 +1,37 @@
 package object_test
 
 import (
-	"crypto/sha1"
-	"encoding/hex"
+	"bytes"
+	"errors"
 	"os"
+	"path/filepath"
 	"reflect"
+	"strings"
 	"testing"
 
 	"github.com/f1-surya/git-go/commands"
 	"github.com/f1-surya/git-go/object"
+	"github.com/f1-surya/git-go/pack"
 )
 
+func initRepo(t *testing.T) *commands.Repository {
+	t.Helper()
+	repo, err := commands.Init(".", commands.InitOptions{})
+	if err != nil {
+		t.Fatalf("Init errored: %v", err)
+	}
+	return repo
+}
+
+var store = object.NewLooseStore(filepath.Join(".git-go", "objects"))
+
 func TestWriteBlob(t *testing.T) {
 	file, err := os.ReadFile("object_test.go")
 	if err != nil {
 		t.Fatalf("Read file errored: %v", err)
 	}
 
-	fileName := sha1.Sum(file)
-	err = object.WriteObject(file, hex.EncodeToString(fileName[:]))
+	_, err = store.Put(object.TypeBlob, file)
 	if err != nil {
 		t.Fatalf("Blob writing errored: %v", err)
 	}
@@ -32,21 +45,27 @@ func TestContent(t *testing.T) {
 		t.Fatalf("Read file errored: %v", err)
 	}
 
-	sum := sha1.Sum(file)
-	fileName := hex.EncodeToString(sum[:])
-	err = object.WriteObject(file, fileName)
-	if object.WriteObject(file, fileName); err != nil {
+	fileName, err := store.Put(object.TypeBlob, file)
+	if _, err := store.Put(object.TypeBlob, file); err != nil {
 		t.Fatalf("Object writing errored: %v", err)
 	}
 
-	blob, err := object.ReadObject(fileName)
+	objType, blob, err := store.Get(fileName)
 	if err != nil {
 		t.Fatalf("Read blob object: %v", err)
 	}
-	if !reflect.DeepEqual(file, blob) {
+	if objType != object.TypeBlob || !reflect.DeepEqual(file, blob) {
 		t.Fatalf("Decompressed content doesn't match")
 	}
 
+	objType, size, err := store.Stat(fileName)
+	if err != nil {
+		t.Fatalf("Stat errored: %v", err)
+	}
+	if objType != object.TypeBlob || size != int64(len(file)) {
+		t.Fatalf("Wrong type or size: %s %d", objType, size)
+	}
+
 	os.RemoveAll(".git-go")
 }
 
@@ -54,8 +73,8 @@ func TestObjectExists(t *testing.T) {
 	t.Cleanup(func() {
 		os.RemoveAll(".git-go")
 	})
-	commands.Init()
-	err := commands.Add([]string{"object.go"})
+	repo := initRepo(t)
+	err := repo.Add([]string{"object.go"})
 	if err != nil {
 		t.Fatalf("Add errored: %v", err)
 	}
@@ -63,9 +82,8 @@ func TestObjectExists(t *testing.T) {
 	if err != nil {
 		t.Fatalf("Readfile errored: %v", err)
 	}
-	fileHash := sha1.Sum(file)
-	fileHashString := hex.EncodeToString(fileHash[:])
-	if !object.ObjectExist(fileHashString) {
+	fileHashString := object.Hash(object.TypeBlob, file)
+	if !repo.Store.Has(fileHashString) {
 		t.Fatalf("Object does exist but the function is returning false")
 	}
 
@@ -73,9 +91,152 @@ func TestObjectExists(t *testing.T) {
 	if err != nil {
 		t.Fatalf("Read file errored: %v", err)
 	}
-	fileHash = sha1.Sum(file)
-	fileHashString = hex.EncodeToString(fileHash[:])
-	if object.ObjectExist(fileHashString) {
+	fileHashString = object.Hash(object.TypeBlob, file)
+	if repo.Store.Has(fileHashString) {
 		t.Fatalf("File is not being tracked but the function returns true")
 	}
 }
+
+func TestMemoryStore(t *testing.T) {
+	memory := object.NewMemoryStore()
+
+	hash, err := memory.Put(object.TypeBlob, []byte("hello world\n"))
+	if err != nil {
+		t.Fatalf("Put errored: %v", err)
+	}
+	if hash != object.Hash(object.TypeBlob, []byte("hello world\n")) {
+		t.Fatalf("Wrong hash: %s", hash)
+	}
+	if !memory.Has(hash) {
+		t.Fatalf("Stored object is missing")
+	}
+
+	objType, content, err := memory.Get(hash)
+	if err != nil {
+		t.Fatalf("Get errored: %v", err)
+	}
+	if objType != object.TypeBlob || string(content) != "hello world\n" {
+		t.Fatalf("Wrong object: %s %q", objType, content)
+	}
+
+	if _, _, err := memory.Get(object.Hash(object.TypeBlob, nil)); !errors.Is(err, object.ErrNotFound) {
+		t.Fatalf("Missing object should return ErrNotFound, got %v", err)
+	}
+
+	count := 0
+	memory.Iterate(func(string) error {
+		count++
+		return nil
+	})
+	if count != 1 {
+		t.Fatalf("Iterate visited %d objects", count)
+	}
+}
+
+func TestEncodeDecode(t *testing.T) {
+	content := []byte("hello world\n")
+	data := object.Encode(object.TypeBlob, content)
+	if string(data) != "blob 12\x00hello world\n" {
+		t.Fatalf("Wrong header: %q", data)
+	}
+
+	// Same hash as `git hash-object` for the same content.
+	if hash := object.Hash(object.TypeBlob, content); hash != "3b18e512dba79e4c8300dd08aeb37f8e728b8dad" {
+		t.Fatalf("Wrong hash: %s", hash)
+	}
+
+	objType, decoded, err := object.Decode(data)
+	if err != nil {
+		t.Fatalf("Decode errored: %v", err)
+	}
+	if objType != object.TypeBlob || !reflect.DeepEqual(decoded, content) {
+		t.Fatalf("Decoded object doesn't match: %s %q", objType, decoded)
+	}
+
+	if _, _, err := object.Decode([]byte("blob 3\x00hello")); err == nil {
+		t.Fatalf("Size mismatch wasn't detected")
+	}
+}
+
+func TestObjectLayout(t *testing.T) {
+	t.Cleanup(func() {
+		os.RemoveAll(".git-go")
+	})
+	hash, err := store.Put(object.TypeBlob, []byte("hello world\n"))
+	if err != nil {
+		t.Fatalf("Object writing errored: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(".git-go", "objects", hash[:2], hash[2:])); err != nil {
+		t.Fatalf("Object is not stored in the fan-out directory: %v", err)
+	}
+}
+
+func TestLooseStoreReadsPacks(t *testing.T) {
+	dir := t.TempDir()
+	packed := pack.Object{Type: object.TypeBlob, Content: []byte("packed content\n")}
+	if _, err := pack.WriteFiles(filepath.Join(dir, "pack"), []pack.Object{packed}, pack.DefaultWriteOptions); err != nil {
+		t.Fatalf("Writing pack errored: %v", err)
+	}
+
+	loose := object.NewLooseStore(dir)
+	hash := object.Hash(object.TypeBlob, packed.Content)
+	if !loose.Has(hash) {
+		t.Fatalf("Packed object isn't found")
+	}
+	objType, content, err := loose.Get(hash)
+	if err != nil {
+		t.Fatalf("Get errored: %v", err)
+	}
+	if objType != object.TypeBlob || string(content) != "packed content\n" {
+		t.Fatalf("Wrong packed object: %s %q", objType, content)
+	}
+
+	count := 0
+	loose.Iterate(func(string) error {
+		count++
+		return nil
+	})
+	if count != 1 {
+		t.Fatalf("Iterate visited %d objects", count)
+	}
+
+	// Storing a packed object again doesn't duplicate it as a loose object.
+	if got, err := loose.Put(packed.Type, packed.Content); err != nil || got != hash {
+		t.Fatalf("Put returned %s, %v", got, err)
+	}
+	if got, err := loose.PutReader(packed.Type, int64(len(packed.Content)), bytes.NewReader(packed.Content)); err != nil || got != hash {
+		t.Fatalf("PutReader returned %s, %v", got, err)
+	}
+	if loose.HasLoose(hash) {
+		t.Fatalf("Packed object was written as a loose object")
+	}
+	if _, err := loose.PutLoose(packed.Type, packed.Content); err != nil || !loose.HasLoose(hash) {
+		t.Fatalf("PutLoose didn't write a loose object: %v", err)
+	}
+}
+
+func TestPutReader(t *testing.T) {
+	content := []byte(strings.Repeat("streamed content\n", 1000))
+	want := object.Hash(object.TypeBlob, content)
+
+	hash, err := object.HashReader(object.TypeBlob, int64(len(content)), bytes.NewReader(content))
+	if err != nil || hash != want {
+		t.Fatalf("HashReader returned %s, %v, want %s", hash, err, want)
+	}
+
+	stores := []object.ObjectStore{object.NewLooseStore(t.TempDir()), object.NewMemoryStore()}
+	for _, s := range stores {
+		hash, err := object.PutReader(s, object.TypeBlob, int64(len(content)), bytes.NewReader(content))
+		if err != nil || hash != want {
+			t.Fatalf("PutReader returned %s, %v, want %s", hash, err, want)
+		}
+		objType, stored, err := s.Get(hash)
+		if err != nil || objType != object.TypeBlob || !bytes.Equal(stored, content) {
+			t.Fatalf("Streamed object didn't round trip: %s, %v", objType, err)
+		}
+	}
+
+	if _, err := object.PutReader(stores[0], object.TypeBlob, int64(len(content))+1, bytes.NewReader(content)); err == nil {
+		t.Fatalf("PutReader accepted a short reader")
+	}
+}
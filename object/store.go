@@ -0,0 +1,459 @@
+package object
+
+import (
+	"bufio"
+	"bytes"
+	"compress/zlib"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/f1-surya/git-go/pack"
+)
+
+var ErrNotFound = errors.New("object not found")
+
+// Storage for Git objects, addressed by the hex SHA-1 of their encoded form.
+type ObjectStore interface {
+	// Returns the type and content (without the header) of the object.
+	Get(hash string) (string, []byte, error)
+	// Stores the object and returns its hash. Storing an existing object is a no-op.
+	Put(objType string, content []byte) (string, error)
+	Has(hash string) bool
+	// Calls fn with the hash of every object in the store, stops at the first error.
+	Iterate(fn func(hash string) error) error
+	// Returns the type and size of the object, reading as little of it as possible.
+	Stat(hash string) (string, int64, error)
+}
+
+// Implemented by stores that can write an object without holding all of it in memory.
+type ReaderPutter interface {
+	// Stores the object of the given size read from r and returns its hash.
+	PutReader(objType string, size int64, r io.Reader) (string, error)
+}
+
+// Stores the object read from r, streaming it if the store supports it.
+func PutReader(store ObjectStore, objType string, size int64, r io.Reader) (string, error) {
+	if putter, ok := store.(ReaderPutter); ok {
+		return putter.PutReader(objType, size, r)
+	}
+	content := make([]byte, size)
+	if _, err := io.ReadFull(r, content); err != nil {
+		return "", err
+	}
+	return store.Put(objType, content)
+}
+
+// Implemented by stores that can find objects by a hash prefix without
+// listing every object.
+type PrefixFinder interface {
+	// Returns the hashes of the objects starting with the lowercase hex prefix.
+	FindPrefix(prefix string) ([]string, error)
+}
+
+// Returns the sorted hashes of the objects starting with prefix.
+func FindPrefix(store ObjectStore, prefix string) ([]string, error) {
+	var hashes []string
+	if finder, ok := store.(PrefixFinder); ok {
+		found, err := finder.FindPrefix(prefix)
+		if err != nil {
+			return nil, err
+		}
+		hashes = found
+	} else {
+		err := store.Iterate(func(hash string) error {
+			if strings.HasPrefix(hash, prefix) {
+				hashes = append(hashes, hash)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	sort.Strings(hashes)
+	return slices.Compact(hashes), nil
+}
+
+func notFound(hash string) error {
+	return fmt.Errorf("%w: %s", ErrNotFound, hash)
+}
+
+// Stores every object as its own zlib compressed file under Dir, using
+// Git's loose object layout (Dir/ab/cdef...). Objects that were packed into
+// Dir/pack are read from there transparently, new objects are always loose.
+type LooseStore struct {
+	Dir string
+
+	mu    sync.Mutex
+	packs map[string]*pack.Pack
+}
+
+func NewLooseStore(dir string) *LooseStore {
+	return &LooseStore{Dir: dir}
+}
+
+func (s *LooseStore) path(hash string) string {
+	return filepath.Join(s.Dir, hash[:2], hash[2:])
+}
+
+// Returns the packs in Dir/pack, opening new ones and dropping removed ones.
+func (s *LooseStore) Packs() ([]*pack.Pack, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	matches, err := filepath.Glob(filepath.Join(s.Dir, "pack", "pack-*.pack"))
+	if err != nil {
+		return nil, err
+	}
+	current := make(map[string]*pack.Pack)
+	for _, path := range matches {
+		if p, ok := s.packs[path]; ok {
+			current[path] = p
+			continue
+		}
+		if _, err := os.Stat(strings.TrimSuffix(path, ".pack") + ".idx"); err != nil {
+			// Still being written.
+			continue
+		}
+		p, err := pack.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		current[path] = p
+	}
+	for path, p := range s.packs {
+		if _, ok := current[path]; !ok {
+			p.Close()
+		}
+	}
+	s.packs = current
+
+	packs := make([]*pack.Pack, 0, len(current))
+	for _, path := range matches {
+		if p, ok := current[path]; ok {
+			packs = append(packs, p)
+		}
+	}
+	return packs, nil
+}
+
+func (s *LooseStore) findPacked(hash string) (*pack.Pack, error) {
+	packs, err := s.Packs()
+	if err != nil {
+		return nil, err
+	}
+	for _, p := range packs {
+		if p.Has(hash) {
+			return p, nil
+		}
+	}
+	return nil, notFound(hash)
+}
+
+func (s *LooseStore) Get(hash string) (string, []byte, error) {
+	if len(hash) != 40 {
+		return "", nil, notFound(hash)
+	}
+	compressedData, err := os.ReadFile(s.path(hash))
+	if err != nil {
+		if os.IsNotExist(err) {
+			p, err := s.findPacked(hash)
+			if err != nil {
+				return "", nil, err
+			}
+			return p.Get(hash)
+		}
+		return "", nil, err
+	}
+	data, err := Inflate(compressedData)
+	if err != nil {
+		return "", nil, fmt.Errorf("could not decompress %s: %w", hash, err)
+	}
+	return Decode(data)
+}
+
+func (s *LooseStore) Put(objType string, content []byte) (string, error) {
+	hash := Hash(objType, content)
+	if s.Has(hash) {
+		return hash, nil
+	}
+	return s.putReader(objType, int64(len(content)), bytes.NewReader(content), s.Has)
+}
+
+// Stores the object as a loose file even if a pack has it, for objects of a
+// pack that's about to be deleted.
+func (s *LooseStore) PutLoose(objType string, content []byte) (string, error) {
+	hash := Hash(objType, content)
+	if s.HasLoose(hash) {
+		return hash, nil
+	}
+	return s.putReader(objType, int64(len(content)), bytes.NewReader(content), s.HasLoose)
+}
+
+// Compresses the object into a temp file while hashing it, so large files
+// never have to be held in memory.
+func (s *LooseStore) PutReader(objType string, size int64, r io.Reader) (string, error) {
+	return s.putReader(objType, size, r, s.Has)
+}
+
+// Writes the object unless has reports that it's already stored.
+func (s *LooseStore) putReader(objType string, size int64, r io.Reader, has func(hash string) bool) (string, error) {
+	if err := os.MkdirAll(s.Dir, os.ModePerm); err != nil {
+		return "", err
+	}
+
+	// Written to a temp file first so readers never see a partially written object.
+	file, err := os.CreateTemp(s.Dir, "tmp_obj_")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(file.Name())
+
+	hasher := sha1.New()
+	w := zlib.NewWriter(file)
+	out := io.MultiWriter(w, hasher)
+	_, err = fmt.Fprintf(out, "%s %d\x00", objType, size)
+	if err == nil {
+		_, err = io.CopyN(out, r, size)
+	}
+	if err == nil {
+		err = w.Close()
+	}
+	if err != nil {
+		file.Close()
+		return "", err
+	}
+	if err := file.Close(); err != nil {
+		return "", err
+	}
+
+	hash := hex.EncodeToString(hasher.Sum(nil))
+	if has(hash) {
+		return hash, nil
+	}
+	path := s.path(hash)
+	if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+		return "", err
+	}
+	if err := os.Rename(file.Name(), path); err != nil {
+		return "", err
+	}
+	return hash, nil
+}
+
+func (s *LooseStore) Has(hash string) bool {
+	if s.HasLoose(hash) {
+		return true
+	}
+	_, err := s.findPacked(hash)
+	return err == nil
+}
+
+// Reports whether the object is stored as a loose file, ignoring packs.
+func (s *LooseStore) HasLoose(hash string) bool {
+	if len(hash) != 40 {
+		return false
+	}
+	_, err := os.Stat(s.path(hash))
+	return err == nil
+}
+
+func (s *LooseStore) Iterate(fn func(hash string) error) error {
+	if err := s.IterateLoose(fn); err != nil {
+		return err
+	}
+	packs, err := s.Packs()
+	if err != nil {
+		return err
+	}
+	seen := make(map[string]bool)
+	for _, p := range packs {
+		for _, hash := range p.Hashes() {
+			if seen[hash] || s.HasLoose(hash) {
+				continue
+			}
+			seen[hash] = true
+			if err := fn(hash); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Only reads the fan-out directory of the prefix and the pack indexes.
+func (s *LooseStore) FindPrefix(prefix string) ([]string, error) {
+	if len(prefix) < 2 {
+		return nil, fmt.Errorf("hash prefix %q is too short", prefix)
+	}
+	var hashes []string
+	files, err := os.ReadDir(filepath.Join(s.Dir, prefix[:2]))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	for _, file := range files {
+		if hash := prefix[:2] + file.Name(); len(hash) == 40 && strings.HasPrefix(hash, prefix) {
+			hashes = append(hashes, hash)
+		}
+	}
+
+	packs, err := s.Packs()
+	if err != nil {
+		return nil, err
+	}
+	for _, p := range packs {
+		all := p.Hashes()
+		for i := sort.SearchStrings(all, prefix); i < len(all) && strings.HasPrefix(all[i], prefix); i++ {
+			hashes = append(hashes, all[i])
+		}
+	}
+	return hashes, nil
+}
+
+// Calls fn with the hash of every loose object, ignoring packs.
+func (s *LooseStore) IterateLoose(fn func(hash string) error) error {
+	dirs, err := os.ReadDir(s.Dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	for _, dir := range dirs {
+		if !dir.IsDir() || len(dir.Name()) != 2 {
+			continue
+		}
+		files, err := os.ReadDir(filepath.Join(s.Dir, dir.Name()))
+		if err != nil {
+			return err
+		}
+		for _, file := range files {
+			if len(file.Name()) != 38 {
+				continue
+			}
+			if err := fn(dir.Name() + file.Name()); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (s *LooseStore) Stat(hash string) (string, int64, error) {
+	if len(hash) != 40 {
+		return "", 0, notFound(hash)
+	}
+	file, err := os.Open(s.path(hash))
+	if err != nil {
+		if os.IsNotExist(err) {
+			p, err := s.findPacked(hash)
+			if err != nil {
+				return "", 0, err
+			}
+			objType, content, err := p.Get(hash)
+			return objType, int64(len(content)), err
+		}
+		return "", 0, err
+	}
+	defer file.Close()
+
+	reader, err := zlib.NewReader(file)
+	if err != nil {
+		return "", 0, fmt.Errorf("could not decompress %s: %w", hash, err)
+	}
+	defer reader.Close()
+
+	header, err := bufio.NewReader(reader).ReadBytes(0)
+	if err != nil {
+		return "", 0, fmt.Errorf("could not read header of %s: %w", hash, err)
+	}
+	objType, size, ok := bytes.Cut(header[:len(header)-1], []byte(" "))
+	if !ok {
+		return "", 0, fmt.Errorf("malformed object header %q", header)
+	}
+	length, err := strconv.ParseInt(string(size), 10, 64)
+	if err != nil {
+		return "", 0, fmt.Errorf("malformed object size %q", size)
+	}
+	return string(objType), length, nil
+}
+
+type memoryObject struct {
+	objType string
+	content []byte
+}
+
+// Keeps all objects in memory, useful for tests and short lived operations
+// that shouldn't touch the disk. Safe for concurrent use.
+type MemoryStore struct {
+	mu      sync.RWMutex
+	objects map[string]memoryObject
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{objects: make(map[string]memoryObject)}
+}
+
+func (s *MemoryStore) Get(hash string) (string, []byte, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	obj, ok := s.objects[hash]
+	if !ok {
+		return "", nil, notFound(hash)
+	}
+	return obj.objType, bytes.Clone(obj.content), nil
+}
+
+func (s *MemoryStore) Put(objType string, content []byte) (string, error) {
+	hash := Hash(objType, content)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.objects[hash]; !ok {
+		s.objects[hash] = memoryObject{objType: objType, content: bytes.Clone(content)}
+	}
+	return hash, nil
+}
+
+func (s *MemoryStore) Has(hash string) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	_, ok := s.objects[hash]
+	return ok
+}
+
+func (s *MemoryStore) Iterate(fn func(hash string) error) error {
+	s.mu.RLock()
+	hashes := make([]string, 0, len(s.objects))
+	for hash := range s.objects {
+		hashes = append(hashes, hash)
+	}
+	s.mu.RUnlock()
+
+	sort.Strings(hashes)
+	for _, hash := range hashes {
+		if err := fn(hash); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *MemoryStore) Stat(hash string) (string, int64, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	obj, ok := s.objects[hash]
+	if !ok {
+		return "", 0, notFound(hash)
+	}
+	return obj.objType, int64(len(obj.content)), nil
+}
@@ -0,0 +1,178 @@
+package pack
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+)
+
+// Size of the blocks of the base that are indexed when looking for copies.
+const deltaBlockSize = 16
+
+// Largest amount of bytes a single copy instruction is made to cover.
+const maxCopySize = 0xffff
+
+func appendDeltaSize(buf []byte, size int) []byte {
+	for size >= 0x80 {
+		buf = append(buf, byte(size)|0x80)
+		size >>= 7
+	}
+	return append(buf, byte(size))
+}
+
+func readDeltaSize(delta []byte) (int, []byte, error) {
+	size, shift := 0, 0
+	for i, b := range delta {
+		size |= int(b&0x7f) << shift
+		shift += 7
+		if b&0x80 == 0 {
+			return size, delta[i+1:], nil
+		}
+	}
+	return 0, nil, errors.New("truncated delta size")
+}
+
+func appendInsert(buf, data []byte) []byte {
+	for len(data) > 0 {
+		n := min(len(data), 0x7f)
+		buf = append(buf, byte(n))
+		buf = append(buf, data[:n]...)
+		data = data[n:]
+	}
+	return buf
+}
+
+func appendCopy(buf []byte, offset, size int) []byte {
+	for size > 0 {
+		n := min(size, maxCopySize)
+		op := byte(0x80)
+		var args []byte
+		for i := range 4 {
+			if b := byte(offset >> (8 * i)); b != 0 {
+				op |= 1 << i
+				args = append(args, b)
+			}
+		}
+		for i := range 3 {
+			if b := byte(n >> (8 * i)); b != 0 {
+				op |= 1 << (4 + i)
+				args = append(args, b)
+			}
+		}
+		buf = append(buf, op)
+		buf = append(buf, args...)
+		offset += n
+		size -= n
+	}
+	return buf
+}
+
+// Creates a Git delta that turns base into target. Blocks of the base are
+// indexed by content and every match in the target becomes a copy instruction,
+// everything else is inserted literally.
+func CreateDelta(base, target []byte) []byte {
+	delta := appendDeltaSize(nil, len(base))
+	delta = appendDeltaSize(delta, len(target))
+
+	blocks := make(map[string]int)
+	for i := 0; i+deltaBlockSize <= len(base); i += deltaBlockSize {
+		key := string(base[i : i+deltaBlockSize])
+		if _, ok := blocks[key]; !ok {
+			blocks[key] = i
+		}
+	}
+
+	insertStart := 0
+	for i := 0; i < len(target); {
+		if i+deltaBlockSize > len(target) {
+			break
+		}
+		offset, ok := blocks[string(target[i:i+deltaBlockSize])]
+		if !ok {
+			i++
+			continue
+		}
+
+		// Grow the match in both directions, backwards only into pending literals.
+		start, baseStart := i, offset
+		for start > insertStart && baseStart > 0 && target[start-1] == base[baseStart-1] {
+			start--
+			baseStart--
+		}
+		end, baseEnd := i+deltaBlockSize, offset+deltaBlockSize
+		for end < len(target) && baseEnd < len(base) && target[end] == base[baseEnd] {
+			end++
+			baseEnd++
+		}
+
+		delta = appendInsert(delta, target[insertStart:start])
+		delta = appendCopy(delta, baseStart, end-start)
+		i, insertStart = end, end
+	}
+	return appendInsert(delta, target[insertStart:])
+}
+
+// Applies a Git delta to base and returns the resulting object content.
+func ApplyDelta(base, delta []byte) ([]byte, error) {
+	baseSize, delta, err := readDeltaSize(delta)
+	if err != nil {
+		return nil, err
+	}
+	if baseSize != len(base) {
+		return nil, fmt.Errorf("delta base size mismatch: expected %d, got %d", baseSize, len(base))
+	}
+	targetSize, delta, err := readDeltaSize(delta)
+	if err != nil {
+		return nil, err
+	}
+
+	result := bytes.NewBuffer(make([]byte, 0, targetSize))
+	for len(delta) > 0 {
+		op := delta[0]
+		delta = delta[1:]
+
+		if op&0x80 == 0 {
+			if op == 0 {
+				return nil, errors.New("invalid delta instruction 0")
+			}
+			if int(op) > len(delta) {
+				return nil, errors.New("truncated delta insert")
+			}
+			result.Write(delta[:op])
+			delta = delta[op:]
+			continue
+		}
+
+		offset, size := 0, 0
+		for i := range 4 {
+			if op&(1<<i) != 0 {
+				if len(delta) == 0 {
+					return nil, errors.New("truncated delta copy")
+				}
+				offset |= int(delta[0]) << (8 * i)
+				delta = delta[1:]
+			}
+		}
+		for i := range 3 {
+			if op&(1<<(4+i)) != 0 {
+				if len(delta) == 0 {
+					return nil, errors.New("truncated delta copy")
+				}
+				size |= int(delta[0]) << (8 * i)
+				delta = delta[1:]
+			}
+		}
+		if size == 0 {
+			size = 0x10000
+		}
+		if offset+size > len(base) {
+			return nil, errors.New("delta copy out of base bounds")
+		}
+		result.Write(base[offset : offset+size])
+	}
+
+	if result.Len() != targetSize {
+		return nil, fmt.Errorf("delta result size mismatch: expected %d, got %d", targetSize, result.Len())
+	}
+	return result.Bytes(), nil
+}
@@ -0,0 +1,121 @@
+package pack
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Object type codes used in pack entry headers.
+const (
+	typeCommit   = 1
+	typeTree     = 2
+	typeBlob     = 3
+	typeTag      = 4
+	typeOfsDelta = 6
+	typeRefDelta = 7
+)
+
+var typeCodes = map[string]byte{
+	"commit": typeCommit,
+	"tree":   typeTree,
+	"blob":   typeBlob,
+	"tag":    typeTag,
+}
+
+var typeNames = map[byte]string{
+	typeCommit: "commit",
+	typeTree:   "tree",
+	typeBlob:   "blob",
+	typeTag:    "tag",
+}
+
+// An object to store in a pack.
+type Object struct {
+	Type    string
+	Content []byte
+}
+
+// Returns the hash Git gives the object, the same as object.Hash.
+func (o Object) Hash() [20]byte {
+	h := sha1.New()
+	fmt.Fprintf(h, "%s %d\x00", o.Type, len(o.Content))
+	h.Write(o.Content)
+	var sum [20]byte
+	copy(sum[:], h.Sum(nil))
+	return sum
+}
+
+func parseHash(hash string) ([20]byte, error) {
+	var sum [20]byte
+	if len(hash) != 40 {
+		return sum, fmt.Errorf("invalid hash %q", hash)
+	}
+	if _, err := hex.Decode(sum[:], []byte(hash)); err != nil {
+		return sum, fmt.Errorf("invalid hash %q", hash)
+	}
+	return sum, nil
+}
+
+// Encodes the type and uncompressed size that start every pack entry.
+func appendEntryHeader(buf []byte, objType byte, size int) []byte {
+	c := objType<<4 | byte(size&0x0f)
+	size >>= 4
+	for size != 0 {
+		buf = append(buf, c|0x80)
+		c = byte(size & 0x7f)
+		size >>= 7
+	}
+	return append(buf, c)
+}
+
+func readEntryHeader(r *bufio.Reader) (byte, int, error) {
+	b, err := r.ReadByte()
+	if err != nil {
+		return 0, 0, err
+	}
+	objType := (b >> 4) & 0x07
+	size := int(b & 0x0f)
+	shift := 4
+	for b&0x80 != 0 {
+		if b, err = r.ReadByte(); err != nil {
+			return 0, 0, err
+		}
+		size |= int(b&0x7f) << shift
+		shift += 7
+	}
+	return objType, size, nil
+}
+
+// Encodes the distance back to the base of an OFS_DELTA entry.
+func appendOffset(buf []byte, offset uint64) []byte {
+	var tmp [10]byte
+	pos := len(tmp) - 1
+	tmp[pos] = byte(offset & 0x7f)
+	for offset >>= 7; offset != 0; offset >>= 7 {
+		offset--
+		pos--
+		tmp[pos] = 0x80 | byte(offset&0x7f)
+	}
+	return append(buf, tmp[pos:]...)
+}
+
+func readOffset(r io.ByteReader) (uint64, error) {
+	b, err := r.ReadByte()
+	if err != nil {
+		return 0, err
+	}
+	offset := uint64(b & 0x7f)
+	for b&0x80 != 0 {
+		if b, err = r.ReadByte(); err != nil {
+			return 0, err
+		}
+		offset = ((offset + 1) << 7) | uint64(b&0x7f)
+	}
+	return offset, nil
+}
+
+var errBadPack = errors.New("not a version 2 pack file")
@@ -0,0 +1,113 @@
+package pack_test
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/f1-surya/git-go/pack"
+)
+
+func TestDelta(t *testing.T) {
+	base := []byte(strings.Repeat("the quick brown fox jumps over the lazy dog\n", 50))
+	target := append(bytes.Clone(base[:1000]), []byte("something new in the middle\n")...)
+	target = append(target, base[1200:]...)
+
+	delta := pack.CreateDelta(base, target)
+	if len(delta) >= len(target)/2 {
+		t.Fatalf("Delta isn't smaller than the target: %d >= %d", len(delta), len(target)/2)
+	}
+
+	result, err := pack.ApplyDelta(base, delta)
+	if err != nil {
+		t.Fatalf("ApplyDelta errored: %v", err)
+	}
+	if !bytes.Equal(result, target) {
+		t.Fatalf("Delta didn't reproduce the target")
+	}
+
+	if _, err := pack.ApplyDelta(base[1:], delta); err == nil {
+		t.Fatalf("Wrong base size wasn't detected")
+	}
+}
+
+func testObjects() []pack.Object {
+	var objects []pack.Object
+	content := strings.Repeat("line of some file that keeps changing a little\n", 40)
+	for i := range 20 {
+		content += fmt.Sprintf("revision %d\n", i)
+		objects = append(objects, pack.Object{Type: "blob", Content: []byte(content)})
+	}
+	objects = append(objects, pack.Object{Type: "commit", Content: []byte("tree 4b825dc642cb6eb9a060e54bf8d69288fbca4904\n\nmsg\n")})
+	objects = append(objects, pack.Object{Type: "blob", Content: nil})
+	return objects
+}
+
+func TestWriteAndRead(t *testing.T) {
+	for _, refDelta := range []bool{false, true} {
+		t.Run(fmt.Sprintf("refDelta=%v", refDelta), func(t *testing.T) {
+			dir := t.TempDir()
+			objects := testObjects()
+			opts := pack.DefaultWriteOptions
+			opts.RefDelta = refDelta
+
+			path, err := pack.WriteFiles(dir, objects, opts)
+			if err != nil {
+				t.Fatalf("WriteFiles errored: %v", err)
+			}
+			if filepath.Dir(path) != dir || !strings.HasPrefix(filepath.Base(path), "pack-") {
+				t.Fatalf("Pack written to the wrong place: %s", path)
+			}
+			for _, name := range []string{path, strings.TrimSuffix(path, ".pack") + ".idx"} {
+				if info, err := os.Stat(name); err != nil || info.Mode().Perm() != 0444 {
+					t.Fatalf("%s isn't read-only: %v", name, err)
+				}
+			}
+
+			p, err := pack.Open(path)
+			if err != nil {
+				t.Fatalf("Open errored: %v", err)
+			}
+			defer p.Close()
+			if err := p.Verify(); err != nil {
+				t.Fatalf("Verify errored: %v", err)
+			}
+			if len(p.Hashes()) != len(objects) {
+				t.Fatalf("Pack has %d objects, want %d", len(p.Hashes()), len(objects))
+			}
+
+			for _, object := range objects {
+				hash := object.Hash()
+				objType, content, err := p.Get(hex.EncodeToString(hash[:]))
+				if err != nil {
+					t.Fatalf("Get errored: %v", err)
+				}
+				if objType != object.Type || !bytes.Equal(content, object.Content) {
+					t.Fatalf("Object %x doesn't match", hash)
+				}
+			}
+
+			if p.Has(strings.Repeat("0", 40)) {
+				t.Fatalf("Pack claims to have a missing object")
+			}
+		})
+	}
+}
+
+func TestDeltasShrinkPack(t *testing.T) {
+	objects := testObjects()
+	var whole, deltified bytes.Buffer
+	if _, _, err := pack.Write(&whole, objects, pack.WriteOptions{}); err != nil {
+		t.Fatalf("Write errored: %v", err)
+	}
+	if _, _, err := pack.Write(&deltified, objects, pack.DefaultWriteOptions); err != nil {
+		t.Fatalf("Write errored: %v", err)
+	}
+	if deltified.Len() >= whole.Len() {
+		t.Fatalf("Deltas didn't make the pack smaller: %d >= %d", deltified.Len(), whole.Len())
+	}
+}
@@ -0,0 +1,266 @@
+package pack
+
+import (
+	"bufio"
+	"bytes"
+	"compress/zlib"
+	"crypto/sha1"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+)
+
+var ErrNotFound = errors.New("object not in pack")
+
+// A pack file opened through its .idx. Safe for concurrent use.
+type Pack struct {
+	Path     string
+	file     *os.File
+	size     int64
+	hashes   [][20]byte
+	offsets  []uint64
+	crcs     []uint32
+	fanout   [256]uint32
+	checksum [20]byte
+}
+
+// Opens the pack at path (ending in .pack) together with its .idx.
+func Open(path string) (*Pack, error) {
+	idx, err := os.ReadFile(strings.TrimSuffix(path, ".pack") + ".idx")
+	if err != nil {
+		return nil, err
+	}
+	p := &Pack{Path: path}
+	if err := p.parseIndex(idx); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	p.file, p.size = file, info.Size()
+
+	header := make([]byte, 12)
+	if _, err := file.ReadAt(header, 0); err != nil {
+		file.Close()
+		return nil, err
+	}
+	if string(header[:4]) != "PACK" || binary.BigEndian.Uint32(header[4:]) != 2 {
+		file.Close()
+		return nil, errBadPack
+	}
+	if int(binary.BigEndian.Uint32(header[8:])) != len(p.hashes) {
+		file.Close()
+		return nil, fmt.Errorf("%s: object count doesn't match its index", path)
+	}
+	return p, nil
+}
+
+func (p *Pack) parseIndex(idx []byte) error {
+	if len(idx) < 8+256*4+40 || !bytes.Equal(idx[:4], []byte{0xff, 't', 'O', 'c'}) {
+		return errors.New("not a version 2 pack index")
+	}
+	if binary.BigEndian.Uint32(idx[4:]) != 2 {
+		return errors.New("unsupported pack index version")
+	}
+	sum := sha1.Sum(idx[:len(idx)-20])
+	if !bytes.Equal(sum[:], idx[len(idx)-20:]) {
+		return errors.New("pack index checksum mismatch")
+	}
+
+	pos := 8
+	for i := range p.fanout {
+		p.fanout[i] = binary.BigEndian.Uint32(idx[pos:])
+		pos += 4
+	}
+	count := int(p.fanout[255])
+	if len(idx) < pos+count*(20+4+4)+40 {
+		return errors.New("truncated pack index")
+	}
+
+	p.hashes = make([][20]byte, count)
+	for i := range count {
+		copy(p.hashes[i][:], idx[pos:])
+		pos += 20
+	}
+	p.crcs = make([]uint32, count)
+	for i := range count {
+		p.crcs[i] = binary.BigEndian.Uint32(idx[pos:])
+		pos += 4
+	}
+	small := make([]uint32, count)
+	for i := range count {
+		small[i] = binary.BigEndian.Uint32(idx[pos:])
+		pos += 4
+	}
+	p.offsets = make([]uint64, count)
+	for i, offset := range small {
+		if offset&0x80000000 == 0 {
+			p.offsets[i] = uint64(offset)
+			continue
+		}
+		largePos := pos + int(offset&0x7fffffff)*8
+		if largePos+8 > len(idx)-40 {
+			return errors.New("pack index large offset out of range")
+		}
+		p.offsets[i] = binary.BigEndian.Uint64(idx[largePos:])
+	}
+	copy(p.checksum[:], idx[len(idx)-40:])
+	return nil
+}
+
+func (p *Pack) Close() error {
+	return p.file.Close()
+}
+
+// Returns the position of hash in the index or -1.
+func (p *Pack) find(hash [20]byte) int {
+	lo := 0
+	if hash[0] > 0 {
+		lo = int(p.fanout[hash[0]-1])
+	}
+	hi := int(p.fanout[hash[0]])
+	i := lo + sort.Search(hi-lo, func(i int) bool {
+		return bytes.Compare(p.hashes[lo+i][:], hash[:]) >= 0
+	})
+	if i < hi && p.hashes[i] == hash {
+		return i
+	}
+	return -1
+}
+
+func (p *Pack) Has(hash string) bool {
+	sum, err := parseHash(hash)
+	return err == nil && p.find(sum) != -1
+}
+
+// Returns the hashes of every object in the pack, sorted.
+func (p *Pack) Hashes() []string {
+	hashes := make([]string, len(p.hashes))
+	for i, hash := range p.hashes {
+		hashes[i] = hex.EncodeToString(hash[:])
+	}
+	return hashes
+}
+
+// Returns the index entries of every object in the pack.
+func (p *Pack) Entries() []IndexEntry {
+	entries := make([]IndexEntry, len(p.hashes))
+	for i := range p.hashes {
+		entries[i] = IndexEntry{Hash: p.hashes[i], Offset: p.offsets[i], CRC32: p.crcs[i]}
+	}
+	return entries
+}
+
+// Returns the type and content of the object with the given hash, resolving deltas.
+func (p *Pack) Get(hash string) (string, []byte, error) {
+	sum, err := parseHash(hash)
+	if err != nil {
+		return "", nil, err
+	}
+	i := p.find(sum)
+	if i == -1 {
+		return "", nil, fmt.Errorf("%w: %s", ErrNotFound, hash)
+	}
+	return p.readAt(p.offsets[i], 0)
+}
+
+// Deltas are never chained deeper than this, protects against cycles in corrupt packs.
+const maxChainLength = 10000
+
+func (p *Pack) readAt(offset uint64, depth int) (string, []byte, error) {
+	if depth > maxChainLength {
+		return "", nil, errors.New("delta chain too long")
+	}
+	if offset >= uint64(p.size) {
+		return "", nil, fmt.Errorf("offset %d out of pack bounds", offset)
+	}
+	reader := bufio.NewReader(io.NewSectionReader(p.file, int64(offset), p.size-int64(offset)))
+	objType, size, err := readEntryHeader(reader)
+	if err != nil {
+		return "", nil, fmt.Errorf("could not read entry at %d: %w", offset, err)
+	}
+
+	var baseType string
+	var base []byte
+	switch objType {
+	case typeOfsDelta:
+		distance, err := readOffset(reader)
+		if err != nil {
+			return "", nil, err
+		}
+		if distance == 0 || distance > offset {
+			return "", nil, fmt.Errorf("invalid delta base offset at %d", offset)
+		}
+		baseType, base, err = p.readAt(offset-distance, depth+1)
+		if err != nil {
+			return "", nil, err
+		}
+	case typeRefDelta:
+		var baseHash [20]byte
+		if _, err := io.ReadFull(reader, baseHash[:]); err != nil {
+			return "", nil, err
+		}
+		i := p.find(baseHash)
+		if i == -1 {
+			return "", nil, fmt.Errorf("%w: delta base %x", ErrNotFound, baseHash)
+		}
+		baseType, base, err = p.readAt(p.offsets[i], depth+1)
+		if err != nil {
+			return "", nil, err
+		}
+	default:
+		if _, ok := typeNames[objType]; !ok {
+			return "", nil, fmt.Errorf("unknown entry type %d at %d", objType, offset)
+		}
+	}
+
+	zr, err := zlib.NewReader(reader)
+	if err != nil {
+		return "", nil, err
+	}
+	defer zr.Close()
+	data := make([]byte, size)
+	if _, err := io.ReadFull(zr, data); err != nil {
+		return "", nil, fmt.Errorf("could not decompress entry at %d: %w", offset, err)
+	}
+
+	if objType != typeOfsDelta && objType != typeRefDelta {
+		return typeNames[objType], data, nil
+	}
+	content, err := ApplyDelta(base, data)
+	if err != nil {
+		return "", nil, fmt.Errorf("entry at %d: %w", offset, err)
+	}
+	return baseType, content, nil
+}
+
+// Checks the pack checksum against its content and the one recorded in the index.
+func (p *Pack) Verify() error {
+	hasher := sha1.New()
+	if _, err := io.Copy(hasher, io.NewSectionReader(p.file, 0, p.size-20)); err != nil {
+		return err
+	}
+	var trailer [20]byte
+	if _, err := p.file.ReadAt(trailer[:], p.size-20); err != nil {
+		return err
+	}
+	if !bytes.Equal(hasher.Sum(nil), trailer[:]) {
+		return fmt.Errorf("%s: pack checksum mismatch", p.Path)
+	}
+	if trailer != p.checksum {
+		return fmt.Errorf("%s: pack checksum doesn't match its index", p.Path)
+	}
+	return nil
+}
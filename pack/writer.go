@@ -0,0 +1,255 @@
+package pack
+
+import (
+	"bytes"
+	"compress/zlib"
+	"crypto/sha1"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+type WriteOptions struct {
+	// How many of the previously sorted objects are tried as a delta base, 0 disables deltas.
+	Window int
+	// Longest chain of deltas an object may be reconstructed from.
+	MaxDepth int
+	// Write deltas as REF_DELTA (base referenced by hash) instead of OFS_DELTA.
+	RefDelta bool
+}
+
+var DefaultWriteOptions = WriteOptions{Window: 10, MaxDepth: 50}
+
+// Objects smaller than this are always stored whole.
+const minDeltaSize = 64
+
+// The location of an object inside a pack, as recorded by the .idx file.
+type IndexEntry struct {
+	Hash   [20]byte
+	Offset uint64
+	CRC32  uint32
+}
+
+type countingWriter struct {
+	w io.Writer
+	n uint64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += uint64(n)
+	return n, err
+}
+
+type packEntry struct {
+	object Object
+	hash   [20]byte
+	base   int
+	delta  []byte
+	depth  int
+}
+
+// Chooses a delta base for every object. Objects are sorted by type and
+// then by size, biggest first, so bases are always written before the
+// objects that depend on them.
+func planDeltas(objects []Object, opts WriteOptions) []packEntry {
+	entries := make([]packEntry, len(objects))
+	for i, object := range objects {
+		entries[i] = packEntry{object: object, hash: object.Hash(), base: -1}
+	}
+	sort.SliceStable(entries, func(i, j int) bool {
+		if entries[i].object.Type != entries[j].object.Type {
+			return entries[i].object.Type < entries[j].object.Type
+		}
+		return len(entries[i].object.Content) > len(entries[j].object.Content)
+	})
+
+	for i := range entries {
+		target := entries[i].object.Content
+		if len(target) < minDeltaSize {
+			continue
+		}
+		best := len(target) / 2
+		for j := i - 1; j >= 0 && j >= i-opts.Window; j-- {
+			candidate := entries[j]
+			if candidate.object.Type != entries[i].object.Type || candidate.depth >= opts.MaxDepth {
+				continue
+			}
+			delta := CreateDelta(candidate.object.Content, target)
+			if len(delta) < best {
+				best = len(delta)
+				entries[i].base = j
+				entries[i].delta = delta
+				entries[i].depth = candidate.depth + 1
+			}
+		}
+	}
+	return entries
+}
+
+// Writes a version 2 pack containing objects to w. Returns where every object
+// ended up, which is what the .idx file needs, and the pack checksum.
+func Write(w io.Writer, objects []Object, opts WriteOptions) ([]IndexEntry, [20]byte, error) {
+	var checksum [20]byte
+	entries := planDeltas(objects, opts)
+
+	hasher := sha1.New()
+	out := &countingWriter{w: io.MultiWriter(w, hasher)}
+
+	header := []byte("PACK")
+	header = binary.BigEndian.AppendUint32(header, 2)
+	header = binary.BigEndian.AppendUint32(header, uint32(len(entries)))
+	if _, err := out.Write(header); err != nil {
+		return nil, checksum, err
+	}
+
+	index := make([]IndexEntry, len(entries))
+	for i, entry := range entries {
+		offset := out.n
+
+		var raw []byte
+		data := entry.object.Content
+		if entry.base == -1 {
+			typeCode, ok := typeCodes[entry.object.Type]
+			if !ok {
+				return nil, checksum, fmt.Errorf("unknown object type %q", entry.object.Type)
+			}
+			raw = appendEntryHeader(raw, typeCode, len(data))
+		} else if opts.RefDelta {
+			data = entry.delta
+			raw = appendEntryHeader(raw, typeRefDelta, len(data))
+			raw = append(raw, entries[entry.base].hash[:]...)
+		} else {
+			data = entry.delta
+			raw = appendEntryHeader(raw, typeOfsDelta, len(data))
+			raw = appendOffset(raw, offset-index[entry.base].Offset)
+		}
+
+		var compressed bytes.Buffer
+		zw := zlib.NewWriter(&compressed)
+		if _, err := zw.Write(data); err != nil {
+			return nil, checksum, err
+		}
+		if err := zw.Close(); err != nil {
+			return nil, checksum, err
+		}
+		raw = append(raw, compressed.Bytes()...)
+
+		if _, err := out.Write(raw); err != nil {
+			return nil, checksum, err
+		}
+		index[i] = IndexEntry{Hash: entry.hash, Offset: offset, CRC32: crc32.ChecksumIEEE(raw)}
+	}
+
+	copy(checksum[:], hasher.Sum(nil))
+	if _, err := w.Write(checksum[:]); err != nil {
+		return nil, checksum, err
+	}
+	return index, checksum, nil
+}
+
+// Writes a version 2 .idx file for a pack with the given entries and checksum.
+func WriteIndex(w io.Writer, entries []IndexEntry, packChecksum [20]byte) error {
+	sorted := make([]IndexEntry, len(entries))
+	copy(sorted, entries)
+	sort.Slice(sorted, func(i, j int) bool {
+		return bytes.Compare(sorted[i].Hash[:], sorted[j].Hash[:]) < 0
+	})
+
+	hasher := sha1.New()
+	out := io.MultiWriter(w, hasher)
+
+	buf := []byte{0xff, 't', 'O', 'c'}
+	buf = binary.BigEndian.AppendUint32(buf, 2)
+
+	var fanout [256]uint32
+	for _, entry := range sorted {
+		fanout[entry.Hash[0]]++
+	}
+	total := uint32(0)
+	for i := range fanout {
+		total += fanout[i]
+		buf = binary.BigEndian.AppendUint32(buf, total)
+	}
+
+	for _, entry := range sorted {
+		buf = append(buf, entry.Hash[:]...)
+	}
+	for _, entry := range sorted {
+		buf = binary.BigEndian.AppendUint32(buf, entry.CRC32)
+	}
+	var large []uint64
+	for _, entry := range sorted {
+		if entry.Offset < 0x80000000 {
+			buf = binary.BigEndian.AppendUint32(buf, uint32(entry.Offset))
+			continue
+		}
+		buf = binary.BigEndian.AppendUint32(buf, 0x80000000|uint32(len(large)))
+		large = append(large, entry.Offset)
+	}
+	for _, offset := range large {
+		buf = binary.BigEndian.AppendUint64(buf, offset)
+	}
+	buf = append(buf, packChecksum[:]...)
+
+	if _, err := out.Write(buf); err != nil {
+		return err
+	}
+	_, err := w.Write(hasher.Sum(nil))
+	return err
+}
+
+// Writes objects as pack-<checksum>.pack and pack-<checksum>.idx into dir
+// and returns the path of the pack. The idx is written last so readers never
+// find an index without its pack.
+func WriteFiles(dir string, objects []Object, opts WriteOptions) (string, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+
+	tmpPack, err := os.CreateTemp(dir, "tmp_pack_")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(tmpPack.Name())
+	entries, checksum, err := Write(tmpPack, objects, opts)
+	if closeErr := tmpPack.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return "", err
+	}
+
+	tmpIdx, err := os.CreateTemp(dir, "tmp_idx_")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(tmpIdx.Name())
+	err = WriteIndex(tmpIdx, entries, checksum)
+	if closeErr := tmpIdx.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return "", err
+	}
+
+	// Read-only like in git, temp files are only readable by their owner.
+	for _, name := range []string{tmpPack.Name(), tmpIdx.Name()} {
+		if err := os.Chmod(name, 0444); err != nil {
+			return "", err
+		}
+	}
+	base := filepath.Join(dir, "pack-"+hex.EncodeToString(checksum[:]))
+	if err := os.Rename(tmpPack.Name(), base+".pack"); err != nil {
+		return "", err
+	}
+	if err := os.Rename(tmpIdx.Name(), base+".idx"); err != nil {
+		return "", err
+	}
+	return base + ".pack", nil
+}
@@ -0,0 +1,171 @@
+package pathspec
+
+import (
+	"fmt"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// A pattern selecting paths in the work tree. A pattern matches a path if it
+// matches the path itself or one of its parent directories, so a directory
+// selects everything below it. Glob patterns use *, ? and [...] within a path
+// segment and ** for any number of directories. Like in Git, a glob without a
+// slash matches file names at any depth below the directory it was given in.
+type Pattern struct {
+	// The pattern relative to the root of the work tree, "" matches everything.
+	clean    string
+	segments []string
+	literal  bool
+}
+
+// Compiles pattern, which is relative to prefix, a slash separated directory
+// relative to the root of the work tree.
+func Compile(prefix, pattern string) (Pattern, error) {
+	pattern = filepath.ToSlash(pattern)
+	clean := path.Join(filepath.ToSlash(prefix), pattern)
+	if clean == ".." || strings.HasPrefix(clean, "../") || path.IsAbs(clean) {
+		return Pattern{}, fmt.Errorf("%s is outside the repository", pattern)
+	}
+	if clean == "." {
+		clean = ""
+	}
+
+	p := Pattern{clean: clean, literal: !hasMagic(pattern)}
+	if p.literal || clean == "" {
+		return p, nil
+	}
+
+	var segments []string
+	if name := strings.TrimSuffix(pattern, "/"); !strings.Contains(name, "/") {
+		if base := path.Clean(filepath.ToSlash(prefix)); base != "." {
+			segments = strings.Split(base, "/")
+		}
+		segments = append(segments, "**", name)
+	} else {
+		segments = strings.Split(clean, "/")
+	}
+	for _, segment := range segments {
+		if _, err := path.Match(segment, ""); err != nil {
+			return Pattern{}, fmt.Errorf("invalid pattern %s: %w", pattern, err)
+		}
+	}
+	p.segments = segments
+	return p, nil
+}
+
+func hasMagic(pattern string) bool {
+	return strings.ContainsAny(pattern, "*?[\\")
+}
+
+func (p Pattern) String() string {
+	if p.clean == "" {
+		return "."
+	}
+	return p.clean
+}
+
+// Returns the leading directories of the pattern that don't contain globs,
+// nothing outside of it can match. "" means the whole work tree.
+func (p Pattern) Root() string {
+	if p.literal {
+		return p.clean
+	}
+	var literal []string
+	for _, segment := range p.segments {
+		if hasMagic(segment) {
+			break
+		}
+		literal = append(literal, segment)
+	}
+	return strings.Join(literal, "/")
+}
+
+// Reports whether the path, relative to the root of the work tree, is selected.
+func (p Pattern) Match(name string) bool {
+	name = filepath.ToSlash(name)
+	if p.clean == "" || name == p.clean || strings.HasPrefix(name, p.clean+"/") {
+		return true
+	}
+	if p.literal {
+		return false
+	}
+	return matchSegments(p.segments, strings.Split(name, "/"))
+}
+
+func matchSegments(pattern, parts []string) bool {
+	if len(pattern) == 0 {
+		// Everything below a matching directory matches too.
+		return true
+	}
+	if pattern[0] == "**" {
+		for i := 0; i <= len(parts); i++ {
+			if matchSegments(pattern[1:], parts[i:]) {
+				return true
+			}
+		}
+		return false
+	}
+	if len(parts) == 0 {
+		return false
+	}
+	ok, _ := path.Match(pattern[0], parts[0])
+	return ok && matchSegments(pattern[1:], parts[1:])
+}
+
+// A list of patterns, a path is selected if any of them matches it.
+type Pathspec []Pattern
+
+// Compiles the patterns, which are relative to prefix.
+func New(prefix string, patterns ...string) (Pathspec, error) {
+	spec := make(Pathspec, 0, len(patterns))
+	for _, pattern := range patterns {
+		p, err := Compile(prefix, pattern)
+		if err != nil {
+			return nil, err
+		}
+		spec = append(spec, p)
+	}
+	return spec, nil
+}
+
+// Reports whether any pattern matches the path. An empty pathspec matches everything.
+func (s Pathspec) Match(name string) bool {
+	if len(s) == 0 {
+		return true
+	}
+	for _, p := range s {
+		if p.Match(name) {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns the directories that have to be searched for matching paths,
+// without duplicates or directories inside one another.
+func (s Pathspec) Roots() []string {
+	if len(s) == 0 {
+		return []string{""}
+	}
+	var roots []string
+	for _, p := range s {
+		roots = append(roots, p.Root())
+	}
+
+	var unique []string
+	for _, root := range roots {
+		covered := false
+		for _, other := range roots {
+			if other != root && (other == "" || strings.HasPrefix(root, other+"/")) {
+				covered = true
+				break
+			}
+		}
+		if !covered && !slices.Contains(unique, root) {
+			unique = append(unique, root)
+		}
+	}
+	return unique
+}
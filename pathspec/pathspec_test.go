@@ -0,0 +1,70 @@
+package pathspec_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/f1-surya/git-go/pathspec"
+)
+
+func TestMatch(t *testing.T) {
+	tests := []struct {
+		prefix  string
+		pattern string
+		matches []string
+		misses  []string
+	}{
+		{"", ".", []string{"a.txt", "src/main.go"}, nil},
+		{"", "src", []string{"src", "src/main.go", "src/deep/x.go"}, []string{"srcfile", "lib/src/a.go"}},
+		{"", "src/", []string{"src/main.go"}, []string{"src2/main.go"}},
+		{"", "*.go", []string{"main.go", "src/deep/x.go"}, []string{"main.go.txt", "README.md"}},
+		{"src", "*.go", []string{"src/main.go", "src/deep/x.go"}, []string{"main.go", "lib/x.go"}},
+		{"", "src/*.go", []string{"src/main.go"}, []string{"src/deep/x.go", "main.go"}},
+		{"", "**/testdata/*", []string{"testdata/a", "pkg/testdata/a", "a/b/testdata/c/d"}, []string{"pkg/test/a", "pkg/testdata"}},
+		{"", "src/**/*_test.go", []string{"src/a_test.go", "src/x/y/a_test.go"}, []string{"a_test.go", "src/a.go"}},
+		{"", "file?.[ch]", []string{"file1.c", "dir/fileX.h"}, []string{"file10.c", "file1.go"}},
+		{"sub", "../README.md", []string{"README.md"}, []string{"sub/README.md"}},
+	}
+	for _, test := range tests {
+		p, err := pathspec.Compile(test.prefix, test.pattern)
+		if err != nil {
+			t.Fatalf("Compile(%q, %q) errored: %v", test.prefix, test.pattern, err)
+		}
+		for _, path := range test.matches {
+			if !p.Match(path) {
+				t.Errorf("%q in %q doesn't match %s", test.pattern, test.prefix, path)
+			}
+		}
+		for _, path := range test.misses {
+			if p.Match(path) {
+				t.Errorf("%q in %q matches %s", test.pattern, test.prefix, path)
+			}
+		}
+	}
+}
+
+func TestCompileErrors(t *testing.T) {
+	for _, pattern := range []string{"../outside", "[unclosed*"} {
+		if _, err := pathspec.Compile("", pattern); err == nil {
+			t.Errorf("Compile(%q) didn't error", pattern)
+		}
+	}
+}
+
+func TestRoots(t *testing.T) {
+	spec, err := pathspec.New("", "src/a", "src", "docs/*.md", "lib/x.go")
+	if err != nil {
+		t.Fatalf("New errored: %v", err)
+	}
+	if roots := spec.Roots(); !reflect.DeepEqual(roots, []string{"src", "docs", "lib/x.go"}) {
+		t.Fatalf("Wrong roots %q", roots)
+	}
+
+	spec, _ = pathspec.New("", "src", "*.go")
+	if roots := spec.Roots(); !reflect.DeepEqual(roots, []string{""}) {
+		t.Fatalf("A glob without a slash should search everything, got %q", roots)
+	}
+	if !pathspec.Pathspec(nil).Match("anything") {
+		t.Fatalf("Empty pathspec doesn't match everything")
+	}
+}
@@ -0,0 +1,220 @@
+package refs
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/f1-surya/git-go/lockfile"
+)
+
+// Who changed a ref and why, recorded in its reflog.
+type Reason struct {
+	// The committer identity, "Name <email>".
+	Who     string
+	When    time.Time
+	Message string
+}
+
+// A line of a reflog, in git's format:
+// "<old> <new> Name <email> <unix> <tz>\t<message>". Old is ZeroHash when the
+// ref was created.
+type LogEntry struct {
+	Old string
+	New string
+	Reason
+}
+
+func (e LogEntry) String() string {
+	message := strings.Join(strings.Fields(e.Message), " ")
+	return fmt.Sprintf("%s %s %s %d %s\t%s", e.Old, e.New, e.Who, e.When.Unix(), e.When.Format("-0700"), message)
+}
+
+func parseLogEntry(line string) (LogEntry, error) {
+	var e LogEntry
+	header, message, _ := strings.Cut(line, "\t")
+	e.Message = message
+	fields := strings.Fields(header)
+	if len(fields) < 5 || !isHash(fields[0]) || !isHash(fields[1]) {
+		return e, fmt.Errorf("malformed reflog entry %q", line)
+	}
+	e.Old, e.New = fields[0], fields[1]
+	e.Who = strings.Join(fields[2:len(fields)-2], " ")
+	seconds, err := strconv.ParseInt(fields[len(fields)-2], 10, 64)
+	if err != nil {
+		return e, fmt.Errorf("malformed reflog timestamp %q", line)
+	}
+	zone, err := time.Parse("-0700", fields[len(fields)-1])
+	if err != nil {
+		return e, fmt.Errorf("malformed reflog time zone %q", line)
+	}
+	e.When = time.Unix(seconds, 0).In(zone.Location())
+	return e, nil
+}
+
+func logPath(gitDir, name string) string {
+	return filepath.Join(gitDir, "logs", filepath.FromSlash(name))
+}
+
+// Like git with core.logAllRefUpdates, HEAD and branches always get a log,
+// other refs only when their log already exists.
+func shouldLog(gitDir, name string) bool {
+	if name == Head || strings.HasPrefix(name, HeadsPrefix) {
+		return true
+	}
+	_, err := os.Stat(logPath(gitDir, name))
+	return err == nil
+}
+
+// The hash the ref resolves to, ZeroHash if it doesn't exist yet.
+func logValue(gitDir, name string) string {
+	hash, err := Resolve(gitDir, name)
+	if err != nil {
+		return ZeroHash
+	}
+	return hash
+}
+
+// Records that the ref changed from old to new. A change to the branch HEAD
+// points to is recorded in the log of HEAD as well.
+func logUpdate(gitDir, name, old, new string, reason *Reason) error {
+	// Nothing happened, like pointing HEAD at another unborn branch.
+	if reason == nil || (old == ZeroHash && new == ZeroHash) {
+		return nil
+	}
+	entry := LogEntry{Old: old, New: new, Reason: *reason}
+	if shouldLog(gitDir, name) {
+		if err := appendLog(gitDir, name, entry); err != nil {
+			return err
+		}
+	}
+	if name == Head {
+		return nil
+	}
+	if branch, err := HeadBranch(gitDir); err == nil && branch == name {
+		return appendLog(gitDir, Head, entry)
+	}
+	return nil
+}
+
+func appendLog(gitDir, name string, entry LogEntry) error {
+	path := logPath(gitDir, name)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := file.WriteString(entry.String() + "\n"); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// Returns the entries of the reflog of the ref, oldest first. A ref without
+// a log has no entries.
+func ReadLog(gitDir, name string) ([]LogEntry, error) {
+	file, err := os.Open(logPath(gitDir, name))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var entries []LogEntry
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		if scanner.Text() == "" {
+			continue
+		}
+		entry, err := parseLogEntry(scanner.Text())
+		if err != nil {
+			return nil, fmt.Errorf("reflog of %s: %w", name, err)
+		}
+		entries = append(entries, entry)
+	}
+	return entries, scanner.Err()
+}
+
+// Replaces the reflog of the ref with the entries. The ref is locked while
+// the log is written, so no update is lost.
+func WriteLog(gitDir, name string, entries []LogEntry, lockOpts lockfile.Options) error {
+	refLock, err := lockfile.Acquire(refPath(gitDir, name), lockOpts)
+	if err != nil {
+		return err
+	}
+	defer refLock.Rollback()
+
+	lock, err := lockfile.Acquire(logPath(gitDir, name), lockOpts)
+	if err != nil {
+		return err
+	}
+	defer lock.Rollback()
+	var buff bytes.Buffer
+	for _, entry := range entries {
+		buff.WriteString(entry.String() + "\n")
+	}
+	if _, err := lock.Write(buff.Bytes()); err != nil {
+		return err
+	}
+	return lock.Commit()
+}
+
+// Removes the reflog of the ref, if it has one.
+func DeleteLog(gitDir, name string) error {
+	path := logPath(gitDir, name)
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	pruneDirs(filepath.Join(gitDir, "logs"), filepath.Dir(path))
+	return nil
+}
+
+// Moves the reflog of a ref to another ref, replacing its log.
+func RenameLog(gitDir, oldName, newName string) error {
+	oldPath, newPath := logPath(gitDir, oldName), logPath(gitDir, newName)
+	if _, err := os.Stat(oldPath); os.IsNotExist(err) {
+		return DeleteLog(gitDir, newName)
+	}
+	if err := os.MkdirAll(filepath.Dir(newPath), 0755); err != nil {
+		return err
+	}
+	if err := os.Rename(oldPath, newPath); err != nil {
+		return err
+	}
+	pruneDirs(filepath.Join(gitDir, "logs"), filepath.Dir(oldPath))
+	return nil
+}
+
+// Returns the names of the refs that have a reflog, sorted.
+func ListLogs(gitDir string) ([]string, error) {
+	var names []string
+	logsDir := filepath.Join(gitDir, "logs")
+	err := filepath.WalkDir(logsDir, func(path string, d fs.DirEntry, err error) error {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		if err != nil || d.IsDir() || strings.HasSuffix(path, ".lock") || strings.HasSuffix(path, ".temp") {
+			return err
+		}
+		rel, err := filepath.Rel(logsDir, path)
+		if err != nil {
+			return err
+		}
+		names = append(names, filepath.ToSlash(rel))
+		return nil
+	})
+	sort.Strings(names)
+	return names, err
+}
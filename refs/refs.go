@@ -0,0 +1,353 @@
+package refs
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/f1-surya/git-go/lockfile"
+)
+
+const (
+	Head = "HEAD"
+	// Prefix of the refs of branches.
+	HeadsPrefix = "refs/heads/"
+	// Passed as the old hash to Update and Delete for a ref that must not exist yet.
+	ZeroHash = "0000000000000000000000000000000000000000"
+	// Symbolic refs pointing to symbolic refs are followed this many times at most.
+	maxSymrefDepth = 5
+)
+
+var (
+	ErrNotFound   = errors.New("ref not found")
+	ErrRefChanged = errors.New("ref was updated by another process")
+	ErrInvalidRef = errors.New("invalid ref name")
+)
+
+// A ref as it's stored, pointing either to an object or to another ref.
+type Ref struct {
+	// The full name, HEAD or refs/heads/main.
+	Name string
+	// The hash the ref points to, "" for a symbolic ref.
+	Hash string
+	// The ref a symbolic ref points to, like refs/heads/main for HEAD.
+	Target string
+}
+
+func (r Ref) IsSymbolic() bool {
+	return r.Target != ""
+}
+
+func refPath(gitDir, name string) string {
+	return filepath.Join(gitDir, filepath.FromSlash(name))
+}
+
+// Reads a ref without following it. A missing or empty file, which older
+// repositories used for branches without commits, returns ErrNotFound.
+// Repositories created before HEAD existed have HEAD point to refs/heads/main.
+func Read(gitDir, name string) (Ref, error) {
+	content, err := os.ReadFile(refPath(gitDir, name))
+	if os.IsNotExist(err) {
+		if name == Head {
+			return Ref{Name: Head, Target: HeadsPrefix + "main"}, nil
+		}
+		return Ref{}, fmt.Errorf("%w: %s", ErrNotFound, name)
+	}
+	if err != nil {
+		return Ref{}, err
+	}
+	value := strings.TrimSpace(string(content))
+	if value == "" {
+		return Ref{}, fmt.Errorf("%w: %s", ErrNotFound, name)
+	}
+	if target, ok := strings.CutPrefix(value, "ref: "); ok {
+		return Ref{Name: name, Target: strings.TrimSpace(target)}, nil
+	}
+	if !isHash(value) {
+		return Ref{}, fmt.Errorf("%s contains %q, which isn't a hash", name, value)
+	}
+	return Ref{Name: name, Hash: value}, nil
+}
+
+// Follows symbolic refs starting at name and returns the name of the ref
+// that holds a hash, which may not exist yet.
+func Deref(gitDir, name string) (string, error) {
+	for range maxSymrefDepth {
+		ref, err := Read(gitDir, name)
+		if errors.Is(err, ErrNotFound) {
+			return name, nil
+		}
+		if err != nil {
+			return "", err
+		}
+		if !ref.IsSymbolic() {
+			return name, nil
+		}
+		name = ref.Target
+	}
+	return "", fmt.Errorf("too many levels of symbolic refs at %s", name)
+}
+
+// Returns the hash the ref points to after following symbolic refs. Fails
+// with ErrNotFound for a branch without commits.
+func Resolve(gitDir, name string) (string, error) {
+	target, err := Deref(gitDir, name)
+	if err != nil {
+		return "", err
+	}
+	ref, err := Read(gitDir, target)
+	if err != nil {
+		return "", err
+	}
+	if ref.IsSymbolic() {
+		return "", fmt.Errorf("%w: %s", ErrNotFound, target)
+	}
+	return ref.Hash, nil
+}
+
+// Returns the branch HEAD points to, like refs/heads/main, or "" if HEAD is detached.
+func HeadBranch(gitDir string) (string, error) {
+	ref, err := Read(gitDir, Head)
+	if err != nil {
+		return "", err
+	}
+	return ref.Target, nil
+}
+
+// Points the ref, or the ref it symbolically points to, at hash. Unless
+// oldHash is "" the ref must still point at oldHash, or not exist for
+// ZeroHash, otherwise ErrRefChanged is returned. The change is recorded in the
+// reflog unless reason is nil.
+func Update(gitDir, name, hash, oldHash string, reason *Reason, lockOpts lockfile.Options) error {
+	target, err := Deref(gitDir, name)
+	if err != nil {
+		return err
+	}
+	return UpdateNoDeref(gitDir, target, hash, oldHash, reason, lockOpts)
+}
+
+// Like Update, but replaces a symbolic ref instead of the ref it points to,
+// which detaches HEAD.
+func UpdateNoDeref(gitDir, name, hash, oldHash string, reason *Reason, lockOpts lockfile.Options) error {
+	if !isHash(hash) || hash == ZeroHash {
+		return fmt.Errorf("can't point %s at %q", name, hash)
+	}
+	locked, err := Lock(gitDir, name, oldHash, lockOpts)
+	if err != nil {
+		return err
+	}
+	defer locked.Rollback()
+	return locked.Set(hash, reason)
+}
+
+// Points the ref at another ref, like HEAD at refs/heads/main. The reflog of
+// the ref records the move from the old commit to the one of target.
+func SetSymbolic(gitDir, name, target string, reason *Reason, lockOpts lockfile.Options) error {
+	locked, err := Lock(gitDir, name, "", lockOpts)
+	if err != nil {
+		return err
+	}
+	defer locked.Rollback()
+	return locked.SetSymbolic(target, reason)
+}
+
+// A ref locked for an update, so commands can hold it while they change the
+// work tree and only then move the ref.
+type Locked struct {
+	gitDir string
+	name   string
+	lock   *lockfile.Lock
+}
+
+// Locks the ref, without following symbolic refs. Unless oldHash is "" the
+// ref must point at oldHash, or not exist for ZeroHash, like for Update.
+func Lock(gitDir, name, oldHash string, lockOpts lockfile.Options) (*Locked, error) {
+	if err := CheckName(name); err != nil {
+		return nil, err
+	}
+	path := refPath(gitDir, name)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+	lock, err := lockfile.Acquire(path, lockOpts)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkOld(gitDir, name, oldHash); err != nil {
+		lock.Rollback()
+		return nil, err
+	}
+	return &Locked{gitDir: gitDir, name: name, lock: lock}, nil
+}
+
+// Points the locked ref at hash and releases it.
+func (l *Locked) Set(hash string, reason *Reason) error {
+	if !isHash(hash) || hash == ZeroHash {
+		return fmt.Errorf("can't point %s at %q", l.name, hash)
+	}
+	return l.write([]byte(hash), reason)
+}
+
+// Points the locked ref at another ref and releases it.
+func (l *Locked) SetSymbolic(target string, reason *Reason) error {
+	if err := CheckName(target); err != nil {
+		return err
+	}
+	return l.write([]byte("ref: "+target+"\n"), reason)
+}
+
+// Releases the ref without changing it. Does nothing after Set, so it can
+// always be deferred.
+func (l *Locked) Rollback() error {
+	return l.lock.Rollback()
+}
+
+func (l *Locked) write(content []byte, reason *Reason) error {
+	before := logValue(l.gitDir, l.name)
+	if _, err := l.lock.Write(content); err != nil {
+		return err
+	}
+	if err := l.lock.Commit(); err != nil {
+		return err
+	}
+	return logUpdate(l.gitDir, l.name, before, logValue(l.gitDir, l.name), reason)
+}
+
+// Must be called while the ref is locked.
+func checkOld(gitDir, name, oldHash string) error {
+	if oldHash == "" {
+		return nil
+	}
+	current := ZeroHash
+	ref, err := Read(gitDir, name)
+	if err == nil {
+		current = ref.Hash
+		if ref.IsSymbolic() {
+			current = "ref: " + ref.Target
+		}
+	} else if !errors.Is(err, ErrNotFound) {
+		return err
+	}
+	if current != oldHash {
+		if current == ZeroHash {
+			return fmt.Errorf("%w: %s doesn't exist anymore", ErrRefChanged, name)
+		}
+		return fmt.Errorf("%w: %s moved to %s", ErrRefChanged, name, current)
+	}
+	return nil
+}
+
+// Removes the ref, its reflog and the directories that become empty. Unless
+// oldHash is "" the ref must still point at oldHash.
+func Delete(gitDir, name, oldHash string, lockOpts lockfile.Options) error {
+	if err := CheckName(name); err != nil {
+		return err
+	}
+	path := refPath(gitDir, name)
+	lock, err := lockfile.Acquire(path, lockOpts)
+	if err != nil {
+		return err
+	}
+	defer lock.Rollback()
+
+	if err := checkOld(gitDir, name, oldHash); err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	// Removing the lock first lets the now empty directories go too.
+	lock.Rollback()
+	pruneDirs(filepath.Join(gitDir, "refs"), filepath.Dir(path))
+	return DeleteLog(gitDir, name)
+}
+
+// Removes dir and its parents below top while they're empty.
+func pruneDirs(top, dir string) {
+	for ; dir != top && strings.HasPrefix(dir, top); dir = filepath.Dir(dir) {
+		// Only succeeds once the directory is empty.
+		if os.Remove(dir) != nil {
+			return
+		}
+	}
+}
+
+// Returns the refs whose names start with prefix, like refs/heads/, sorted by
+// name. Branches without commits are skipped.
+func List(gitDir, prefix string) ([]Ref, error) {
+	var refs []Ref
+	refsDir := filepath.Join(gitDir, "refs")
+	err := filepath.WalkDir(refsDir, func(path string, d fs.DirEntry, err error) error {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		if err != nil || d.IsDir() || strings.HasSuffix(path, ".lock") || strings.HasSuffix(path, ".temp") {
+			return err
+		}
+		rel, err := filepath.Rel(gitDir, path)
+		if err != nil {
+			return err
+		}
+		name := filepath.ToSlash(rel)
+		if !strings.HasPrefix(name, prefix) {
+			return nil
+		}
+		ref, err := Read(gitDir, name)
+		if errors.Is(err, ErrNotFound) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		refs = append(refs, ref)
+		return nil
+	})
+	sort.Slice(refs, func(i, j int) bool { return refs[i].Name < refs[j].Name })
+	return refs, err
+}
+
+// Reports whether name is a valid ref name, following git check-ref-format.
+func ValidName(name string) bool {
+	if name == "" || name == "@" || strings.HasSuffix(name, "/") || strings.HasSuffix(name, ".") || strings.HasPrefix(name, "/") {
+		return false
+	}
+	if strings.Contains(name, "..") || strings.Contains(name, "@{") || strings.Contains(name, "//") {
+		return false
+	}
+	for _, r := range name {
+		if r < 0x20 || r == 0x7f || strings.ContainsRune(" ~^:?*[\\", r) {
+			return false
+		}
+	}
+	for _, component := range strings.Split(name, "/") {
+		if strings.HasPrefix(component, ".") || strings.HasSuffix(component, ".lock") {
+			return false
+		}
+	}
+	return true
+}
+
+// Fails with ErrInvalidRef unless name is HEAD or a valid name under refs/,
+// which also keeps it inside the git directory.
+func CheckName(name string) error {
+	if name != Head && (!strings.HasPrefix(name, "refs/") || !ValidName(name)) {
+		return fmt.Errorf("%w: %q", ErrInvalidRef, name)
+	}
+	return nil
+}
+
+func isHash(s string) bool {
+	if len(s) != 40 {
+		return false
+	}
+	for _, c := range s {
+		if (c < '0' || c > '9') && (c < 'a' || c > 'f') {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,201 @@
+package refs_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/f1-surya/git-go/lockfile"
+	"github.com/f1-surya/git-go/refs"
+)
+
+var (
+	hashA = strings.Repeat("a", 40)
+	hashB = strings.Repeat("b", 40)
+)
+
+func TestUpdateAndResolve(t *testing.T) {
+	gitDir := t.TempDir()
+	opts := lockfile.DefaultOptions
+
+	// Without a HEAD file, HEAD points to main like in older repositories.
+	if branch, err := refs.HeadBranch(gitDir); err != nil || branch != "refs/heads/main" {
+		t.Fatalf("HeadBranch = %q, %v", branch, err)
+	}
+	if err := refs.SetSymbolic(gitDir, refs.Head, "refs/heads/dev", nil, opts); err != nil {
+		t.Fatalf("SetSymbolic errored: %v", err)
+	}
+	if _, err := refs.Resolve(gitDir, refs.Head); !errors.Is(err, refs.ErrNotFound) {
+		t.Fatalf("Resolve of an unborn branch = %v", err)
+	}
+
+	if err := refs.Update(gitDir, refs.Head, hashA, refs.ZeroHash, nil, opts); err != nil {
+		t.Fatalf("Update errored: %v", err)
+	}
+	if hash, err := refs.Resolve(gitDir, refs.Head); err != nil || hash != hashA {
+		t.Fatalf("Resolve(HEAD) = %q, %v", hash, err)
+	}
+	if ref, err := refs.Read(gitDir, "refs/heads/dev"); err != nil || ref.Hash != hashA {
+		t.Fatalf("Update didn't follow HEAD: %+v, %v", ref, err)
+	}
+
+	if err := refs.Update(gitDir, refs.Head, hashB, refs.ZeroHash, nil, opts); !errors.Is(err, refs.ErrRefChanged) {
+		t.Fatalf("Update of an existing ref with ZeroHash = %v", err)
+	}
+	if err := refs.Update(gitDir, refs.Head, hashB, hashB, nil, opts); !errors.Is(err, refs.ErrRefChanged) {
+		t.Fatalf("Update with the wrong old hash = %v", err)
+	}
+	if err := refs.Update(gitDir, refs.Head, hashB, hashA, nil, opts); err != nil {
+		t.Fatalf("Update errored: %v", err)
+	}
+	if err := refs.Update(gitDir, "refs/heads/bad..name", hashA, "", nil, opts); !errors.Is(err, refs.ErrInvalidRef) {
+		t.Fatalf("Update of an invalid name = %v", err)
+	}
+
+	// A detached HEAD holds the hash itself.
+	if err := os.WriteFile(filepath.Join(gitDir, "HEAD"), []byte(hashA+"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if branch, err := refs.HeadBranch(gitDir); err != nil || branch != "" {
+		t.Fatalf("HeadBranch of a detached HEAD = %q, %v", branch, err)
+	}
+	if err := refs.Update(gitDir, refs.Head, hashB, hashA, nil, opts); err != nil {
+		t.Fatalf("Update of a detached HEAD errored: %v", err)
+	}
+	if ref, _ := refs.Read(gitDir, "refs/heads/dev"); ref.Hash != hashB {
+		t.Fatalf("Detached HEAD moved the branch")
+	}
+}
+
+func TestListAndDelete(t *testing.T) {
+	gitDir := t.TempDir()
+	opts := lockfile.DefaultOptions
+	for _, name := range []string{"refs/heads/main", "refs/heads/feature/x", "refs/tags/v1"} {
+		if err := refs.Update(gitDir, name, hashA, "", nil, opts); err != nil {
+			t.Fatalf("Update(%s) errored: %v", name, err)
+		}
+	}
+	// Older repositories created empty files for branches without commits.
+	os.WriteFile(filepath.Join(gitDir, "refs", "heads", "empty"), nil, 0644)
+
+	heads, err := refs.List(gitDir, refs.HeadsPrefix)
+	if err != nil {
+		t.Fatalf("List errored: %v", err)
+	}
+	var names []string
+	for _, ref := range heads {
+		names = append(names, ref.Name)
+	}
+	if strings.Join(names, " ") != "refs/heads/feature/x refs/heads/main" {
+		t.Fatalf("List = %q", names)
+	}
+
+	if err := refs.Delete(gitDir, "refs/heads/feature/x", hashB, opts); !errors.Is(err, refs.ErrRefChanged) {
+		t.Fatalf("Delete with the wrong old hash = %v", err)
+	}
+	if err := refs.Delete(gitDir, "refs/heads/feature/x", hashA, opts); err != nil {
+		t.Fatalf("Delete errored: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(gitDir, "refs", "heads", "feature")); !os.IsNotExist(err) {
+		t.Fatalf("Empty directory wasn't removed: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(gitDir, "refs", "heads")); err != nil {
+		t.Fatalf("refs/heads was removed: %v", err)
+	}
+
+	// Names leaving the git directory are refused before anything is touched.
+	victim := filepath.Join(filepath.Dir(gitDir), "x")
+	os.WriteFile(victim, []byte(hashA+"\n"), 0644)
+	for _, name := range []string{"../x", "refs/../../x"} {
+		if err := refs.Delete(gitDir, name, "", opts); !errors.Is(err, refs.ErrInvalidRef) {
+			t.Errorf("Delete(%q) = %v, want ErrInvalidRef", name, err)
+		}
+	}
+	if _, err := os.Stat(victim); err != nil {
+		t.Fatalf("File outside the git directory was deleted: %v", err)
+	}
+	if _, err := os.Stat(victim + ".lock"); !os.IsNotExist(err) {
+		t.Fatalf("Lock created outside the git directory: %v", err)
+	}
+}
+
+func TestReflog(t *testing.T) {
+	gitDir := t.TempDir()
+	opts := lockfile.DefaultOptions
+	reason := func(message string) *refs.Reason {
+		return &refs.Reason{Who: "Jane Doe <jane@example.com>", When: time.Unix(1700000000, 0).In(time.FixedZone("", -5*3600)), Message: message}
+	}
+
+	if err := refs.Update(gitDir, refs.Head, hashA, refs.ZeroHash, reason("commit (initial): first\nline"), opts); err != nil {
+		t.Fatalf("Update errored: %v", err)
+	}
+	if err := refs.Update(gitDir, "refs/heads/main", hashB, hashA, reason("commit: second"), opts); err != nil {
+		t.Fatalf("Update errored: %v", err)
+	}
+	// Tags only get a log when it already exists, and nil reasons aren't logged.
+	if err := refs.Update(gitDir, "refs/tags/v1", hashA, "", reason("tag"), opts); err != nil {
+		t.Fatalf("Update errored: %v", err)
+	}
+	if err := refs.Update(gitDir, "refs/heads/quiet", hashA, "", nil, opts); err != nil {
+		t.Fatalf("Update errored: %v", err)
+	}
+
+	content, err := os.ReadFile(filepath.Join(gitDir, "logs", "refs", "heads", "main"))
+	want := refs.ZeroHash + " " + hashA + " Jane Doe <jane@example.com> 1700000000 -0500\tcommit (initial): first line\n" +
+		hashA + " " + hashB + " Jane Doe <jane@example.com> 1700000000 -0500\tcommit: second\n"
+	if err != nil || string(content) != want {
+		t.Fatalf("Branch log = %q, %v", content, err)
+	}
+	// Updating the branch HEAD points to is logged for HEAD too.
+	head, err := refs.ReadLog(gitDir, refs.Head)
+	if err != nil || len(head) != 2 || head[1].Old != hashA || head[1].New != hashB || head[1].Message != "commit: second" {
+		t.Fatalf("HEAD log = %+v, %v", head, err)
+	}
+	if !head[0].When.Equal(time.Unix(1700000000, 0)) || head[0].Who != "Jane Doe <jane@example.com>" {
+		t.Fatalf("Entry = %+v", head[0])
+	}
+	if names, err := refs.ListLogs(gitDir); err != nil || strings.Join(names, " ") != "HEAD refs/heads/main" {
+		t.Fatalf("ListLogs = %v, %v", names, err)
+	}
+
+	if err := refs.WriteLog(gitDir, refs.Head, head[1:], opts); err != nil {
+		t.Fatalf("WriteLog errored: %v", err)
+	}
+	if head, err := refs.ReadLog(gitDir, refs.Head); err != nil || len(head) != 1 {
+		t.Fatalf("HEAD log after WriteLog = %+v, %v", head, err)
+	}
+	if err := refs.SetSymbolic(gitDir, refs.Head, "refs/heads/quiet", reason("checkout: moving from main to quiet"), opts); err != nil {
+		t.Fatalf("SetSymbolic errored: %v", err)
+	}
+	if err := refs.Delete(gitDir, "refs/heads/main", "", opts); err != nil {
+		t.Fatalf("Delete errored: %v", err)
+	}
+	if entries, err := refs.ReadLog(gitDir, "refs/heads/main"); err != nil || entries != nil {
+		t.Fatalf("Log of a deleted branch = %+v, %v", entries, err)
+	}
+	if head, err := refs.ReadLog(gitDir, refs.Head); err != nil || len(head) != 2 || head[1].Old != hashB || head[1].New != hashA {
+		t.Fatalf("HEAD log after checkout = %+v, %v", head, err)
+	}
+}
+
+func TestValidName(t *testing.T) {
+	for name, want := range map[string]bool{
+		"refs/heads/main":        true,
+		"refs/heads/feature/x-1": true,
+		"refs/heads/a..b":        false,
+		"refs/heads/.hidden":     false,
+		"refs/heads/x.lock":      false,
+		"refs/heads/with space":  false,
+		"refs/heads/a~1":         false,
+		"refs/heads/end/":        false,
+		"refs/heads/a@{1}":       false,
+		"refs/heads/dot.":        false,
+	} {
+		if got := refs.ValidName(name); got != want {
+			t.Errorf("ValidName(%q) = %v, want %v", name, got, want)
+		}
+	}
+}
@@ -0,0 +1,74 @@
+package revparse
+
+import (
+	"strings"
+
+	"github.com/f1-surya/git-go/commit"
+	"github.com/f1-surya/git-go/refs"
+)
+
+// The commits reachable from any of Include but none of Exclude, like the
+// arguments of git log.
+type Range struct {
+	Include []string
+	Exclude []string
+}
+
+// Parses revision arguments: A, ^A, A..B (B but not A) and A...B (either but
+// not both). An empty side of .. or ... is HEAD.
+func (r *Resolver) ParseRange(args []string) (Range, error) {
+	var result Range
+	for _, arg := range args {
+		if left, right, ok := strings.Cut(arg, "..."); ok {
+			a, b, err := r.rangeEnds(left, right)
+			if err != nil {
+				return result, err
+			}
+			bases, err := commit.MergeBases(r.Store, a, b)
+			if err != nil {
+				return result, err
+			}
+			result.Include = append(result.Include, a, b)
+			result.Exclude = append(result.Exclude, bases...)
+			continue
+		}
+		if left, right, ok := strings.Cut(arg, ".."); ok {
+			a, b, err := r.rangeEnds(left, right)
+			if err != nil {
+				return result, err
+			}
+			result.Include = append(result.Include, b)
+			result.Exclude = append(result.Exclude, a)
+			continue
+		}
+		if rev, ok := strings.CutPrefix(arg, "^"); ok {
+			hash, err := r.ResolveCommit(rev)
+			if err != nil {
+				return result, err
+			}
+			result.Exclude = append(result.Exclude, hash)
+			continue
+		}
+		hash, err := r.ResolveCommit(arg)
+		if err != nil {
+			return result, err
+		}
+		result.Include = append(result.Include, hash)
+	}
+	return result, nil
+}
+
+func (r *Resolver) rangeEnds(left, right string) (string, string, error) {
+	if left == "" {
+		left = refs.Head
+	}
+	if right == "" {
+		right = refs.Head
+	}
+	a, err := r.ResolveCommit(left)
+	if err != nil {
+		return "", "", err
+	}
+	b, err := r.ResolveCommit(right)
+	return a, b, err
+}
@@ -0,0 +1,359 @@
+package revparse
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/f1-surya/git-go/commit"
+	"github.com/f1-surya/git-go/index"
+	"github.com/f1-surya/git-go/object"
+	"github.com/f1-surya/git-go/refs"
+	"github.com/f1-surya/git-go/tag"
+	"github.com/f1-surya/git-go/tree"
+)
+
+// Abbreviated hashes must have at least this many digits.
+const MinAbbrev = 4
+
+var (
+	ErrUnknown   = errors.New("unknown revision")
+	ErrAmbiguous = errors.New("ambiguous revision")
+)
+
+// Resolves revisions in Git's syntax to object hashes.
+type Resolver struct {
+	GitDir string
+	Store  object.ObjectStore
+}
+
+func New(gitDir string, store object.ObjectStore) *Resolver {
+	return &Resolver{GitDir: gitDir, Store: store}
+}
+
+// Returns the object the revision names. A revision is a name followed by
+// any number of suffixes, or a path in a tree:
+//
+//	HEAD, @, main, v1.0, refs/heads/main  refs, shortest form first
+//	3b18e51                               a hash of at least 4 digits
+//	main@{2}                              the 2nd previous value of a ref
+//	HEAD~3, HEAD^2, HEAD^                 ancestors, parents of merges
+//	v1.0^{commit}, v1.0^{}, v1.0^0        tags peeled to a type
+//	HEAD:path/to/file, :path              a path in a tree or the index
+func (r *Resolver) Resolve(rev string) (string, error) {
+	if name, path, ok := strings.Cut(rev, ":"); ok {
+		if name == "" {
+			return r.indexPath(path)
+		}
+		treeHash, err := r.ResolveType(name, object.TypeTree)
+		if err != nil {
+			return "", err
+		}
+		return r.treePath(treeHash, path, rev)
+	}
+
+	end := len(rev)
+	if i := strings.IndexAny(rev, "~^"); i != -1 {
+		end = i
+	}
+	base, suffixes := rev[:end], rev[end:]
+
+	hash, err := r.resolveBase(base)
+	if err != nil {
+		return "", err
+	}
+	for suffixes != "" {
+		if hash, suffixes, err = r.applySuffix(hash, suffixes, rev); err != nil {
+			return "", err
+		}
+	}
+	return hash, nil
+}
+
+// Returns the commit the revision names, following tags.
+func (r *Resolver) ResolveCommit(rev string) (string, error) {
+	return r.ResolveType(rev, object.TypeCommit)
+}
+
+// Returns the object of the given type the revision names, following tags,
+// and commits to their tree for trees.
+func (r *Resolver) ResolveType(rev, objType string) (string, error) {
+	hash, err := r.Resolve(rev)
+	if err != nil {
+		return "", err
+	}
+	return r.peel(hash, objType, rev)
+}
+
+// Follows tags, and commits to their tree for objType tree, until the object
+// has the given type. "" follows tags to whatever they point to.
+func (r *Resolver) peel(hash, objType, rev string) (string, error) {
+	hash, actual, err := tag.Peel(r.Store, hash)
+	if err != nil {
+		return "", missing(err, rev)
+	}
+	if objType == "" || actual == objType {
+		return hash, nil
+	}
+	if actual == object.TypeCommit && objType == object.TypeTree {
+		c, err := r.commit(hash, rev)
+		if err != nil {
+			return "", err
+		}
+		return c.Tree, nil
+	}
+	return "", fmt.Errorf("%s is a %s, not a %s", rev, actual, objType)
+}
+
+// Reads the commit rev leads to.
+func (r *Resolver) commit(hash, rev string) (*commit.Commit, error) {
+	c, err := commit.ParseCommit(r.Store, hash)
+	return c, missing(err, rev)
+}
+
+// Turns a missing object, like a parent that was never fetched, into an
+// unknown revision.
+func missing(err error, rev string) error {
+	if errors.Is(err, object.ErrNotFound) {
+		return fmt.Errorf("%w: %s, %v", ErrUnknown, rev, err)
+	}
+	return err
+}
+
+// Resolves a name with an optional @{n}, without ~ and ^ suffixes.
+func (r *Resolver) resolveBase(base string) (string, error) {
+	if name, rest, ok := strings.Cut(base, "@{"); ok {
+		if !strings.HasSuffix(rest, "}") {
+			return "", fmt.Errorf("%w: %s", ErrUnknown, base)
+		}
+		n, err := strconv.Atoi(strings.TrimSuffix(rest, "}"))
+		if err != nil || n < 0 {
+			return "", fmt.Errorf("only @{<n>} is supported for reflog entries: %s", base)
+		}
+		ref := refs.Head
+		if name == "" {
+			// @{n} alone is the reflog of the current branch.
+			if ref, err = refs.Deref(r.GitDir, refs.Head); err != nil {
+				return "", err
+			}
+		} else if name != refs.Head && name != "@" {
+			if ref, err = r.RefName(name); err != nil {
+				return "", err
+			}
+		}
+		return r.reflogEntry(ref, n)
+	}
+
+	if base == "@" {
+		base = refs.Head
+	}
+	if base == "" {
+		return "", fmt.Errorf("%w: empty revision", ErrUnknown)
+	}
+	if ref, err := r.RefName(base); err == nil {
+		return refs.Resolve(r.GitDir, ref)
+	}
+	return r.expandHash(base)
+}
+
+// Returns the full name of the ref a name refers to, checking the same places
+// in the same order as git: HEAD, refs/<name>, refs/tags/<name>, refs/heads/<name>.
+func (r *Resolver) RefName(name string) (string, error) {
+	candidates := []string{name}
+	if name != refs.Head {
+		candidates = []string{"refs/" + name, "refs/tags/" + name, refs.HeadsPrefix + name}
+		if strings.HasPrefix(name, "refs/") {
+			candidates = []string{name}
+		}
+	}
+	for _, candidate := range candidates {
+		if !refs.ValidName(candidate) {
+			continue
+		}
+		if _, err := refs.Resolve(r.GitDir, candidate); err == nil {
+			return candidate, nil
+		} else if !errors.Is(err, refs.ErrNotFound) {
+			return "", err
+		}
+	}
+	return "", fmt.Errorf("%w: %s", ErrUnknown, name)
+}
+
+// Returns the full hash of an object given by a full or abbreviated hash.
+func (r *Resolver) expandHash(prefix string) (string, error) {
+	if len(prefix) < MinAbbrev || len(prefix) > 40 || !isHex(prefix) {
+		return "", fmt.Errorf("%w: %s", ErrUnknown, prefix)
+	}
+	prefix = strings.ToLower(prefix)
+	matches, err := object.FindPrefix(r.Store, prefix)
+	if err != nil {
+		return "", err
+	}
+	switch len(matches) {
+	case 0:
+		return "", fmt.Errorf("%w: %s", ErrUnknown, prefix)
+	case 1:
+		return matches[0], nil
+	}
+	var candidates []string
+	for _, hash := range matches {
+		objType, _, _ := r.Store.Stat(hash)
+		candidates = append(candidates, hash+" "+objType)
+	}
+	return "", fmt.Errorf("%w: short hash %s matches\n\t%s", ErrAmbiguous, prefix, strings.Join(candidates, "\n\t"))
+}
+
+// Applies the first suffix of suffixes to hash and returns the result and the
+// suffixes left.
+func (r *Resolver) applySuffix(hash, suffixes, rev string) (string, string, error) {
+	op := suffixes[0]
+	rest := suffixes[1:]
+
+	if op == '^' && strings.HasPrefix(rest, "{") {
+		end := strings.IndexByte(rest, '}')
+		if end == -1 {
+			return "", "", fmt.Errorf("%w: unterminated ^{ in %s", ErrUnknown, rev)
+		}
+		objType := rest[1:end]
+		switch objType {
+		case "", object.TypeCommit, object.TypeTree, object.TypeBlob:
+		case object.TypeTag:
+			if t, _, err := r.Store.Stat(hash); err != nil || t != object.TypeTag {
+				return "", "", fmt.Errorf("%s is not a tag", rev)
+			}
+			return hash, rest[end+1:], nil
+		case "object":
+			return hash, rest[end+1:], nil
+		default:
+			return "", "", fmt.Errorf("%w: unknown type %q in %s", ErrUnknown, objType, rev)
+		}
+		peeled, err := r.peel(hash, objType, rev)
+		return peeled, rest[end+1:], err
+	}
+
+	digits := 0
+	for digits < len(rest) && rest[digits] >= '0' && rest[digits] <= '9' {
+		digits++
+	}
+	n := 1
+	if digits > 0 {
+		var err error
+		if n, err = strconv.Atoi(rest[:digits]); err != nil {
+			return "", "", fmt.Errorf("%w: %s", ErrUnknown, rev)
+		}
+	}
+	rest = rest[digits:]
+
+	hash, err := r.peel(hash, object.TypeCommit, rev)
+	if err != nil {
+		return "", "", err
+	}
+	if op == '^' {
+		if n == 0 {
+			return hash, rest, nil
+		}
+		c, err := r.commit(hash, rev)
+		if err != nil {
+			return "", "", err
+		}
+		if n > len(c.Parents) {
+			return "", "", fmt.Errorf("%w: %s, %s has %d parents", ErrUnknown, rev, hash[:7], len(c.Parents))
+		}
+		return c.Parents[n-1], rest, nil
+	}
+	for range n {
+		c, err := r.commit(hash, rev)
+		if err != nil {
+			return "", "", err
+		}
+		if len(c.Parents) == 0 {
+			return "", "", fmt.Errorf("%w: %s goes past the root commit %s", ErrUnknown, rev, hash[:7])
+		}
+		hash = c.Parents[0]
+	}
+	return hash, rest, nil
+}
+
+// Returns the object at path in the tree.
+func (r *Resolver) treePath(treeHash, path, rev string) (string, error) {
+	path = strings.Trim(filepath.ToSlash(filepath.Clean(path)), "/")
+	if path == "." || path == "" {
+		return treeHash, nil
+	}
+	hash := treeHash
+	for _, name := range strings.Split(path, "/") {
+		t, err := tree.ParseTreeObject(r.Store, hash)
+		if err != nil {
+			return "", fmt.Errorf("%w: %s", ErrUnknown, rev)
+		}
+		found := false
+		for _, child := range t.Children {
+			if child.Name == name {
+				hash, found = hex.EncodeToString(child.Hash), true
+				break
+			}
+		}
+		if !found {
+			return "", fmt.Errorf("%w: path '%s' does not exist in '%s'", ErrUnknown, path, strings.SplitN(rev, ":", 2)[0])
+		}
+	}
+	return hash, nil
+}
+
+// Returns the blob staged for path.
+func (r *Resolver) indexPath(path string) (string, error) {
+	entries, err := index.ReadIndex(filepath.Join(r.GitDir, "index"))
+	if err != nil {
+		return "", err
+	}
+	path = filepath.Clean(filepath.FromSlash(path))
+	for _, entry := range entries {
+		if entry.Path == path {
+			return hex.EncodeToString(entry.Hash[:]), nil
+		}
+	}
+	return "", fmt.Errorf("%w: path '%s' is not in the index", ErrUnknown, filepath.ToSlash(path))
+}
+
+// Returns the value the ref had n updates ago, from its reflog.
+func (r *Resolver) reflogEntry(ref string, n int) (string, error) {
+	entries, err := refs.ReadLog(r.GitDir, ref)
+	if err != nil {
+		return "", err
+	}
+	if len(entries) == 0 {
+		return "", fmt.Errorf("%w: log for '%s' is empty", ErrUnknown, ref)
+	}
+	if n >= len(entries) {
+		return "", fmt.Errorf("%w: log for '%s' only has %d entries", ErrUnknown, ref, len(entries))
+	}
+	return entries[len(entries)-1-n].New, nil
+}
+
+// Returns the shortest prefix of hash, at least min digits long, that no
+// other object starts with.
+func (r *Resolver) Abbrev(hash string, min int) (string, error) {
+	min = max(min, MinAbbrev)
+	for length := min; length < len(hash); length++ {
+		matches, err := object.FindPrefix(r.Store, hash[:length])
+		if err != nil {
+			return "", err
+		}
+		if len(matches) <= 1 {
+			return hash[:length], nil
+		}
+	}
+	return hash, nil
+}
+
+func isHex(s string) bool {
+	for _, c := range s {
+		if (c < '0' || c > '9') && (c < 'a' || c > 'f') && (c < 'A' || c > 'F') {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,230 @@
+package revparse_test
+
+import (
+	"encoding/hex"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/f1-surya/git-go/commit"
+	"github.com/f1-surya/git-go/index"
+	"github.com/f1-surya/git-go/lockfile"
+	"github.com/f1-surya/git-go/object"
+	"github.com/f1-surya/git-go/refs"
+	"github.com/f1-surya/git-go/revparse"
+	"github.com/f1-surya/git-go/tag"
+	"github.com/f1-surya/git-go/tree"
+)
+
+// Builds R <- A <- M <- C, with B branching off R and merged in M, on the
+// branch main, plus a side branch at B and an annotated tag v1 at A.
+func setup(t *testing.T) (*revparse.Resolver, map[string]string) {
+	t.Helper()
+	gitDir := t.TempDir()
+	store := object.NewLooseStore(filepath.Join(gitDir, "objects"))
+
+	blob, err := store.Put(object.TypeBlob, []byte("hello\n"))
+	if err != nil {
+		t.Fatalf("Put errored: %v", err)
+	}
+	entry := index.IndexEntry{Mode: object.ModeRegular, Path: filepath.Join("dir", "file.txt")}
+	hashBytes, _ := hex.DecodeString(blob)
+	copy(entry.Hash[:], hashBytes)
+	if err := index.WriteIndex(filepath.Join(gitDir, "index"), []index.IndexEntry{entry}); err != nil {
+		t.Fatalf("WriteIndex errored: %v", err)
+	}
+	treeHash, err := tree.WriteTrees(store, []index.IndexEntry{entry})
+	if err != nil {
+		t.Fatalf("WriteTrees errored: %v", err)
+	}
+
+	hashes := map[string]string{"blob": blob, "tree": treeHash}
+	for i, c := range []struct{ name, parents string }{
+		{"R", ""}, {"A", "R"}, {"B", "R"}, {"M", "A B"}, {"C", "M"},
+	} {
+		sig := commit.Signature{Name: "Someone", Email: "someone@example.com", When: time.Unix(int64(1700000000+i), 0).UTC()}
+		newCommit := commit.Commit{Tree: treeHash, Author: sig, Committer: sig, Message: c.name + "\n"}
+		for _, parent := range strings.Fields(c.parents) {
+			newCommit.Parents = append(newCommit.Parents, hashes[parent])
+		}
+		if hashes[c.name], err = store.Put(object.TypeCommit, newCommit.ToBytes()); err != nil {
+			t.Fatalf("Put errored: %v", err)
+		}
+	}
+	annotated := tag.Tag{Object: hashes["A"], Type: object.TypeCommit, Name: "v1", Message: "v1\n"}
+	if hashes["v1"], err = store.Put(object.TypeTag, annotated.ToBytes()); err != nil {
+		t.Fatalf("Put errored: %v", err)
+	}
+
+	for name, hash := range map[string]string{
+		"refs/heads/main": hashes["C"],
+		"refs/heads/side": hashes["B"],
+		"refs/tags/v1":    hashes["v1"],
+	} {
+		if err := refs.Update(gitDir, name, hash, "", nil, lockfile.Options{}); err != nil {
+			t.Fatalf("Update errored: %v", err)
+		}
+	}
+	if err := refs.SetSymbolic(gitDir, refs.Head, "refs/heads/main", nil, lockfile.Options{}); err != nil {
+		t.Fatalf("SetSymbolic errored: %v", err)
+	}
+	return revparse.New(gitDir, store), hashes
+}
+
+func TestResolve(t *testing.T) {
+	r, hashes := setup(t)
+	for rev, want := range map[string]string{
+		"HEAD":                           hashes["C"],
+		"@":                              hashes["C"],
+		"main":                           hashes["C"],
+		"refs/heads/side":                hashes["B"],
+		"HEAD^":                          hashes["M"],
+		"HEAD~1":                         hashes["M"],
+		"HEAD~2":                         hashes["A"],
+		"main^^2":                        hashes["B"],
+		"HEAD~1^2~1":                     hashes["R"],
+		"HEAD^0":                         hashes["C"],
+		"v1":                             hashes["v1"],
+		"v1^{}":                          hashes["A"],
+		"v1^{commit}":                    hashes["A"],
+		"v1^{tag}":                       hashes["v1"],
+		"v1~1":                           hashes["R"],
+		"side^{tree}":                    hashes["tree"],
+		"HEAD:dir/file.txt":              hashes["blob"],
+		"HEAD:dir":                       "",
+		"HEAD:":                          hashes["tree"],
+		":dir/file.txt":                  hashes["blob"],
+		hashes["A"][:10]:                 hashes["A"],
+		hashes["R"]:                      hashes["R"],
+		"side~1^{commit}~0":              hashes["R"],
+		"HEAD^{object}":                  hashes["C"],
+		"main~2^{tree}":                  hashes["tree"],
+		strings.ToUpper(hashes["B"][:8]): hashes["B"],
+	} {
+		got, err := r.Resolve(rev)
+		if err != nil {
+			t.Errorf("Resolve(%q) errored: %v", rev, err)
+			continue
+		}
+		if want != "" && got != want {
+			t.Errorf("Resolve(%q) = %s, want %s", rev, got, want)
+		}
+	}
+
+	for _, rev := range []string{
+		"nope", "HEAD~5", "HEAD^3", "side^{tag}", "HEAD:missing", ":missing",
+		"HEAD^{thing}", "abc", "v1^{blob}", "",
+	} {
+		if got, err := r.Resolve(rev); err == nil {
+			t.Errorf("Resolve(%q) = %s, want an error", rev, got)
+		}
+	}
+	if _, err := r.Resolve("nope"); !errors.Is(err, revparse.ErrUnknown) {
+		t.Errorf("Resolve of a missing name = %v, want ErrUnknown", err)
+	}
+}
+
+func TestResolveMissingParent(t *testing.T) {
+	r, hashes := setup(t)
+	os.Remove(filepath.Join(r.GitDir, "objects", hashes["A"][:2], hashes["A"][2:]))
+	for _, rev := range []string{"HEAD~3", "HEAD~1^^", "HEAD~2^2", "v1~1", "HEAD~2^{tree}"} {
+		if _, err := r.Resolve(rev); !errors.Is(err, revparse.ErrUnknown) {
+			t.Errorf("Resolve(%q) with a missing commit = %v, want ErrUnknown", rev, err)
+		}
+	}
+	if got, err := r.Resolve("HEAD~2"); err != nil || got != hashes["A"] {
+		t.Errorf("Resolve(\"HEAD~2\") = %s, %v, want %s", got, err, hashes["A"])
+	}
+}
+
+func TestAbbreviations(t *testing.T) {
+	r, hashes := setup(t)
+	// Enough blobs that two of them share their first 4 digits.
+	store := object.NewMemoryStore()
+	seen := make(map[string]string)
+	shared := ""
+	for i := 0; shared == ""; i++ {
+		hash, err := store.Put(object.TypeBlob, []byte(strconv.Itoa(i)))
+		if err != nil {
+			t.Fatalf("Put errored: %v", err)
+		}
+		if _, ok := seen[hash[:4]]; ok {
+			shared = hash[:4]
+		}
+		seen[hash[:4]] = hash
+	}
+	_, err := revparse.New(r.GitDir, store).Resolve(shared)
+	if !errors.Is(err, revparse.ErrAmbiguous) {
+		t.Errorf("Resolve(%s) = %v, want ErrAmbiguous", shared, err)
+	}
+
+	for _, hash := range hashes {
+		short, err := r.Abbrev(hash, 7)
+		if err != nil || len(short) < 7 || !strings.HasPrefix(hash, short) {
+			t.Fatalf("Abbrev(%s) = %s, %v", hash, short, err)
+		}
+		if got, err := r.Resolve(short); err != nil || got != hash {
+			t.Fatalf("Resolve(%s) = %s, %v", short, got, err)
+		}
+	}
+}
+
+func TestReflogEntries(t *testing.T) {
+	r, hashes := setup(t)
+	logDir := filepath.Join(r.GitDir, "logs", "refs", "heads")
+	if err := os.MkdirAll(logDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	log := refs.ZeroHash + " " + hashes["R"] + " Someone <someone@example.com> 1700000000 +0000\tcommit (initial): R\n" +
+		hashes["R"] + " " + hashes["A"] + " Someone <someone@example.com> 1700000001 +0000\tcommit: A\n" +
+		hashes["A"] + " " + hashes["C"] + " Someone <someone@example.com> 1700000002 +0000\tmerge\n"
+	if err := os.WriteFile(filepath.Join(logDir, "main"), []byte(log), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	for rev, want := range map[string]string{
+		"main@{0}":   hashes["C"],
+		"main@{1}":   hashes["A"],
+		"@{2}":       hashes["R"],
+		"main@{1}~1": hashes["R"],
+	} {
+		if got, err := r.Resolve(rev); err != nil || got != want {
+			t.Errorf("Resolve(%q) = %s, %v, want %s", rev, got, err, want)
+		}
+	}
+	for _, rev := range []string{"main@{3}", "side@{0}", "main@{yesterday}"} {
+		if _, err := r.Resolve(rev); err == nil {
+			t.Errorf("Resolve(%q) should fail", rev)
+		}
+	}
+}
+
+func TestParseRange(t *testing.T) {
+	r, hashes := setup(t)
+	for _, c := range []struct {
+		args             []string
+		include, exclude []string
+	}{
+		{[]string{"side..main"}, []string{hashes["C"]}, []string{hashes["B"]}},
+		{[]string{"side.."}, []string{hashes["C"]}, []string{hashes["B"]}},
+		{[]string{"v1...side"}, []string{hashes["A"], hashes["B"]}, []string{hashes["R"]}},
+		{[]string{"main", "^side"}, []string{hashes["C"]}, []string{hashes["B"]}},
+	} {
+		got, err := r.ParseRange(c.args)
+		if err != nil {
+			t.Errorf("ParseRange(%q) errored: %v", c.args, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, revparse.Range{Include: c.include, Exclude: c.exclude}) {
+			t.Errorf("ParseRange(%q) = %+v", c.args, got)
+		}
+	}
+	if _, err := r.ParseRange([]string{"side..nope"}); err == nil {
+		t.Errorf("ParseRange of a missing end should fail")
+	}
+}
@@ -0,0 +1,119 @@
+package tag
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	"github.com/f1-surya/git-go/commit"
+	"github.com/f1-surya/git-go/object"
+)
+
+// Tags pointing to tags are followed this many times at most.
+const maxPeelDepth = 10
+
+// An annotated tag object.
+type Tag struct {
+	// The object the tag points to and its type.
+	Object string
+	Type   string
+	// The name of the tag, without refs/tags/.
+	Name string
+	// Missing in some old tags, in which case it's the zero Signature.
+	Tagger  commit.Signature
+	Message string
+	Hash    string
+}
+
+// Returns the content of the tag object, without the header.
+func (t *Tag) ToBytes() []byte {
+	var buff bytes.Buffer
+	fmt.Fprintf(&buff, "object %s\n", t.Object)
+	fmt.Fprintf(&buff, "type %s\n", t.Type)
+	fmt.Fprintf(&buff, "tag %s\n", t.Name)
+	if t.Tagger.Name != "" || t.Tagger.Email != "" {
+		fmt.Fprintf(&buff, "tagger %s\n", t.Tagger)
+	}
+	buff.WriteString("\n")
+	buff.WriteString(t.Message)
+	return buff.Bytes()
+}
+
+// Parses the content of a tag object of the given hash.
+func Parse(hash string, content []byte) (*Tag, error) {
+	t := Tag{Hash: hash}
+	headers, message, ok := bytes.Cut(content, []byte("\n\n"))
+	if !ok {
+		if !bytes.HasSuffix(content, []byte("\n")) {
+			return nil, fmt.Errorf("tag %s is truncated", hash)
+		}
+		headers = content[:len(content)-1]
+	}
+	t.Message = string(message)
+
+	expected := []string{"object", "type", "tag"}
+	for i, line := range strings.Split(string(headers), "\n") {
+		key, value, ok := strings.Cut(line, " ")
+		if !ok {
+			return nil, fmt.Errorf("tag %s: malformed header %q", hash, line)
+		}
+		if i < len(expected) && key != expected[i] {
+			return nil, fmt.Errorf("tag %s: expected %s line, got %q", hash, expected[i], line)
+		}
+		switch key {
+		case "object":
+			t.Object = value
+		case "type":
+			t.Type = value
+		case "tag":
+			t.Name = value
+		case "tagger":
+			tagger, err := commit.ParseSignature(value)
+			if err != nil {
+				return nil, fmt.Errorf("tag %s: %w", hash, err)
+			}
+			t.Tagger = tagger
+		}
+	}
+	if t.Name == "" {
+		return nil, fmt.Errorf("tag %s: missing object, type or tag line", hash)
+	}
+	switch t.Type {
+	case object.TypeBlob, object.TypeTree, object.TypeCommit, object.TypeTag:
+	default:
+		return nil, fmt.Errorf("tag %s: invalid type %q", hash, t.Type)
+	}
+	return &t, nil
+}
+
+// Reads the tag object of the given hash.
+func ParseTag(store object.ObjectStore, hash string) (*Tag, error) {
+	objType, content, err := store.Get(hash)
+	if err != nil {
+		return nil, err
+	}
+	if objType != object.TypeTag {
+		return nil, fmt.Errorf("object %s is a %s, not a tag", hash, objType)
+	}
+	return Parse(hash, content)
+}
+
+// Follows tag objects starting at hash and returns the first object that
+// isn't a tag and its type.
+func Peel(store object.ObjectStore, hash string) (string, string, error) {
+	for range maxPeelDepth {
+		objType, _, err := store.Stat(hash)
+		if err != nil {
+			return "", "", err
+		}
+		if objType != object.TypeTag {
+			return hash, objType, nil
+		}
+		t, err := ParseTag(store, hash)
+		if err != nil {
+			return "", "", err
+		}
+		hash = t.Object
+	}
+	return "", "", fmt.Errorf("too many levels of tags at %s", hash)
+}
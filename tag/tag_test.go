@@ -0,0 +1,78 @@
+package tag_test
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/f1-surya/git-go/commit"
+	"github.com/f1-surya/git-go/object"
+	"github.com/f1-surya/git-go/tag"
+)
+
+func TestFormatRoundTrip(t *testing.T) {
+	original := tag.Tag{
+		Object: "3b18e512dba79e4c8300dd08aeb37f8e728b8dad",
+		Type:   object.TypeCommit,
+		Name:   "v1.0",
+		Tagger: commit.Signature{
+			Name:  "Jane Doe",
+			Email: "jane@example.com",
+			When:  time.Unix(1700000000, 0).In(time.FixedZone("", 2*3600)),
+		},
+		Message: "Release 1.0\n\nWith notes.\n",
+	}
+	content := original.ToBytes()
+	want := "object 3b18e512dba79e4c8300dd08aeb37f8e728b8dad\ntype commit\ntag v1.0\n" +
+		"tagger Jane Doe <jane@example.com> 1700000000 +0200\n\nRelease 1.0\n\nWith notes.\n"
+	if string(content) != want {
+		t.Fatalf("ToBytes() = %q, want %q", content, want)
+	}
+
+	parsed, err := tag.Parse("hash", content)
+	if err != nil {
+		t.Fatalf("Parse errored: %v", err)
+	}
+	original.Hash = "hash"
+	if !parsed.Tagger.When.Equal(original.Tagger.When) {
+		t.Fatalf("Tagger date = %v", parsed.Tagger.When)
+	}
+	parsed.Tagger.When, original.Tagger.When = time.Time{}, time.Time{}
+	if !reflect.DeepEqual(*parsed, original) {
+		t.Fatalf("Parse() = %+v, want %+v", *parsed, original)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, content := range []string{
+		"type commit\nobject abc\ntag v1\n\nmsg",
+		"object abc\ntype commit\n\nmsg",
+		"object abc\ntype thing\ntag v1\n\nmsg",
+		"object abc\ntype commit\ntag v1\ntagger broken\n\nmsg",
+		"object abc\ntype commit\ntag v1",
+	} {
+		if _, err := tag.Parse("hash", []byte(content)); err == nil {
+			t.Errorf("Parse(%q) should fail", content)
+		}
+	}
+}
+
+func TestPeel(t *testing.T) {
+	store := object.NewMemoryStore()
+	blob, _ := store.Put(object.TypeBlob, []byte("content"))
+	inner := tag.Tag{Object: blob, Type: object.TypeBlob, Name: "inner", Message: "inner\n"}
+	innerHash, _ := store.Put(object.TypeTag, inner.ToBytes())
+	outer := tag.Tag{Object: innerHash, Type: object.TypeTag, Name: "outer", Message: "outer\n"}
+	outerHash, _ := store.Put(object.TypeTag, outer.ToBytes())
+
+	hash, objType, err := tag.Peel(store, outerHash)
+	if err != nil || hash != blob || objType != object.TypeBlob {
+		t.Fatalf("Peel() = %s, %s, %v", hash, objType, err)
+	}
+	if hash, _, err := tag.Peel(store, blob); err != nil || hash != blob {
+		t.Fatalf("Peel of a blob = %s, %v", hash, err)
+	}
+	if _, err := tag.ParseTag(store, blob); err == nil {
+		t.Fatalf("ParseTag of a blob didn't error")
+	}
+}
@@ -0,0 +1,383 @@
+package tree
+
+import (
+	"bytes"
+	"encoding/hex"
+	"path/filepath"
+	"sort"
+
+	"github.com/f1-surya/git-go/object"
+)
+
+type ChangeType int
+
+const (
+	Added ChangeType = iota
+	Deleted
+	Modified
+	// Only the mode of the file changed, not its content.
+	ModeChanged
+	Renamed
+	Copied
+)
+
+func (t ChangeType) String() string {
+	switch t {
+	case Added:
+		return "added"
+	case Deleted:
+		return "deleted"
+	case Modified:
+		return "modified"
+	case ModeChanged:
+		return "mode changed"
+	case Renamed:
+		return "renamed"
+	case Copied:
+		return "copied"
+	}
+	return "unknown"
+}
+
+// Returns the letter of the change in git's --name-status output.
+func (t ChangeType) Letter() byte {
+	return "ADMMRC"[t]
+}
+
+// A file that differs between two trees.
+type Change struct {
+	Type ChangeType
+	// The path in the old tree, "" for added files.
+	OldPath string
+	// The path in the new tree, "" for deleted files.
+	NewPath string
+	// The entries on both sides, the zero entry on a side without the file.
+	Old, New TreeEntry
+	// How similar the content of a renamed or copied file is, in percent.
+	Similarity int
+}
+
+// Returns the path of the file in the new tree, or in the old one if it was
+// deleted.
+func (c Change) Path() string {
+	if c.NewPath != "" {
+		return c.NewPath
+	}
+	return c.OldPath
+}
+
+type DiffOptions struct {
+	// Pairs deleted files with similar added files as renames.
+	Renames bool
+	// Also pairs added files with similar modified or deleted files as
+	// copies. Implies Renames.
+	Copies bool
+	// The similarity a rename or copy needs, in percent, 50 if 0.
+	Threshold int
+	// Only exact renames are looked for when there are more than this many
+	// added files or sources, 1000 if 0.
+	RenameLimit int
+}
+
+const (
+	defaultThreshold   = 50
+	defaultRenameLimit = 1000
+)
+
+// Returns the files that differ between the trees of the given hashes, sorted
+// by path. "" is the empty tree. Subtrees with the same hash on both sides
+// aren't read.
+func Diff(store object.ObjectStore, a, b string, opts DiffOptions) ([]Change, error) {
+	var changes []Change
+	if err := diffTrees(store, ".", a, b, &changes); err != nil {
+		return nil, err
+	}
+	return detectRenames(store, changes, opts)
+}
+
+// Returns the files that differ between the flat lists of entries, keyed by
+// path, sorted by path. The store is only read to detect renames.
+func DiffEntries(store object.ObjectStore, a, b map[string]TreeEntry, opts DiffOptions) ([]Change, error) {
+	var changes []Change
+	for path, old := range a {
+		if new, ok := b[path]; ok {
+			if change, changed := compareEntries(path, old, new); changed {
+				changes = append(changes, change)
+			}
+		} else {
+			changes = append(changes, Change{Type: Deleted, OldPath: path, Old: old})
+		}
+	}
+	for path, new := range b {
+		if _, ok := a[path]; !ok {
+			changes = append(changes, Change{Type: Added, NewPath: path, New: new})
+		}
+	}
+	return detectRenames(store, changes, opts)
+}
+
+func compareEntries(path string, old, new TreeEntry) (Change, bool) {
+	change := Change{OldPath: path, NewPath: path, Old: old, New: new}
+	switch {
+	case !bytes.Equal(old.Hash, new.Hash):
+		change.Type = Modified
+	case old.Mode != new.Mode:
+		change.Type = ModeChanged
+	default:
+		return change, false
+	}
+	return change, true
+}
+
+// Returns the children of the tree keyed by name, none for "".
+func readChildren(store object.ObjectStore, hash string) (map[string]TreeEntry, error) {
+	children := make(map[string]TreeEntry)
+	if hash == "" {
+		return children, nil
+	}
+	t, err := ParseTreeObject(store, hash)
+	if err != nil {
+		return nil, err
+	}
+	for _, child := range t.Children {
+		children[child.Name] = child
+	}
+	return children, nil
+}
+
+// Appends the changes between the trees a and b at dir to changes.
+func diffTrees(store object.ObjectStore, dir, a, b string, changes *[]Change) error {
+	if a == b {
+		return nil
+	}
+	oldChildren, err := readChildren(store, a)
+	if err != nil {
+		return err
+	}
+	newChildren, err := readChildren(store, b)
+	if err != nil {
+		return err
+	}
+	names := make([]string, 0, len(oldChildren)+len(newChildren))
+	for name := range oldChildren {
+		names = append(names, name)
+	}
+	for name := range newChildren {
+		if _, ok := oldChildren[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		path := filepath.Join(dir, name)
+		old, inOld := oldChildren[name]
+		new, inNew := newChildren[name]
+		oldTree, newTree := inOld && old.Type == "tree", inNew && new.Type == "tree"
+
+		// A subtree on one side is diffed against the empty tree, so a file
+		// replaced by a directory is deleted and its files added.
+		var oldHash, newHash string
+		if oldTree {
+			oldHash = hex.EncodeToString(old.Hash)
+		}
+		if newTree {
+			newHash = hex.EncodeToString(new.Hash)
+		}
+		if oldTree || newTree {
+			if err := diffTrees(store, path, oldHash, newHash, changes); err != nil {
+				return err
+			}
+		}
+
+		oldBlob, newBlob := inOld && !oldTree, inNew && !newTree
+		switch {
+		case oldBlob && newBlob:
+			if change, changed := compareEntries(path, old, new); changed {
+				*changes = append(*changes, change)
+			}
+		case oldBlob:
+			*changes = append(*changes, Change{Type: Deleted, OldPath: path, Old: old})
+		case newBlob:
+			*changes = append(*changes, Change{Type: Added, NewPath: path, New: new})
+		}
+	}
+	return nil
+}
+
+// A possible rename or copy.
+type pairing struct {
+	source, dest int
+	score        int
+}
+
+// Turns pairs of deleted and added files with similar content into renames,
+// and with Copies, added files similar to a modified or deleted file into
+// copies. Returns the changes sorted by path.
+func detectRenames(store object.ObjectStore, changes []Change, opts DiffOptions) ([]Change, error) {
+	if opts.Renames || opts.Copies {
+		var err error
+		if changes, err = pairRenames(store, changes, opts); err != nil {
+			return nil, err
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i].Path() < changes[j].Path()
+	})
+	return changes, nil
+}
+
+func pairRenames(store object.ObjectStore, changes []Change, opts DiffOptions) ([]Change, error) {
+	threshold := opts.Threshold
+	if threshold <= 0 {
+		threshold = defaultThreshold
+	}
+	limit := opts.RenameLimit
+	if limit <= 0 {
+		limit = defaultRenameLimit
+	}
+
+	var sources, dests []int
+	for i, change := range changes {
+		switch {
+		case change.Type == Added:
+			dests = append(dests, i)
+		case change.Type == Deleted:
+			sources = append(sources, i)
+		case opts.Copies && change.Type == Modified:
+			sources = append(sources, i)
+		}
+	}
+	if len(sources) == 0 || len(dests) == 0 {
+		return changes, nil
+	}
+	exactOnly := len(sources) > limit || len(dests) > limit
+
+	contents := make(map[string][]byte)
+	content := func(hash []byte) ([]byte, error) {
+		key := hex.EncodeToString(hash)
+		if data, ok := contents[key]; ok {
+			return data, nil
+		}
+		_, data, err := store.Get(key)
+		if err != nil {
+			return nil, err
+		}
+		contents[key] = data
+		return data, nil
+	}
+
+	var pairings []pairing
+	for _, d := range dests {
+		dest := changes[d].New
+		for _, s := range sources {
+			source := changes[s].Old
+			if bytes.Equal(source.Hash, dest.Hash) {
+				pairings = append(pairings, pairing{s, d, 100})
+				continue
+			}
+			if exactOnly || !isFile(source.Mode) || !isFile(dest.Mode) {
+				continue
+			}
+			a, err := content(source.Hash)
+			if err != nil {
+				return nil, err
+			}
+			b, err := content(dest.Hash)
+			if err != nil {
+				return nil, err
+			}
+			// Files too different in size can't be similar enough.
+			if min(len(a), len(b))*100 < threshold*max(len(a), len(b)) {
+				continue
+			}
+			if score := Similarity(a, b); score >= threshold {
+				pairings = append(pairings, pairing{s, d, score})
+			}
+		}
+	}
+	// The best matches win, ties go to the first paths.
+	sort.SliceStable(pairings, func(i, j int) bool {
+		if pairings[i].score != pairings[j].score {
+			return pairings[i].score > pairings[j].score
+		}
+		if pairings[i].dest != pairings[j].dest {
+			return changes[pairings[i].dest].NewPath < changes[pairings[j].dest].NewPath
+		}
+		return changes[pairings[i].source].OldPath < changes[pairings[j].source].OldPath
+	})
+
+	paired := make(map[int]bool)
+	removed := make(map[int]bool)
+	for _, p := range pairings {
+		if paired[p.dest] {
+			continue
+		}
+		source := changes[p.source]
+		change := Change{
+			OldPath:    source.OldPath,
+			NewPath:    changes[p.dest].NewPath,
+			Old:        source.Old,
+			New:        changes[p.dest].New,
+			Similarity: p.score,
+		}
+		// A deleted file is renamed once, later matches are copies of it.
+		if source.Type == Deleted && !removed[p.source] {
+			change.Type = Renamed
+			removed[p.source] = true
+		} else if opts.Copies {
+			change.Type = Copied
+		} else {
+			continue
+		}
+		changes[p.dest] = change
+		paired[p.dest] = true
+	}
+
+	kept := changes[:0]
+	for i, change := range changes {
+		if !removed[i] {
+			kept = append(kept, change)
+		}
+	}
+	return kept, nil
+}
+
+// Returns how similar the contents are, in percent: the bytes of the lines
+// they have in common, relative to the size of the larger one.
+func Similarity(a, b []byte) int {
+	larger := max(len(a), len(b))
+	if larger == 0 {
+		return 100
+	}
+	lines := make(map[string]int)
+	for _, line := range splitLines(a) {
+		lines[string(line)] += len(line)
+	}
+	common := 0
+	for _, line := range splitLines(b) {
+		if left := lines[string(line)]; left > 0 {
+			n := min(left, len(line))
+			common += n
+			lines[string(line)] -= n
+		}
+	}
+	return common * 100 / larger
+}
+
+func isFile(mode uint32) bool {
+	return mode == object.ModeRegular || mode == object.ModeExecutable
+}
+
+func splitLines(content []byte) [][]byte {
+	var lines [][]byte
+	for len(content) > 0 {
+		end := bytes.IndexByte(content, '\n') + 1
+		if end == 0 {
+			end = len(content)
+		}
+		lines = append(lines, content[:end])
+		content = content[end:]
+	}
+	return lines
+}
@@ -8,6 +8,8 @@ import (
 	"fmt"
 	"io"
 	"path/filepath"
+	"sort"
+	"strconv"
 	"strings"
 	"sync"
 
@@ -26,7 +28,8 @@ type Tree struct {
 	Children []TreeEntry
 }
 
-func (t *Tree) GetBlob() []byte {
+// Returns the content of the tree object, without the header.
+func (t *Tree) Content() []byte {
 	var buffer bytes.Buffer
 
 	for _, entry := range t.Children {
@@ -34,25 +37,20 @@ func (t *Tree) GetBlob() []byte {
 		buffer.Write(entry.Hash)
 	}
 
-	content := buffer.Bytes()
-	var result bytes.Buffer
-	fmt.Fprintf(&result, "tree %d\x00", len(content))
-	result.Write(content)
+	return buffer.Bytes()
+}
 
-	return result.Bytes()
+func (t *Tree) GetBlob() []byte {
+	return object.Encode(object.TypeTree, t.Content())
 }
 
 func (t *Tree) Hash() [20]byte {
 	return sha1.Sum(t.GetBlob())
 }
 
-// Creates the necessary trees for all the tracked files.
-func CreateRoot() (map[string]*Tree, error) {
-	entries, err := index.ReadIndex()
-	if err != nil {
-		return nil, err
-	}
-
+// Creates the necessary trees for all the given index entries, keyed by
+// their path relative to the root, which is ".".
+func CreateRoot(entries []index.IndexEntry) (map[string]*Tree, error) {
 	trees := make(map[string]*Tree)
 	trees["."] = &Tree{}
 
@@ -62,7 +60,7 @@ func CreateRoot() (map[string]*Tree, error) {
 		currentPath := "."
 
 		for i := range len(parts) - 1 {
-			currentPath = parts[i]
+			currentPath = filepath.Join(currentPath, parts[i])
 			subTree, ok := trees[currentPath]
 			if !ok {
 				subTree = &Tree{}
@@ -86,17 +84,23 @@ func CreateRoot() (map[string]*Tree, error) {
 		})
 	}
 
-	for path, tree := range trees {
+	// The hash of a tree depends on its subtrees, so the deepest trees go first.
+	paths := make([]string, 0, len(trees))
+	for path := range trees {
 		if path != "." {
-			hash := tree.Hash()
-			parentPath := filepath.Dir(path)
-			parentTree := trees[parentPath]
-
-			for i, entry := range parentTree.Children {
-				if entry.Name == filepath.Base(path) {
-					parentTree.Children[i].Hash = hash[:]
-					break
-				}
+			paths = append(paths, path)
+		}
+	}
+	sort.Slice(paths, func(i, j int) bool {
+		return strings.Count(paths[i], string(filepath.Separator)) > strings.Count(paths[j], string(filepath.Separator))
+	})
+	for _, path := range paths {
+		hash := trees[path].Hash()
+		parentTree := trees[filepath.Dir(path)]
+		for i, entry := range parentTree.Children {
+			if entry.Type == "tree" && entry.Name == filepath.Base(path) {
+				parentTree.Children[i].Hash = hash[:]
+				break
 			}
 		}
 	}
@@ -104,9 +108,9 @@ func CreateRoot() (map[string]*Tree, error) {
 	return trees, nil
 }
 
-// Creates the trees for all the tracked files and writes them to the ObjectDB
-func WriteTrees() (string, error) {
-	trees, err := CreateRoot()
+// Creates the trees for all the given index entries and writes them to the ObjectDB
+func WriteTrees(store object.ObjectStore, entries []index.IndexEntry) (string, error) {
+	trees, err := CreateRoot(entries)
 	if err != nil {
 		return "", err
 	}
@@ -114,13 +118,10 @@ func WriteTrees() (string, error) {
 	rootHash := trees["."].Hash()
 	for _, tree := range trees {
 		treeHash := tree.Hash()
-		treeHashString := hex.EncodeToString(treeHash[:])
-		exists := object.ObjectExist(treeHashString)
-		if exists {
+		if store.Has(hex.EncodeToString(treeHash[:])) {
 			continue
 		}
-		err = object.WriteObject(tree.GetBlob(), treeHashString)
-		if err != nil {
+		if _, err = store.Put(object.TypeTree, tree.Content()); err != nil {
 			return "", err
 		}
 	}
@@ -129,41 +130,47 @@ func WriteTrees() (string, error) {
 }
 
 // Parses the object of the given hash and returns all the children of the tree.
-func ParseTreeObject(hash string) (Tree, error) {
-	var root Tree
-
-	treeObject, err := object.ReadObject(hash)
+func ParseTreeObject(store object.ObjectStore, hash string) (Tree, error) {
+	objType, content, err := store.Get(hash)
 	if err != nil {
-		return root, err
+		return Tree{}, err
 	}
-	headerEnd := bytes.IndexByte(treeObject, '\000')
-	if headerEnd == -1 {
-		return root, errors.New("header end not found")
+	if objType != object.TypeTree {
+		return Tree{}, fmt.Errorf("object %s is a %s, not a tree", hash, objType)
 	}
-	buff := bytes.NewBuffer(treeObject[headerEnd+1:])
+	return ParseTree(content)
+}
+
+// Parses the content of a tree object (without the header) into its entries.
+func ParseTree(content []byte) (Tree, error) {
+	var root Tree
+	buff := bytes.NewBuffer(content)
 
 	for buff.Len() > 0 {
 		mode, err := buff.ReadBytes(' ')
 		if err != nil {
-			if err == io.EOF {
-				break
-			}
-			return root, err
+			return root, fmt.Errorf("missing space after entry mode: %w", err)
 		}
 		modeStr := string(mode[:len(mode)-1])
-		var modeInt uint32
-		fmt.Sscanf(modeStr, "%o", &modeInt)
+		modeValue, err := strconv.ParseUint(modeStr, 8, 32)
+		if err != nil {
+			return root, fmt.Errorf("invalid entry mode %q", modeStr)
+		}
+		modeInt := uint32(modeValue)
 
 		pathEnd, err := buff.ReadBytes('\000')
 		if err != nil {
 			return root, fmt.Errorf("missing null terminator after file path: %w", err)
 		}
 		path := string(pathEnd[:len(pathEnd)-1])
+		if path == "" || path == "." || path == ".." || strings.Contains(path, "/") {
+			return root, fmt.Errorf("invalid entry name %q", path)
+		}
 
 		hash := make([]byte, 20)
-		n, err := buff.Read(hash)
+		n, err := io.ReadFull(buff, hash)
 		if err != nil || n != 20 {
-			return root, fmt.Errorf("incomplete hash: %w", err)
+			return root, fmt.Errorf("incomplete hash for %s: %w", path, err)
 		}
 
 		entryType := "blob"
@@ -182,72 +189,53 @@ func ParseTreeObject(hash string) (Tree, error) {
 	return root, nil
 }
 
-// Gets the tree for the given hash and all of its subtrees recursively
-func GetTreesRecursive(tree string) (map[string]Tree, error) {
+// Gets the tree for the given hash and all of its subtrees recursively, keyed
+// by their path relative to the root, which is ".".
+func GetTreesRecursive(store object.ObjectStore, tree string) (map[string]Tree, error) {
 	trees := make(map[string]Tree)
-	var entries []TreeEntry
-	var wg sync.WaitGroup
 	var mu sync.Mutex
-	errs := make(chan error)
 
-	root, err := ParseTreeObject(tree)
-	if err != nil {
-		return trees, err
-	}
-	entries = append(entries, root.Children...)
-
-	for i := range entries {
-		currEntry := entries[i]
-		if currEntry.Type == "tree" {
+	var readTree func(path, hash string) error
+	readTree = func(path, hash string) error {
+		t, err := ParseTreeObject(store, hash)
+		if err != nil {
+			return err
+		}
+		mu.Lock()
+		trees[path] = t
+		mu.Unlock()
+
+		// Sibling subtrees are read in parallel.
+		var wg sync.WaitGroup
+		errs := make([]error, len(t.Children))
+		for i, child := range t.Children {
+			if child.Type != "tree" {
+				continue
+			}
 			wg.Add(1)
 			go func() {
 				defer wg.Done()
-				tree, err := ParseTreeObject(hex.EncodeToString(currEntry.Hash))
-				if err != nil {
-					errs <- err
-				}
-				mu.Lock()
-				trees[currEntry.Name] = tree
-				entries = append(entries, tree.Children...)
-				mu.Unlock()
+				errs[i] = readTree(filepath.Join(path, child.Name), hex.EncodeToString(child.Hash))
 			}()
 		}
-	}
-
-	go func() {
 		wg.Wait()
-		close(errs)
-	}()
-
-	for err := range errs {
-		return trees, err
+		return errors.Join(errs...)
 	}
-	trees["."] = root
 
-	return trees, nil
+	err := readTree(".", tree)
+	return trees, err
 }
 
+// Returns the hash of the blob at the given path, "" if there is none.
 func GetFileHash(trees map[string]Tree, file string) string {
-	currentTree, exists := trees["."]
-	if !exists {
+	dir, name := filepath.Split(filepath.Clean(file))
+	parent, ok := trees[filepath.Clean(dir)]
+	if !ok {
 		return ""
 	}
-
-	parts := strings.Split(file, string(filepath.Separator))
-
-	for _, part := range parts {
-		for _, child := range currentTree.Children {
-			if child.Type == "blob" && child.Name == part {
-				return hex.EncodeToString(child.Hash)
-			} else if child.Name == part {
-				nextTree, ok := trees[child.Name]
-				if ok {
-					currentTree = nextTree
-					break
-				} else {
-					return ""
-				}
-			}
+	for _, child := range parent.Children {
+		if child.Type == "blob" && child.Name == name {
+			return hex.EncodeToString(child.Hash)
 		}
 	}
 	return ""
@@ -257,6 +245,15 @@ func GetFileHash(trees map[string]Tree, file string) string {
 // tree with the file's path as key and its hash as value
 func GetAllFiles(trees map[string]Tree) map[string]string {
 	files := make(map[string]string)
+	for path, entry := range GetAllEntries(trees) {
+		files[path] = hex.EncodeToString(entry.Hash)
+	}
+	return files
+}
+
+// Returns the entry of every file in the trees, keyed by the file's path.
+func GetAllEntries(trees map[string]Tree) map[string]TreeEntry {
+	files := make(map[string]TreeEntry)
 
 	var walkTrees func(string, Tree)
 	walkTrees = func(prefix string, tree Tree) {
@@ -264,9 +261,9 @@ func GetAllFiles(trees map[string]Tree) map[string]string {
 			path := filepath.Join(prefix, child.Name)
 			switch child.Type {
 			case "blob":
-				files[path] = hex.EncodeToString(child.Hash)
+				files[path] = child
 			case "tree":
-				subTree, ok := trees[child.Name]
+				subTree, ok := trees[path]
 				if ok {
 					walkTrees(path, subTree)
 				}
@@ -276,7 +273,7 @@ func GetAllFiles(trees map[string]Tree) map[string]string {
 
 	root, ok := trees["."]
 	if ok {
-		walkTrees("", root)
+		walkTrees(".", root)
 	}
 
 	return files
@@ -1,20 +1,36 @@
 package tree_test
 
 import (
+	"encoding/hex"
+	"fmt"
 	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
 	"testing"
 
 	"github.com/f1-surya/git-go/commands"
 	"github.com/f1-surya/git-go/commit"
+	"github.com/f1-surya/git-go/index"
+	"github.com/f1-surya/git-go/object"
 	"github.com/f1-surya/git-go/tree"
 )
 
+func initRepo(t *testing.T) *commands.Repository {
+	t.Helper()
+	repo, err := commands.Init(".", commands.InitOptions{})
+	if err != nil {
+		t.Fatalf("Init errored: %v", err)
+	}
+	return repo
+}
+
 func TestGetTreesRecursive(t *testing.T) {
 	t.Cleanup(func() {
 		os.RemoveAll(".git-go")
 		os.RemoveAll("test")
 	})
-	commands.Init()
+	repo := initRepo(t)
 
 	err := os.Mkdir("test", 0755)
 	if err != nil {
@@ -27,21 +43,21 @@ func TestGetTreesRecursive(t *testing.T) {
 	}
 	defer file.Close()
 
-	err = commands.Add([]string{"tree.go", "test/test.txt"})
+	err = repo.Add([]string{"tree.go", "test/test.txt"})
 	if err != nil {
 		t.Fatalf("Add errored: %v", err)
 	}
 
-	err = commands.Commit([]string{"-m", "Init"})
+	err = repo.Commit([]string{"-m", "Init"})
 	if err != nil {
 		t.Fatalf("Commit errored: %v", err)
 	}
-	latestCommit, err := commit.GetLatest()
+	latestCommit, err := commit.GetLatest(repo.Store, repo.GitDir)
 	if err != nil {
 		t.Fatalf("Failed to fetch latest commit: %v", err)
 	}
 
-	trees, err := tree.GetTreesRecursive(latestCommit.Tree)
+	trees, err := tree.GetTreesRecursive(repo.Store, latestCommit.Tree)
 	if err != nil {
 		t.Fatalf("Failed to pares root: %v", err)
 	}
@@ -58,7 +74,7 @@ func TestGetFileHash(t *testing.T) {
 		os.RemoveAll(".git-go")
 		os.RemoveAll("test")
 	})
-	commands.Init()
+	repo := initRepo(t)
 
 	err := os.Mkdir("test", 0755)
 	if err != nil {
@@ -71,21 +87,21 @@ func TestGetFileHash(t *testing.T) {
 	}
 	defer file.Close()
 
-	err = commands.Add([]string{"tree.go", "test/test.txt"})
+	err = repo.Add([]string{"tree.go", "test/test.txt"})
 	if err != nil {
 		t.Fatalf("Add errored: %v", err)
 	}
 
-	err = commands.Commit([]string{"-m", "Init"})
+	err = repo.Commit([]string{"-m", "Init"})
 	if err != nil {
 		t.Fatalf("Commit errored: %v", err)
 	}
-	latestCommit, err := commit.GetLatest()
+	latestCommit, err := commit.GetLatest(repo.Store, repo.GitDir)
 	if err != nil {
 		t.Fatalf("Failed to fetch latest commit: %v", err)
 	}
 
-	trees, err := tree.GetTreesRecursive(latestCommit.Tree)
+	trees, err := tree.GetTreesRecursive(repo.Store, latestCommit.Tree)
 	if err != nil {
 		t.Fatalf("Failed to pares root: %v", err)
 	}
@@ -106,3 +122,147 @@ func TestGetFileHash(t *testing.T) {
 		})
 	}
 }
+
+func TestNestedTrees(t *testing.T) {
+	store := object.NewMemoryStore()
+	files := map[string]string{
+		"a/x/deep/f.txt": "f",
+		"b/x/g.txt":      "g",
+		"x/h.txt":        "h",
+		"top.txt":        "top",
+	}
+	var entries []index.IndexEntry
+	for path, content := range files {
+		hash, err := store.Put(object.TypeBlob, []byte(content))
+		if err != nil {
+			t.Fatal(err)
+		}
+		entry := index.IndexEntry{Path: filepath.FromSlash(path), Mode: object.ModeRegular}
+		hex.Decode(entry.Hash[:], []byte(hash))
+		entries = append(entries, entry)
+	}
+	sort.Sort(index.ByPath(entries))
+
+	root, err := tree.WriteTrees(store, entries)
+	if err != nil {
+		t.Fatalf("WriteTrees errored: %v", err)
+	}
+	trees, err := tree.GetTreesRecursive(store, root)
+	if err != nil {
+		t.Fatalf("GetTreesRecursive errored: %v", err)
+	}
+	got := make(map[string]string)
+	for path, hash := range tree.GetAllFiles(trees) {
+		_, content, err := store.Get(hash)
+		if err != nil {
+			t.Fatalf("Blob of %s is missing: %v", path, err)
+		}
+		got[filepath.ToSlash(path)] = string(content)
+	}
+	if !reflect.DeepEqual(got, files) {
+		t.Fatalf("Files after a round trip = %v", got)
+	}
+	if hash := tree.GetFileHash(trees, filepath.FromSlash("b/x/g.txt")); hash != object.Hash(object.TypeBlob, []byte("g")) {
+		t.Fatalf("GetFileHash = %q", hash)
+	}
+}
+
+func TestDiff(t *testing.T) {
+	store := object.NewMemoryStore()
+	body := "line one\nline two\nline three\nline four\nline five\nline six\n"
+	writeTree := func(files map[string]string) string {
+		t.Helper()
+		var entries []index.IndexEntry
+		for path, content := range files {
+			hash, err := store.Put(object.TypeBlob, []byte(content))
+			if err != nil {
+				t.Fatalf("Put errored: %v", err)
+			}
+			entry := index.IndexEntry{Path: path, Mode: object.ModeRegular}
+			if path == "run.sh" {
+				entry.Mode = object.ModeExecutable
+			}
+			hex.Decode(entry.Hash[:], []byte(hash))
+			entries = append(entries, entry)
+		}
+		sort.Sort(index.ByPath(entries))
+		hash, err := tree.WriteTrees(store, entries)
+		if err != nil {
+			t.Fatalf("WriteTrees errored: %v", err)
+		}
+		return hash
+	}
+	summary := func(changes []tree.Change) []string {
+		var lines []string
+		for _, c := range changes {
+			line := string(c.Type.Letter()) + " " + c.Path()
+			if c.Type == tree.Renamed || c.Type == tree.Copied {
+				line = fmt.Sprintf("%c%d %s -> %s", c.Type.Letter(), c.Similarity, c.OldPath, c.NewPath)
+			}
+			lines = append(lines, line)
+		}
+		return lines
+	}
+
+	old := writeTree(map[string]string{
+		"keep/a.txt":  "same\n",
+		"keep/b.txt":  "same too\n",
+		"doc.txt":     body,
+		"moved.txt":   "exact\n",
+		"edited.txt":  "before\n",
+		"dir":         "file becomes a directory\n",
+		"gone/x.txt":  "gone\n",
+		"run.sh.orig": "#!/bin/sh\n",
+	})
+	new := writeTree(map[string]string{
+		"keep/a.txt":      "same\n",
+		"keep/b.txt":      "same too\n",
+		"notes/doc.md":    body + "line seven\n",
+		"there/moved.txt": "exact\n",
+		"edited.txt":      "after\n",
+		"dir/inside.txt":  "new\n",
+		"run.sh":          "#!/bin/sh\n",
+	})
+
+	changes, err := tree.Diff(store, old, new, tree.DiffOptions{})
+	if err != nil {
+		t.Fatalf("Diff errored: %v", err)
+	}
+	want := []string{"D dir", "A dir/inside.txt", "D doc.txt", "M edited.txt", "D gone/x.txt", "D moved.txt", "A notes/doc.md", "A run.sh", "D run.sh.orig", "A there/moved.txt"}
+	if got := summary(changes); !reflect.DeepEqual(got, want) {
+		t.Fatalf("Diff = %q, want %q", got, want)
+	}
+
+	changes, err = tree.Diff(store, old, new, tree.DiffOptions{Renames: true})
+	if err != nil {
+		t.Fatalf("Diff with renames errored: %v", err)
+	}
+	want = []string{"D dir", "A dir/inside.txt", "M edited.txt", "D gone/x.txt", "R84 doc.txt -> notes/doc.md", "R100 run.sh.orig -> run.sh", "R100 moved.txt -> there/moved.txt"}
+	if got := summary(changes); !reflect.DeepEqual(got, want) {
+		t.Fatalf("Diff with renames = %q, want %q", got, want)
+	}
+	if changes[5].Old.Mode != object.ModeRegular || changes[5].New.Mode != object.ModeExecutable {
+		t.Fatalf("Rename lost the modes: %+v", changes[5])
+	}
+
+	// Copies come from modified files, or a deleted file after its rename.
+	copied := writeTree(map[string]string{"edited.txt": "after\n", "copy.txt": "before\n", "there.txt": "exact\n", "again.txt": "exact\n"})
+	changes, err = tree.Diff(store, writeTree(map[string]string{"edited.txt": "before\n", "moved.txt": "exact\n"}), copied, tree.DiffOptions{Copies: true})
+	if err != nil {
+		t.Fatalf("Diff with copies errored: %v", err)
+	}
+	want = []string{"R100 moved.txt -> again.txt", "C100 edited.txt -> copy.txt", "M edited.txt", "C100 moved.txt -> there.txt"}
+	if got := summary(changes); !reflect.DeepEqual(got, want) {
+		t.Fatalf("Diff with copies = %q, want %q", got, want)
+	}
+
+	if changes, err := tree.Diff(store, new, new, tree.DiffOptions{Renames: true}); err != nil || len(changes) != 0 {
+		t.Fatalf("Diff of the same tree = %v, %v", changes, err)
+	}
+	if changes, err := tree.Diff(store, "", old, tree.DiffOptions{}); err != nil || len(changes) != 8 {
+		t.Fatalf("Diff from the empty tree = %v, %v", changes, err)
+	}
+	if got := tree.Similarity([]byte("a\nb\nc\nd\n"), []byte("a\nb\nc\ne\n")); got != 75 {
+		t.Fatalf("Similarity = %d", got)
+	}
+}